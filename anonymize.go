@@ -0,0 +1,110 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/js-arias/earth"
+)
+
+// MovePixels moves the pixels of the range of a taxon,
+// using a function that returns the destination
+// of each pixel.
+// The function is called with the pixels
+// sorted by ID,
+// so a function that uses random numbers
+// produces the same results with the same seed.
+//
+// If several pixels are moved to the same pixel,
+// the density is the maximum density of the pixels,
+// the record counts are added,
+// and the values of the extra columns
+// of the pixel with the smallest ID are kept.
+// It returns false if the taxon is not in the collection.
+func (c *Collection) MovePixels(name string, move func(px int) int) bool {
+	name = canon(name)
+	if name == "" {
+		return false
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return false
+	}
+
+	pixels := make([]int, 0, len(tax.rng))
+	for px := range tax.rng {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	rng := make(map[int]float64, len(tax.rng))
+	var recs map[int]int
+	if tax.recs != nil {
+		recs = make(map[int]int, len(tax.recs))
+	}
+	var extra map[int][]string
+	if tax.extra != nil {
+		extra = make(map[int][]string, len(tax.extra))
+	}
+	for _, px := range pixels {
+		to := move(px)
+		if to < 0 || to >= c.pix.Len() {
+			to = px
+		}
+		if v := tax.rng[px]; v > rng[to] {
+			rng[to] = v
+		}
+		if n, ok := tax.recs[px]; ok {
+			recs[to] += n
+		}
+		if vals, ok := tax.extra[px]; ok {
+			if _, ok := extra[to]; !ok {
+				extra[to] = vals
+			}
+		}
+	}
+	tax.rng = rng
+	tax.recs = recs
+	tax.extra = extra
+	c.resetIndex()
+	return true
+}
+
+// CoarsePixel returns the pixel
+// that is at the center of the pixel
+// of a coarser pixelation
+// that contains a pixel.
+// Moving all the pixels of a range
+// to their coarse pixels
+// reduces the precision of the range
+// to the resolution of the coarse pixelation,
+// keeping the pixelation of the range.
+func CoarsePixel(pix, coarse *earth.Pixelation, px int) int {
+	pt := pix.ID(px).Point()
+	cp := coarse.Pixel(pt.Latitude(), pt.Longitude()).Point()
+	return pix.Pixel(cp.Latitude(), cp.Longitude()).ID()
+}
+
+// JitterPixel returns a random pixel
+// at a distance less or equal than radius
+// (in km)
+// from a pixel.
+// The points are taken uniformly
+// from the disc defined by the radius.
+func JitterPixel(pix *earth.Pixelation, px int, radius float64, rnd *rand.Rand) int {
+	if radius <= 0 {
+		return px
+	}
+	// angular distance in radians
+	angle := radius / (float64(earth.Radius) / 1000)
+	dist := angle * math.Sqrt(rnd.Float64())
+	bearing := 2 * math.Pi * rnd.Float64()
+
+	pt := earth.Destination(pix.ID(px).Point(), dist, bearing)
+	return pix.Pixel(pt.Latitude(), pt.Longitude()).ID()
+}
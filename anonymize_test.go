@@ -0,0 +1,85 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"maps"
+	"math/rand"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestMovePixels(t *testing.T) {
+	coll := makeCollection(t)
+	nm := "Rhododendron ericoides"
+	pix := coll.Pixelation()
+
+	var recs int
+	for _, n := range coll.Records(nm) {
+		recs += n
+	}
+
+	coarse := earth.NewPixelation(10)
+	if !coll.MovePixels(nm, func(px int) int {
+		return ranges.CoarsePixel(pix, coarse, px)
+	}) {
+		t.Fatalf("move pixels: taxon %q not found", nm)
+	}
+	rng := coll.Range(nm)
+	if len(rng) != 1 {
+		t.Errorf("coarse pixels: got %d pixels, want %d", len(rng), 1)
+	}
+	var got int
+	for px, n := range coll.Records(nm) {
+		if _, ok := rng[px]; !ok {
+			t.Errorf("coarse pixels: records at pixel %d outside range", px)
+		}
+		got += n
+	}
+	if got != recs {
+		t.Errorf("coarse pixels: got %d records, want %d", got, recs)
+	}
+
+	if coll.MovePixels("unknown taxon", func(px int) int { return px }) {
+		t.Errorf("move pixels: unknown taxon moved")
+	}
+}
+
+func TestJitterPixel(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	px := pix.Pixel(10, 10).ID()
+	radius := 200.0
+
+	jitter := func(seed int64) map[int]float64 {
+		rnd := rand.New(rand.NewSource(seed))
+		m := make(map[int]float64)
+		for i := 0; i < 100; i++ {
+			m[ranges.JitterPixel(pix, px, radius, rnd)] = 1
+		}
+		return m
+	}
+
+	a := jitter(1)
+	if len(a) < 2 {
+		t.Errorf("jitter: got %d pixels, want more than one", len(a))
+	}
+	// maximum distance in radians,
+	// including the size of a pixel
+	max := radius/(float64(earth.Radius)/1000) + earth.ToRad(pix.Step())
+	for id := range a {
+		if d := earth.Distance(pix.ID(px).Point(), pix.ID(id).Point()); d > max {
+			t.Errorf("jitter: pixel %d at distance %.6f, want <= %.6f", id, d, max)
+		}
+	}
+	if b := jitter(1); !maps.Equal(a, b) {
+		t.Errorf("jitter: different pixels with the same seed")
+	}
+
+	if got := ranges.JitterPixel(pix, px, 0, rand.New(rand.NewSource(1))); got != px {
+		t.Errorf("jitter: got pixel %d with radius 0, want %d", got, px)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+
+	"github.com/js-arias/earth"
+)
+
+// PixelArea returns the area of a pixel
+// (in km²)
+// in the given pixelation.
+//
+// As the pixelation is an isolatitude pixelation,
+// the area of a pixel is the area of its ring
+// divided by the number of pixels in the ring.
+func PixelArea(pix *earth.Pixelation, id int) float64 {
+	ring := pix.ID(id).Ring()
+	lat := pix.RingLat(ring)
+	top := math.Min(90, lat+pix.Step()/2)
+	bottom := math.Max(-90, lat-pix.Step()/2)
+
+	r := float64(earth.Radius) / 1000
+	ringArea := 2 * math.Pi * r * r * (math.Sin(earth.ToRad(top)) - math.Sin(earth.ToRad(bottom)))
+	return ringArea / float64(pix.PixPerRing(ring))
+}
+
+// Area returns the area
+// (in km²)
+// of the pixels in the range of a taxon.
+func (c *Collection) Area(name string) float64 {
+	var a float64
+	for px := range c.Range(name) {
+		a += PixelArea(c.pix, px)
+	}
+	return a
+}
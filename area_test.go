@@ -0,0 +1,75 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestPixelArea(t *testing.T) {
+	pix := earth.NewPixelation(360)
+
+	var sum float64
+	for id := 0; id < pix.Len(); id++ {
+		sum += ranges.PixelArea(pix, id)
+	}
+	r := float64(earth.Radius) / 1000
+	want := 4 * math.Pi * r * r
+	if math.Abs(sum-want)/want > 1e-9 {
+		t.Errorf("total area: got %.3f km², want %.3f km²", sum, want)
+	}
+
+	// pixels are of approximately equal area
+	eq := ranges.PixelArea(pix, pix.Pixel(0, 0).ID())
+	hi := ranges.PixelArea(pix, pix.Pixel(60, 0).ID())
+	if math.Abs(eq-hi)/eq > 0.05 {
+		t.Errorf("pixel area: equator %.3f km², latitude 60: %.3f km²", eq, hi)
+	}
+}
+
+func TestArea(t *testing.T) {
+	coll := makeCollection(t)
+	nm := "Rhododendron ericoides"
+	pix := coll.Pixelation()
+	r := float64(earth.Radius) / 1000
+	want := float64(len(coll.Range(nm))) * 4 * math.Pi * r * r / float64(pix.Len())
+	if a := coll.Area(nm); math.Abs(a-want)/want > 0.05 {
+		t.Errorf("area: got %.3f km², want %.3f km²", a, want)
+	}
+}
+
+func TestCentroid(t *testing.T) {
+	pix := earth.NewPixelation(360)
+
+	rng := map[int]float64{
+		pix.Pixel(10, 20).ID(): 1,
+		pix.Pixel(10, 40).ID(): 1,
+	}
+	c, ok := ranges.Centroid(pix, rng)
+	if !ok {
+		t.Fatalf("centroid: undefined centroid")
+	}
+	if d := earth.Distance(c, earth.NewPoint(10.5, 30)); d > earth.ToRad(1) {
+		t.Errorf("centroid: got %.4f, %.4f", c.Latitude(), c.Longitude())
+	}
+
+	// across the anti-meridian
+	rng = map[int]float64{
+		pix.Pixel(0, 175).ID():  1,
+		pix.Pixel(0, -175).ID(): 1,
+	}
+	c, _ = ranges.Centroid(pix, rng)
+	if d := earth.Distance(c, earth.NewPoint(0, 180)); d > earth.ToRad(1) {
+		t.Errorf("anti-meridian centroid: got %.4f, %.4f", c.Latitude(), c.Longitude())
+	}
+
+	if _, ok := ranges.Centroid(pix, nil); ok {
+		t.Errorf("centroid: empty range: got a centroid")
+	}
+}
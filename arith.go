@@ -0,0 +1,106 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+// Sum returns a range map
+// in which the value of each pixel
+// is the sum of the values of the pixel
+// in both range maps.
+// Pixels that are only in a range map
+// keep its value.
+func Sum(a, b map[int]float64) map[int]float64 {
+	s := make(map[int]float64, max(len(a), len(b)))
+	for px, v := range a {
+		s[px] = v
+	}
+	for px, v := range b {
+		s[px] += v
+	}
+	return s
+}
+
+// Mul returns a range map
+// in which the value of each pixel
+// is the product of the values of the pixel
+// in both range maps.
+// Only pixels present in both range maps
+// are included in the result.
+func Mul(a, b map[int]float64) map[int]float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	m := make(map[int]float64, len(a))
+	for px, v := range a {
+		w, ok := b[px]
+		if !ok {
+			continue
+		}
+		if p := v * w; p != 0 {
+			m[px] = p
+		}
+	}
+	return m
+}
+
+// Div returns a range map
+// in which the value of each pixel
+// is the value of the pixel in range map a,
+// divided by the value of the pixel in range map b.
+// Pixels not present in b,
+// or with a value of 0 in b,
+// are excluded from the result.
+func Div(a, b map[int]float64) map[int]float64 {
+	d := make(map[int]float64, len(a))
+	for px, v := range a {
+		w := b[px]
+		if w == 0 {
+			continue
+		}
+		d[px] = v / w
+	}
+	return d
+}
+
+// Erase returns a range map
+// with the pixels of range map a
+// that are not in the mask
+// (i.e. pixels with a value greater than 0
+// in the mask are removed).
+func Erase(a, mask map[int]float64) map[int]float64 {
+	e := make(map[int]float64, len(a))
+	for px, v := range a {
+		if mask[px] > 0 {
+			continue
+		}
+		e[px] = v
+	}
+	return e
+}
+
+// Norm returns a range map
+// with the values scaled,
+// so the maximum value will be 1.
+// Pixels with a value smaller or equal to 0
+// are excluded from the result.
+func Norm(rng map[int]float64) map[int]float64 {
+	var max float64
+	for _, v := range rng {
+		if v > max {
+			max = v
+		}
+	}
+
+	n := make(map[int]float64, len(rng))
+	if max == 0 {
+		return n
+	}
+	for px, v := range rng {
+		if v <= 0 {
+			continue
+		}
+		n[px] = v / max
+	}
+	return n
+}
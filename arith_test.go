@@ -0,0 +1,80 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/js-arias/ranges"
+)
+
+func TestArith(t *testing.T) {
+	a := map[int]float64{
+		1: 0.5,
+		2: 1.0,
+		3: 0.25,
+	}
+	b := map[int]float64{
+		2: 0.5,
+		3: 0,
+		4: 1.0,
+	}
+
+	tests := map[string]struct {
+		got  map[int]float64
+		want map[int]float64
+	}{
+		"sum": {
+			got: ranges.Sum(a, b),
+			want: map[int]float64{
+				1: 0.5,
+				2: 1.5,
+				3: 0.25,
+				4: 1.0,
+			},
+		},
+		"mul": {
+			got: ranges.Mul(a, b),
+			want: map[int]float64{
+				2: 0.5,
+			},
+		},
+		"div": {
+			got: ranges.Div(a, b),
+			want: map[int]float64{
+				2: 2.0,
+			},
+		},
+		"erase": {
+			got: ranges.Erase(a, b),
+			want: map[int]float64{
+				1: 0.5,
+				3: 0.25,
+			},
+		},
+		"norm": {
+			got: ranges.Norm(map[int]float64{
+				1: 2.0,
+				2: 4.0,
+				3: 0,
+			}),
+			want: map[int]float64{
+				1: 0.5,
+				2: 1.0,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		if !maps.Equal(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", name, test.got, test.want)
+		}
+	}
+
+	if n := ranges.Norm(map[int]float64{1: 0}); len(n) != 0 {
+		t.Errorf("norm: empty range: got %v", n)
+	}
+}
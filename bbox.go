@@ -0,0 +1,165 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+	"slices"
+
+	"github.com/js-arias/earth"
+)
+
+// A BBox is a geographic bounding box
+// (in degrees).
+// If MinLon is greater than MaxLon,
+// the box crosses the anti-meridian
+// (for example, a box from 170 to -160
+// spans 30 degrees of longitude).
+type BBox struct {
+	MinLat, MaxLat float64
+	MinLon, MaxLon float64
+}
+
+// LonSpan returns the longitude span
+// of the box
+// (in degrees).
+func (b BBox) LonSpan() float64 {
+	if b.MinLon > b.MaxLon {
+		return b.MaxLon + 360 - b.MinLon
+	}
+	return b.MaxLon - b.MinLon
+}
+
+// Contains returns true
+// if a geographic point
+// is inside the box.
+func (b BBox) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon > b.MaxLon {
+		return lon >= b.MinLon || lon <= b.MaxLon
+	}
+	return lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// BoundingBox returns the minimal bounding box
+// that contains all the pixels of a range,
+// using the extent of each pixel
+// (not only its center).
+//
+// The longitude range of the box
+// is the complement of the largest longitude interval
+// without pixels,
+// so if the range crosses the anti-meridian,
+// the box will cross the anti-meridian.
+// If the range covers all longitudes
+// (for example, if it includes a pole),
+// the box will be from -180 to 180.
+// It returns false if the range is empty.
+func BoundingBox(pix *earth.Pixelation, rng map[int]float64) (BBox, bool) {
+	if len(rng) == 0 {
+		return BBox{}, false
+	}
+
+	// longitude intervals
+	type interval struct {
+		west, east float64
+	}
+	b := BBox{MinLat: 90, MaxLat: -90}
+	ivs := make([]interval, 0, len(rng))
+	full := false
+	for px := range rng {
+		p := pix.ID(px)
+		lat := pix.RingLat(p.Ring())
+		b.MinLat = math.Min(b.MinLat, math.Max(-90, lat-pix.Step()/2))
+		b.MaxLat = math.Max(b.MaxLat, math.Min(90, lat+pix.Step()/2))
+
+		n := pix.PixPerRing(p.Ring())
+		if n == 1 {
+			full = true
+			continue
+		}
+		half := 180 / float64(n)
+		west := p.Point().Longitude() - half
+		if west < -180 {
+			west += 360
+		}
+		if west >= 180 {
+			west -= 360
+		}
+		ivs = append(ivs, interval{west: west, east: west + 2*half})
+	}
+	if full {
+		b.MinLon, b.MaxLon = -180, 180
+		return b, true
+	}
+
+	slices.SortFunc(ivs, func(a, b interval) int {
+		if a.west < b.west {
+			return -1
+		}
+		if a.west > b.west {
+			return 1
+		}
+		return 0
+	})
+
+	// find the largest gap
+	// between the intervals
+	var gap float64
+	var gapWest, gapEast float64
+	east := ivs[0].east
+	for _, iv := range ivs[1:] {
+		if iv.west > east && iv.west-east > gap {
+			gap = iv.west - east
+			gapWest, gapEast = east, iv.west
+		}
+		east = math.Max(east, iv.east)
+	}
+	// gap across the anti-meridian
+	if g := ivs[0].west + 360 - east; g > gap {
+		gap = g
+		gapWest, gapEast = east, ivs[0].west+360
+	}
+	if gap <= 0 {
+		b.MinLon, b.MaxLon = -180, 180
+		return b, true
+	}
+
+	// -180 and 180 are the same meridian,
+	// so the box starts at -180
+	// and ends at 180
+	b.MinLon = normLon(gapEast)
+	if b.MinLon == 180 {
+		b.MinLon = -180
+	}
+	b.MaxLon = normLon(gapWest)
+	if b.MaxLon == -180 {
+		b.MaxLon = 180
+	}
+	return b, true
+}
+
+// BoundingBox returns the minimal bounding box
+// of the range of a taxon
+// (see BoundingBox).
+// It returns false if the taxon is not in the collection,
+// or its range is empty.
+func (c *Collection) BoundingBox(name string) (BBox, bool) {
+	return BoundingBox(c.pix, c.Range(name))
+}
+
+// NormLon returns a longitude
+// in the range [-180, 180].
+func normLon(lon float64) float64 {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon > 180 {
+		lon -= 360
+	}
+	return lon
+}
@@ -0,0 +1,93 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestBoundingBox(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	half := pix.Step() / 2
+
+	tests := map[string]struct {
+		pts  [][2]float64
+		want ranges.BBox
+		span float64
+	}{
+		"simple": {
+			pts:  [][2]float64{{0.25, 10.25}, {20.25, 30.25}},
+			want: ranges.BBox{MinLat: 0.25 - half, MaxLat: 20.25 + half, MinLon: 10.25 - half, MaxLon: 30.25 + half},
+			span: 20 + 2*half,
+		},
+		"anti-meridian": {
+			pts:  [][2]float64{{0.25, 170.25}, {0.25, -160.25}},
+			want: ranges.BBox{MinLat: 0.25 - half, MaxLat: 0.25 + half, MinLon: 170.25 - half, MaxLon: -160.25 + half},
+			span: 29.5 + 2*half,
+		},
+		"pole": {
+			pts:  [][2]float64{{90, 0}, {80, 10}},
+			want: ranges.BBox{MinLat: 80 - half, MaxLat: 90, MinLon: -180, MaxLon: 180},
+			span: 360,
+		},
+	}
+
+	for name, test := range tests {
+		rng := make(map[int]float64)
+		for _, p := range test.pts {
+			rng[pix.Pixel(p[0], p[1]).ID()] = 1
+		}
+		box, ok := ranges.BoundingBox(pix, rng)
+		if !ok {
+			t.Fatalf("%s: undefined box", name)
+		}
+
+		// pixel centers are not exactly at the given points
+		const tol = 0.6
+		if math.Abs(box.MinLat-test.want.MinLat) > tol || math.Abs(box.MaxLat-test.want.MaxLat) > tol {
+			t.Errorf("%s: got latitude %.3f..%.3f, want %.3f..%.3f", name, box.MinLat, box.MaxLat, test.want.MinLat, test.want.MaxLat)
+		}
+		if math.Abs(box.MinLon-test.want.MinLon) > tol || math.Abs(box.MaxLon-test.want.MaxLon) > tol {
+			t.Errorf("%s: got longitude %.3f..%.3f, want %.3f..%.3f", name, box.MinLon, box.MaxLon, test.want.MinLon, test.want.MaxLon)
+		}
+		if s := box.LonSpan(); math.Abs(s-test.span) > 2*tol {
+			t.Errorf("%s: got span %.3f, want %.3f", name, s, test.span)
+		}
+		for px := range rng {
+			pt := pix.ID(px).Point()
+			if !box.Contains(pt.Latitude(), pt.Longitude()) {
+				t.Errorf("%s: pixel %d not in box", name, px)
+			}
+		}
+	}
+
+	// a box across the anti-meridian
+	// does not contain the longitudes
+	// outside the box
+	rng := map[int]float64{
+		pix.Pixel(0, 170).ID():  1,
+		pix.Pixel(0, -160).ID(): 1,
+	}
+	box, _ := ranges.BoundingBox(pix, rng)
+	if box.Contains(0, 0) {
+		t.Errorf("anti-meridian: box %v contains longitude 0", box)
+	}
+	if !box.Contains(0, 180) {
+		t.Errorf("anti-meridian: box %v does not contain longitude 180", box)
+	}
+
+	if _, ok := ranges.BoundingBox(pix, nil); ok {
+		t.Errorf("empty range: expecting undefined box")
+	}
+
+	coll := makeCollection(t)
+	if _, ok := coll.BoundingBox("Unknown taxon"); ok {
+		t.Errorf("undefined taxon: expecting undefined box")
+	}
+}
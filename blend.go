@@ -0,0 +1,74 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+
+	"github.com/js-arias/earth"
+)
+
+// Clip returns the pixels of a range map
+// that are in the extent of a mask
+// (i.e. pixels with a value larger than 0 in the mask).
+// The values of the range map are preserved.
+func Clip(rng, mask map[int]float64) map[int]float64 {
+	c := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		if mask[px] <= 0 {
+			continue
+		}
+		c[px] = v
+	}
+	return c
+}
+
+// Blend returns a range map
+// that keeps the extent of an expert range map,
+// with the densities boosted
+// near the given points.
+//
+// The density of each pixel of the expert range
+// is a weighted mean
+// of the expert density
+// and a normal kernel
+// of the distance to the nearest point:
+//
+//	(1 - weight) * expert + weight * exp(-0.5 * (dist / bandwidth)^2)
+//
+// where the distance and the bandwidth
+// are in km.
+// Points outside the expert range are ignored.
+func Blend(pix *earth.Pixelation, expert, points map[int]float64, bandwidth, weight float64) map[int]float64 {
+	var pts []earth.Point
+	for px := range points {
+		if expert[px] <= 0 {
+			continue
+		}
+		pts = append(pts, pix.ID(px).Point())
+	}
+
+	// bandwidth as an angular distance in radians
+	bw := bandwidth / (float64(earth.Radius) / 1000)
+
+	b := make(map[int]float64, len(expert))
+	for px, v := range expert {
+		if v <= 0 {
+			continue
+		}
+		var k float64
+		if len(pts) > 0 && bw > 0 {
+			pt := pix.ID(px).Point()
+			min := math.Inf(1)
+			for _, p := range pts {
+				min = math.Min(min, earth.Distance(p, pt))
+			}
+			d := min / bw
+			k = math.Exp(-0.5 * d * d)
+		}
+		b[px] = (1-weight)*v + weight*k
+	}
+	return b
+}
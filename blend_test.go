@@ -0,0 +1,73 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"maps"
+	"math"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestClip(t *testing.T) {
+	rng := map[int]float64{
+		1: 0.5,
+		2: 1.0,
+		3: 0.25,
+	}
+	mask := map[int]float64{
+		2: 0.1,
+		3: 0,
+		4: 1.0,
+	}
+
+	got := ranges.Clip(rng, mask)
+	want := map[int]float64{
+		2: 1.0,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("clip: got %v, want %v", got, want)
+	}
+}
+
+func TestBlend(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	a := pix.Pixel(0, 0).ID()
+	b := pix.Pixel(0, 10).ID()
+	c := pix.Pixel(0, 40).ID()
+	outside := pix.Pixel(0, 20).ID()
+
+	expert := map[int]float64{
+		a: 1.0,
+		b: 0.5,
+		c: 0.5,
+	}
+	points := map[int]float64{
+		a:       1,
+		outside: 1,
+	}
+
+	got := ranges.Blend(pix, expert, points, 500, 0.5)
+	if len(got) != len(expert) {
+		t.Fatalf("blend: got %d pixels, want %d", len(got), len(expert))
+	}
+	if math.Abs(got[a]-1.0) > 1e-9 {
+		t.Errorf("blend: pixel with point: got %.6f, want %.6f", got[a], 1.0)
+	}
+	if got[b] <= 0.25 || got[b] >= 0.75 {
+		t.Errorf("blend: near pixel: got %.6f, want a value in (0.25, 0.75)", got[b])
+	}
+	if got[c] > 0.25+1e-6 {
+		t.Errorf("blend: far pixel: got %.6f, want %.6f", got[c], 0.25)
+	}
+
+	// without points
+	got = ranges.Blend(pix, expert, nil, 500, 0.5)
+	if math.Abs(got[a]-0.5) > 1e-9 {
+		t.Errorf("blend: without points: got %.6f, want %.6f", got[a], 0.5)
+	}
+}
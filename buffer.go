@@ -0,0 +1,88 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+
+	"github.com/js-arias/earth"
+)
+
+// Buffer returns the pixels
+// that are at a distance
+// less or equal than dist
+// (in km)
+// of any of the given pixels.
+// The returned pixels include the given pixels,
+// and all of them are set to 1.0.
+func Buffer(pix *earth.Pixelation, pixels map[int]float64, dist float64) map[int]float64 {
+	// a buffer is a generalization
+	// in which all pixels have the same value
+	ones := make(map[int]float64, len(pixels))
+	for px := range pixels {
+		ones[px] = 1
+	}
+	return Generalize(pix, ones, dist)
+}
+
+// Generalize returns a generalized version of a range,
+// in which each pixel at a distance
+// less or equal than dist
+// (in km)
+// of any pixel of the range
+// takes the maximum value
+// of the range pixels within that distance.
+// It is used to blur the range of a taxon,
+// so the exact pixels of the range
+// can not be recovered.
+// Pixels with a value of 0 are ignored.
+func Generalize(pix *earth.Pixelation, rng map[int]float64, dist float64) map[int]float64 {
+	gen := make(map[int]float64, len(rng))
+	type source struct {
+		pt earth.Point
+		v  float64
+	}
+	src := make([]source, 0, len(rng))
+	minLat, maxLat := 90.0, -90.0
+	for px, v := range rng {
+		if v <= 0 {
+			continue
+		}
+		gen[px] = v
+		pt := pix.ID(px).Point()
+		src = append(src, source{pt: pt, v: v})
+		minLat = math.Min(minLat, pt.Latitude())
+		maxLat = math.Max(maxLat, pt.Latitude())
+	}
+	if dist <= 0 || len(src) == 0 {
+		return gen
+	}
+
+	// angular distance in radians
+	angle := dist / (float64(earth.Radius) / 1000)
+	latDist := earth.ToDegree(angle) + pix.Step()
+	for r := 0; r < pix.Rings(); r++ {
+		lat := pix.RingLat(r)
+		if lat < minLat-latDist || lat > maxLat+latDist {
+			continue
+		}
+		first := pix.FirstPix(r).ID()
+		for id := first; id < first+pix.PixPerRing(r); id++ {
+			pt := pix.ID(id).Point()
+			for _, s := range src {
+				if s.v <= gen[id] {
+					continue
+				}
+				if math.Abs(s.pt.Latitude()-pt.Latitude()) > latDist {
+					continue
+				}
+				if earth.Distance(s.pt, pt) <= angle {
+					gen[id] = s.v
+				}
+			}
+		}
+	}
+	return gen
+}
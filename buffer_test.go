@@ -0,0 +1,128 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestBuffer(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	center := pix.Pixel(10, 20)
+	rng := map[int]float64{
+		center.ID(): 1,
+	}
+
+	if b := ranges.Buffer(pix, rng, 0); len(b) != 1 {
+		t.Errorf("buffer 0 km: got %d pixels, want 1", len(b))
+	}
+
+	dist := 500.0
+	b := ranges.Buffer(pix, rng, dist)
+	if len(b) < 2 {
+		t.Fatalf("buffer %.0f km: got %d pixels", dist, len(b))
+	}
+	r := float64(earth.Radius) / 1000
+	for px := range b {
+		d := earth.Distance(center.Point(), pix.ID(px).Point()) * r
+		if d > dist {
+			t.Errorf("buffer %.0f km: pixel %d at %.3f km", dist, px, d)
+		}
+	}
+	for id := 0; id < pix.Len(); id++ {
+		if _, ok := b[id]; ok {
+			continue
+		}
+		d := earth.Distance(center.Point(), pix.ID(id).Point()) * r
+		if d <= dist {
+			t.Errorf("buffer %.0f km: pixel %d at %.3f km not in buffer", dist, id, d)
+		}
+	}
+
+	// a pixel at the anti-meridian
+	am := pix.Pixel(0, 179.9)
+	b = ranges.Buffer(pix, map[int]float64{am.ID(): 1}, 300)
+	var east, west bool
+	for px := range b {
+		lon := pix.ID(px).Point().Longitude()
+		if lon > 170 {
+			east = true
+		}
+		if lon < -170 {
+			west = true
+		}
+	}
+	if !east || !west {
+		t.Errorf("buffer at anti-meridian: east %v, west %v", east, west)
+	}
+
+	// a buffer across the pole
+	for _, lat := range []float64{88, -88} {
+		p := pix.Pixel(lat, 0)
+		b = ranges.Buffer(pix, map[int]float64{p.ID(): 1}, 500)
+		for id := 0; id < pix.Len(); id++ {
+			d := earth.Distance(p.Point(), pix.ID(id).Point()) * r
+			if _, ok := b[id]; ok != (d <= 500) {
+				t.Errorf("buffer at %.0f: pixel %d at %.3f km: in buffer %v", lat, id, d, ok)
+			}
+		}
+		if px := pix.Pixel(lat, 180).ID(); b[px] != 1 {
+			t.Errorf("buffer at %.0f: pixel %d across the pole not in buffer", lat, px)
+		}
+	}
+}
+
+func TestGeneralize(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	high := pix.Pixel(10, 20)
+	low := pix.Pixel(10, 24)
+	rng := map[int]float64{
+		high.ID(): 1,
+		low.ID():  0.5,
+	}
+
+	if g := ranges.Generalize(pix, rng, 0); len(g) != 2 {
+		t.Errorf("generalize 0 km: got %d pixels, want 2", len(g))
+	}
+
+	dist := 300.0
+	g := ranges.Generalize(pix, rng, dist)
+	r := float64(earth.Radius) / 1000
+	for id := 0; id < pix.Len(); id++ {
+		pt := pix.ID(id).Point()
+		dh := earth.Distance(high.Point(), pt) * r
+		dl := earth.Distance(low.Point(), pt) * r
+		var want float64
+		switch {
+		case dh <= dist:
+			want = 1
+		case dl <= dist:
+			want = 0.5
+		}
+		if got := g[id]; got != want {
+			t.Errorf("generalize %.0f km: pixel %d: got %.3f, want %.3f", dist, id, got, want)
+		}
+	}
+
+	// on a presence-absence range
+	// it is the same as a buffer
+	pts := map[int]float64{
+		high.ID(): 1,
+		low.ID():  1,
+	}
+	b := ranges.Buffer(pix, pts, dist)
+	g = ranges.Generalize(pix, pts, dist)
+	if len(g) != len(b) {
+		t.Errorf("generalize points: got %d pixels, want %d", len(g), len(b))
+	}
+	for px := range b {
+		if _, ok := g[px]; !ok {
+			t.Errorf("generalize points: pixel %d not in range", px)
+		}
+	}
+}
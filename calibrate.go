@@ -0,0 +1,248 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+// An Observation is a presence-absence observation
+// from an independent dataset,
+// and the density predicted by a range
+// at the pixel of the observation.
+type Observation struct {
+	Density  float64
+	Presence bool
+}
+
+// A Calibration is a monotone function
+// that maps the density values of a range
+// to the probability of presence,
+// estimated with an isotonic regression
+// of the presences on the densities
+// of a set of observations.
+type Calibration struct {
+	blocks []calBlock
+}
+
+// A calBlock is a block of pooled observations
+// of an isotonic regression.
+type calBlock struct {
+	lower, upper float64 // density bounds
+	n            float64 // number of observations
+	p            float64 // frequency of presences
+}
+
+// Calibrate returns the calibration function
+// for a set of observations,
+// using the pool adjacent violators algorithm.
+func Calibrate(obs []Observation) (*Calibration, error) {
+	if len(obs) == 0 {
+		return nil, errors.New("calibration without observations")
+	}
+
+	sorted := slices.Clone(obs)
+	slices.SortFunc(sorted, func(a, b Observation) int {
+		if a.Density < b.Density {
+			return -1
+		}
+		if a.Density > b.Density {
+			return 1
+		}
+		return 0
+	})
+
+	var blocks []calBlock
+	for _, o := range sorted {
+		var v float64
+		if o.Presence {
+			v = 1
+		}
+		if len(blocks) > 0 && blocks[len(blocks)-1].upper == o.Density {
+			// tied densities are always pooled
+			b := &blocks[len(blocks)-1]
+			b.p = (b.p*b.n + v) / (b.n + 1)
+			b.n++
+		} else {
+			blocks = append(blocks, calBlock{
+				lower: o.Density,
+				upper: o.Density,
+				n:     1,
+				p:     v,
+			})
+		}
+
+		// pool adjacent violators
+		for len(blocks) > 1 {
+			last := blocks[len(blocks)-1]
+			prev := &blocks[len(blocks)-2]
+			if prev.p < last.p {
+				break
+			}
+			prev.p = (prev.p*prev.n + last.p*last.n) / (prev.n + last.n)
+			prev.n += last.n
+			prev.upper = last.upper
+			blocks = blocks[:len(blocks)-1]
+		}
+	}
+	return &Calibration{blocks: blocks}, nil
+}
+
+// Prob returns the calibrated probability
+// of a density value.
+//
+// Densities inside a block of the isotonic regression
+// have the probability of the block,
+// densities between two blocks
+// are interpolated linearly,
+// and densities outside the range of the observations
+// have the probability of the nearest block.
+func (c *Calibration) Prob(density float64) float64 {
+	i := sort.Search(len(c.blocks), func(i int) bool {
+		return c.blocks[i].upper >= density
+	})
+	if i == len(c.blocks) {
+		return c.blocks[len(c.blocks)-1].p
+	}
+	b := c.blocks[i]
+	if i == 0 || density >= b.lower {
+		return b.p
+	}
+	prev := c.blocks[i-1]
+	f := (density - prev.upper) / (b.lower - prev.upper)
+	return prev.p + f*(b.p-prev.p)
+}
+
+// Apply returns a range map
+// with the density values
+// replaced by the calibrated probabilities.
+// Pixels with a probability of 0
+// are excluded from the result.
+func (c *Calibration) Apply(rng map[int]float64) map[int]float64 {
+	cal := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		p := c.Prob(v)
+		if p <= 0 {
+			continue
+		}
+		cal[px] = p
+	}
+	return cal
+}
+
+// ApplyCalibration replaces the densities
+// of the range of a taxon
+// with the calibrated probabilities.
+// Unlike Set,
+// the values are not scaled,
+// so the maximum value of the range
+// can be smaller than 1.
+// Pixels with a probability of 0
+// are removed from the range.
+// It returns false if the taxon is not in the collection,
+// or if it is not a continuous range.
+func (c *Collection) ApplyCalibration(name string, cal *Calibration) bool {
+	name = canon(name)
+	if name == "" {
+		return false
+	}
+	tax, ok := c.taxa[name]
+	if !ok || tax.tp != Range {
+		return false
+	}
+
+	for px, v := range tax.rng {
+		p := cal.Prob(v)
+		if p <= 0 {
+			delete(tax.rng, px)
+			delete(tax.recs, px)
+			delete(tax.extra, px)
+			continue
+		}
+		tax.rng[px] = p
+	}
+	c.resetIndex()
+	return true
+}
+
+// A ReliabilityBin is a bin of a reliability diagram.
+type ReliabilityBin struct {
+	// Density bounds of the bin.
+	Lower, Upper float64
+
+	// Number of observations in the bin.
+	N int
+
+	// Mean predicted density of the observations.
+	Mean float64
+
+	// Frequency of presences in the bin.
+	Freq float64
+}
+
+// Reliability returns the bins of a reliability diagram
+// of a set of observations,
+// i.e. the frequency of presences
+// for the observations with a predicted density
+// in each bin.
+// Bins have the same width,
+// and cover densities from 0 to 1
+// (densities out of this interval
+// are assigned to the first or the last bin).
+func Reliability(obs []Observation, bins int) []ReliabilityBin {
+	if bins < 1 {
+		bins = 1
+	}
+	rb := make([]ReliabilityBin, bins)
+	for i := range rb {
+		rb[i].Lower = float64(i) / float64(bins)
+		rb[i].Upper = float64(i+1) / float64(bins)
+	}
+	for _, o := range obs {
+		i := int(o.Density * float64(bins))
+		if i < 0 {
+			i = 0
+		}
+		if i >= bins {
+			i = bins - 1
+		}
+		rb[i].N++
+		rb[i].Mean += o.Density
+		if o.Presence {
+			rb[i].Freq++
+		}
+	}
+	for i := range rb {
+		if rb[i].N == 0 {
+			continue
+		}
+		rb[i].Mean /= float64(rb[i].N)
+		rb[i].Freq /= float64(rb[i].N)
+	}
+	return rb
+}
+
+// BrierScore returns the Brier score
+// of a set of observations,
+// i.e. the mean squared difference
+// between the predicted density
+// and the observed presence (1)
+// or absence (0).
+func BrierScore(obs []Observation) float64 {
+	if len(obs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, o := range obs {
+		d := o.Density
+		if o.Presence {
+			d = 1 - d
+		}
+		sum += d * d
+	}
+	return sum / float64(len(obs))
+}
@@ -0,0 +1,116 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"maps"
+	"math"
+	"testing"
+
+	"github.com/js-arias/ranges"
+)
+
+func TestCalibrate(t *testing.T) {
+	obs := []ranges.Observation{
+		{Density: 0.9, Presence: false},
+		{Density: 0.1, Presence: false},
+		{Density: 0.2, Presence: true},
+		{Density: 1.0, Presence: true},
+		{Density: 0.3, Presence: false},
+		{Density: 0.6, Presence: true},
+		{Density: 0.8, Presence: true},
+	}
+
+	cal, err := ranges.Calibrate(obs)
+	if err != nil {
+		t.Fatalf("calibrate: %v", err)
+	}
+
+	tests := map[float64]float64{
+		0.05: 0,
+		0.1:  0,
+		0.15: 0.25,
+		0.25: 0.5,
+		0.45: 0.5 + 1.0/12,
+		0.7:  2.0 / 3,
+		0.95: 2.0/3 + 1.0/6,
+		2.0:  1,
+	}
+	for d, want := range tests {
+		if got := cal.Prob(d); math.Abs(got-want) > 1e-9 {
+			t.Errorf("prob %.2f: got %.6f, want %.6f", d, got, want)
+		}
+	}
+
+	rng := cal.Apply(map[int]float64{
+		1: 0.05,
+		2: 0.25,
+		3: 1.0,
+	})
+	if len(rng) != 2 {
+		t.Errorf("apply: got %d pixels, want %d", len(rng), 2)
+	}
+	if _, ok := rng[1]; ok {
+		t.Errorf("apply: pixel %d with probability 0", 1)
+	}
+	if rng[3] != 1 {
+		t.Errorf("apply: pixel %d: got %.6f, want %.6f", 3, rng[3], 1.0)
+	}
+
+	coll := makeCollection(t)
+	var tax string
+	for _, nm := range coll.Taxa() {
+		if coll.Type(nm) == ranges.Range {
+			tax = nm
+			break
+		}
+	}
+	if tax == "" {
+		t.Fatalf("collection without continuous ranges")
+	}
+	prev := maps.Clone(coll.Range(tax))
+	if !coll.ApplyCalibration(tax, cal) {
+		t.Fatalf("apply calibration: taxon %q not calibrated", tax)
+	}
+	got := coll.Range(tax)
+	for px, v := range prev {
+		p := cal.Prob(v)
+		if p <= 0 {
+			if _, ok := got[px]; ok {
+				t.Errorf("apply calibration: pixel %d with probability 0", px)
+			}
+			continue
+		}
+		if got[px] != p {
+			t.Errorf("apply calibration: pixel %d: got %.6f, want %.6f", px, got[px], p)
+		}
+	}
+	if coll.ApplyCalibration("unknown taxon", cal) {
+		t.Errorf("apply calibration: unknown taxon calibrated")
+	}
+
+	if got := ranges.BrierScore(obs); math.Abs(got-0.25) > 1e-9 {
+		t.Errorf("brier score: got %.6f, want %.6f", got, 0.25)
+	}
+
+	bins := ranges.Reliability(obs, 2)
+	want := []ranges.ReliabilityBin{
+		{Lower: 0, Upper: 0.5, N: 3, Mean: 0.2, Freq: 1.0 / 3},
+		{Lower: 0.5, Upper: 1, N: 4, Mean: 0.825, Freq: 0.75},
+	}
+	if len(bins) != len(want) {
+		t.Fatalf("reliability: got %d bins, want %d", len(bins), len(want))
+	}
+	for i, b := range bins {
+		w := want[i]
+		if b.Lower != w.Lower || b.Upper != w.Upper || b.N != w.N || math.Abs(b.Mean-w.Mean) > 1e-9 || math.Abs(b.Freq-w.Freq) > 1e-9 {
+			t.Errorf("reliability bin %d: got %v, want %v", i, b, w)
+		}
+	}
+
+	if _, err := ranges.Calibrate(nil); err == nil {
+		t.Errorf("calibrate: expecting error without observations")
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import "github.com/js-arias/earth"
+
+// Centroid returns the centroid of a range,
+// i.e. the mean direction of the pixels of the range
+// weighted by the value of each pixel.
+// It returns false if the range is empty,
+// or the centroid is undefined
+// (for example, if the range is made of antipodal pixels).
+func Centroid(pix *earth.Pixelation, rng map[int]float64) (earth.Point, bool) {
+	var c vec3
+	for px, v := range rng {
+		if v <= 0 {
+			continue
+		}
+		c = c.add(toVec3(pix.ID(px).Point()).scale(v))
+	}
+	n := c.norm()
+	if n < 1e-9 {
+		return earth.Point{}, false
+	}
+	lat, lon := fromVec3(c.scale(1 / n))
+	return earth.NewPoint(lat, lon), true
+}
@@ -0,0 +1,259 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package anonymize implements a command to reduce
+// the precision of the ranges of sensitive taxa.
+package anonymize
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/seed"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/sensitive"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `anonymize [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--sensitive <file> [--mode <mode>]
+	[--equator <number>] [--radius <value>] [--seed <value>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "reduce the precision of ranges of sensitive taxa",
+	Long: `
+Command anonymize reads a geographic range file, and reduces the precision of
+the ranges of sensitive taxa (for example, poached taxa), so the file can be
+shared publicly.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --sensitive is required, and defines a tab-delimited file with the
+list of sensitive taxa. The file must have the field "taxon", and optionally,
+the fields "action" and "value", to define how each taxon is anonymized. For
+example:
+
+	taxon	action	value
+	Aus bus	coarse	15
+	Aus cus	jitter	300
+	Dus eus	remove
+
+Valid actions are:
+
+	coarse  each pixel is moved to the center of the pixel that contains it
+	        in a coarser pixelation, so the precision of the range is the
+	        resolution of the coarser pixelation. The value is the number
+	        of pixels in the equator of the coarser pixelation.
+	jitter  each pixel is moved to a random pixel at a distance less or
+	        equal than the value (in km).
+	remove  the taxon is not written.
+
+If there is no action for a taxon, the action defined by the flag --mode will
+be used (by default "coarse"). If there is no value, the value defined by the
+flag --equator (by default 30) for the "coarse" action, or the flag --radius
+(by default 100 km) for the "jitter" action, will be used. Taxa not in the
+list are not modified.
+
+If several pixels are moved to the same pixel, the density of the pixel is
+the maximum density, and the record counts are added.
+
+The flag --seed defines the seed of the random number generator used by the
+"jitter" action (default 1), so the same seed always produces the same
+output. Use "random" to take the seed from the current time. The seed is
+recorded as a comment in the output file.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var sensitiveFile string
+var modeFlag string
+var equatorFlag int
+var radiusFlag float64
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	seed.SetFlags(c)
+	c.Flags().StringVar(&sensitiveFile, "sensitive", "", "")
+	c.Flags().StringVar(&modeFlag, "mode", "coarse", "")
+	c.Flags().IntVar(&equatorFlag, "equator", 30, "")
+	c.Flags().Float64Var(&radiusFlag, "radius", 100, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if sensitiveFile == "" {
+		return c.UsageError("flag --sensitive required")
+	}
+	if !sensitive.ValidAction(modeFlag) {
+		return c.UsageError(fmt.Sprintf("invalid --mode value %q", modeFlag))
+	}
+	if equatorFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --equator value %d", equatorFlag))
+	}
+	if radiusFlag < 0 {
+		return c.UsageError(fmt.Sprintf("invalid --radius value %.6f", radiusFlag))
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+
+	list, err := readSensitive(sensitiveFile, coll.Pixelation())
+	if err != nil {
+		return err
+	}
+
+	pix := coll.Pixelation()
+	rnd := seed.Rand()
+	var jitter bool
+	for _, s := range list {
+		if !coll.HasTaxon(s.taxon) {
+			log.Info("sensitive taxon not in collection", "taxon", s.taxon)
+			continue
+		}
+		switch s.action {
+		case "remove":
+			coll.Delete(s.taxon)
+		case "coarse":
+			coarse := earth.NewPixelation(int(s.value))
+			coll.MovePixels(s.taxon, func(px int) int {
+				return ranges.CoarsePixel(pix, coarse, px)
+			})
+		case "jitter":
+			jitter = true
+			coll.MovePixels(s.taxon, func(px int) int {
+				return ranges.JitterPixel(pix, px, s.value, rnd)
+			})
+		}
+		log.Debug("taxon anonymized", "taxon", s.taxon, "action", s.action, "value", s.value)
+	}
+	if jitter {
+		coll.AddComment(seed.Comment())
+	}
+
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+// A SensitiveTaxon is a sensitive taxon
+// and the action used to anonymize it.
+type sensitiveTaxon struct {
+	taxon  string
+	action string
+	value  float64
+}
+
+func readSensitive(name string, pix *earth.Pixelation) ([]sensitiveTaxon, error) {
+	ls, err := sensitive.Read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]sensitiveTaxon, 0, len(ls))
+	for _, t := range ls {
+		s := sensitiveTaxon{
+			taxon:  t.Name,
+			action: t.Action,
+			value:  t.Value,
+		}
+		if s.action == "" {
+			s.action = modeFlag
+		}
+		if !t.HasValue {
+			switch s.action {
+			case "coarse":
+				s.value = float64(equatorFlag)
+			case "jitter":
+				s.value = radiusFlag
+			}
+		}
+		if s.action == "coarse" {
+			eq := int(s.value)
+			if float64(eq) != s.value || eq < 1 || eq >= pix.Equator() {
+				return nil, fmt.Errorf("on file %q: row %d: field %q: invalid equator %v: must be an integer between 1 and %d", name, t.Row, "value", s.value, pix.Equator()-1)
+			}
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
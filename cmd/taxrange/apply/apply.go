@@ -0,0 +1,208 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package apply implements a command to apply
+// a patch to a collection of range maps.
+package apply
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `apply [--quiet | -v | -vv] [--log-json]
+	[--reverse] [--check] [--json-summary <file>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--force] [-o|--output <file>] <patch-file> [<rng-file>]`,
+	Short: "apply a patch to a range file",
+	Long: `
+Command apply reads a patch file and a geographic range file, and applies the
+changes of the patch to the ranges.
+
+A patch file is a small tab-delimited file with a list of changes to the
+ranges, so collaborators can exchange reviewable changes to a shared dataset,
+instead of whole regenerated files. A patch can be written with the flag
+--patch of the commands that edit ranges (for example clean, erase, names, or
+set-age), or by hand. The file must contain the columns "op", with the
+operation, and "taxon", with the name of the taxon. The other columns depend
+on the operation:
+
+	add	adds a pixel to the range of the taxon. It requires
+		the columns "type", "age", "equator", and "pixel",
+		and optionally "density" (by default 1), and
+		"records" (by default 0).
+	remove	removes a pixel from the range of the taxon. It uses
+		the same columns of "add".
+	age	sets the age of the taxon. It requires the columns
+		"age", with the age (in years) before the change, and
+		"value", with the new age.
+	rename	renames the taxon. It requires the column "value",
+		with the new name.
+
+Columns not used by an operation can be empty. Here is an example file:
+
+	# taxon range patch
+	op	taxon	type	age	equator	pixel	density	records	value
+	remove	Aus bus	points	0	360	17319	1.000000	2
+	add	Aus bus	points	0	360	17320	1.000000	1
+	age	Cus dus		5000000					6000000
+	rename	Eus fus							Eus gus
+
+As each removed pixel keeps its density and number of records, and each
+change of age or name keeps the previous value, the changes of a patch can be
+reverted.
+
+The first argument of the command is the name of the patch file. The second
+argument is the name of the range file. If no range file is given, the ranges
+will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Each added pixel must not be in the range of the taxon, and each removed pixel
+must be in the range of the taxon, otherwise the command ends with an error,
+so a patch can not be applied twice, or to a different version of the ranges.
+The age of a taxon must be the age before the change, and a taxon can not be
+renamed with the name of another taxon. A taxon without pixels after the patch
+is removed.
+
+If the flag --check is defined, the patch is applied, but the ranges are not
+written. Instead, the number of changes of each operation is printed, so a
+patch can be reviewed before it is applied.
+
+If the flag --reverse is defined, the changes of the patch will be reverted,
+for example, to undo the edition that produced the patch.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var reverseFlag bool
+var checkFlag bool
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&reverseFlag, "reverse", false, "")
+	c.Flags().BoolVar(&checkFlag, "check", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 1 {
+		return c.UsageError("expecting patch file")
+	}
+	patchFile := args[0]
+	p, err := readPatch(patchFile)
+	if err != nil {
+		return err
+	}
+	if reverseFlag {
+		p = p.Reverse()
+	}
+
+	input := "-"
+	if len(args) > 1 {
+		input = args[1]
+	}
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Apply(coll); err != nil {
+		return fmt.Errorf("when applying %q: %v", patchFile, err)
+	}
+
+	if checkFlag {
+		count := make(map[ranges.Op]int)
+		for _, ch := range p.Changes() {
+			count[ch.Op]++
+		}
+		fmt.Fprintf(c.Stdout(), "operation\tchanges\n")
+		for _, op := range []ranges.Op{ranges.OpAdd, ranges.OpRemove, ranges.OpAge, ranges.OpRename} {
+			fmt.Fprintf(c.Stdout(), "%s\t%d\n", op, count[op])
+		}
+		return nil
+	}
+
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+func readPatch(name string) (*ranges.Patch, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := ranges.ReadPatch(f)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	return p, nil
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
@@ -0,0 +1,147 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package at implements a command to print
+// the taxa present at a location.
+package at
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `at [--quiet | -v | -vv] [--log-json]
+	[--lat <value> --lon <value> | --pixel <value>]
+	[--json-summary <file>] [--force]
+	[--introduced <mode>]
+	[<rng-file>...]`,
+	Short: "prints the taxa present at a location",
+	Long: `
+Command at reads one or more geographic range files, and prints the taxa with
+a range that includes the indicated location.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The location can be defined with the flags --lat and --lon, for the latitude
+and longitude of a point, or with the flag --pixel, for the ID of a pixel in
+the pixelation of the range files.
+
+The output is a tab-delimited table with the following columns:
+
+	file	the range file
+	taxon	the name of the taxon
+	type	the type of the range
+	age	the age of the range (in million years)
+	pixel	the pixel ID
+	density	the density of the range at the pixel
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var latFlag float64
+var lonFlag float64
+var pixFlag int
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().Float64Var(&latFlag, "lat", math.NaN(), "")
+	c.Flags().Float64Var(&lonFlag, "lon", math.NaN(), "")
+	c.Flags().IntVar(&pixFlag, "pixel", -1, "")
+}
+
+func run(c *command.Command, args []string) error {
+	hasPoint := !math.IsNaN(latFlag) || !math.IsNaN(lonFlag)
+	if hasPoint && pixFlag >= 0 {
+		return c.UsageError("both --pixel and --lat, --lon flags defined")
+	}
+	if hasPoint && (math.IsNaN(latFlag) || math.IsNaN(lonFlag)) {
+		return c.UsageError("both --lat and --lon flags are required")
+	}
+	if !hasPoint && pixFlag < 0 {
+		return c.UsageError("undefined location: use --lat and --lon, or --pixel")
+	}
+	if hasPoint {
+		if latFlag < -90 || latFlag > 90 {
+			return c.UsageError(fmt.Sprintf("invalid latitude %.6f", latFlag))
+		}
+		if lonFlag < -180 || lonFlag > 180 {
+			return c.UsageError(fmt.Sprintf("invalid longitude %.6f", lonFlag))
+		}
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\ttaxon\ttype\tage\tpixel\tdensity\n")
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		if err := printTaxa(c.Stdin(), c.Stdout(), a, hasPoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func printTaxa(r io.Reader, w io.Writer, name string, hasPoint bool) error {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	px := pixFlag
+	if hasPoint {
+		px = coll.Pixelation().Pixel(latFlag, lonFlag).ID()
+	}
+	if px >= coll.Pixelation().Len() {
+		return fmt.Errorf("when reading %q: invalid pixel %d", name, px)
+	}
+
+	for _, tax := range coll.TaxaAt(px) {
+		age := float64(coll.Age(tax)) / millionYears
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.6f\t%d\t%.6f\n", name, tax, coll.Type(tax), age, px, coll.Range(tax)[px])
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package bench implements a command to measure
+// the performance of common operations
+// on synthetic range maps.
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/earth/stat/dist"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/seed"
+	"github.com/js-arias/ranges/kde"
+	"github.com/js-arias/ranges/render"
+)
+
+var Command = &command.Command{
+	Usage: `bench [--quiet | -v | -vv] [--log-json]
+	[--taxa <number>] [--points <number>] [--spread <value>]
+	[-e|--equator <value>] [--seed <value>]
+	[--ops <list>] [--repeat <number>] [-c|--columns <value>]
+	[--cpuprofile <file>] [--memprofile <file>]
+	[--force] [-o|--output <file>]`,
+	Short: "measure the performance of range operations",
+	Long: `
+Command bench generates a synthetic collection of range maps, and measures
+the time used by common operations on the collection. It is useful to
+quantify the differences in performance between versions of the program, in
+the hardware of the user.
+
+The synthetic collection is made of point ranges. Each taxon is centered at a
+random point on the sphere, and its points are distributed around the center
+using a normal distribution. The flag --taxa defines the number of taxa
+(default 100), the flag --points the number of points of each taxon (default
+20), and the flag --spread the standard deviation of the distance of the
+points to the center (in degrees, default 5). The flag --equator, or -e,
+defines the pixelation of the collection (default 360). The flag --seed
+defines the seed of the random number generator (default 1), so the same
+collection is generated on each run. Use "random" to take the seed from the
+current time. The seed is always recorded in the output.
+
+By default all operations are measured. Use the flag --ops to define a
+comma-separated list of the operations to be measured. Valid operations are:
+
+	write	encode the collection as a TSV file
+	read	decode the collection from a TSV file
+	index	encode the collection as an indexed file, and read the
+		range of each taxon from the indexed file
+	kde	estimate the density of each taxon using a kernel density
+		estimation (as in the command kde, with the default lambda,
+		and a time pixelation in which all pixels are land)
+	map	draw a global map of each taxon and encode it as a PNG image
+		(the flag --columns, or -c, defines the number of columns of
+		the image, default 720)
+
+Each operation is repeated three times. Use the flag --repeat to change the
+number of repetitions.
+
+The output is a tab-delimited table with the following columns:
+
+	operation	the name of the operation
+	items	the number of items processed in each repetition
+			(taxa, or pixels for read and write)
+	best	the time of the fastest repetition (in seconds)
+	mean	the mean time of the repetitions (in seconds)
+	rate	the number of items processed per second in the fastest
+		repetition
+
+The table is preceded by comments with the version of the program, and the
+hardware used.
+
+The flags --cpuprofile and --memprofile write a CPU profile, or a memory
+profile, of the measured operations, in the indicated file. The profiles can
+be analyzed with the command "go tool pprof".
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+	`,
+	SetFlags: setFlags,
+	Run:      run,
+}
+
+var numTaxa int
+var numPoints int
+var spread float64
+var equator int
+var opsFlag string
+var repeat int
+var colsFlag int
+var cpuProfile string
+var memProfile string
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	seed.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().IntVar(&numTaxa, "taxa", 100, "")
+	c.Flags().IntVar(&numPoints, "points", 20, "")
+	c.Flags().Float64Var(&spread, "spread", 5, "")
+	c.Flags().IntVar(&equator, "equator", 360, "")
+	c.Flags().IntVar(&equator, "e", 360, "")
+	c.Flags().StringVar(&opsFlag, "ops", "write,read,index,kde,map", "")
+	c.Flags().IntVar(&repeat, "repeat", 3, "")
+	c.Flags().IntVar(&colsFlag, "columns", 720, "")
+	c.Flags().IntVar(&colsFlag, "c", 720, "")
+	c.Flags().StringVar(&cpuProfile, "cpuprofile", "", "")
+	c.Flags().StringVar(&memProfile, "memprofile", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// An Operation is a measured operation.
+type operation struct {
+	name string
+
+	// prepare is called before the measurements,
+	// and returns the number of items
+	// processed by the operation.
+	prepare func(coll *ranges.Collection) (int, error)
+
+	// run runs the operation once.
+	run func(coll *ranges.Collection) error
+}
+
+// A Result is the result of the measurement
+// of an operation.
+type result struct {
+	name  string
+	items int
+	times []time.Duration
+}
+
+func run(c *command.Command, args []string) error {
+	if numTaxa < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --taxa value %d", numTaxa))
+	}
+	if numPoints < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --points value %d", numPoints))
+	}
+	if spread <= 0 {
+		return c.UsageError(fmt.Sprintf("invalid --spread value %.6f", spread))
+	}
+	if equator < 2 {
+		return c.UsageError(fmt.Sprintf("invalid --equator value %d", equator))
+	}
+	if repeat < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --repeat value %d", repeat))
+	}
+	if colsFlag < 2 {
+		return c.UsageError(fmt.Sprintf("invalid --columns value %d", colsFlag))
+	}
+
+	var ops []operation
+	for _, nm := range strings.Split(opsFlag, ",") {
+		nm = strings.ToLower(strings.TrimSpace(nm))
+		if nm == "" {
+			continue
+		}
+		op, ok := operations[nm]
+		if !ok {
+			return c.UsageError(fmt.Sprintf("invalid operation %q", nm))
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return c.UsageError("flag --ops without operations")
+	}
+
+	coll := synthetic(earth.NewPixelation(equator), seed.Rand())
+
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return fmt.Errorf("when writing %q: %v", cpuProfile, err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	var res []result
+	for _, op := range ops {
+		n, err := op.prepare(coll)
+		if err != nil {
+			return fmt.Errorf("operation %q: %v", op.name, err)
+		}
+		r := result{
+			name:  op.name,
+			items: n,
+		}
+		for i := 0; i < repeat; i++ {
+			runtime.GC()
+			start := time.Now()
+			if err := op.run(coll); err != nil {
+				return fmt.Errorf("operation %q: %v", op.name, err)
+			}
+			r.times = append(r.times, time.Since(start))
+		}
+		res = append(res, r)
+	}
+
+	if memProfile != "" {
+		if err := writeMemProfile(memProfile); err != nil {
+			return err
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return writeResults(w, res)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+var operations = map[string]operation{
+	"write": {
+		name:    "write",
+		prepare: numPixels,
+		run: func(coll *ranges.Collection) error {
+			return coll.TSV(io.Discard)
+		},
+	},
+	"read": {
+		name: "read",
+		prepare: func(coll *ranges.Collection) (int, error) {
+			tsvData.Reset()
+			if err := coll.TSV(&tsvData); err != nil {
+				return 0, err
+			}
+			return numPixels(coll)
+		},
+		run: func(coll *ranges.Collection) error {
+			_, err := ranges.ReadTSV(bytes.NewReader(tsvData.Bytes()), coll.Pixelation())
+			return err
+		},
+	},
+	"index": {
+		name:    "index",
+		prepare: numTaxonItems,
+		run: func(coll *ranges.Collection) error {
+			var buf bytes.Buffer
+			if err := coll.WriteIndex(&buf); err != nil {
+				return err
+			}
+			ix, err := ranges.ParseIndexed(buf.Bytes(), coll.Pixelation())
+			if err != nil {
+				return err
+			}
+			for _, tax := range ix.Taxa() {
+				r := ix.Pixels(tax)
+				for i := 0; i < r.Len(); i++ {
+					r.Density(i)
+				}
+			}
+			return nil
+		},
+	},
+	"kde": {
+		name: "kde",
+		prepare: func(coll *ranges.Collection) (int, error) {
+			pix := coll.Pixelation()
+			landPix = model.NewTimePix(pix)
+			for px := 0; px < pix.Len(); px++ {
+				landPix.Set(0, px, 1)
+			}
+			return numTaxonItems(coll)
+		},
+		run: func(coll *ranges.Collection) error {
+			pix := coll.Pixelation()
+			n := dist.NewNormal(kde.DefaultLambda(pix), pix)
+			for _, tax := range coll.Taxa() {
+				if _, err := kde.Normal(context.Background(), n, coll.Range(tax), landPix, 0, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	"map": {
+		name:    "map",
+		prepare: numTaxonItems,
+		run: func(coll *ranges.Collection) error {
+			m := render.New(coll.Pixelation(), render.Global(colsFlag))
+			m.UseGrid()
+			for _, tax := range coll.Taxa() {
+				m.SetRange(coll.Range(tax))
+				if err := render.EncodePNG(context.Background(), io.Discard, m); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// TsvData is the encoded collection
+// used by the read operation.
+var tsvData bytes.Buffer
+
+// LandPix is the time pixelation
+// used by the kde operation.
+var landPix *model.TimePix
+
+func numPixels(coll *ranges.Collection) (int, error) {
+	var n int
+	for _, tax := range coll.Taxa() {
+		n += len(coll.Range(tax))
+	}
+	return n, nil
+}
+
+func numTaxonItems(coll *ranges.Collection) (int, error) {
+	return len(coll.Taxa()), nil
+}
+
+// Synthetic returns a synthetic collection
+// of point ranges.
+func synthetic(pix *earth.Pixelation, rnd *rand.Rand) *ranges.Collection {
+	coll := ranges.New(pix)
+	for i := 0; i < numTaxa; i++ {
+		name := fmt.Sprintf("Taxon%06d synthetic", i+1)
+
+		// uniform point on the sphere
+		lat := earth.ToDegree(math.Asin(2*rnd.Float64() - 1))
+		lon := rnd.Float64()*360 - 180
+		for j := 0; j < numPoints; j++ {
+			pLat := lat + rnd.NormFloat64()*spread
+			if pLat > 90 {
+				pLat = 180 - pLat
+			}
+			if pLat < -90 {
+				pLat = -180 - pLat
+			}
+			pLon := lon + rnd.NormFloat64()*spread
+			for pLon > 180 {
+				pLon -= 360
+			}
+			for pLon < -180 {
+				pLon += 360
+			}
+			coll.Add(name, 0, pLat, pLon)
+		}
+	}
+	return coll
+}
+
+func writeMemProfile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("when writing %q: %v", name, err)
+	}
+	return f.Close()
+}
+
+func writeResults(w io.Writer, res []result) error {
+	bw := bufio.NewWriter(w)
+	version := "(unknown)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+	fmt.Fprintf(bw, "# taxrange bench\n")
+	fmt.Fprintf(bw, "# version: %s\n", version)
+	fmt.Fprintf(bw, "# go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(bw, "# cpus: %d\n", runtime.NumCPU())
+	fmt.Fprintf(bw, "# taxa: %d points: %d spread: %.6f equator: %d seed: %d\n", numTaxa, numPoints, spread, equator, seed.Seed())
+	fmt.Fprintf(bw, "operation\titems\tbest\tmean\trate\n")
+	for _, r := range res {
+		best := r.times[0]
+		var sum time.Duration
+		for _, t := range r.times {
+			if t < best {
+				best = t
+			}
+			sum += t
+		}
+		mean := sum / time.Duration(len(r.times))
+		rate := math.Inf(1)
+		if best > 0 {
+			rate = float64(r.items) / best.Seconds()
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%.6f\t%.6f\t%.3f\n", r.name, r.items, best.Seconds(), mean.Seconds(), rate)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
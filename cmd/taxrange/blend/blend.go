@@ -0,0 +1,232 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package blend implements a command to blend
+// expert range maps with occurrence data.
+package blend
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `blend [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--expert <rng-file> [--mode <mode>]
+	[--bandwidth <value>] [--weight <value>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "blend expert range maps with occurrence data",
+	Long: `
+Command blend reads a geographic range file with occurrence data (points, or
+continuous ranges, for example, the output of the command kde), and a range
+file with expert range maps, and blends them to produce the final range maps.
+
+The argument of the command is the name of the range file with the occurrence
+data. If no file is given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --expert is required, and defines the range file with the expert
+range maps (for example, a file imported with the command imp.polygon). The
+extent of an expert range is the set of pixels with a density larger than 0.
+Both files must use the same pixelation.
+
+The flag --mode defines how the ranges are blended. Valid modes are:
+
+	boost  keep the extent of the expert range, and boost the densities
+	       near the occurrences. This is the default.
+	clip   clip the occurrence ranges to the extent of the expert range.
+
+In the "boost" mode, the density of each pixel of the expert range is a
+weighted mean of the expert density and a normal kernel of the distance to
+the nearest occurrence of the taxon:
+
+	(1 - weight) * expert + weight * exp(-0.5 * (distance / bandwidth)^2)
+
+The bandwidth (in km) is defined with the flag --bandwidth (by default, 100
+km), and the weight with the flag --weight (by default, 0.5). The resulting
+densities are scaled, so the maximum density of each range is 1. Occurrences
+outside the expert range are ignored, and reported as a warning. The output
+contains the ranges of all the taxa in the expert file. Taxa with occurrences
+but without an expert range are reported as a warning and ignored.
+
+In the "clip" mode, the pixels of the occurrence ranges outside the extent of
+the expert range of the taxon are removed. For points ranges, the record
+counts of the remaining pixels are preserved, and for continuous ranges, the
+densities are scaled, so the maximum density of each range is 1. The output
+contains the ranges of all the taxa in the occurrence file. Taxa without an
+expert range are reported as a warning, and their ranges are not modified.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var expertFile string
+var modeFlag string
+var bandwidth float64
+var weight float64
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&expertFile, "expert", "", "")
+	c.Flags().StringVar(&modeFlag, "mode", "boost", "")
+	c.Flags().Float64Var(&bandwidth, "bandwidth", 100, "")
+	c.Flags().Float64Var(&weight, "weight", 0.5, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if expertFile == "" {
+		return c.UsageError("flag --expert required")
+	}
+	if modeFlag != "boost" && modeFlag != "clip" {
+		return c.UsageError(fmt.Sprintf("invalid --mode value %q", modeFlag))
+	}
+	if bandwidth <= 0 {
+		return c.UsageError(fmt.Sprintf("invalid --bandwidth value %.6f", bandwidth))
+	}
+	if weight < 0 || weight > 1 {
+		return c.UsageError(fmt.Sprintf("invalid --weight value %.6f", weight))
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	occ, err := readCollection(c.Stdin(), input, nil)
+	if err != nil {
+		return err
+	}
+	expert, err := readCollection(nil, expertFile, occ.Pixelation())
+	if err != nil {
+		return err
+	}
+
+	out := occ
+	if modeFlag == "boost" {
+		out = expert
+		pix := expert.Pixelation()
+		for _, tax := range occ.Taxa() {
+			if !expert.HasTaxon(tax) {
+				log.Warn("taxon without expert range", "taxon", tax)
+			}
+		}
+		for _, tax := range expert.Taxa() {
+			ext := expert.Range(tax)
+			pts := occ.Range(tax)
+			var outside int
+			for px := range pts {
+				if ext[px] <= 0 {
+					outside++
+				}
+			}
+			if outside > 0 {
+				log.Warn("occurrences outside expert range", "taxon", tax, "pixels", outside)
+			}
+			rng := ranges.Blend(pix, ext, pts, bandwidth, weight)
+			expert.Set(expert.VerbatimName(tax), expert.Age(tax), rng)
+			log.Debug("taxon blended", "taxon", tax, "occurrences", len(pts)-outside)
+		}
+	} else {
+		for _, tax := range occ.Taxa() {
+			if !expert.HasTaxon(tax) {
+				log.Warn("taxon without expert range", "taxon", tax)
+				continue
+			}
+			rng := occ.Range(tax)
+			clip := ranges.Clip(rng, expert.Range(tax))
+			if len(clip) == 0 {
+				log.Warn("empty range after clip", "taxon", tax)
+				occ.Delete(tax)
+				continue
+			}
+			log.Debug("taxon clipped", "taxon", tax, "removed", len(rng)-len(clip))
+			if occ.Type(tax) == ranges.Points {
+				for px := range rng {
+					if _, ok := clip[px]; !ok {
+						occ.RemovePixel(tax, px)
+					}
+				}
+				continue
+			}
+			occ.Set(occ.VerbatimName(tax), occ.Age(tax), clip)
+		}
+	}
+
+	out.KeepVerbatim(verbatimFlag)
+	outformat.Set(out)
+	summary.Written(len(out.Taxa()))
+	return files.Output(c.Stdout(), output, out.TSV)
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package cache implements a command to manage
+// the local cache of downloaded files.
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+)
+
+var Command = &command.Command{
+	Usage: `cache [--quiet | -v | -vv] [--log-json]
+	[--path] [--clear] [--rm] [<url>...]`,
+	Short: "manage the cache of downloaded files",
+	Long: `
+Command cache manages the local cache of files downloaded from URLs (range
+files, time pixelations, plate motion models, etc.).
+
+When a command reads a file from an URL, the file is downloaded once and
+stored in the cache, and later reads of the same URL use the cached file. By
+default, the cache is the directory "taxrange" in the user cache directory
+(for example "~/.cache/taxrange"). Use the environment variable TAXRANGE_CACHE
+to set a different directory, or set it to "off" to disable the cache.
+
+The files are stored by the SHA-256 hash of their content. An URL can be
+pinned to a particular content by adding the fragment "#sha256=<hash>" to the
+URL, for example:
+
+	taxrange kde --timepix https://example.org/tp.tab#sha256=<hash> ranges.tab
+
+A pinned file is read from the cache if a file with the same hash was already
+downloaded (even from a different URL), and a download with a different hash
+is an error, so the same data is always used.
+
+Without arguments, the command prints the cached URLs, with the hash of the
+content, its size (in bytes), and the date in which it was downloaded. If one
+or more URLs are given, they are downloaded into the cache (replacing any
+previous content of the URL), and the hash of their content is printed, so it
+can be used to pin them.
+
+If the flag --rm is defined, the indicated URLs will be removed from the
+cache. If the flag --clear is defined, all the files of the cache will be
+removed. If the flag --path is defined, the directory of the cache will be
+printed.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+	`,
+	SetFlags: setFlags,
+	Run:      run,
+}
+
+var pathFlag bool
+var clearFlag bool
+var rmFlag bool
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	c.Flags().BoolVar(&pathFlag, "path", false, "")
+	c.Flags().BoolVar(&clearFlag, "clear", false, "")
+	c.Flags().BoolVar(&rmFlag, "rm", false, "")
+}
+
+func run(c *command.Command, args []string) error {
+	if pathFlag {
+		dir, err := files.CacheDir()
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			dir = "off"
+		}
+		fmt.Fprintf(c.Stdout(), "%s\n", dir)
+		return nil
+	}
+
+	if clearFlag {
+		return files.CacheClear()
+	}
+
+	if rmFlag {
+		if len(args) == 0 {
+			return c.UsageError("expecting one or more URLs")
+		}
+		for _, a := range args {
+			if err := files.CacheRemove(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(args) > 0 {
+		for _, a := range args {
+			if !files.IsURL(a) {
+				return c.UsageError(fmt.Sprintf("invalid URL %q", a))
+			}
+			e, err := files.Fetch(a)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.Stdout(), "%s\t%s\n", e.Hash, e.URL)
+		}
+		return nil
+	}
+
+	ls, err := files.Cached()
+	if err != nil {
+		return err
+	}
+	for _, e := range ls {
+		fmt.Fprintf(c.Stdout(), "%s\t%d\t%s\t%s\n", e.Hash, e.Size, e.Time.Format(time.DateOnly), e.URL)
+	}
+	return nil
+}
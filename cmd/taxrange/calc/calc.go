@@ -0,0 +1,306 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package calc implements a command to combine
+// range maps using arithmetic expressions.
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/script"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `calc [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--introduced <mode>] [--transform <expression>]
+	[--force] [-o|--output <file>] <expression> <name>=<rng-file>...`,
+	Short: "combine range maps with an arithmetic expression",
+	Long: `
+Command calc reads one or more geographic range files, and produces a new
+range file, in which the range of each taxon is the result of an arithmetic
+expression.
+
+The first argument is the expression. The other arguments bind the variables
+used in the expression to range files, in the form <name>=<rng-file>. For
+example:
+
+	taxrange calc "kde * prior / bias" kde=kde.tab prior=prior.tab bias=bias.tab
+
+All range files must use the same pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+An expression accepts the operators +, -, *, and /, parenthesis, numbers
+(that can use scientific notation, as in 2.5e-3), and the following
+functions:
+
+	- norm(x)	scales the values so the maximum value will be 1
+
+When both operands are range maps, the sum and the difference include all the
+pixels of both maps, the product only includes the pixels present in both
+maps, and the division only includes the pixels of the first map with a
+non-zero value in the second map. When an operand is a number, the operation
+is applied to each pixel of the range map. If an operation produces a value
+that is not a finite number (for example, a division by 0), the command ends
+with an error.
+
+The expression is evaluated for each taxon in the file of the first variable
+of the expression. For other variables, the range of the same taxon is used,
+or if the file has a single taxon, the range of that taxon is used for all
+taxa (for example, a sampling bias surface). Taxa without a range in any
+variable will be ignored. In the result, pixels with a value smaller or equal
+to 0 are removed, and the values are scaled so the maximum value will be 1.
+The resulting ranges have the age of the taxon in the first variable.
+
+Use the flag --transform to define an expression that will be applied to each
+pixel of the result, before removing the pixels with a value smaller or equal
+to 0. The expression can use the following variables:
+
+	value		the value of the pixel
+	pixel		the ID of the pixel
+	lat		the latitude of the center of the pixel
+	lon		the longitude of the center of the pixel
+	area		the area of the pixel (in km²)
+	age		the age of the taxon (in million years)
+
+For example, the following expression removes the pixels with a value smaller
+than 0.1, and the pixels in the southern hemisphere:
+
+	--transform "if(value >= 0.1 && lat >= 0, value, 0)"
+
+A transform expression accepts numbers, the operators +, -, *, /, ==, !=, <,
+<=, >, >=, && (and), || (or), and ! (not), parenthesis, and the functions
+abs, exp, if, log, max, min, pow, and sqrt. Comparisons and logical operators
+return 1 if they are true, and 0 otherwise. If the transform produces a value
+that is not a finite number, the command ends with an error. If the flag value
+starts with '@', the expression will be read from the indicated file (in which
+lines starting with '#' are ignored).
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is
+an error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var verbatimFlag bool
+var transformFlag string
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&transformFlag, "transform", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting an expression and a range file")
+	}
+	log := logger.New(c.Stderr())
+
+	expr, vars, err := parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid expression %q: %v", args[0], err)
+	}
+	if len(vars) == 0 {
+		return fmt.Errorf("invalid expression %q: without variables", args[0])
+	}
+	var transform *script.Expr
+	if transformFlag != "" {
+		transform, err = script.Read(transformFlag)
+		if err != nil {
+			return c.UsageError(fmt.Sprintf("flag --transform: %v", err))
+		}
+		if err := transform.Check(transformVars...); err != nil {
+			return c.UsageError(fmt.Sprintf("flag --transform: %v", err))
+		}
+	}
+
+	var pix *earth.Pixelation
+	colls := make(map[string]*ranges.Collection)
+	for _, a := range args[1:] {
+		name, file, ok := strings.Cut(a, "=")
+		if !ok || name == "" || file == "" {
+			return c.UsageError(fmt.Sprintf("invalid variable definition %q", a))
+		}
+		if _, dup := colls[name]; dup {
+			return c.UsageError(fmt.Sprintf("variable %q defined twice", name))
+		}
+		coll, err := readCollection(c.Stdin(), file, pix)
+		if err != nil {
+			return err
+		}
+		pix = coll.Pixelation()
+		colls[name] = coll
+	}
+	for _, v := range vars {
+		if _, ok := colls[v]; !ok {
+			return fmt.Errorf("variable %q undefined", v)
+		}
+	}
+
+	first := colls[vars[0]]
+	out := ranges.New(pix)
+	for _, tax := range first.TaxaBy(ranges.InputOrder) {
+		e := func(name string) (map[int]float64, error) {
+			coll := colls[name]
+			if coll.HasTaxon(tax) {
+				return coll.Range(tax), nil
+			}
+			if t := coll.Taxa(); len(t) == 1 {
+				return coll.Range(t[0]), nil
+			}
+			return nil, fmt.Errorf("variable %q: taxon %q not found", name, tax)
+		}
+		v, err := eval(expr, e)
+		if errors.Is(err, errNonFinite) {
+			return fmt.Errorf("invalid expression %q: taxon %q: %v", args[0], tax, err)
+		}
+		if err != nil {
+			log.Warn("taxon ignored", "taxon", tax, "error", err)
+			continue
+		}
+		if v.isNum {
+			return fmt.Errorf("invalid expression %q: result is not a range map", args[0])
+		}
+
+		rng := make(map[int]float64, len(v.rng))
+		for px, p := range v.rng {
+			if transform != nil {
+				var err error
+				p, err = transformPixel(transform, pix, px, p, first.Age(tax))
+				if err != nil {
+					return fmt.Errorf("flag --transform: taxon %q: pixel %d: %v", tax, px, err)
+				}
+			}
+			if p <= 0 {
+				continue
+			}
+			rng[px] = p
+		}
+		if len(rng) == 0 {
+			log.Warn("empty range", "taxon", tax)
+			continue
+		}
+		out.Set(first.VerbatimName(tax), first.Age(tax), rng)
+		log.Debug("range calculated", "taxon", tax, "pixels", len(rng))
+	}
+
+	out.KeepVerbatim(verbatimFlag)
+	outformat.Set(out)
+	summary.Written(len(out.Taxa()))
+	return files.Output(c.Stdout(), output, out.TSV)
+}
+
+// TransformVars are the variables
+// accepted in a transform expression.
+var transformVars = []string{
+	"value",
+	"pixel",
+	"lat",
+	"lon",
+	"area",
+	"age",
+}
+
+// TransformPixel returns the value of a pixel
+// after applying a transform expression.
+// If the result is not a finite number,
+// it returns an error.
+func transformPixel(e *script.Expr, pix *earth.Pixelation, px int, v float64, age int64) (float64, error) {
+	env := func(name string) script.Value {
+		switch name {
+		case "value":
+			return script.Num(v)
+		case "pixel":
+			return script.Num(float64(px))
+		case "lat":
+			return script.Num(pix.ID(px).Point().Latitude())
+		case "lon":
+			return script.Num(pix.ID(px).Point().Longitude())
+		case "area":
+			return script.Num(ranges.PixelArea(pix, px))
+		case "age":
+			return script.Num(float64(age) / millionYears)
+		}
+		return script.Num(math.NaN())
+	}
+	r := e.Eval(env).Float()
+	if !isFinite(r) {
+		return 0, fmt.Errorf("result %g: %w", r, errNonFinite)
+	}
+	return r, nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
@@ -0,0 +1,182 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/script"
+)
+
+// A Value is the result of an expression,
+// either a number
+// or a range map.
+type value struct {
+	rng   map[int]float64
+	num   float64
+	isNum bool
+}
+
+// An Env returns the range map of a variable.
+type env func(name string) (map[int]float64, error)
+
+// ErrNonFinite is returned
+// when an operation produces a value
+// that is not a finite number
+// (for example, a division by 0).
+var errNonFinite = errors.New("value is not a finite number")
+
+// Functions are the functions
+// accepted in an expression,
+// with their number of arguments.
+var functions = map[string]int{
+	"norm": 1,
+}
+
+// Parse parses an expression
+// and returns the root node,
+// and the variables used in the expression
+// in the order in which they are found.
+func parse(src string) (*script.Node, []string, error) {
+	n, vars, err := script.ParseTree(src, functions)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := check(n); err != nil {
+		return nil, nil, err
+	}
+	return n, vars, nil
+}
+
+// Check returns an error
+// if a node uses an element
+// not accepted in a range map expression.
+func check(n *script.Node) error {
+	switch n.Op {
+	case "num", "var", "call", "neg", "+", "-", "*", "/":
+	case "str":
+		return fmt.Errorf("at position %d: unexpected string", n.Pos)
+	default:
+		return fmt.Errorf("at position %d: unexpected operator %q", n.Pos, n.Op)
+	}
+	for _, a := range n.Args {
+		if err := check(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Eval evaluates a node of an expression.
+func eval(n *script.Node, e env) (value, error) {
+	switch n.Op {
+	case "num":
+		return value{num: n.Num, isNum: true}, nil
+	case "var":
+		rng, err := e(n.Name)
+		if err != nil {
+			return value{}, err
+		}
+		return value{rng: rng}, nil
+	case "call":
+		v, err := eval(n.Args[0], e)
+		if err != nil {
+			return value{}, err
+		}
+		if v.isNum {
+			return value{}, fmt.Errorf("function %s: expecting a range map", n.Name)
+		}
+		return value{rng: ranges.Norm(v.rng)}, nil
+	case "neg":
+		r, err := eval(n.Args[0], e)
+		if err != nil {
+			return value{}, err
+		}
+		return binary('-', value{isNum: true}, r, n.Pos)
+	}
+
+	l, err := eval(n.Args[0], e)
+	if err != nil {
+		return value{}, err
+	}
+	r, err := eval(n.Args[1], e)
+	if err != nil {
+		return value{}, err
+	}
+	return binary(n.Op[0], l, r, n.Pos)
+}
+
+// Binary applies an arithmetic operator.
+// It returns an error
+// if the result is not a finite number.
+func binary(op byte, l, r value, pos int) (value, error) {
+	var v value
+	switch {
+	case l.isNum && r.isNum:
+		v = value{num: apply(op, l.num, r.num), isNum: true}
+	case r.isNum:
+		rng := make(map[int]float64, len(l.rng))
+		for px, p := range l.rng {
+			rng[px] = apply(op, p, r.num)
+		}
+		v = value{rng: rng}
+	case l.isNum:
+		rng := make(map[int]float64, len(r.rng))
+		for px, p := range r.rng {
+			if op == '/' && p == 0 {
+				continue
+			}
+			rng[px] = apply(op, l.num, p)
+		}
+		v = value{rng: rng}
+	default:
+		switch op {
+		case '+':
+			v = value{rng: ranges.Sum(l.rng, r.rng)}
+		case '-':
+			neg := make(map[int]float64, len(r.rng))
+			for px, p := range r.rng {
+				neg[px] = -p
+			}
+			v = value{rng: ranges.Sum(l.rng, neg)}
+		case '*':
+			v = value{rng: ranges.Mul(l.rng, r.rng)}
+		default:
+			v = value{rng: ranges.Div(l.rng, r.rng)}
+		}
+	}
+
+	if v.isNum {
+		if !isFinite(v.num) {
+			return value{}, fmt.Errorf("at position %d: operator %q: %w", pos, op, errNonFinite)
+		}
+		return v, nil
+	}
+	for px, p := range v.rng {
+		if !isFinite(p) {
+			return value{}, fmt.Errorf("at position %d: operator %q: pixel %d: %w", pos, op, px, errNonFinite)
+		}
+	}
+	return v, nil
+}
+
+func apply(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	}
+	return a / b
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
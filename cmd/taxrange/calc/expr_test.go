@@ -0,0 +1,127 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		src  string
+		vars []string
+		err  bool
+	}{
+		"product":          {src: "kde * prior / bias", vars: []string{"kde", "prior", "bias"}},
+		"case":             {src: "Kde + kde", vars: []string{"Kde", "kde"}},
+		"repeated":         {src: "a * a", vars: []string{"a"}},
+		"function":         {src: "NORM(a) * 1e-3", vars: []string{"a"}},
+		"negation":         {src: "-(a - b)", vars: []string{"a", "b"}},
+		"unknown function": {src: "sqrt(a)", err: true},
+		"comparison":       {src: "a > 0", err: true},
+		"logical":          {src: "a && b", err: true},
+		"not":              {src: "!a", err: true},
+		"string":           {src: `a * "2"`, err: true},
+		"unexpected end":   {src: "a *", err: true},
+		"arguments":        {src: "norm(a, b)", err: true},
+	}
+
+	for name, test := range tests {
+		_, vars, err := parse(test.src)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: %q: expecting error", name, test.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %q: unexpected error: %v", name, test.src, err)
+			continue
+		}
+		if !slices.Equal(vars, test.vars) {
+			t.Errorf("%s: %q: variables: got %v, want %v", name, test.src, vars, test.vars)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	vars := map[string]map[int]float64{
+		"a": {1: 1, 2: 2, 3: 4},
+		"b": {2: 1, 3: 0, 4: 2},
+	}
+	e := func(name string) (map[int]float64, error) {
+		rng, ok := vars[name]
+		if !ok {
+			return nil, fmt.Errorf("variable %q undefined", name)
+		}
+		return rng, nil
+	}
+
+	tests := map[string]struct {
+		src       string
+		rng       map[int]float64
+		num       float64
+		isNum     bool
+		nonFinite bool
+		err       bool
+	}{
+		"number":        {src: "2.5e1 - 5", num: 20, isNum: true},
+		"scale":         {src: "a * 2", rng: map[int]float64{1: 2, 2: 4, 3: 8}},
+		"negation":      {src: "-a", rng: map[int]float64{1: -1, 2: -2, 3: -4}},
+		"sum":           {src: "a + b", rng: map[int]float64{1: 1, 2: 3, 3: 4, 4: 2}},
+		"difference":    {src: "a - b", rng: map[int]float64{1: 1, 2: 1, 3: 4, 4: -2}},
+		"product":       {src: "a * b", rng: map[int]float64{2: 2}},
+		"division":      {src: "a / b", rng: map[int]float64{2: 2}},
+		"inverse":       {src: "1 / b", rng: map[int]float64{2: 1, 4: 0.5}},
+		"norm":          {src: "norm(a)", rng: map[int]float64{1: 0.25, 2: 0.5, 3: 1}},
+		"zero number":   {src: "1 / 0", nonFinite: true},
+		"zero division": {src: "a / 0", nonFinite: true},
+		"zero literal":  {src: "a / (2 - 2)", nonFinite: true},
+		"overflow":      {src: "a * 1e308 * 10", nonFinite: true},
+		"undefined":     {src: "a * c", err: true},
+		"norm number":   {src: "norm(2)", err: true},
+	}
+
+	for name, test := range tests {
+		n, _, err := parse(test.src)
+		if err != nil {
+			t.Errorf("%s: %q: unexpected error: %v", name, test.src, err)
+			continue
+		}
+		v, err := eval(n, e)
+		if test.nonFinite || test.err {
+			if err == nil {
+				t.Errorf("%s: %q: expecting error", name, test.src)
+				continue
+			}
+			if got := errors.Is(err, errNonFinite); got != test.nonFinite {
+				t.Errorf("%s: %q: error %q: non-finite %v, want %v", name, test.src, err, got, test.nonFinite)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %q: unexpected error: %v", name, test.src, err)
+			continue
+		}
+		if v.isNum != test.isNum {
+			t.Errorf("%s: %q: got number %v, want %v", name, test.src, v.isNum, test.isNum)
+			continue
+		}
+		if v.isNum {
+			if v.num != test.num {
+				t.Errorf("%s: %q: got %g, want %g", name, test.src, v.num, test.num)
+			}
+			continue
+		}
+		if !maps.EqualFunc(v.rng, test.rng, func(x, y float64) bool { return math.Abs(x-y) < 1e-12 }) {
+			t.Errorf("%s: %q: got %v, want %v", name, test.src, v.rng, test.rng)
+		}
+	}
+}
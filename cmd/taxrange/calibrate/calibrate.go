@@ -0,0 +1,315 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package calibrate implements a command to calibrate
+// the densities of range maps
+// against independent presence-absence data.
+package calibrate
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/plot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/presence"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/table"
+)
+
+var Command = &command.Command{
+	Usage: `calibrate [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--test <file> [--bins <number>]
+	[--reliability <file>] [--format <format>] [--diagram <file>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "calibrate range densities with presence-absence data",
+	Long: `
+Command calibrate reads a geographic range file with continuous ranges (for
+example, the output of the command kde), and a file with independent
+presence-absence observations, and calibrates the densities of the ranges, so
+they can be interpreted as probabilities of presence.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The flag --test is required, and defines a tab-delimited file with the
+observations. The file must have the following fields: "taxon" (or
+"species"), "latitude", "longitude", and "presence". Valid values for the
+presence field are "1", "true", or "present" for a presence, and "0",
+"false", or "absent" for an absence. For example:
+
+	taxon	latitude	longitude	presence
+	Aus bus	10.5	10.25	1
+	Aus bus	-20.0	45.0	0
+
+The observations should be independent of the data used to build the ranges.
+The density of each observation is the density of the range of the taxon at
+the pixel of the observation (or 0, if the pixel is outside the range).
+Observations of taxa not in the range file, or of taxa without a continuous
+range, are ignored.
+
+The calibration function is estimated with an isotonic regression of the
+observed presences on the densities, pooling the observations of all taxa.
+The isotonic regression is the best fit to the observations that preserves
+the order of the densities, so a pixel with a higher density has an equal or
+higher calibrated probability. Densities between the fitted values are
+interpolated. The densities of all the continuous ranges are replaced with
+the calibrated probabilities, and the pixels with a probability of 0 are
+removed. As the probabilities are not scaled, the maximum value of a range
+can be smaller than 1. Ranges of points are not modified.
+
+If the flag --reliability is defined, a reliability table will be written in
+the indicated file. The observations are grouped in bins by their density,
+and for each bin the table has the following columns:
+
+	lower		the lower bound of the bin
+	upper		the upper bound of the bin
+	observations	the number of observations in the bin
+	density		the mean density of the observations
+	observed	the frequency of presences in the bin
+	calibrated	the mean calibrated probability of the observations
+
+In a well calibrated range, the mean density of each bin is similar to the
+observed frequency of presences. By default, 10 bins of the same width are
+used. Use the flag --bins to define a different number of bins. By default
+the table is a tab-delimited table. Use the flag --format to define a
+different format: "markdown" for a Markdown table, or "latex" for a LaTeX
+tabular environment. If the flag --diagram is defined, a reliability diagram,
+with the observed frequency of presences of each bin, will be written in the
+indicated file, as an SVG image if the file has the ".svg" extension, or as a
+PNG image otherwise.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages (for
+example, the Brier score of the observations before and after the
+calibration), or -vv to report debug messages. If the flag --log-json is
+defined, messages will be written as JSON lines.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var testFile string
+var binsFlag int
+var reliabilityFile string
+var diagramFile string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	table.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&testFile, "test", "", "")
+	c.Flags().IntVar(&binsFlag, "bins", 10, "")
+	c.Flags().StringVar(&reliabilityFile, "reliability", "", "")
+	c.Flags().StringVar(&diagramFile, "diagram", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if testFile == "" {
+		return c.UsageError("flag --test required")
+	}
+	if binsFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --bins value %d", binsFlag))
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+
+	obs, err := readObservations(testFile, coll, log)
+	if err != nil {
+		return err
+	}
+	if len(obs) == 0 {
+		return fmt.Errorf("on file %q: no observations for the taxa in %q", testFile, input)
+	}
+	cal, err := ranges.Calibrate(obs)
+	if err != nil {
+		return err
+	}
+
+	calObs := make([]ranges.Observation, len(obs))
+	for i, o := range obs {
+		calObs[i] = ranges.Observation{
+			Density:  cal.Prob(o.Density),
+			Presence: o.Presence,
+		}
+	}
+	log.Info("calibration", "observations", len(obs), "brier-score", ranges.BrierScore(obs), "calibrated-score", ranges.BrierScore(calObs))
+
+	for _, tax := range coll.Taxa() {
+		if !coll.ApplyCalibration(tax, cal) {
+			continue
+		}
+		if len(coll.Range(tax)) == 0 {
+			log.Warn("empty range after calibration", "taxon", tax)
+			coll.Delete(tax)
+			continue
+		}
+		log.Debug("taxon calibrated", "taxon", tax, "pixels", len(coll.Range(tax)))
+	}
+
+	bins := ranges.Reliability(obs, binsFlag)
+	if reliabilityFile != "" {
+		if err := writeReliability(reliabilityFile, bins, obs, calObs); err != nil {
+			return err
+		}
+	}
+	if diagramFile != "" {
+		if err := writeDiagram(diagramFile, bins); err != nil {
+			return err
+		}
+	}
+
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readObservations(name string, coll *ranges.Collection, log *slog.Logger) ([]ranges.Observation, error) {
+	po, err := presence.Read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pix := coll.Pixelation()
+	ignored := make(map[string]bool)
+	var obs []ranges.Observation
+	for _, o := range po {
+		if !coll.HasTaxon(o.Taxon) || coll.Type(o.Taxon) != ranges.Range {
+			if !ignored[strings.ToLower(o.Taxon)] {
+				log.Warn("observations ignored", "taxon", o.Taxon)
+				ignored[strings.ToLower(o.Taxon)] = true
+			}
+			continue
+		}
+
+		px := pix.Pixel(o.Lat, o.Lon).ID()
+		obs = append(obs, ranges.Observation{
+			Density:  coll.Range(o.Taxon)[px],
+			Presence: o.Presence,
+		})
+	}
+	return obs, nil
+}
+
+func writeReliability(name string, bins []ranges.ReliabilityBin, obs, calObs []ranges.Observation) error {
+	// mean calibrated probability
+	// of the observations of each bin
+	cal := make([]float64, len(bins))
+	for i, o := range obs {
+		b := int(o.Density * float64(len(bins)))
+		if b < 0 {
+			b = 0
+		}
+		if b >= len(bins) {
+			b = len(bins) - 1
+		}
+		cal[b] += calObs[i].Density
+	}
+
+	tab := table.New("lower", "upper", "observations", "density", "observed", "calibrated")
+	for i, b := range bins {
+		if b.N > 0 {
+			cal[i] /= float64(b.N)
+		}
+		tab.Add(
+			strconv.FormatFloat(b.Lower, 'f', 3, 64),
+			strconv.FormatFloat(b.Upper, 'f', 3, 64),
+			strconv.Itoa(b.N),
+			strconv.FormatFloat(b.Mean, 'f', 6, 64),
+			strconv.FormatFloat(b.Freq, 'f', 6, 64),
+			strconv.FormatFloat(cal[i], 'f', 6, 64),
+		)
+	}
+	return files.WriteFile(name, tab.Write)
+}
+
+func writeDiagram(name string, bins []ranges.ReliabilityBin) error {
+	ch := plot.Chart{
+		Title:  "Reliability",
+		XLabel: "density",
+		YLabel: "observed frequency",
+	}
+	for _, b := range bins {
+		ch.Bars = append(ch.Bars, plot.Bar{
+			Label: strconv.FormatFloat(b.Upper, 'f', -1, 64),
+			Value: b.Freq,
+		})
+	}
+
+	write := ch.WritePNG
+	if strings.EqualFold(filepath.Ext(name), ".svg") {
+		write = ch.WriteSVG
+	}
+	return files.WriteFile(name, write)
+}
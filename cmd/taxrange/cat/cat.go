@@ -0,0 +1,150 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package cat implements a command to concatenate
+// range files.
+package cat
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `cat [--quiet | -v | -vv] [--log-json]
+	[--replace] [--verbatim]
+	[--json-summary <file>]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>...]`,
+	Short: "concatenate range files",
+	Long: `
+Command cat reads one or more geographic range files, and writes them as a
+single range file. It is the reverse of the command split.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. All range files must use the same
+pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+By default, it is an error if a taxon is defined in more than one file. If the
+flag --replace is defined, the range of a taxon will be replaced by the range
+in the last file in which the taxon is defined.
+
+Record counts, and any other column of the input files, are preserved.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var replaceFlag bool
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&replaceFlag, "replace", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	var out *ranges.Collection
+	var pix *earth.Pixelation
+	source := make(map[string]string)
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, pix)
+		if err != nil {
+			return err
+		}
+		if out == nil {
+			pix = coll.Pixelation()
+			out = ranges.New(pix)
+		}
+
+		for _, tax := range coll.Taxa() {
+			if prev, ok := source[tax]; ok && !replaceFlag {
+				return fmt.Errorf("taxon %q defined in %q and %q", tax, prev, a)
+			}
+			source[tax] = a
+			if err := out.Copy(coll, tax); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.KeepVerbatim(verbatimFlag)
+	outformat.Set(out)
+	summary.Written(len(out.Taxa()))
+	return files.Output(c.Stdout(), output, out.TSV)
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
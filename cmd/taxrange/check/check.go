@@ -0,0 +1,127 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package check implements a command to validate
+// a taxon range collection.
+package check
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `check [--quiet | -v | -vv] [--log-json]
+	[-e|--equator <value>]
+	[--json-summary <file>] [--force]
+	[<rng-file>...]`,
+	Short: "validate a collection of taxon ranges",
+	Long: `
+Command check reads one or more geographic range files, and reports any problem
+found in the ranges.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The following problems are reported:
+
+	pixel-out-of-range	a pixel ID not defined in the pixelation
+	invalid-density		a NaN, infinite, or negative density
+	empty-range		a taxon without pixels
+	duplicate-name		taxon names that only differ by invisible
+				characters
+	equator-mismatch	a pixelation different from the expected
+				pixelation
+	gridded-points		points of a taxon snapped to a regular
+				lattice (e.g. records from gridded data),
+				that should be treated as a range rather
+				than as points. It requires at least 10
+				points, and a lattice spacing of at least
+				twice the size of the pixels
+
+Use the flag --equator, or -e, to define the expected number of pixels at the
+equator of the pixelation. If no value is given, the pixelation of the range
+file will be accepted.
+
+The output is a tab-delimited table printed in the standard output, with the
+following columns:
+
+	file	the range file
+	taxon	the taxon with the problem (empty for the whole file)
+	issue	the kind of problem
+	pixel	the pixel ID with the problem (-1 if not applicable)
+	message	a description of the problem
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var equator int
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().IntVar(&equator, "equator", 0, "")
+	c.Flags().IntVar(&equator, "e", 0, "")
+}
+
+func run(c *command.Command, args []string) error {
+	var pix *earth.Pixelation
+	if equator > 0 {
+		pix = earth.NewPixelation(equator)
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\ttaxon\tissue\tpixel\tmessage\n")
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		if err := checkFile(c.Stdin(), c.Stdout(), a, pix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFile(r io.Reader, w io.Writer, name string, pix *earth.Pixelation) error {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	for _, i := range coll.Validate(pix) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", name, i.Taxon, i.Kind, i.Pixel, i.Msg)
+	}
+	return nil
+}
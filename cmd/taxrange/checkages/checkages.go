@@ -0,0 +1,261 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package checkages implements a command to check
+// that the ages of the taxa in a collection
+// are valid stages of a plate motion model
+// or a time pixelation.
+package checkages
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `check-ages [--quiet | -v | -vv] [--log-json]
+	[--model <motion-model> | --timepix <time-pixelation>]
+	[--json-summary <file>]
+	[--sort <order>] [--reproducible]
+	[--snap [--force] -o|--output <file>] [<rng-file>...]`,
+	Short: "check taxon ages against the stages of a model",
+	Long: `
+Command check-ages reads one or more geographic range files, and checks that
+the age of each taxon is one of the stages defined in a plate motion model, or
+a time pixelation.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Either the flag --model, that defines a pixelated plate motion model, or the
+flag --timepix, that defines a time pixelation, is required.
+
+The output is a tab-delimited table printed in the standard output, with the
+taxa with an age that is not a stage of the model. The table contains the
+following columns:
+
+	file	the range file that contains the taxon
+	taxon	the name of the taxon
+	age	the age of the taxon (in million years)
+	stage	the closest stage in the model (in million years)
+
+If the flag --snap is defined, the ages of the taxa will be set to the closest
+stage in the model, and the resulting ranges will be written in the file
+defined by the flag --output, or -o, which is required when --snap is used. If
+the output file exists, existing taxa will be replaced, and new taxa will be
+added to the indicated file, so the flag --force is not required to update
+it. The output file is only replaced after all the data was written, so if
+there is an error, the previous content of the file will be preserved.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var snapFlag bool
+var modelFile string
+var timepixFile string
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&snapFlag, "snap", false, "")
+	c.Flags().StringVar(&modelFile, "model", "", "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// A Stager is a model with a defined set of stages.
+type stager interface {
+	ClosestStageAge(age int64) int64
+	Stages() []int64
+}
+
+func run(c *command.Command, args []string) error {
+	if modelFile == "" && timepixFile == "" {
+		return c.UsageError("either --model or --timepix flags are required")
+	}
+	if modelFile != "" && timepixFile != "" {
+		return c.UsageError("both --model and --timepix flags defined")
+	}
+	if snapFlag && output == "" {
+		return c.UsageError("flag --output required when --snap is defined")
+	}
+	if snapFlag && output == "-" {
+		return c.UsageError("flag --output: the standard output is used by the table")
+	}
+
+	var st stager
+	if modelFile != "" {
+		tot, err := readRotation(modelFile)
+		if err != nil {
+			return err
+		}
+		st = tot
+	} else {
+		tp, err := readTimePix(timepixFile)
+		if err != nil {
+			return err
+		}
+		st = tp
+	}
+	stages := st.Stages()
+
+	var outColl *ranges.Collection
+	if snapFlag {
+		var err error
+		outColl, err = readOutColl(output)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\ttaxon\tage\tstage\n")
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a)
+		if err != nil {
+			return err
+		}
+		if a == "-" {
+			a = "stdin"
+		}
+		if outColl == nil {
+			outColl = ranges.New(coll.Pixelation())
+		}
+		if outColl.Pixelation().Equator() != coll.Pixelation().Equator() {
+			return fmt.Errorf("when reading %q: invalid pixelation: got %d pixels, want %d", a, coll.Pixelation().Equator(), outColl.Pixelation().Equator())
+		}
+
+		for _, tax := range coll.Taxa() {
+			age := coll.Age(tax)
+			stage := age
+			if _, ok := slices.BinarySearch(stages, age); !ok {
+				stage = st.ClosestStageAge(age)
+				fmt.Fprintf(c.Stdout(), "%s\t%s\t%.6f\t%.6f\n", a, tax, float64(age)/millionYears, float64(stage)/millionYears)
+			}
+			if !snapFlag {
+				continue
+			}
+
+			// the taxon is copied as is,
+			// so only its age is modified
+			if err := outColl.Copy(coll, tax); err != nil {
+				return err
+			}
+			outColl.SetAge(tax, stage)
+		}
+	}
+
+	if !snapFlag {
+		return nil
+	}
+	outformat.Set(outColl)
+	summary.Written(len(outColl.Taxa()))
+	return files.ReplaceFile(output, outColl.TSV)
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readOutColl(name string) (*ranges.Collection, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coll, err := ranges.ReadTSV(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+
+	return coll, nil
+}
+
+func readRotation(name string) (*model.Total, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rot, err := model.ReadTotal(f, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+
+	return rot, nil
+}
+
+func readTimePix(name string) (*model.TimePix, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tp, err := model.ReadTimePix(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return tp, nil
+}
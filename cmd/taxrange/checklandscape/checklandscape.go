@@ -0,0 +1,187 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package checklandscape implements a command to check
+// that the ranges of the taxa in a collection
+// are in the landscape of a time pixelation
+// at the age of each taxon.
+package checklandscape
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/landscape"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `check-landscape [--quiet | -v | -vv] [--log-json]
+	--timepix <time-pixelation> [--prior <prior-file>]
+	[--introduced <mode>]
+	[--json-summary <file>] [--force]
+	[--max <fraction>] [<rng-file>...]`,
+	Short: "check taxon ranges against a landscape",
+	Long: `
+Command check-landscape reads one or more geographic range files, and reports,
+for each taxon, the fraction of the pixels of its range that are outside the
+landscape at the age of the taxon, for example, terrestrial taxa with records
+in the ocean, or marine taxa with records in land. A large fraction of pixels
+outside the landscape usually indicates bad coordinates, or a bad rotation of
+the ranges.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --timepix, that defines a time pixelation, is required. The
+landscape is made of the pixels with a non-zero value in the time pixelation,
+at the stage closest to the age of the taxon. Prior probabilities for each
+pixel type can be defined on a file and read with the flag --prior (the same
+format used by the command kde), so the landscape is made of the pixels with a
+non-zero prior. The time pixelation must have the same pixelation as the
+range files.
+
+For ranges of "points" type, all occurrence pixels are checked. For ranges of
+"range" type, all pixels with a non-zero value are checked.
+
+The output is a tab-delimited table printed in the standard output, with the
+following columns:
+
+	file		the range file that contains the taxon
+	taxon		the name of the taxon
+	age		the age of the taxon (in million years)
+	stage		the stage of the time pixelation used to check the
+			taxon (in million years)
+	pixels		the number of pixels in the range of the taxon
+	outside		the number of pixels outside the landscape
+	fraction	the fraction of pixels outside the landscape
+
+Use the flag --max to define the maximum fraction of pixels outside the
+landscape accepted for a taxon. If any taxon has a larger fraction, the
+command will end with an error after the table is printed. By default, any
+fraction is accepted.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var maxFlag float64
+var timepixFile string
+var priorFile string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().Float64Var(&maxFlag, "max", 1, "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().StringVar(&priorFile, "prior", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if timepixFile == "" {
+		return c.UsageError("flag --timepix required")
+	}
+	if maxFlag < 0 || maxFlag > 1 {
+		return c.UsageError("flag --max must be a value between 0 and 1")
+	}
+
+	land, err := landscape.Read(timepixFile, priorFile, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\ttaxon\tage\tstage\tpixels\toutside\tfraction\n")
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	var failed int
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a)
+		if err != nil {
+			return err
+		}
+		if a == "-" {
+			a = "stdin"
+		}
+		if eq := land.Pixelation().Equator(); coll.Pixelation().Equator() != eq {
+			return fmt.Errorf("when reading %q: invalid pixelation: got %d pixels, want %d", a, coll.Pixelation().Equator(), eq)
+		}
+
+		for _, tax := range coll.Taxa() {
+			age := coll.Age(tax)
+			stage := land.ClosestStageAge(age)
+			in := land.At(age)
+
+			var pixels, outside int
+			for px, v := range coll.Range(tax) {
+				if v <= 0 {
+					continue
+				}
+				pixels++
+				if !in[px] {
+					outside++
+				}
+			}
+			if pixels == 0 {
+				continue
+			}
+
+			f := float64(outside) / float64(pixels)
+			if f > maxFlag {
+				failed++
+			}
+			fmt.Fprintf(c.Stdout(), "%s\t%s\t%.6f\t%.6f\t%d\t%d\t%.6f\n", a, tax, float64(age)/millionYears, float64(stage)/millionYears, pixels, outside, f)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d taxa with more than %.6f of pixels outside the landscape", failed, maxFlag)
+	}
+	return nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
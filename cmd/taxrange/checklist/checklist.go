@@ -0,0 +1,216 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package checklist implements a command to write
+// the list of taxa present in each unit
+// of a set of political (or any other) boundaries.
+package checklist
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/table"
+	"github.com/js-arias/ranges/geojson"
+)
+
+var Command = &command.Command{
+	Usage: `checklist [--quiet | -v | -vv] [--log-json]
+	--units <geojson-file> [--name-field <field>[,<field>...]]
+	[--threshold <value>] [--format <format>] [--verbatim]
+	[--json-summary <file>]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "write the list of taxa in each political unit",
+	Long: `
+Command checklist reads a geographic range file, and a GeoJSON file with the
+boundaries of a set of units (for example, countries or states), and writes
+the list of taxa present in each unit.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --units is required, and defines a GeoJSON file with the boundaries
+of the units, as a FeatureCollection with a feature for each unit. Only
+polygons and multipolygons are used. As defined by the GeoJSON specification,
+the edges of the polygons are straight lines in geographic coordinates, the
+first ring of a polygon is the exterior ring, and the other rings are holes.
+The boundaries can be downloaded, for example, from Natural Earth, or GADM.
+
+The name of each unit is taken from the property "name" of each feature. Use
+the flag --name-field to define a different property, or a list of properties,
+separated by commas, that will be joined with " / ". For example, with the
+GADM files of states, "--name-field NAME_0,NAME_1" will produce names like
+"Argentina / Mendoza".
+
+A pixel is assigned to a unit if the pixel center is inside the boundaries of
+the unit. If the center of no pixel is inside a polygon of the unit (for
+example, a small island), the pixels of the vertices of the polygon will be
+used. A pixel can be assigned to more than one unit.
+
+By default a taxon is present in any pixel of its range. Use the flag
+--threshold to define the minimum density value for a pixel of a continuous
+range to be counted as a presence.
+
+The output table has the following columns:
+
+	unit	the name of the unit
+	taxon	the name of the taxon
+	pixels	the number of pixels of the range of the taxon in the
+		unit
+
+Units are written in the order of the GeoJSON file, and taxa are sorted by
+name. Units without taxa are not written.
+
+By default the table is a tab-delimited table. Use the flag --format to
+define a different format: "markdown" for a Markdown table, or "latex" for a
+LaTeX tabular environment.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var unitsFile string
+var nameField string
+var threshold float64
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	table.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&unitsFile, "units", "", "")
+	c.Flags().StringVar(&nameField, "name-field", "name", "")
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if unitsFile == "" {
+		return c.UsageError("flag --units required")
+	}
+	var fields []string
+	for _, f := range strings.Split(nameField, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return c.UsageError("flag --name-field without fields")
+	}
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+	units, err := readUnits(unitsFile, fields)
+	if err != nil {
+		return err
+	}
+
+	tab := table.New("unit", "taxon", "pixels")
+	pix := coll.Pixelation()
+	taxa := coll.Taxa()
+	for _, u := range units {
+		px := u.Pixels(pix)
+		for _, tax := range taxa {
+			var n int
+			for id, v := range coll.Range(tax) {
+				if v < threshold {
+					continue
+				}
+				if _, ok := px[id]; ok {
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			nm := tax
+			if verbatimFlag {
+				nm = coll.VerbatimName(tax)
+			}
+			tab.Add(u.Name, nm, strconv.Itoa(n))
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return tab.Write(w)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+func readUnits(name string, fields []string) ([]geojson.Feature, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	units, err := geojson.Read(f, fields...)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	return units, nil
+}
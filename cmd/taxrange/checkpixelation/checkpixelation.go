@@ -0,0 +1,348 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package checkpixelation implements a command to check
+// that range files,
+// a time pixelation,
+// and a plate motion model
+// use compatible pixelations.
+package checkpixelation
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `check-pixelation [--quiet | -v | -vv] [--log-json]
+	[--model <motion-model>]
+	[--timepix <time-pixelation>] [--min <value>]
+	[--json-summary <file>] [--force]
+	[<rng-file>...]`,
+	Short: "check that files use compatible pixelations",
+	Long: `
+Command check-pixelation reads range files, a time pixelation, and a plate
+motion model, and checks that all of them were built on the same pixelation,
+so the pixel IDs of a file refer to the same locations in the other files. A
+file built on a different pixelation does not always produce an error in other
+commands, instead, the ranges will be silently misplaced.
+
+One or more range files can be given as arguments. The flag --timepix defines
+a time pixelation, and the flag --model defines a plate motion model (the same
+file used by the command rotate). At least two files must be given, and if no
+range file is given, the standard input will not be read.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The following checks are reported:
+
+	equator		the number of pixels at the equator of the file is
+			the same as the first file
+	present		the present stage of the plate motion model moves
+			each pixel to itself
+	ordering	the values of the time pixelation at the present
+			(or youngest) stage, and the plates of the plate
+			motion model, are spatially coherent
+
+As the files only store the pixel IDs, a file built with a different ordering
+of the pixels can not be detected directly. Instead, the ordering check
+measures the agreement of the values of neighboring pixels, corrected by the
+agreement expected by chance (1 means that all neighbors have the same value,
+and 0 means that the values are distributed at random). Real landscapes and
+plates are made of large contiguous regions, so they have a high coherence,
+but the same values read with a different pixel ordering will be scattered
+across the globe. Use the flag --min to define the minimum coherence accepted
+(default 0.5).
+
+The output is a tab-delimited table printed in the standard output, with the
+following columns:
+
+	file	the checked file
+	kind	the kind of file ("range", "timepix", or "model")
+	check	the check
+	status	either "ok", "error", or "skipped"
+	message	a description of the result
+
+A check is skipped if it can not be done, for example, the present check of a
+plate motion model without a present stage.
+
+If any check fails, the command will end with an error after the table is
+printed.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var modelFile string
+var timepixFile string
+var minFlag float64
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&modelFile, "model", "", "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().Float64Var(&minFlag, "min", 0.5, "")
+}
+
+// A Source is a file
+// with a pixelation.
+type source struct {
+	name string
+	kind string
+	pix  *earth.Pixelation
+}
+
+// A Result is the result of a check.
+type result struct {
+	src     source
+	check   string
+	ok      bool
+	skipped bool
+	msg     string
+}
+
+func run(c *command.Command, args []string) error {
+	n := len(args)
+	if modelFile != "" {
+		n++
+	}
+	if timepixFile != "" {
+		n++
+	}
+	if n < 2 {
+		return c.UsageError("at least two files are required")
+	}
+	if minFlag < 0 || minFlag > 1 {
+		return c.UsageError("flag --min must be a value between 0 and 1")
+	}
+
+	var sources []source
+	var res []result
+	for _, a := range args {
+		coll, err := readCollection(a)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source{name: a, kind: "range", pix: coll.Pixelation()})
+	}
+
+	var tp *model.TimePix
+	if timepixFile != "" {
+		var err error
+		tp, err = readTimePix(timepixFile)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source{name: timepixFile, kind: "timepix", pix: tp.Pixelation()})
+	}
+
+	var rec *model.Recons
+	if modelFile != "" {
+		var err error
+		rec, err = readRecons(modelFile)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source{name: modelFile, kind: "model", pix: rec.Pixelation()})
+	}
+
+	ref := sources[0]
+	for _, s := range sources {
+		eq := s.pix.Equator()
+		r := result{src: s, check: "equator", ok: eq == ref.pix.Equator()}
+		if r.ok {
+			r.msg = fmt.Sprintf("%d pixels at the equator (%d pixels)", eq, s.pix.Len())
+		} else {
+			r.msg = fmt.Sprintf("%d pixels at the equator, want %d (from %q)", eq, ref.pix.Equator(), ref.name)
+		}
+		res = append(res, r)
+	}
+
+	if tp != nil {
+		src := sources[len(args)]
+		st := tp.Stages()
+		age := st[0]
+		class := make(map[int]int)
+		for px, v := range tp.Stage(age) {
+			if v != 0 {
+				class[px] = v
+			}
+		}
+		res = append(res, orderingResult(src, class, fmt.Sprintf("stage %.6f", float64(age)/millionYears)))
+	}
+
+	if rec != nil {
+		src := sources[len(sources)-1]
+		res = append(res, presentResult(src, rec))
+
+		class := make(map[int]int)
+		for _, p := range rec.Plates() {
+			for _, px := range rec.Pixels(p) {
+				class[px] = p
+			}
+		}
+		res = append(res, orderingResult(src, class, "plates"))
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\tkind\tcheck\tstatus\tmessage\n")
+	var failed int
+	for _, r := range res {
+		status := "ok"
+		if r.skipped {
+			status = "skipped"
+		} else if !r.ok {
+			status = "error"
+			failed++
+		}
+		fmt.Fprintf(c.Stdout(), "%s\t%s\t%s\t%s\t%s\n", r.src.name, r.src.kind, r.check, status, r.msg)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d failed checks: incompatible pixelations", failed)
+	}
+	return nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+// PresentResult checks that the present stage
+// of a plate motion model
+// moves each pixel to itself.
+// If the model does not have a present stage
+// the check is skipped.
+func presentResult(src source, rec *model.Recons) result {
+	var total, moved int
+	for _, p := range rec.Plates() {
+		for px, locs := range rec.PixStage(p, 0) {
+			total++
+			if !slices.Contains(locs, px) {
+				moved++
+			}
+		}
+	}
+	r := result{src: src, check: "present", ok: moved == 0}
+	if total == 0 {
+		r.msg = "present stage not defined"
+		r.skipped = true
+		return r
+	}
+	r.msg = fmt.Sprintf("%d of %d pixels moved at the present stage", moved, total)
+	return r
+}
+
+// OrderingResult checks the spatial coherence
+// of the values of a pixelation.
+func orderingResult(src source, class map[int]int, what string) result {
+	k := coherence(src.pix, class)
+	return result{
+		src:   src,
+		check: "ordering",
+		ok:    k >= minFlag,
+		msg:   fmt.Sprintf("%s: coherence %.3f", what, k),
+	}
+}
+
+// Coherence returns the agreement
+// between the values of neighboring pixels,
+// corrected by the agreement expected by chance
+// (i.e. Cohen's kappa).
+// Pixels without a value are taken as a different class.
+func coherence(pix *earth.Pixelation, class map[int]int) float64 {
+	const absent = -1
+	value := func(px int) int {
+		if v, ok := class[px]; ok {
+			return v
+		}
+		return absent
+	}
+
+	counts := make(map[int]int)
+	var same, pairs float64
+	for px := 0; px < pix.Len(); px++ {
+		v := value(px)
+		counts[v]++
+		for _, nb := range ranges.Neighbors(pix, px) {
+			pairs++
+			if value(nb) == v {
+				same++
+			}
+		}
+	}
+	if pairs == 0 {
+		return 1
+	}
+
+	var expected float64
+	for _, n := range counts {
+		f := float64(n) / float64(pix.Len())
+		expected += f * f
+	}
+	if expected >= 1 {
+		// a single class
+		return 1
+	}
+	return (same/pairs - expected) / (1 - expected)
+}
+
+func readCollection(name string) (*ranges.Collection, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coll, err := ranges.ReadTSV(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+func readTimePix(name string) (*model.TimePix, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tp, err := model.ReadTimePix(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return tp, nil
+}
+
+func readRecons(name string) (*model.Recons, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rec, err := model.ReadReconsTSV(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	return rec, nil
+}
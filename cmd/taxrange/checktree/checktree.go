@@ -0,0 +1,231 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package checktree implements a command to check
+// that the terminals of a phylogenetic tree
+// have a range in a collection.
+package checktree
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/phylo"
+)
+
+var Command = &command.Command{
+	Usage: `check-tree [--quiet | -v | -vv] [--log-json]
+	--tree <newick-file>
+	[--json-summary <file>]
+	[--prune -o|--output <file>] [--force] [--sort <order>]
+	[--reproducible]
+	[<rng-file>...]`,
+	Short: "check taxon ranges against a phylogenetic tree",
+	Long: `
+Command check-tree reads a phylogenetic tree, and one or more geographic range
+files, and checks that each terminal of the tree has a range in the range
+files, for example, before using the ranges in a phylogenetic biogeography
+analysis.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The flag --tree is required, and defines a file with a phylogenetic tree in
+Newick format. Terminals of the tree are matched with the taxa of the range
+files by name, ignoring the case of the letters, and reading the underscores
+of unquoted names as spaces (for example, "Homo_sapiens" will match "Homo
+sapiens").
+
+The output is a tab-delimited table printed in the standard output, with the
+following columns:
+
+	file	the range file that contains the taxon (empty for
+		terminals without a range)
+	taxon	the name of the taxon
+	issue	the kind of problem
+
+The following problems are reported:
+
+	missing		a terminal of the tree without a range
+	extra		a taxon with a range that is not in the tree
+	duplicate	a terminal of the tree with a range in more than
+			one file (only the first range is used)
+
+If any terminal of the tree is without a range, the command will end with an
+error after the table is printed.
+
+If the flag --prune is defined, the ranges of the terminals of the tree will
+be written in the file defined by the flag --output, or -o, which is required
+when --prune is used, so the taxa that are not in the tree are removed. The
+output file is written even if there are terminals without a range.
+
+An existing output file is not overwritten, unless the flag --force is
+defined.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var treeFile string
+var pruneFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&treeFile, "tree", "", "")
+	c.Flags().BoolVar(&pruneFlag, "prune", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if treeFile == "" {
+		return c.UsageError("flag --tree required")
+	}
+	if pruneFlag && output == "" {
+		return c.UsageError("flag --output required when --prune is defined")
+	}
+	if pruneFlag && output == "-" {
+		return c.UsageError("flag --output: the standard output is used by the table")
+	}
+
+	t, err := readTree(treeFile)
+	if err != nil {
+		return err
+	}
+
+	// terminals of the tree,
+	// and the file with its range
+	terms := make(map[string]string)
+	for _, term := range t.Terms() {
+		terms[key(term)] = ""
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\ttaxon\tissue\n")
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	var outColl *ranges.Collection
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a)
+		if err != nil {
+			return err
+		}
+		if a == "-" {
+			a = "stdin"
+		}
+		if outColl == nil {
+			outColl = ranges.New(coll.Pixelation())
+		}
+		if outColl.Pixelation().Equator() != coll.Pixelation().Equator() {
+			return fmt.Errorf("when reading %q: invalid pixelation: got %d pixels, want %d", a, coll.Pixelation().Equator(), outColl.Pixelation().Equator())
+		}
+
+		for _, tax := range coll.Taxa() {
+			f, ok := terms[key(tax)]
+			if !ok {
+				fmt.Fprintf(c.Stdout(), "%s\t%s\textra\n", a, tax)
+				continue
+			}
+			if f != "" {
+				fmt.Fprintf(c.Stdout(), "%s\t%s\tduplicate\n", a, tax)
+				continue
+			}
+			terms[key(tax)] = a
+			if err := outColl.Copy(coll, tax); err != nil {
+				return err
+			}
+		}
+	}
+
+	var missing int
+	for _, term := range t.Terms() {
+		if terms[key(term)] != "" {
+			continue
+		}
+		fmt.Fprintf(c.Stdout(), "\t%s\tmissing\n", term)
+		missing++
+	}
+
+	if pruneFlag {
+		outformat.Set(outColl)
+		summary.Written(len(outColl.Taxa()))
+		if err := files.WriteFile(output, outColl.TSV); err != nil {
+			return err
+		}
+	}
+
+	if missing > 0 {
+		return fmt.Errorf("%d terminals of the tree without range", missing)
+	}
+	return nil
+}
+
+// Key returns the name of a taxon
+// as used to match the terminals of the tree
+// with the taxa of the range files.
+func key(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readTree(name string) (*phylo.Tree, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t, err := phylo.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,400 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package clean implements a command to flag
+// or remove points with typical bad coordinates.
+package clean
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/snapshot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `clean [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--ref <file>[,<file>...]] [--no-builtin] [--kind <kind>[,<kind>...]]
+	[--dist <value>] [--remove] [--patch <file>] [--verbatim]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "flag points with typical bad coordinates",
+	Long: `
+Command clean reads a geographic range file, and flags the points that are in
+the location of a country capital, a country centroid, or a biodiversity
+institution, as these locations are frequently assigned to records without
+precise coordinates, or to records with the location of the collection in
+which the specimen is stored.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input. Only taxa with ranges
+of "points" type are checked.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The command includes a small reference dataset of country capitals, country
+centroids (as commonly used by geocoding services), and major biodiversity
+institutions. Use the flag --ref to add one or more reference files
+(separated by commas). A reference file is a tab-delimited file with the
+following columns:
+
+	name		name of the reference location
+	kind		the kind of location, for example "capital"
+	latitude	the latitude of the location
+	longitude	the longitude of the location
+
+Use the flag --no-builtin to only use the reference files given with --ref.
+Use the flag --kind to only use the locations of the indicated kinds
+(separated by commas), for example "--kind capital,institution".
+
+By default a point is flagged if it is in the same pixel of a reference
+location. Use the flag --dist to flag points at the indicated distance (in
+km) from a reference location.
+
+By default, the output is a tab-delimited table with the following columns:
+
+	taxon		the name of the taxon
+	pixel		the pixel ID of the flagged point
+	latitude	the latitude of the pixel
+	longitude	the longitude of the pixel
+	reference	the name of the reference location
+	kind		the kind of the reference location
+
+If the flag --remove is defined, the flagged points will be removed, and the
+output will be the cleaned range file. The removed points will be reported as
+information messages. Taxa without points after cleaning will be removed,
+and reported as warnings.
+
+If the flag --patch is defined with --remove, the removed points will be
+written as a patch into the indicated file, so they can be restored with the
+command apply, using the flag --reverse.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is
+an error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+//go:embed reference.tab
+var builtin string
+
+var refFiles string
+var noBuiltin bool
+var kindFlag string
+var distFlag float64
+var removeFlag bool
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	snapshot.SetFlags(c)
+	c.Flags().StringVar(&refFiles, "ref", "", "")
+	c.Flags().BoolVar(&noBuiltin, "no-builtin", false, "")
+	c.Flags().StringVar(&kindFlag, "kind", "", "")
+	c.Flags().Float64Var(&distFlag, "dist", 0, "")
+	c.Flags().BoolVar(&removeFlag, "remove", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if noBuiltin && refFiles == "" {
+		return c.UsageError("flag --no-builtin defined without --ref")
+	}
+	if distFlag < 0 {
+		return c.UsageError("flag --dist must be a positive value")
+	}
+	if snapshot.Defined() && !removeFlag {
+		return c.UsageError("flag --patch requires --remove")
+	}
+	log := logger.New(c.Stderr())
+
+	var refs []reference
+	if !noBuiltin {
+		r, err := readReference(strings.NewReader(builtin), "builtin")
+		if err != nil {
+			return err
+		}
+		refs = r
+	}
+	if refFiles != "" {
+		for _, name := range strings.Split(refFiles, ",") {
+			r, err := readRefFile(name)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, r...)
+		}
+	}
+	if kindFlag != "" {
+		kinds := strings.Split(strings.ToLower(kindFlag), ",")
+		refs = slices.DeleteFunc(refs, func(r reference) bool {
+			return !slices.Contains(kinds, r.kind)
+		})
+	}
+	log.Info("reference locations", "locations", len(refs))
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+
+	pix := coll.Pixelation()
+	flagged := make(map[int]reference)
+	for _, r := range refs {
+		px := pix.Pixel(r.lat, r.lon).ID()
+		for p := range ranges.Buffer(pix, map[int]float64{px: 1}, distFlag) {
+			if _, ok := flagged[p]; !ok {
+				flagged[p] = r
+			}
+		}
+	}
+
+	var fl []flag
+	for _, tax := range coll.Taxa() {
+		if coll.Type(tax) != ranges.Points {
+			continue
+		}
+		rng := coll.Range(tax)
+		pixels := make([]int, 0, len(rng))
+		for px := range rng {
+			pixels = append(pixels, px)
+		}
+		slices.Sort(pixels)
+		for _, px := range pixels {
+			r, ok := flagged[px]
+			if !ok {
+				continue
+			}
+			fl = append(fl, flag{taxon: coll.VerbatimName(tax), pixel: px, ref: r})
+		}
+	}
+
+	if !removeFlag {
+		write := func(w io.Writer) error {
+			return writeFlags(w, pix, fl)
+		}
+		return files.Output(c.Stdout(), output, write)
+	}
+
+	if err := snapshot.Take(coll); err != nil {
+		return err
+	}
+
+	for _, f := range fl {
+		coll.RemovePixel(f.taxon, f.pixel)
+		log.Info("point removed", "taxon", f.taxon, "pixel", f.pixel, "reference", f.ref.name)
+		if len(coll.Range(f.taxon)) == 0 {
+			coll.Delete(f.taxon)
+			log.Warn("taxon without points after cleaning", "taxon", f.taxon)
+		}
+	}
+	if len(fl) > 0 {
+		log.Warn("points removed by cleaning", "points", len(fl))
+	}
+
+	if err := snapshot.Write(coll); err != nil {
+		return err
+	}
+
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+// A Reference is a location
+// frequently assigned to bad records.
+type reference struct {
+	name string
+	kind string
+	lat  float64
+	lon  float64
+}
+
+// A Flag is a point
+// at a reference location.
+type flag struct {
+	taxon string
+	pixel int
+	ref   reference
+}
+
+func writeFlags(w io.Writer, pix *earth.Pixelation, fl []flag) error {
+	tab := csv.NewWriter(w)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	if err := tab.Write([]string{"taxon", "pixel", "latitude", "longitude", "reference", "kind"}); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	for _, f := range fl {
+		pt := pix.ID(f.pixel).Point()
+		row := []string{
+			f.taxon,
+			strconv.Itoa(f.pixel),
+			strconv.FormatFloat(pt.Latitude(), 'f', 6, 64),
+			strconv.FormatFloat(pt.Longitude(), 'f', 6, 64),
+			f.ref.name,
+			f.ref.kind,
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+func readRefFile(name string) ([]reference, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readReference(f, name)
+}
+
+var refFields = []string{
+	"name",
+	"kind",
+	"latitude",
+	"longitude",
+}
+
+func readReference(r io.Reader, name string) ([]reference, error) {
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range refFields {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, h)
+		}
+	}
+
+	var refs []reference
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+		}
+
+		f := "latitude"
+		lat, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		if lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: invalid latitude %.6f", name, ln, f, lat)
+		}
+
+		f = "longitude"
+		lon, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		if lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: invalid longitude %.6f", name, ln, f, lon)
+		}
+
+		refs = append(refs, reference{
+			name: strings.TrimSpace(row[fields["name"]]),
+			kind: strings.ToLower(strings.TrimSpace(row[fields["kind"]])),
+			lat:  lat,
+			lon:  lon,
+		})
+	}
+	return refs, nil
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
@@ -0,0 +1,336 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package cumulative implements a command to build
+// the cumulative range of taxa
+// found at different ages.
+package cumulative
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/table"
+)
+
+var Command = &command.Command{
+	Usage: `cumulative [--quiet | -v | -vv] [--log-json]
+	[--appearance <file>] [--pixels <file>]
+	[--format <format>]
+	[--json-summary <file>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>...]`,
+	Short: "build the cumulative range of taxa across ages",
+	Long: `
+Command cumulative reads one or more geographic range files, with the ranges of
+taxa at different ages (for example, a file with the fossil records of each
+stage), and writes the cumulative range of each taxon (i.e. the union of the
+ranges at all ages, or "total fossil range").
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. All range files must use the same
+pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The pixels of all ranges must be in the same reference frame (for example,
+the present locations of the fossil records), so ranges rotated to different
+ages (for example, with the command rotate) should not be combined.
+
+The density of each pixel of the cumulative range is the maximum density of
+the pixel in the ranges of the taxon. If all the ranges of a taxon are points
+ranges, the cumulative range will be a points range, otherwise, it will be a
+continuous range. The age of the cumulative range is the youngest age of the
+taxon.
+
+If the flag --appearance is defined, a table with a summary of each age of
+each taxon will be written in the indicated file, with the following columns:
+
+	taxon	the name of the taxon
+	age	the age (in million years)
+	pixels	the number of pixels of the range at that age
+	first	the number of pixels with its first appearance
+		(i.e. its oldest age) at that age
+	last	the number of pixels with its last appearance
+		(i.e. its youngest age) at that age
+
+For each taxon, the ages are sorted from the oldest to the youngest.
+
+If the flag --pixels is defined, a table with the appearance of each pixel of
+the cumulative range of each taxon will be written in the indicated file, with
+the following columns:
+
+	taxon		the name of the taxon
+	pixel		the ID of the pixel
+	latitude	the latitude of the pixel center
+	longitude	the longitude of the pixel center
+	first		the age of the first appearance (in million years)
+	last		the age of the last appearance (in million years)
+	ages		the number of ages in which the pixel is found
+
+A table file named "-" is the standard output, and an existing table file is
+not overwritten, unless the flag --force is defined.
+
+By default the tables are tab-delimited tables. Use the flag --format to define
+a different format: "markdown" for a Markdown table, or "latex" for a LaTeX
+tabular environment.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var appearanceFile string
+var pixelsFile string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	table.SetFlags(c)
+	c.Flags().StringVar(&appearanceFile, "appearance", "", "")
+	c.Flags().StringVar(&pixelsFile, "pixels", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// A Taxon stores the ranges of a taxon
+// at different ages.
+type taxon struct {
+	name     string
+	verbatim string
+	points   bool
+	rngs     []ranges.AgeRange
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	var pix *earth.Pixelation
+	taxa := make(map[string]*taxon)
+	var names []string
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, pix)
+		if err != nil {
+			return err
+		}
+		pix = coll.Pixelation()
+
+		for _, tax := range coll.TaxaBy(ranges.InputOrder) {
+			t, ok := taxa[tax]
+			if !ok {
+				t = &taxon{
+					name:     tax,
+					verbatim: coll.VerbatimName(tax),
+					points:   true,
+				}
+				taxa[tax] = t
+				names = append(names, tax)
+			}
+			if coll.Type(tax) != ranges.Points {
+				t.points = false
+			}
+			t.rngs = append(t.rngs, ranges.AgeRange{
+				Age:   coll.Age(tax),
+				Range: coll.Range(tax),
+			})
+		}
+	}
+
+	out := ranges.New(pix)
+	apps := make(map[string]map[int]ranges.Appearance, len(names))
+	for _, tax := range names {
+		t := taxa[tax]
+		union, app := ranges.Cumulative(t.rngs)
+		apps[tax] = app
+		if len(union) == 0 {
+			continue
+		}
+
+		age := t.rngs[0].Age
+		for _, r := range t.rngs {
+			if r.Age < age {
+				age = r.Age
+			}
+		}
+		if t.points {
+			out.SetPixels(t.verbatim, age, union)
+			continue
+		}
+		out.Set(t.verbatim, age, union)
+	}
+
+	if appearanceFile != "" {
+		if err := writeAppearance(c.Stdout(), appearanceFile, names, taxa, apps); err != nil {
+			return err
+		}
+	}
+	if pixelsFile != "" {
+		if err := writePixels(c.Stdout(), pixelsFile, pix, names, taxa, apps); err != nil {
+			return err
+		}
+	}
+
+	out.KeepVerbatim(verbatimFlag)
+	outformat.Set(out)
+	summary.Written(len(out.Taxa()))
+	return files.Output(c.Stdout(), output, out.TSV)
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func formatAge(age int64) string {
+	return strconv.FormatFloat(float64(age)/millionYears, 'f', 6, 64)
+}
+
+func writeAppearance(w io.Writer, name string, names []string, taxa map[string]*taxon, apps map[string]map[int]ranges.Appearance) error {
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+
+	tab := table.New("taxon", "age", "pixels", "first", "last")
+	for _, tax := range sorted {
+		t := taxa[tax]
+		pixels := make(map[int64]map[int]bool)
+		var ages []int64
+		for _, r := range t.rngs {
+			if _, ok := pixels[r.Age]; !ok {
+				pixels[r.Age] = make(map[int]bool)
+				ages = append(ages, r.Age)
+			}
+			for px, v := range r.Range {
+				if v <= 0 {
+					continue
+				}
+				pixels[r.Age][px] = true
+			}
+		}
+		slices.Sort(ages)
+
+		first := make(map[int64]int)
+		last := make(map[int64]int)
+		for _, a := range apps[tax] {
+			first[a.First]++
+			last[a.Last]++
+		}
+
+		nm := tax
+		if verbatimFlag {
+			nm = t.verbatim
+		}
+		for i := len(ages) - 1; i >= 0; i-- {
+			age := ages[i]
+			tab.Add(
+				nm,
+				formatAge(age),
+				strconv.Itoa(len(pixels[age])),
+				strconv.Itoa(first[age]),
+				strconv.Itoa(last[age]),
+			)
+		}
+	}
+	return files.Output(w, name, tab.Write)
+}
+
+func writePixels(w io.Writer, name string, pix *earth.Pixelation, names []string, taxa map[string]*taxon, apps map[string]map[int]ranges.Appearance) error {
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+
+	tab := table.New("taxon", "pixel", "latitude", "longitude", "first", "last", "ages")
+	for _, tax := range sorted {
+		app := apps[tax]
+		pixels := make([]int, 0, len(app))
+		for px := range app {
+			pixels = append(pixels, px)
+		}
+		slices.Sort(pixels)
+
+		nm := tax
+		if verbatimFlag {
+			nm = taxa[tax].verbatim
+		}
+		for _, px := range pixels {
+			a := app[px]
+			pt := pix.ID(px).Point()
+			tab.Add(
+				nm,
+				strconv.Itoa(px),
+				strconv.FormatFloat(pt.Latitude(), 'f', 6, 64),
+				strconv.FormatFloat(pt.Longitude(), 'f', 6, 64),
+				formatAge(a.First),
+				formatAge(a.Last),
+				strconv.Itoa(a.Ages),
+			)
+		}
+	}
+	return files.Output(w, name, tab.Write)
+}
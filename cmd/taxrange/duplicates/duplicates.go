@@ -0,0 +1,309 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package duplicates implements a command to detect
+// and resolve taxa defined with different ranges
+// in several files of a workspace.
+package duplicates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/workspace"
+)
+
+var Command = &command.Command{
+	Usage: `duplicates [--quiet | -v | -vv] [--log-json]
+	[--index <file>] [--keep <mode>]
+	[--verbatim] [--json-summary <file>]
+	[--sort <order>] [--reproducible]
+	[--force] [-o|--output <file>]`,
+	Short: "resolve taxa defined in several files",
+	Long: `
+Command duplicates reads a workspace index, and reports the taxa that are
+defined with different ranges, of the same type, in several files of the
+workspace.
+
+A workspace index is built with the command index, using a directory as
+argument. By default, the command looks for the file "taxrange-index.tab" in
+the current directory, and then in its parent directories. Use the flag
+--index to set a different index file. As the index is not updated
+automatically, rebuild it after the range files are modified.
+
+By default, for each duplicated taxon the command prints the name of the
+taxon, the type of the range, and for each file in which the taxon is
+defined, the path of the file, the number of pixels, and the hash of the
+range.
+
+If the flag --keep is defined, the duplicated taxa are resolved, and their
+ranges are written as a range file. Valid modes are:
+
+	newest  keep the range of the most recently modified file.
+	merge   merge the ranges of all files: for points, the merged range is
+	        the union of the pixels (and the record counts are added), and
+	        for continuous ranges, the maximum density at each pixel. All
+	        ranges must have the same age.
+	ask     ask for each taxon which range should be kept (or whether the
+	        ranges should be merged), reading the answer from the standard
+	        input.
+
+If there are no duplicated taxa, no output is written. The resolved ranges
+can be added to a file of the workspace with the command cat, using the flag
+--replace.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var indexFile string
+var keepFlag string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&indexFile, "index", "", "")
+	c.Flags().StringVar(&keepFlag, "keep", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	switch keepFlag {
+	case "", "newest", "merge", "ask":
+	default:
+		return c.UsageError(fmt.Sprintf("invalid --keep value %q", keepFlag))
+	}
+
+	name := indexFile
+	if name == "" {
+		var err error
+		name, err = workspace.Locate()
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := readIndex(name)
+	if err != nil {
+		return err
+	}
+	dup := workspace.Duplicates(entries)
+
+	if keepFlag == "" {
+		for _, d := range dup {
+			fmt.Fprintf(c.Stdout(), "%s\t%s", d[0].Taxon, d[0].Type)
+			for _, e := range d {
+				fmt.Fprintf(c.Stdout(), "\t%s\t%d\t%s", e.File, e.Pixels, e.Hash)
+			}
+			fmt.Fprintf(c.Stdout(), "\n")
+		}
+		return nil
+	}
+
+	if files.IsURL(name) {
+		return fmt.Errorf("flag --keep requires a local workspace index: got %q", name)
+	}
+	dir := filepath.Dir(name)
+
+	if len(dup) == 0 {
+		return nil
+	}
+
+	var out *ranges.Collection
+	var pix *earth.Pixelation
+	read := make(map[string]*ranges.Collection)
+	in := bufio.NewReader(c.Stdin())
+	for _, d := range dup {
+		colls := make([]*ranges.Collection, len(d))
+		for i, e := range d {
+			coll, ok := read[e.File]
+			if !ok {
+				coll, err = readCollection(filepath.Join(dir, filepath.FromSlash(e.File)), pix)
+				if err != nil {
+					return err
+				}
+				read[e.File] = coll
+			}
+			if pix == nil {
+				pix = coll.Pixelation()
+				out = ranges.New(pix)
+			}
+			colls[i] = coll
+		}
+
+		tax := d[0].Taxon
+		var keep int
+		switch keepFlag {
+		case "newest":
+			keep, err = newest(dir, d)
+		case "merge":
+			keep = -1
+		case "ask":
+			keep, err = ask(c.Stderr(), in, d)
+		}
+		if err != nil {
+			return err
+		}
+
+		if keep >= 0 {
+			if err := out.Copy(colls[keep], tax); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := merge(out, tax, colls); err != nil {
+			return err
+		}
+	}
+	out.KeepVerbatim(verbatimFlag)
+	outformat.Set(out)
+	summary.Written(len(out.Taxa()))
+	return files.Output(c.Stdout(), output, out.TSV)
+}
+
+// Newest returns the entry with the most recently
+// modified file.
+func newest(dir string, d []workspace.Entry) (int, error) {
+	var keep int
+	var last time.Time
+	for i, e := range d {
+		st, err := os.Stat(filepath.Join(dir, filepath.FromSlash(e.File)))
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 || !st.ModTime().Before(last) {
+			keep = i
+			last = st.ModTime()
+		}
+	}
+	return keep, nil
+}
+
+// Ask asks which entry should be kept,
+// returning -1 if the ranges should be merged.
+func ask(w io.Writer, r *bufio.Reader, d []workspace.Entry) (int, error) {
+	fmt.Fprintf(w, "taxon %q (%s) is defined in:\n", d[0].Taxon, d[0].Type)
+	for i, e := range d {
+		fmt.Fprintf(w, "\t%d. %s (%d pixels)\n", i+1, e.File, e.Pixels)
+	}
+	fmt.Fprintf(w, "\tm. merge the ranges\n")
+	for {
+		fmt.Fprintf(w, "choose [1-%d, m]: ", len(d))
+		ln, err := r.ReadString('\n')
+		ln = strings.TrimSpace(ln)
+		if ln == "" && err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, fmt.Errorf("taxon %q: no choice given", d[0].Taxon)
+			}
+			return 0, err
+		}
+		if strings.EqualFold(ln, "m") {
+			return -1, nil
+		}
+		if v, err := strconv.Atoi(ln); err == nil && v > 0 && v <= len(d) {
+			return v - 1, nil
+		}
+		fmt.Fprintf(w, "invalid choice %q\n", ln)
+		if err != nil {
+			return 0, fmt.Errorf("taxon %q: no choice given", d[0].Taxon)
+		}
+	}
+}
+
+// Merge merges the ranges of a taxon
+// defined in several collections.
+func merge(out *ranges.Collection, tax string, colls []*ranges.Collection) error {
+	tmp := ranges.New(out.Pixelation())
+	src := tax + " merged"
+	for _, coll := range colls {
+		// the merged range is kept with a different name
+		// so the next range can be copied
+		// (the first merge just renames the taxon).
+		if err := tmp.Copy(coll, tax); err != nil {
+			return err
+		}
+		if err := tmp.Merge(src, tax); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Merge(tax, src); err != nil {
+		return err
+	}
+	return out.Copy(tmp, tax)
+}
+
+func readIndex(name string) ([]workspace.Entry, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := workspace.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	return entries, nil
+}
+
+func readCollection(name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coll, err := ranges.ReadTSV(f, pix)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
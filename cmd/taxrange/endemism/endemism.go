@@ -0,0 +1,358 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package endemism implements a command to calculate
+// the weighted endemism,
+// and the phylogenetic diversity and endemism,
+// of each pixel.
+package endemism
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/phylo"
+	"github.com/js-arias/ranges/render"
+)
+
+var Command = &command.Command{
+	Usage: `endemism [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--threshold <value>] [--tree <newick-file>]
+	[--map <image-file> [--index <name>] [-c|--columns <value>]]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>...]`,
+	Short: "calculate the weighted endemism of each pixel",
+	Long: `
+Command endemism reads one or more geographic range files, and calculates the
+weighted endemism of each pixel, i.e. the sum of the inverse of the range size
+of the taxa present in the pixel, so taxa with small ranges contribute more to
+the endemism of a pixel than widespread taxa.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. All range files must use the same
+pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+By default a taxon is present in any pixel of its range. Use the flag
+--threshold to define the minimum density value for a pixel of a continuous
+range to be counted as a presence. The range size of a taxon is the number of
+pixels in which the taxon is present. If a taxon is found in more than one
+range file, its range is the union of the pixels in all files.
+
+The output is a tab-delimited table with the following columns:
+
+	pixel		the pixel ID
+	lat		the latitude of the pixel center
+	lon		the longitude of the pixel center
+	richness	the number of taxa in the pixel
+	we		the weighted endemism of the pixel
+	cwe		the corrected weighted endemism of the pixel, i.e. the
+			weighted endemism divided by the richness
+
+As the weighted endemism is correlated with richness, the corrected weighted
+endemism is useful to find pixels with a high proportion of taxa with small
+ranges.
+
+If the flag --tree is defined, the indicated file will be read as a
+phylogenetic tree in Newick format, and the following columns will be added to
+the output:
+
+	pd	the phylogenetic diversity of the pixel, i.e. the sum of the
+		lengths of the branches that connect the taxa in the pixel
+		with the root of the tree
+	pe	the phylogenetic endemism of the pixel, i.e. the sum of the
+		lengths of the same branches, each one divided by the range
+		size of the branch (the number of pixels in the union of the
+		ranges of its descendant taxa)
+
+Terminals of the tree are matched with the taxa of the range files by name,
+ignoring the case of the letters, and reading the underscores of unquoted
+names as spaces (for example, "Homo_sapiens" will match "Homo sapiens"). The
+branch of the root is not used. If the tree has no branch lengths, each branch
+is taken as of length 1. Taxa without a terminal in the tree are reported as
+warnings, and are only used for the richness and weighted endemism.
+
+If the flag --map is defined, a map will be written in the indicated image
+file (in PNG format), using a plate carrée (equirectangular) projection, and a
+color gradient for the values scaled to the highest value. By default the map
+is of the weighted endemism. Use the flag --index to define the index to
+draw: "we" for the weighted endemism, "cwe" for the corrected weighted
+endemism, "pd" for the phylogenetic diversity, or "pe" for the phylogenetic
+endemism (the last two require the flag --tree). By default the image will be
+3600 pixels wide, use the flag --columns, or -c, to define a different number
+of image columns.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var threshold float64
+var treeFile string
+var mapFile string
+var indexFlag string
+var colsFlag int
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().StringVar(&treeFile, "tree", "", "")
+	c.Flags().StringVar(&mapFile, "map", "", "")
+	c.Flags().StringVar(&indexFlag, "index", "we", "")
+	c.Flags().IntVar(&colsFlag, "columns", 3600, "")
+	c.Flags().IntVar(&colsFlag, "c", 3600, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if colsFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --columns value %d", colsFlag))
+	}
+	indexFlag = strings.ToLower(strings.TrimSpace(indexFlag))
+	switch indexFlag {
+	case "we", "cwe":
+	case "pd", "pe":
+		if treeFile == "" {
+			return c.UsageError(fmt.Sprintf("flag --index %q requires --tree", indexFlag))
+		}
+	default:
+		return c.UsageError(fmt.Sprintf("invalid --index value %q", indexFlag))
+	}
+	log := logger.New(c.Stderr())
+
+	var tree *phylo.Tree
+	if treeFile != "" {
+		var err error
+		tree, err = readTree(treeFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var pix *earth.Pixelation
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	// pixels of each taxon
+	// (a taxon can be in more than one file)
+	taxa := make(map[string]map[int]bool)
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, pix)
+		if err != nil {
+			return err
+		}
+		pix = coll.Pixelation()
+
+		for _, tax := range coll.Taxa() {
+			for px, v := range coll.Range(tax) {
+				if v < threshold {
+					continue
+				}
+				if taxa[tax] == nil {
+					taxa[tax] = make(map[int]bool)
+				}
+				taxa[tax][px] = true
+			}
+		}
+	}
+
+	rich := make(map[int]int)
+	we := make(map[int]float64)
+	for _, pixels := range taxa {
+		w := 1 / float64(len(pixels))
+		for px := range pixels {
+			rich[px]++
+			we[px] += w
+		}
+	}
+
+	idx := map[string]map[int]float64{
+		"we":  we,
+		"cwe": make(map[int]float64, len(we)),
+	}
+	for px, v := range we {
+		idx["cwe"][px] = v / float64(rich[px])
+	}
+	if tree != nil {
+		idx["pd"], idx["pe"] = diversity(log, tree, taxa)
+	}
+
+	if mapFile != "" {
+		if err := writeMap(mapFile, pix, idx[indexFlag]); err != nil {
+			return err
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return writeEndemism(w, pix, rich, idx)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readTree(name string) (*phylo.Tree, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t, err := phylo.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	return t, nil
+}
+
+// Diversity returns the phylogenetic diversity
+// and the phylogenetic endemism
+// of each pixel.
+func diversity(log *slog.Logger, t *phylo.Tree, taxa map[string]map[int]bool) (pd, pe map[int]float64) {
+	rng := make(map[string]map[int]bool, len(taxa))
+	terms := make(map[string]bool)
+	var noRange int
+	for _, term := range t.Terms() {
+		nm := canon(term)
+		terms[nm] = true
+		if _, ok := taxa[nm]; !ok {
+			log.Debug("terminal without range", "terminal", term)
+			noRange++
+			continue
+		}
+		rng[term] = taxa[nm]
+	}
+
+	var noTerm int
+	for tax := range taxa {
+		if !terms[tax] {
+			log.Warn("taxon not in tree", "taxon", tax)
+			noTerm++
+		}
+	}
+	log.Info("tree terminals matched", "matched", len(rng), "without range", noRange, "not in tree", noTerm)
+
+	return t.Diversity(rng)
+}
+
+// Canon returns a name in its canonical form
+// (as used in the range files).
+func canon(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return ""
+	}
+	name = strings.ToLower(name)
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[n:]
+}
+
+func writeEndemism(w io.Writer, pix *earth.Pixelation, rich map[int]int, idx map[string]map[int]float64) error {
+	pixels := make([]int, 0, len(rich))
+	for px := range rich {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	bw := bufio.NewWriter(w)
+	_, phy := idx["pd"]
+	fmt.Fprintf(bw, "pixel\tlat\tlon\trichness\twe\tcwe")
+	if phy {
+		fmt.Fprintf(bw, "\tpd\tpe")
+	}
+	fmt.Fprintf(bw, "\n")
+	for _, px := range pixels {
+		pt := pix.ID(px).Point()
+		fmt.Fprintf(bw, "%d\t%.6f\t%.6f\t%d\t%.6f\t%.6f", px, pt.Latitude(), pt.Longitude(), rich[px], idx["we"][px], idx["cwe"][px])
+		if phy {
+			fmt.Fprintf(bw, "\t%.6f\t%.6f", idx["pd"][px], idx["pe"][px])
+		}
+		fmt.Fprintf(bw, "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// WriteMap writes a map of an endemism index
+// scaled to the maximum value.
+func writeMap(name string, pix *earth.Pixelation, index map[int]float64) error {
+	vals := make(map[int]float64, len(index))
+	var max float64
+	for px, v := range index {
+		vals[px] = v
+		if v > max {
+			max = v
+		}
+	}
+	if max > 0 {
+		for px, v := range vals {
+			vals[px] = v / max
+		}
+	}
+
+	m := render.New(pix, render.Global(colsFlag))
+	m.UseGrid()
+	m.SetRange(vals)
+	return files.WriteFile(name, func(w io.Writer) error {
+		return render.EncodePNG(context.Background(), w, m)
+	})
+}
@@ -0,0 +1,379 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package erase implements a command to remove
+// the pixels of an exclusion mask
+// from the ranges of a collection.
+package erase
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/snapshot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `erase [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--mask <rng-file>] [--global] [--polygon <file>]
+	[--taxon <name>] [--verbatim]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--patch <file>] [--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "remove the pixels of an exclusion mask from ranges",
+	Long: `
+Command erase reads a geographic range file, and removes from the range of
+each taxon the pixels of an exclusion mask, for example, the introduced or
+invasive portions of the range of a species.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations of
+the mask file (see "taxrange help introduced"). The range file is always read
+with all of its pixels, so, for example, with "--introduced only" and the
+same file as the mask, only the introduced pixels are removed.
+
+The exclusion mask can be defined as a set of pixels, or as a set of
+polygons, and at least one of them is required.
+
+The flag --mask defines a range file with the pixels to be removed. By
+default, the pixels of each taxon in the mask file are removed from the range
+of the taxon with the same name. If the flag --global is defined, the pixels
+of all the taxa in the mask file are removed from the range of every taxon.
+The mask file must have the same pixelation as the range file. Either the
+range file or the mask file can be read from the standard input (using "-"
+as the file name), but not both.
+
+The flag --polygon defines a tab-delimited file with one or more polygons.
+The file must contain the following columns:
+
+	polygon		an identifier of the polygon
+	latitude	the latitude of a vertex of the polygon
+	longitude	the longitude of a vertex of the polygon
+
+Optionally, the file can contain a column "taxon", with the name of the taxon
+to which the polygon will be applied. If the taxon column is not defined, or
+it is empty, the polygon will be applied to all taxa. The vertices of each
+polygon must be given in order, and the edges of the polygon are great circle
+arcs between consecutive vertices (the last vertex is connected to the first
+one). A polygon can be non-convex, but its edges must not cross each other,
+and it must be contained in a hemisphere. A pixel is removed if its center is
+inside the polygon.
+
+As the edges are great circle arcs, a long edge does not follow a parallel:
+for example, an edge between two vertices at the same latitude bends towards
+the nearest pole. To follow a parallel, add intermediate
+vertices along the edge.
+
+By default, all taxa in the file will be modified. Use the flag --taxon to
+modify only the indicated taxon. The other taxa will be kept unchanged.
+
+The type of each range is preserved. The values of the remaining pixels
+(densities, record counts, and any other column) are kept. Taxa without pixels after the pixels are removed will be removed,
+and reported as warnings.
+
+If the flag --patch is defined, the changes in the ranges will be written as a
+patch into the indicated file, so they can be reverted with the command apply,
+using the flag --reverse.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var maskFile string
+var globalFlag bool
+var polygonFile string
+var taxonFlag string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	snapshot.SetFlags(c)
+	c.Flags().StringVar(&maskFile, "mask", "", "")
+	c.Flags().BoolVar(&globalFlag, "global", false, "")
+	c.Flags().StringVar(&polygonFile, "polygon", "", "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if maskFile == "" && polygonFile == "" {
+		return c.UsageError("either --mask or --polygon flags are required")
+	}
+	if globalFlag && maskFile == "" {
+		return c.UsageError("flag --global requires --mask")
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	if input == "-" && maskFile == "-" {
+		return c.UsageError("flag --mask: standard input already used by the range file")
+	}
+	// the input is read with all of its pixels,
+	// so the introduced filter is only applied to the mask
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Take(coll); err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+	pix := coll.Pixelation()
+
+	var mask *ranges.Collection
+	global := make(map[int]float64)
+	if maskFile != "" {
+		mask, err = readCollection(c.Stdin(), maskFile, introduced.Options()...)
+		if err != nil {
+			return err
+		}
+		if eq := mask.Pixelation().Equator(); eq != pix.Equator() {
+			return fmt.Errorf("when reading %q: invalid pixelation: got %d pixels, want %d", maskFile, eq, pix.Equator())
+		}
+		if globalFlag {
+			for _, tax := range mask.Taxa() {
+				global = ranges.Sum(global, mask.Range(tax))
+			}
+		}
+	}
+
+	var polys []polygon
+	if polygonFile != "" {
+		polys, err = readPolygons(polygonFile, pix)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tax := range coll.Taxa() {
+		if taxonFlag != "" && !strings.EqualFold(tax, strings.Join(strings.Fields(taxonFlag), " ")) {
+			continue
+		}
+
+		excl := make(map[int]float64)
+		if globalFlag {
+			excl = global
+		} else if mask != nil {
+			excl = ranges.Sum(excl, mask.Range(tax))
+		}
+		for _, p := range polys {
+			if p.taxon != "" && !strings.EqualFold(tax, p.taxon) {
+				continue
+			}
+			excl = ranges.Sum(excl, p.pixels)
+		}
+
+		rng := coll.Range(tax)
+		erased := ranges.Erase(rng, excl)
+		if len(erased) == len(rng) {
+			continue
+		}
+		log.Info("pixels removed", "taxon", tax, "pixels", len(rng), "removed", len(rng)-len(erased))
+
+		if len(erased) == 0 {
+			coll.Delete(tax)
+			log.Warn("taxon without pixels after erase", "taxon", tax)
+			continue
+		}
+		// pixels are removed one by one
+		// so the values of the remaining pixels
+		// (either densities or record counts)
+		// are kept
+		for px := range rng {
+			if _, ok := erased[px]; !ok {
+				coll.RemovePixel(tax, px)
+			}
+		}
+	}
+
+	if err := snapshot.Write(coll); err != nil {
+		return err
+	}
+
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+// A Polygon is an exclusion polygon
+// for a taxon.
+type polygon struct {
+	// if empty,
+	// the polygon is applied to all taxa
+	taxon string
+
+	pixels map[int]float64
+}
+
+var polygonFields = []string{
+	"polygon",
+	"latitude",
+	"longitude",
+}
+
+func readPolygons(name string, pix *earth.Pixelation) ([]polygon, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range polygonFields {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, h)
+		}
+	}
+	taxCol, hasTaxon := fields["taxon"]
+
+	// vertices of each polygon,
+	// in the order in which the polygons are read
+	var ids []string
+	vertices := make(map[string][]earth.Point)
+	taxa := make(map[string]string)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+		}
+
+		id := strings.TrimSpace(row[fields["polygon"]])
+		if id == "" {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: empty value", name, ln, "polygon")
+		}
+
+		f := "latitude"
+		lat, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		if lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: invalid latitude %.6f", name, ln, f, lat)
+		}
+
+		f = "longitude"
+		lon, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		if lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: invalid longitude %.6f", name, ln, f, lon)
+		}
+
+		var tax string
+		if hasTaxon {
+			tax = strings.Join(strings.Fields(row[taxCol]), " ")
+		}
+		if _, ok := vertices[id]; !ok {
+			ids = append(ids, id)
+			taxa[id] = tax
+		} else if !strings.EqualFold(taxa[id], tax) {
+			return nil, fmt.Errorf("on file %q: row %d: polygon %q: got taxon %q, want %q", name, ln, id, tax, taxa[id])
+		}
+		vertices[id] = append(vertices[id], earth.NewPoint(lat, lon))
+	}
+
+	polys := make([]polygon, 0, len(ids))
+	for _, id := range ids {
+		px, err := ranges.PolygonPixels(pix, vertices[id])
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: polygon %q: %v", name, id, err)
+		}
+		polys = append(polys, polygon{
+			taxon:  taxa[id],
+			pixels: px,
+		})
+	}
+	return polys, nil
+}
+
+func readCollection(r io.Reader, name string, opts ...ranges.ReadOption) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
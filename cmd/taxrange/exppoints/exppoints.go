@@ -0,0 +1,282 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package exppoints implements a command to export
+// the pixels of the ranges in a collection
+// as a list of geographic points.
+package exppoints
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/sensitive"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `exp.points [--quiet | -v | -vv] [--log-json]
+	[--model <rotation-file>] [--taxon <name>]
+	[--json-summary <file>]
+	[--sensitive <file> --generalize <km>]
+	[--verbatim] [--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "export range pixels as a list of points",
+	Long: `
+Command exp.points reads a geographic range file, and writes the pixels of the
+range of each taxon as a list of points, using the coordinates of the center of
+each pixel.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The pixels of a taxon with an age older than 0 (for example, a range rotated
+with the command rotate) are paleo-locations. Use the flag --model to define a
+plate motion model, in the format used by the command rotate. The inverse of
+the rotation will be used to find the present locations of each pixel. As a
+paleo-location can be the past location of more than one present pixel, a
+point is written for each present pixel. The model must use the same
+pixelation as the range file.
+
+If the flag --sensitive is defined, it defines a list of sensitive taxa (for
+example, poached taxa), in the format used by the command anonymize. The range
+of each sensitive taxon will be generalized before it is exported: each pixel
+at a distance less or equal than the value of the flag --generalize (in km) of
+the range will be added to the range, with the maximum density of the range
+pixels within that distance, so the exact pixels of the range can not be
+recovered. Sensitive taxa with the action "remove" will not be exported. The
+flag --generalize is required if --sensitive is defined.
+
+By default all taxa will be exported. Use the flag --taxon to export only the
+indicated taxon.
+
+The output is a tab-delimited table with the following columns:
+
+	species		the name of the taxon
+	type		the type of the range
+	age		the age of the range (in years)
+	pixel		the ID of the pixel in the range file
+	latitude	the present latitude of the pixel center
+	longitude	the present longitude of the pixel center
+	paleolatitude	the latitude of the pixel center at the age of
+			the range
+	paleolongitude	the longitude of the pixel center at the age of
+			the range
+
+For taxa of age 0 the present and paleo coordinates are the same. For older
+taxa, if no model is defined, or the model does not have a present location
+for a pixel, the present coordinates will be empty.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var modelFile string
+var taxonFlag string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	sensitive.SetFlags(c)
+	c.Flags().StringVar(&modelFile, "model", "", "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if err := sensitive.Check(); err != nil {
+		return c.UsageError(err.Error())
+	}
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+	if err := sensitive.Apply(coll); err != nil {
+		return err
+	}
+
+	var inv *model.Total
+	if modelFile != "" {
+		inv, err = readInverse(modelFile, coll.Pixelation())
+		if err != nil {
+			return err
+		}
+	}
+
+	taxa := coll.Taxa()
+	if taxonFlag != "" {
+		nm := strings.Join(strings.Fields(taxonFlag), " ")
+		taxa = nil
+		for _, tax := range coll.Taxa() {
+			if strings.EqualFold(tax, nm) {
+				taxa = append(taxa, tax)
+			}
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return writePoints(w, coll, taxa, inv)
+	}
+	summary.Written(len(taxa))
+	return files.Output(c.Stdout(), output, write)
+}
+
+func writePoints(w io.Writer, coll *ranges.Collection, taxa []string, inv *model.Total) error {
+	tab := csv.NewWriter(w)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	header := []string{"species", "type", "age", "pixel", "latitude", "longitude", "paleolatitude", "paleolongitude"}
+	if err := tab.Write(header); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+
+	pix := coll.Pixelation()
+	for _, tax := range taxa {
+		nm := tax
+		if verbatimFlag {
+			nm = coll.VerbatimName(tax)
+		}
+		age := coll.Age(tax)
+		var rot map[int][]int
+		if age > 0 && inv != nil {
+			rot = inv.Rotation(age)
+		}
+
+		rng := coll.Range(tax)
+		pixels := make([]int, 0, len(rng))
+		for px := range rng {
+			pixels = append(pixels, px)
+		}
+		slices.Sort(pixels)
+
+		for _, px := range pixels {
+			paleo := pix.ID(px).Point()
+			row := []string{
+				nm,
+				string(coll.Type(tax)),
+				strconv.FormatInt(age, 10),
+				strconv.Itoa(px),
+				"",
+				"",
+				strconv.FormatFloat(paleo.Latitude(), 'f', 6, 64),
+				strconv.FormatFloat(paleo.Longitude(), 'f', 6, 64),
+			}
+
+			var present []int
+			switch {
+			case age == 0:
+				present = []int{px}
+			case rot != nil:
+				present = rot[px]
+			}
+			if len(present) == 0 {
+				if err := tab.Write(row); err != nil {
+					return fmt.Errorf("while writing data: %v", err)
+				}
+				continue
+			}
+			for _, pp := range present {
+				pt := pix.ID(pp).Point()
+				row[4] = strconv.FormatFloat(pt.Latitude(), 'f', 6, 64)
+				row[5] = strconv.FormatFloat(pt.Longitude(), 'f', 6, 64)
+				if err := tab.Write(row); err != nil {
+					return fmt.Errorf("while writing data: %v", err)
+				}
+			}
+		}
+	}
+
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+// ReadInverse reads the inverse rotation
+// of a plate motion model,
+// i.e. the rotation from the past locations
+// to the present locations.
+func readInverse(name string, pix *earth.Pixelation) (*model.Total, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rot, err := model.ReadTotal(f, nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	if eq := rot.Pixelation().Equator(); eq != pix.Equator() {
+		return nil, fmt.Errorf("on file %q: invalid equator value %d, want %d", name, eq, pix.Equator())
+	}
+	return rot, nil
+}
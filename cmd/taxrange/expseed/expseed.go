@@ -0,0 +1,329 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package expseed implements a command to export
+// the conditional likelihoods of the pixels
+// of the ranges in a collection,
+// to be used as the seeds (i.e., the terminal states)
+// of a phylogenetic biogeography analysis.
+package expseed
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/landscape"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `exp.seed [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--normalize <mode>] [--threshold <value>] [--records]
+	[--timepix <time-pixelation> [--prior <prior-file>]]
+	[--taxon <name>] [--verbatim] [--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "export ranges as conditional likelihood seeds",
+	Long: `
+Command exp.seed reads a geographic range file, and writes the conditional
+likelihood of each pixel of the range of each taxon, i.e. the likelihood of
+observing the data of the taxon, if the taxon is found in the pixel. These
+vectors are the seeds (the terminal states) of a phylogenetic biogeography
+analysis, for example, with the program PhyGeo.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+For ranges of "points" type, each pixel with a record has a likelihood of 1.
+If the flag --records is defined, the likelihood of each pixel is the number
+of records in the pixel (if the range file has a records column). For ranges
+of "range" type, the likelihood of each pixel is its density. Use the flag
+--threshold to define the minimum density of a pixel of a continuous range to
+be included in the output.
+
+The pixels of the ranges must be at the age of the taxon (for example, using
+the command rotate). If the flag --timepix is defined, the likelihoods will be
+masked by the landscape of the time pixelation, at the stage closest to the
+age of the taxon, so only the pixels with a non-zero value in the time
+pixelation will be written. Prior probabilities for each pixel type can be
+defined on a file and read with the flag --prior (the same format used by the
+command kde), so only the pixels with a non-zero prior will be written. The
+time pixelation must have the same pixelation as the range file. Taxa without
+pixels in the landscape are reported as warnings, and they are not written.
+
+By default, the likelihoods of each taxon are normalized so they sum to 1.
+Use the flag --normalize to define a different normalization: "sum" (the
+default) normalizes the values to sum 1, "max" normalizes the values so the
+maximum value is 1, and "none" writes the values as they are. The
+normalization is done after the landscape masking.
+
+By default all taxa will be exported. Use the flag --taxon to export only the
+indicated taxon.
+
+The output is a tab-delimited table with the following columns:
+
+	taxon		the name of the taxon
+	age		the age of the taxon (in years)
+	stage		the age of the stage of the time pixelation used to
+			mask the taxon (in years), or the age of the taxon if
+			no time pixelation is used
+	equator		the number of pixels in the equator of the
+			pixelation
+	pixel		the ID of the pixel
+	value		the conditional likelihood of the pixel
+
+The values are written with the precision required to read them back
+exactly, so no value of a normalized vector is lost by rounding.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var normFlag string
+var threshold float64
+var recordsFlag bool
+var timepixFile string
+var priorFile string
+var taxonFlag string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&normFlag, "normalize", "sum", "")
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().BoolVar(&recordsFlag, "records", false, "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().StringVar(&priorFile, "prior", "", "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	normFlag = strings.ToLower(strings.TrimSpace(normFlag))
+	switch normFlag {
+	case "sum", "max", "none":
+	default:
+		return c.UsageError(fmt.Sprintf("invalid --normalize value %q", normFlag))
+	}
+	if priorFile != "" && timepixFile == "" {
+		return c.UsageError("flag --prior requires --timepix")
+	}
+	log := logger.New(c.Stderr())
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+
+	var land *landscape.Landscape
+	if timepixFile != "" {
+		land, err = landscape.Read(timepixFile, priorFile, coll.Pixelation())
+		if err != nil {
+			return err
+		}
+	}
+
+	taxa := coll.Taxa()
+	if taxonFlag != "" {
+		nm := strings.Join(strings.Fields(taxonFlag), " ")
+		taxa = nil
+		for _, tax := range coll.Taxa() {
+			if strings.EqualFold(tax, nm) {
+				taxa = append(taxa, tax)
+			}
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return writeSeeds(w, log, coll, taxa, land)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+func writeSeeds(w io.Writer, log *slog.Logger, coll *ranges.Collection, taxa []string, land *landscape.Landscape) error {
+	tab := csv.NewWriter(w)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	header := []string{"taxon", "age", "stage", "equator", "pixel", "value"}
+	if err := tab.Write(header); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+
+	eq := strconv.Itoa(coll.Pixelation().Equator())
+	var written int
+	for _, tax := range taxa {
+		age := coll.Age(tax)
+		stage := age
+		if land != nil {
+			stage = land.ClosestStageAge(age)
+		}
+
+		lk := likelihoods(coll, tax, land)
+		if len(lk) == 0 {
+			log.Warn("taxon without pixels", "taxon", tax, "stage", float64(stage)/millionYears)
+			continue
+		}
+		written++
+
+		nm := tax
+		if verbatimFlag {
+			nm = coll.VerbatimName(tax)
+		}
+
+		pixels := make([]int, 0, len(lk))
+		for px := range lk {
+			pixels = append(pixels, px)
+		}
+		slices.Sort(pixels)
+
+		for _, px := range pixels {
+			row := []string{
+				nm,
+				strconv.FormatInt(age, 10),
+				strconv.FormatInt(stage, 10),
+				eq,
+				strconv.Itoa(px),
+				strconv.FormatFloat(lk[px], 'g', -1, 64),
+			}
+			if err := tab.Write(row); err != nil {
+				return fmt.Errorf("while writing data: %v", err)
+			}
+		}
+	}
+
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	log.Info("seeds written", "taxa", written)
+	summary.Written(written)
+	return nil
+}
+
+// Likelihoods returns the normalized conditional likelihoods
+// of the pixels of a taxon.
+func likelihoods(coll *ranges.Collection, tax string, land *landscape.Landscape) map[int]float64 {
+	var in map[int]bool
+	if land != nil {
+		in = land.At(coll.Age(tax))
+	}
+
+	var recs map[int]int
+	if recordsFlag {
+		recs = coll.Records(tax)
+	}
+
+	// pixels are visited in a fixed order
+	// so the sum is always the same
+	rng := coll.Range(tax)
+	pixels := make([]int, 0, len(rng))
+	for px := range rng {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	lk := make(map[int]float64)
+	var sum, max float64
+	for _, px := range pixels {
+		v := rng[px]
+		if v <= 0 || v < threshold {
+			continue
+		}
+		if in != nil && !in[px] {
+			continue
+		}
+		if coll.Type(tax) == ranges.Points {
+			v = 1
+			if recs != nil && recs[px] > 0 {
+				v = float64(recs[px])
+			}
+		}
+		lk[px] = v
+		sum += v
+		if v > max {
+			max = v
+		}
+	}
+
+	var scale float64
+	switch normFlag {
+	case "sum":
+		scale = sum
+	case "max":
+		scale = max
+	default:
+		return lk
+	}
+	for px, v := range lk {
+		lk[px] = v / scale
+	}
+	return lk
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
@@ -0,0 +1,265 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package extrapolate implements a command
+// to build the possible ranges of a taxon
+// at older stages,
+// constrained by a dispersal distance.
+package extrapolate
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/landscape"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `extrapolate [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--model <motion-model> --timepix <time-pixelation>
+	[--prior <prior-file>] --dispersal <distance> [--max-age <age>]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] -o|--output <prefix> [<rng-file>...]`,
+	Short: "extrapolate ranges backwards in time",
+	Long: `
+Command extrapolate reads one or more geographic range files, with present
+locations, and for each stage of a plate motion model, builds the possible
+range of each taxon at that stage, expanding the range by a dispersal distance
+at each stage. This is a common way to set priors for the ancestral range of a
+taxon.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. Only taxa with ranges at the
+present (age 0) will be used.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --model is required and defines a pixelated plate motion model. The
+flag --timepix is required and defines the time pixelation used as the
+landscape. Prior probabilities for each pixel type can be defined on a file
+and read with the flag --prior (the same format used by the command kde). At
+each stage, only pixels with a non-zero prior (or a non-zero value in the time
+pixelation, if no prior is given) are included in the range.
+
+The flag --dispersal is required and defines the dispersal distance (in km) at
+each stage. Starting from the present range, at each stage the range is
+expanded to include all the pixels at the given distance of the range at the
+previous stage. The expansion is done using present locations, and then, the
+expanded range is rotated to the stage age, and masked with the landscape of
+that stage.
+
+By default all the stages of the plate motion model will be used. Use the flag
+--max-age to set the oldest stage (in million years).
+
+The flag --output, or -o, is required and defines the prefix of the output
+files. A range file will be produced for each stage, with the age of the stage
+appended to the prefix.
+
+Existing output files are not overwritten, unless the flag --force is defined.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var dispersal float64
+var maxAge float64
+var modelFile string
+var timepixFile string
+var priorFile string
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().Float64Var(&dispersal, "dispersal", 0, "")
+	c.Flags().Float64Var(&maxAge, "max-age", 0, "")
+	c.Flags().StringVar(&modelFile, "model", "", "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().StringVar(&priorFile, "prior", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if modelFile == "" {
+		return c.UsageError("flag --model required")
+	}
+	if timepixFile == "" {
+		return c.UsageError("flag --timepix required")
+	}
+	if dispersal <= 0 {
+		return c.UsageError("flag --dispersal required")
+	}
+	if output == "" {
+		return c.UsageError("flag --output required")
+	}
+	if output == "-" {
+		return c.UsageError("flag --output: the standard output can not be used as a prefix")
+	}
+	log := logger.New(c.Stderr())
+
+	tot, err := readRotation(modelFile)
+	if err != nil {
+		return err
+	}
+	land, err := landscape.Read(timepixFile, priorFile, tot.Pixelation())
+	if err != nil {
+		return err
+	}
+
+	present := ranges.New(tot.Pixelation())
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, tot.Pixelation())
+		if err != nil {
+			return err
+		}
+		for _, tax := range coll.Taxa() {
+			if coll.Age(tax) != 0 {
+				log.Warn("taxon ignored: not at present", "taxon", tax, "age", float64(coll.Age(tax))/millionYears)
+				continue
+			}
+			present.SetPixels(coll.VerbatimName(tax), 0, coll.Range(tax))
+		}
+	}
+	if len(present.Taxa()) == 0 {
+		return nil
+	}
+
+	stages := slices.Clone(tot.Stages())
+	slices.Sort(stages)
+
+	taxa := present.Taxa()
+	curr := make(map[string]map[int]float64, len(taxa))
+	for _, tax := range taxa {
+		curr[tax] = present.Range(tax)
+	}
+	pix := tot.Pixelation()
+	for _, age := range stages {
+		if age == 0 {
+			continue
+		}
+		if maxAge > 0 && age > int64(maxAge*millionYears) {
+			break
+		}
+
+		rot := tot.Rotation(age)
+		onStage := land.At(age)
+		stColl := ranges.New(pix)
+		for _, tax := range taxa {
+			buf := ranges.Buffer(pix, curr[tax], dispersal)
+
+			// keep only pixels on land at the stage
+			exp := make(map[int]float64, len(buf))
+			rng := make(map[int]float64)
+			for px := range buf {
+				var onLand bool
+				for _, dst := range rot[px] {
+					if !onStage[dst] {
+						continue
+					}
+					rng[dst] = 1
+					onLand = true
+				}
+				if onLand {
+					exp[px] = 1
+				}
+			}
+			// the previous range is always kept
+			for px := range curr[tax] {
+				exp[px] = 1
+			}
+			curr[tax] = exp
+
+			if len(rng) == 0 {
+				log.Warn("empty range", "taxon", tax, "age", float64(age)/millionYears)
+				continue
+			}
+			stColl.SetPixels(present.VerbatimName(tax), age, rng)
+			log.Debug("range extrapolated", "taxon", tax, "age", float64(age)/millionYears, "pixels", len(rng))
+		}
+
+		name := fmt.Sprintf("%s-%.3f.tab", output, float64(age)/millionYears)
+		outformat.Set(stColl)
+		summary.Written(len(stColl.Taxa()))
+		if err := files.WriteFile(name, stColl.TSV); err != nil {
+			return err
+		}
+		log.Info("stage written", "age", float64(age)/millionYears, "file", name)
+	}
+	return nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readRotation(name string) (*model.Total, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rot, err := model.ReadTotal(f, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+
+	return rot, nil
+}
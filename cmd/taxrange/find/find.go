@@ -0,0 +1,128 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package find implements a command to locate
+// the range files in which a taxon is defined.
+package find
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/workspace"
+)
+
+var Command = &command.Command{
+	Usage: `find [--quiet | -v | -vv] [--log-json]
+	[--index <file>] [--partial]
+	[--json-summary <file>] [--force]
+	<taxon>...`,
+	Short: "locate the range files of a taxon",
+	Long: `
+Command find reads a workspace index, and prints the range files in which the
+indicated taxa are defined.
+
+The arguments of the command are the names of the taxa to be searched. Names
+are compared ignoring case. If the flag --partial is defined, any taxon with a
+name that contains one of the arguments will be printed.
+
+A workspace index is built with the command index, using a directory as
+argument. By default, the command looks for the file "taxrange-index.tab" in
+the current directory, and then in its parent directories. Use the flag
+--index to set a different index file.
+
+For each taxon found, the command prints the name of the taxon, the path of
+the range file, the type of the range, its age (in million years), and the
+number of pixels in the range. If a taxon is not found, the command ends with
+an error.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var indexFile string
+var partialFlag bool
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&indexFile, "index", "", "")
+	c.Flags().BoolVar(&partialFlag, "partial", false, "")
+}
+
+// MillionYears is used to transform ages
+// (a float in million years)
+// to an integer (in years).
+const millionYears = 1_000_000
+
+func run(c *command.Command, args []string) error {
+	if len(args) == 0 {
+		return c.UsageError("expecting taxon name")
+	}
+
+	name := indexFile
+	if name == "" {
+		var err error
+		name, err = workspace.Locate()
+		if err != nil {
+			return err
+		}
+	}
+	f, err := files.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries, err := workspace.Read(f)
+	if err != nil {
+		return fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Records(len(entries))
+	dir := filepath.Dir(name)
+
+	var missing []string
+	for _, a := range args {
+		a = strings.Join(strings.Fields(a), " ")
+		var found bool
+		for _, e := range entries {
+			if !match(e.Taxon, a) {
+				continue
+			}
+			found = true
+			p := e.File
+			if !files.IsURL(name) {
+				p = filepath.Join(dir, filepath.FromSlash(e.File))
+			}
+			fmt.Fprintf(c.Stdout(), "%s\t%s\t%s\t%.6f\t%d\n", e.Taxon, p, e.Type, float64(e.Age)/millionYears, e.Pixels)
+		}
+		if !found {
+			missing = append(missing, a)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("taxon not found in %q: %s", name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func match(taxon, name string) bool {
+	if partialFlag {
+		return strings.Contains(strings.ToLower(taxon), strings.ToLower(name))
+	}
+	return strings.EqualFold(taxon, name)
+}
@@ -0,0 +1,236 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package hull implements a command to build
+// the convex hulls of range maps.
+package hull
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/landscape"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/policy"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `hull [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--per-patch] [--link <value>]
+	[--min-points <number> [--fallback <rules>]] [--rules <file>]
+	[--timepix <time-pixelation> [--prior <prior-file>]]
+	[--taxon <name>] [--verbatim]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "build convex hulls of range maps",
+	Long: `
+Command hull reads a geographic range file, and replaces the range of each
+taxon with the pixels inside the spherical convex hull of the range (i.e. the
+minimum convex polygon of the range). The density of all pixels in the hull
+will be set to 1.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+By default a single hull is build for the whole range of the taxon. If the
+flag --per-patch is defined, a hull will be build for each connected patch of
+the range, avoiding hulls that bridge oceans for disjunct taxa. By default, two
+pixels are connected only if they are neighbors. Use the flag --link to define
+a distance (in km) so pixels at a distance less or equal than the indicated
+distance will be connected in the same patch.
+
+A hull is meaningless for taxa with few pixels (for example, a taxon with a
+single point). Use the flag --min-points to define the minimum number of
+pixels of a range to build a hull. For taxa with fewer pixels, a fallback rule
+is used. By default the fallback rule is "buffer=100", i.e. the range is
+replaced by the pixels at a distance of 100 km or less of the pixels of the
+range. Use the flag --fallback to define a different rule: "buffer=<km>" for
+a buffer with the indicated radius, "points" to keep the pixels of the range,
+or "skip" to remove the taxon. Different rules can be used for different
+number of pixels with a comma separated list of rules, each one preceded by
+the number of pixels and a colon, for example "1:buffer=200,2:buffer=100". A
+rule without a number of pixels is used for any other number of pixels. If
+the flag --rules is defined, the rule used for each taxon ("hull", or the
+fallback rule) will be written in the indicated file, as a TSV file with the
+columns "taxon", "points" (the number of pixels of the original range), and
+"rule".
+
+By default, all pixels of the hull are included. If the flag --timepix is
+defined, only the pixels with a non-zero value in the indicated time
+pixelation, at the age of the taxon, will be included (for example, to avoid
+ocean pixels for terrestrial taxa). Prior probabilities for each pixel type
+can be defined on a file and read with the flag --prior (the same format used
+by the command kde), so only the pixels with a non-zero prior will be
+included. The pixels of the original range are always kept.
+
+By default, all taxa in the file will be modified. Use the flag --taxon to
+modify only the indicated taxon. The other taxa will be kept unchanged.
+
+The type of each range is preserved. Record counts of points ranges are
+discarded, as the pixels of the range are modified.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var perPatch bool
+var linkFlag float64
+var taxonFlag string
+var timepixFile string
+var priorFile string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	policy.SetFlags(c)
+	c.Flags().BoolVar(&perPatch, "per-patch", false, "")
+	c.Flags().Float64Var(&linkFlag, "link", 0, "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().StringVar(&priorFile, "prior", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if linkFlag != 0 && !perPatch {
+		return c.UsageError("flag --link requires --per-patch")
+	}
+	if priorFile != "" && timepixFile == "" {
+		return c.UsageError("flag --prior requires --timepix")
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+
+	var land *landscape.Landscape
+	if timepixFile != "" {
+		land, err = landscape.Read(timepixFile, priorFile, coll.Pixelation())
+		if err != nil {
+			return err
+		}
+	}
+
+	pix := coll.Pixelation()
+	for _, tax := range coll.Taxa() {
+		if taxonFlag != "" && !strings.EqualFold(tax, strings.Join(strings.Fields(taxonFlag), " ")) {
+			continue
+		}
+
+		rng := coll.Range(tax)
+		var hull map[int]float64
+		if r, ok := policy.Fallback(len(rng)); ok {
+			policy.Record(coll.VerbatimName(tax), len(rng), r.String())
+			var keep bool
+			hull, keep = r.Apply(pix, rng)
+			if !keep {
+				log.Info("taxon skipped", "taxon", tax, "pixels", len(rng))
+				coll.Delete(tax)
+				continue
+			}
+			log.Debug("fallback rule", "taxon", tax, "pixels", len(rng), "rule", r.String())
+		} else if perPatch {
+			policy.Record(coll.VerbatimName(tax), len(rng), "hull")
+			hull = ranges.PatchHulls(pix, rng, linkFlag)
+		} else {
+			policy.Record(coll.VerbatimName(tax), len(rng), "hull")
+			hull = ranges.ConvexHull(pix, rng)
+		}
+		if land != nil {
+			hull = land.Mask(hull, coll.Age(tax), rng)
+		}
+		if len(hull) == pix.Len() && len(rng) < pix.Len() {
+			log.Warn("hull covers the whole sphere", "taxon", tax)
+		}
+		log.Debug("hull", "taxon", tax, "pixels", len(rng), "hull", len(hull))
+
+		if coll.Type(tax) == ranges.Points {
+			coll.SetPixels(coll.VerbatimName(tax), coll.Age(tax), hull)
+			continue
+		}
+		coll.Set(coll.VerbatimName(tax), coll.Age(tax), hull)
+	}
+
+	summary.Written(len(coll.Taxa()))
+	if err := files.Output(c.Stdout(), output, coll.TSV); err != nil {
+		return err
+	}
+	return policy.Write()
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package imppoints
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BasisOfRecord are the valid values
+// of the DarwinCore term basisOfRecord,
+// in its normalized form.
+var basisOfRecord = map[string]bool{
+	"preservedspecimen":  true,
+	"fossilspecimen":     true,
+	"livingspecimen":     true,
+	"materialsample":     true,
+	"materialcitation":   true,
+	"humanobservation":   true,
+	"machineobservation": true,
+	"observation":        true,
+	"occurrence":         true,
+}
+
+// NormBasis returns the normalized form
+// of a basis of record
+// so "PreservedSpecimen", "preserved specimen",
+// and "PRESERVED_SPECIMEN"
+// are the same value.
+func normBasis(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(s)))
+}
+
+// A BasisFilter filters the records
+// of an input file
+// by its basis of record.
+type basisFilter struct {
+	basis    map[string]bool
+	rejected int
+}
+
+// Basis is the basis of record filter
+// of the file that is being imported.
+// ParseBasis returns the set of accepted
+// basis of record
+// from a comma-separated list.
+func parseBasis(s string) (map[string]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	accepted := make(map[string]bool)
+	for _, v := range strings.Split(s, ",") {
+		b := normBasis(v)
+		if !basisOfRecord[b] {
+			return nil, fmt.Errorf("invalid basis of record %q", v)
+		}
+		accepted[b] = true
+	}
+	return accepted, nil
+}
+
+// Check checks the basis of record of a record.
+// It returns false if the record should be rejected.
+func (bf *basisFilter) check(row []string, fields map[string]int) bool {
+	if bf.basis == nil {
+		return true
+	}
+	if bf.basis[normBasis(row[fields["basisofrecord"]])] {
+		return true
+	}
+	bf.rejected++
+	return false
+}
@@ -0,0 +1,53 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package imppoints
+
+import (
+	"fmt"
+
+	"github.com/js-arias/ranges/cmd/taxrange/internal/script"
+)
+
+// A RecordFilter filters the records
+// of an input file
+// using an user defined expression.
+type recordFilter struct {
+	expr     *script.Expr
+	rejected int
+}
+
+// Filter is the user defined filter
+// of the file that is being imported.
+// CheckFields returns an error
+// if the filter expression uses a field
+// that is not in the input file.
+func (rf *recordFilter) checkFields(fields map[string]int) error {
+	if rf.expr == nil {
+		return nil
+	}
+	for _, v := range rf.expr.Vars() {
+		if _, ok := fields[v]; !ok {
+			return fmt.Errorf("filter expression: expecting field %q", v)
+		}
+	}
+	return nil
+}
+
+// Check evaluates the filter expression
+// on a record.
+// It returns false if the record should be rejected.
+func (rf *recordFilter) check(row []string, fields map[string]int) bool {
+	if rf.expr == nil {
+		return true
+	}
+	env := func(name string) script.Value {
+		return script.Str(row[fields[name]])
+	}
+	if rf.expr.Eval(env).IsTrue() {
+		return true
+	}
+	rf.rejected++
+	return false
+}
@@ -8,24 +8,35 @@
 package imppoints
 
 import (
-	"bufio"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/earth"
-	"github.com/js-arias/gbifer/tsv"
 	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/script"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/importer"
 )
 
 var Command = &command.Command{
-	Usage: `imp.points [-e|--equator <value>] [--age <age>]
-	[-f|--format <format>] [-o|--output <file>] [<input-file>...]`,
+	Usage: `imp.points [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[-e|--equator <value> | --resolution <value>] [--age <age>]
+	[--min-precision <value> [--flag-precision]] [--introduced <mode>]
+	[--min-year <year>] [--max-year <year>] [--basis <value>[,<value>...]]
+	[--drop-issue <issue>[,<issue>...]] [--filter <expression>]
+	[-f|--format <format>] [--taxon <name> [--no-header]]
+	[--gbif] [--checklist <file>]
+	[--names-report <file>] [--verbatim] [--append | --replace]
+	[--sort <order>] [--reproducible]
+	[--force] [-o|--output <file>] [<input-file>...]`,
 	Short: "import a list of specimen records",
 	Long: `
 Command imp.points reads one or more files with specimen records, and import
@@ -37,6 +48,8 @@ will be simple text files, delimited by tab character and with the following
 fields: "species", "latitude", and "longitude". Using the flag --format, or -f,
 an alternative format can be defined. Valid formats are:
 
+Input files can also be read from an URL (see "taxrange help urls").
+
 	darwin	DarwinCore format using tab characters as delimiters (i.e. as
 		files download from GBIF). Key fields are: "species",
 		"decimalLatitude", and "decimalLongitude".
@@ -47,31 +60,215 @@ an alternative format can be defined. Valid formats are:
 	text	The default value, a simple tab-delimited file, with the
 		following fields: "species", "latitude", and "longitude".
 
+To import the records of a single taxon, use the flag --taxon with the name of
+the taxon. In that case, all the records of the input files will be assigned
+to the indicated taxon, and the field "species" is not required. If the flag
+--no-header is also defined, the input files will be read as plain
+tab-delimited lists of coordinates, without a header, in which the first
+column is the latitude, and the second column is the longitude. For example:
+
+	taxrange imp.points --taxon "Brontostoma discus" --no-header \
+		-o discus.tab coordinates.txt
+
+These flags can only be used with the "text" format.
+
 By default the output will be printed in the standard output. If the flag
 --output, or -o, is defined the indicated file will be used as output. If the
-file exists, points will be added to the indicated file.
+file exists, points will be added to the indicated file (the same as using the
+flag --append). Use the flag --replace to discard the content of the file. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. With the flag --replace, an
+existing output file is not overwritten, unless the flag --force is defined.
+Other files written by the command (for example, the file defined by --report)
+are not overwritten either, unless the flag --force is defined.
 
 By default the pixelation will of 360 pixels at the equator. This can be
 changed with the flag --equator, or -e. If an output file is defined, and the
 file exists, then the pixelation will be read from that file.
 
+Alternatively, the flag --resolution defines the pixelation by the size of
+the pixels at the equator, either in degrees, with the suffix "deg", or in arc
+minutes, with the suffix "min". For example "1deg" (equivalent to an equator
+of 360 pixels), "0.5deg" or "30min" (720 pixels), or "0.1deg" (3600 pixels).
+
+If the precision of the coordinates of the records (as defined by the number
+of decimal places in the input file) is coarser than the pixel size, the
+resolution of the data is overstated. For each input file, the number of
+records with such coordinates will be reported as a warning.
+
+Records with coordinates with few decimal places (for example, integer
+degrees) are frequently gridded, low-quality records, that bias density
+estimates. Use the flag --min-precision to reject records with coordinates
+with less decimal places than the indicated value. As trailing zeros are
+frequently removed from the coordinates, the number of decimal places of a
+record is the number of decimal places of its most precise coordinate. If the
+flag --flag-precision is defined, the records will not be rejected, but each
+record will be reported as a warning.
+
+If the input file includes the column "establishmentMeans" (from DarwinCore),
+the pixel of each record will be tagged with its establishment means: either
+"native" (values "native", or "nativeReintroduced"), "introduced" (values
+"introduced", "introducedAssistedColonisation", or older values such as
+"invasive", "naturalised", or "managed"), or "uncertain" (values "uncertain",
+or "vagrant"). If a pixel has records with different establishment means, a
+native record has precedence over an uncertain one, and an uncertain record
+over an introduced one, so a pixel is only tagged as introduced if all of its
+records are introduced. The establishment means is stored in the column
+"establishmentMeans" of the output file. Use the flag --introduced to filter
+the records: "include" (the default) imports all records, "exclude" rejects
+the introduced records, and "only" imports only the introduced records.
+
+Records can be filtered by its collection date. Use the flag --min-year to
+reject the records collected before the indicated year (for example, records
+collected before the use of GPS), and the flag --max-year to reject the
+records collected after the indicated year (for example, to build a range
+snapshot for each decade). The collection year is read from the column "year"
+or, if it is not defined, or it is empty, from the column "eventDate" (from
+DarwinCore). If the event date is an interval (e.g. "1990/1995"), the whole
+interval must be inside the indicated years. If any of these flags is
+defined, records without a collection date will be rejected. For each input
+file, the number of rejected records will be reported as a warning. These
+flags can not be used with the "pbdb" format.
+
+Records can be filtered by its basis of record (from the DarwinCore column
+"basisOfRecord"). Use the flag --basis with a comma-separated list of the
+accepted values, for example "--basis PreservedSpecimen,FossilSpecimen" to
+only import specimen-backed records. Valid values are: "PreservedSpecimen",
+"FossilSpecimen", "LivingSpecimen", "MaterialSample", "MaterialCitation",
+"HumanObservation", "MachineObservation", "Observation", and "Occurrence".
+The values are case insensitive, and underscores are ignored (so the values
+used by the GBIF API, such as "PRESERVED_SPECIMEN", are also valid). If the
+flag is defined, the input files must have the column "basisOfRecord". For
+each input file, the number of rejected records will be reported as a
+warning. This flag can not be used with the "pbdb" format.
+
+GBIF downloads include the column "issue" with the data quality issues
+flagged by GBIF for each record, separated by semicolons. Use the flag
+--drop-issue with a comma-separated list of issues to reject the records
+flagged with any of the indicated issues, for example "--drop-issue
+ZERO_COORDINATE,COUNTRY_COORDINATE_MISMATCH". The issues are case
+insensitive. If the flag is defined, the input files must have the column
+"issue". For each input file, the number of rejected records for each issue
+will be reported as a warning (a record flagged with several of the indicated
+issues is counted for each issue). This flag can not be used with the "pbdb"
+format.
+
+Custom filters can be defined with the flag --filter, using an expression
+that is evaluated for each record. Variables in the expression are the fields
+of the input file (in lower case), and a record is imported only if the
+expression is true. For example, to import only records with a coordinate
+uncertainty smaller than 10 km, and collected by a given institution:
+
+	--filter "coordinateUncertaintyInMeters < 10000 && institutionCode == 'MLP'"
+
+An expression accepts numbers, strings (between quotes), the operators +, -,
+*, /, ==, !=, <, <=, >, >=, && (and), || (or), and ! (not), parenthesis, and
+the functions abs, contains, empty, exp, if, log, lower, max, min, pow, and
+sqrt. Fields that are not valid numbers (for example, empty fields) are never
+equal, smaller or greater than a number, and comparisons between strings are
+case insensitive. If the flag value starts with '@', the expression will be
+read from the indicated file (in which lines starting with '#' are ignored).
+For each input file, the number of rejected records will be reported as a
+warning.
+
 By default points will be set at present time. Use flag --age to set a
 different time. Take into account that this command does not make any rotation,
 so the locations will be set at the given age, assuming that the indicated
 coordinates are real paleo-coordinates. The age is set in million years.
+
+Taxon names can be validated before they are added to the range map. If the
+flag --gbif is defined, names will be searched in the GBIF backbone taxonomy,
+and if the flag --checklist is defined, names will be searched in the indicated
+checklist file. The checklist is a tab-delimited file with the following
+columns:
+
+	name	the taxon name
+	accepted	the accepted name for the taxon, if empty, or equal to
+			name, the name will be considered as accepted
+
+Here is an example of a checklist file:
+
+	name	accepted
+	Brontostoma discus
+	Brontostoma colombiense	Brontostoma discus
+
+If both flags are given, names will be searched first in the checklist. The
+records of a synonym will be added to its accepted name. Unresolved names
+will be imported as given, and reported as warnings. Use the flag
+--names-report to write a tab-delimited file with the status of each name
+(either "accepted", "synonym", or "unresolved").
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      summary.Run(run),
 }
 
 var ageFlag float64
+var gbifFlag bool
+var checklistFile string
+var reportFile string
+var appendFlag bool
+var replaceFlag bool
+var verbatimFlag bool
 var equator int
+var resolution string
+var minPrecision int
+var flagPrecision bool
+var minYear int
+var maxYear int
+var basisFlag string
+var issueFlag string
+var taxonFlag string
+var filterFlag string
+var noHeader bool
 var format string
+var inFormat importer.Format
 var output string
 
 func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&appendFlag, "append", false, "")
+	c.Flags().BoolVar(&replaceFlag, "replace", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().BoolVar(&gbifFlag, "gbif", false, "")
+	c.Flags().Float64Var(&ageFlag, "age", 0, "")
+	c.Flags().StringVar(&checklistFile, "checklist", "", "")
+	c.Flags().StringVar(&reportFile, "names-report", "", "")
 	c.Flags().IntVar(&equator, "e", 360, "")
 	c.Flags().IntVar(&equator, "equator", 360, "")
+	c.Flags().StringVar(&resolution, "resolution", "", "")
+	c.Flags().IntVar(&minPrecision, "min-precision", 0, "")
+	c.Flags().BoolVar(&flagPrecision, "flag-precision", false, "")
+	c.Flags().IntVar(&minYear, "min-year", 0, "")
+	c.Flags().IntVar(&maxYear, "max-year", 0, "")
+	c.Flags().StringVar(&basisFlag, "basis", "", "")
+	c.Flags().StringVar(&issueFlag, "drop-issue", "", "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+	c.Flags().StringVar(&filterFlag, "filter", "", "")
+	c.Flags().BoolVar(&noHeader, "no-header", false, "")
 	c.Flags().StringVar(&format, "format", "text", "")
 	c.Flags().StringVar(&format, "f", "text", "")
 	c.Flags().StringVar(&output, "output", "", "")
@@ -79,60 +276,150 @@ func setFlags(c *command.Command) {
 }
 
 func run(c *command.Command, args []string) (err error) {
+	if appendFlag && replaceFlag {
+		return c.UsageError("both --append and --replace flags defined")
+	}
+	if minYear != 0 && maxYear != 0 && minYear > maxYear {
+		return c.UsageError("flag --min-year greater than --max-year")
+	}
+	accepted, err := parseBasis(basisFlag)
+	if err != nil {
+		return c.UsageError(err.Error())
+	}
+	dropIssues := parseIssues(issueFlag)
+	var filterExpr *script.Expr
+	if filterFlag != "" {
+		filterExpr, err = script.Read(filterFlag)
+		if err != nil {
+			return c.UsageError(fmt.Sprintf("flag --filter: %v", err))
+		}
+	}
+	taxonFlag = strings.Join(strings.Fields(taxonFlag), " ")
+	if noHeader && taxonFlag == "" {
+		return c.UsageError("flag --no-header defined without --taxon")
+	}
+	if noHeader && (accepted != nil || dropIssues != nil) {
+		return c.UsageError("flags --basis and --drop-issue can not be used with --no-header")
+	}
+	if noHeader && (minYear != 0 || maxYear != 0) {
+		return c.UsageError("flags --min-year and --max-year can not be used with --no-header")
+	}
+	if resolution != "" {
+		if equator != 360 {
+			return c.UsageError("both --equator and --resolution flags defined")
+		}
+		eq, err := parseResolution(resolution)
+		if err != nil {
+			return c.UsageError(err.Error())
+		}
+		equator = eq
+	}
+
 	coll, err := readCollection(output)
 	if err != nil {
 		return err
 	}
-	if equator != 360 && coll.Pixelation().Equator() != equator {
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+	if (equator != 360 || resolution != "") && coll.Pixelation().Equator() != equator {
 		return fmt.Errorf("invalid --equator value %d: want %d", equator, coll.Pixelation().Equator())
 	}
 
-	format = strings.ToLower(format)
-	readFunc := readTextData
-	switch format {
-	case "text":
-	case "":
-	case "darwin":
-		readFunc = readGBIFData
-	case "csv":
-		readFunc = readGBIFData
-	case "pbdb":
-		readFunc = readPaleoDBData
-	default:
-		return fmt.Errorf("format %q unknown", format)
+	inFormat, err = importer.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if taxonFlag != "" && inFormat != importer.Text {
+		return c.UsageError(fmt.Sprintf("flag --taxon can not be used with %q format", inFormat))
+	}
+	if inFormat == importer.PBDB {
+		if minYear != 0 || maxYear != 0 {
+			return c.UsageError("flags --min-year and --max-year can not be used with \"pbdb\" format")
+		}
+		if accepted != nil {
+			return c.UsageError("flag --basis can not be used with \"pbdb\" format")
+		}
+		if dropIssues != nil {
+			return c.UsageError("flag --drop-issue can not be used with \"pbdb\" format")
+		}
+	}
+
+	log := logger.New(c.Stderr())
+	resolver, err := newResolver(log)
+	if err != nil {
+		return err
 	}
 
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
+	log.Info("pixelation", "equator", coll.Pixelation().Equator(), "step", coll.Pixelation().Step())
 	for _, a := range args {
-		if err := readFunc(c.Stdin(), a, coll); err != nil {
+		rf := &recordFilters{
+			precision: precisionCheck{
+				log:  log,
+				file: a,
+				step: coll.Pixelation().Step(),
+				min:  minPrecision,
+				flag: flagPrecision,
+			},
+			years: yearFilter{
+				min: minYear,
+				max: maxYear,
+			},
+			basis: basisFilter{
+				basis: accepted,
+			},
+			issues: issueFilter{
+				issues: dropIssues,
+			},
+			filter: recordFilter{
+				expr: filterExpr,
+			},
+		}
+		n, err := readData(c.Stdin(), a, coll, resolver, rf)
+		if err != nil {
 			return err
 		}
+		if rf.precision.rejected > 0 {
+			log.Warn("records rejected by coordinate precision", "file", a, "records", rf.precision.rejected, "total", n)
+		}
+		if rf.basis.rejected > 0 {
+			log.Warn("records rejected by basis of record", "file", a, "records", rf.basis.rejected, "total", n)
+		}
+		for _, iss := range rf.issues.droppedIssues() {
+			log.Warn("records rejected by GBIF issue", "file", a, "issue", iss, "records", rf.issues.dropped[iss], "total", n)
+		}
+		if rf.filter.rejected > 0 {
+			log.Warn("records rejected by filter", "file", a, "records", rf.filter.rejected, "total", n)
+		}
+		if rf.years.rejected > 0 || rf.years.undated > 0 {
+			log.Warn("records rejected by collection year", "file", a, "records", rf.years.rejected, "undated", rf.years.undated, "total", n)
+		}
+		if rf.precision.coarse > 0 {
+			log.Warn("coordinate precision coarser than pixel size", "file", a, "records", rf.precision.coarse, "total", n, "step", coll.Pixelation().Step())
+		}
+		log.Info("file imported", "file", a, "taxa", len(coll.Taxa()))
 	}
 
-	w := c.Stdout()
-	if output != "" {
-		f, err := os.Create(output)
-		if err != nil {
+	if resolver != nil && reportFile != "" {
+		if err := files.WriteFile(reportFile, resolver.writeReport); err != nil {
 			return err
 		}
-		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
-			}
-		}()
-		w = f
 	}
-	if err := coll.TSV(w); err != nil {
-		return err
+
+	summary.Written(len(coll.Taxa()))
+	if files.IsStd(output) {
+		return coll.TSV(c.Stdout())
+	}
+	if replaceFlag {
+		return files.WriteFile(output, coll.TSV)
 	}
-	return nil
+	return files.ReplaceFile(output, coll.TSV)
 }
 
 func readCollection(name string) (*ranges.Collection, error) {
-	if name == "" {
+	if files.IsStd(name) || replaceFlag {
 		pix := earth.NewPixelation(equator)
 		return ranges.New(pix), nil
 	}
@@ -154,180 +441,74 @@ func readCollection(name string) (*ranges.Collection, error) {
 	return coll, nil
 }
 
+// TaxonName returns the name used to store a taxon.
+// If the name resolver is nil,
+// the name is returned as given.
+func taxonName(nr *nameResolver, name string) (string, error) {
+	if nr == nil {
+		return name, nil
+	}
+	return nr.resolve(name)
+}
+
 // MillionYears is used to set a flag age
 // (in million years)
 // to pixel ages (in years).
 const millionYears = 1_000_000
 
-var headerFields = []string{
-	"species",
-	"latitude",
-	"longitude",
-}
-
-func readTextData(r io.Reader, name string, c *ranges.Collection) error {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
-	}
-
-	tab := csv.NewReader(r)
-	tab.Comma = '\t'
-	tab.Comment = '#'
-
-	head, err := tab.Read()
-	if err != nil {
-		return fmt.Errorf("on file %q: while reading header: %v", name, err)
-	}
-	fields := make(map[string]int, len(head))
-	for i, h := range head {
-		h = strings.ToLower(h)
-		fields[h] = i
-	}
-	for _, h := range headerFields {
-		if _, ok := fields[h]; !ok {
-			return fmt.Errorf("on file %q: expecting field %q", name, h)
-		}
-	}
-
-	age := int64(ageFlag * millionYears)
-	for {
-		row, err := tab.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		ln, _ := tab.FieldPos(0)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: %v", name, ln, err)
-		}
-
-		f := "species"
-		tax := row[fields[f]]
-
-		f = "latitude"
-		lat, err := strconv.ParseFloat(row[fields[f]], 64)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
-		}
-		if lat < -90 || lat > 90 {
-			return fmt.Errorf("on file %q: row %d: field %q: invalid latitude %.6f", name, ln, f, lat)
-		}
-
-		f = "longitude"
-		lon, err := strconv.ParseFloat(row[fields[f]], 64)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
-		}
-		if lon < -180 || lon > 180 {
-			return fmt.Errorf("on file %q: row %d: field %q: invalid longitude %.6f", name, ln, f, lon)
-		}
-
-		if tp := c.Type(tax); tp != "" && tp != ranges.Points {
-			return fmt.Errorf("taxon %q: has defined a %q map", tax, tp)
-		}
-
-		c.Add(tax, age, lat, lon)
-	}
-	return nil
-}
-
-var gbifFields = []string{
-	"species",
-	"decimallatitude",
-	"decimallongitude",
+// RecordFilters are the filters
+// used to check the records
+// of an input file.
+type recordFilters struct {
+	precision precisionCheck
+	years     yearFilter
+	basis     basisFilter
+	issues    issueFilter
+	filter    recordFilter
 }
 
-func readGBIFData(r io.Reader, name string, c *ranges.Collection) error {
-	if name != "-" {
-		f, err := os.Open(name)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		r = f
-	} else {
-		name = "stdin"
+// AddRecord adds a record to a collection,
+// with the establishment means
+// of the record,
+// if it is defined in the input file.
+// It returns false if the record was rejected
+// by its basis of record,
+// its GBIF issues,
+// the user defined filter,
+// its collection year,
+// or its establishment means.
+func addRecord(c *ranges.Collection, rf *recordFilters, tax string, age int64, lat, lon float64, row []string, fields map[string]int) bool {
+	if !rf.basis.check(row, fields) {
+		return false
 	}
-
-	tab := tsv.NewReader(r)
-	if format != "csv" {
-		tab.Comma = '\t'
+	if !rf.issues.check(row, fields) {
+		return false
 	}
-
-	head, err := tab.Read()
-	if err != nil {
-		return fmt.Errorf("on file %q: while reading header: %v", name, err)
+	if !rf.filter.check(row, fields) {
+		return false
 	}
-	fields := make(map[string]int, len(head))
-	for i, h := range head {
-		h = strings.ToLower(h)
-		fields[h] = i
+	if !rf.years.check(row, fields) {
+		return false
 	}
-	for _, h := range gbifFields {
-		if _, ok := fields[h]; !ok {
-			return fmt.Errorf("on file %q: expecting field %q", name, h)
-		}
+	var m ranges.Means
+	if i, ok := fields["establishmentmeans"]; ok {
+		m = ranges.ParseMeans(row[i])
 	}
-
-	age := int64(ageFlag * millionYears)
-	for {
-		row, err := tab.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		ln, _ := tab.FieldPos(0)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: %v", name, ln, err)
-		}
-
-		f := "species"
-		tax := row[fields[f]]
-
-		f = "decimallatitude"
-		lat, err := strconv.ParseFloat(row[fields[f]], 64)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
-		}
-		if lat < -90 || lat > 90 {
-			return fmt.Errorf("on file %q: row %d: field %q: invalid latitude %.6f", name, ln, f, lat)
-		}
-
-		f = "decimallongitude"
-		lon, err := strconv.ParseFloat(row[fields[f]], 64)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
-		}
-		if lon < -180 || lon > 180 {
-			return fmt.Errorf("on file %q: row %d: field %q: invalid longitude %.6f", name, ln, f, lon)
-		}
-
-		if tp := c.Type(tax); tp != "" && tp != ranges.Points {
-			return fmt.Errorf("taxon %q: has defined a %q map", tax, tp)
-		}
-
-		c.Add(tax, age, lat, lon)
+	if !introduced.Keep(m) {
+		return false
 	}
-
-	return nil
-}
-
-var pbdbFields = []string{
-	"accepted_name",
-	"lat",
-	"lng",
+	c.Add(tax, age, lat, lon)
+	c.AddMeans(tax, c.Pixelation().Pixel(lat, lon).ID(), m)
+	return true
 }
 
-func readPaleoDBData(r io.Reader, name string, c *ranges.Collection) error {
+// ReadData reads the records of an input file,
+// and returns the number of records read.
+func readData(r io.Reader, name string, c *ranges.Collection, nr *nameResolver, rf *recordFilters) (int, error) {
 	if name != "-" {
-		f, err := os.Open(name)
+		f, err := files.Open(name)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		defer f.Close()
 		r = f
@@ -335,76 +516,64 @@ func readPaleoDBData(r io.Reader, name string, c *ranges.Collection) error {
 		name = "stdin"
 	}
 
-	br := bufio.NewReader(r)
-	metaLines := 0
-	for {
-		ln, err := br.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf("on file %q: %v", name, err)
-		}
-		metaLines++
-		if strings.HasPrefix(ln, "Records:") {
-			break
-		}
+	var opts []importer.Option
+	if taxonFlag != "" {
+		opts = append(opts, importer.WithTaxon(taxonFlag))
 	}
-
-	tab := tsv.NewReader(br)
-	tab.Comma = '\t'
-
-	head, err := tab.Read()
+	if noHeader {
+		opts = append(opts, importer.WithoutHeader())
+	}
+	rd, err := importer.NewReader(r, inFormat, opts...)
 	if err != nil {
-		return fmt.Errorf("on file %q: while reading header: %v", name, err)
+		return 0, fmt.Errorf("on file %q: %v", name, err)
 	}
-	fields := make(map[string]int, len(head))
-	for i, h := range head {
-		h = strings.ToLower(h)
-		fields[h] = i
+	if !rd.HasField("basisofrecord") && rf.basis.basis != nil {
+		return 0, fmt.Errorf("on file %q: expecting field %q", name, "basisOfRecord")
 	}
-	for _, h := range pbdbFields {
-		if _, ok := fields[h]; !ok {
-			return fmt.Errorf("on file %q: expecting field %q", name, h)
-		}
+	if !rd.HasField("issue") && rf.issues.issues != nil {
+		return 0, fmt.Errorf("on file %q: expecting field %q", name, "issue")
+	}
+	if err := rf.filter.checkFields(rd.Fields()); err != nil {
+		return 0, fmt.Errorf("on file %q: %v", name, err)
 	}
 
+	taxField, _, _ := inFormat.Fields()
 	age := int64(ageFlag * millionYears)
+	var n int
 	for {
-		row, err := tab.Read()
+		rec, err := rd.Read()
 		if errors.Is(err, io.EOF) {
 			break
 		}
-		ln, _ := tab.FieldPos(0)
-		ln += metaLines
 		if err != nil {
-			return fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+			return 0, fmt.Errorf("on file %q: %v", name, err)
 		}
+		n++
 
-		f := "accepted_name"
-		tax := row[fields[f]]
-
-		f = "lat"
-		lat, err := strconv.ParseFloat(row[fields[f]], 64)
+		tax, err := taxonName(nr, rec.Taxon)
 		if err != nil {
-			return fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+			return 0, fmt.Errorf("on file %q: row %d: field %q: %v", name, rec.Line, taxField, err)
 		}
-		if lat < -90 || lat > 90 {
-			return fmt.Errorf("on file %q: row %d: field %q: invalid latitude %.6f", name, ln, f, lat)
+		if tp := c.Type(tax); tp != "" && tp != ranges.Points {
+			return 0, fmt.Errorf("taxon %q: has defined a %q map", tax, tp)
 		}
 
-		f = "lng"
-		lon, err := strconv.ParseFloat(row[fields[f]], 64)
-		if err != nil {
-			return fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		if !rf.precision.check(tax, rec.Line, rec.RawLat, rec.RawLon) {
+			continue
 		}
-		if lon < -180 || lon > 180 {
-			return fmt.Errorf("on file %q: row %d: field %q: invalid longitude %.6f", name, ln, f, lon)
+		if inFormat == importer.PBDB {
+			// PaleoBioDB records are only filtered
+			// by user defined filters
+			if !rf.filter.check(rec.Row(), rec.Fields()) {
+				continue
+			}
+			c.Add(tax, age, rec.Lat, rec.Lon)
+			continue
 		}
-
-		if tp := c.Type(tax); tp != "" && tp != ranges.Points {
-			return fmt.Errorf("taxon %q: has defined a %q map", tax, tp)
+		if !addRecord(c, rf, tax, age, rec.Lat, rec.Lon, rec.Row(), rec.Fields()) {
+			continue
 		}
-
-		c.Add(tax, age, lat, lon)
 	}
-
-	return nil
+	summary.Records(n)
+	return n, nil
 }
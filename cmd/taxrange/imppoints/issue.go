@@ -0,0 +1,73 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package imppoints
+
+import (
+	"slices"
+	"strings"
+)
+
+// An IssueFilter filters the records
+// of an input file
+// by the issues flagged by GBIF.
+type issueFilter struct {
+	issues  map[string]bool
+	dropped map[string]int
+}
+
+// Issues is the GBIF issue filter
+// of the file that is being imported.
+// ParseIssues returns the set of issues
+// from a comma-separated list.
+func parseIssues(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		set[v] = true
+	}
+	return set
+}
+
+// Check checks the GBIF issues of a record.
+// It returns false if the record should be rejected.
+func (ifl *issueFilter) check(row []string, fields map[string]int) bool {
+	if ifl.issues == nil {
+		return true
+	}
+
+	ok := true
+	for _, v := range strings.FieldsFunc(row[fields["issue"]], func(r rune) bool {
+		return r == ';' || r == ','
+	}) {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if !ifl.issues[v] {
+			continue
+		}
+		if ifl.dropped == nil {
+			ifl.dropped = make(map[string]int)
+		}
+		ifl.dropped[v]++
+		ok = false
+	}
+	return ok
+}
+
+// DroppedIssues returns the issues
+// with rejected records,
+// sorted alphabetically.
+func (ifl *issueFilter) droppedIssues() []string {
+	ls := make([]string, 0, len(ifl.dropped))
+	for iss := range ifl.dropped {
+		ls = append(ls, iss)
+	}
+	slices.Sort(ls)
+	return ls
+}
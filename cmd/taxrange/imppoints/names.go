@@ -0,0 +1,228 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package imppoints
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/gbifer/gbif"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// Name status values.
+const (
+	accepted   = "accepted"
+	synonym    = "synonym"
+	unresolved = "unresolved"
+)
+
+// A NameEntry is the resolution of a taxon name.
+type nameEntry struct {
+	name     string
+	status   string
+	accepted string
+}
+
+// A NameResolver validates taxon names
+// against the GBIF backbone
+// or a local checklist.
+type nameResolver struct {
+	log       *slog.Logger
+	gbif      bool
+	checklist map[string]nameEntry
+	cache     map[string]nameEntry
+}
+
+func newResolver(log *slog.Logger) (*nameResolver, error) {
+	if !gbifFlag && checklistFile == "" {
+		return nil, nil
+	}
+
+	nr := &nameResolver{
+		log:   log,
+		gbif:  gbifFlag,
+		cache: make(map[string]nameEntry),
+	}
+	if checklistFile != "" {
+		cl, err := readChecklist(checklistFile)
+		if err != nil {
+			return nil, err
+		}
+		nr.checklist = cl
+	}
+	if nr.gbif {
+		gbif.Open()
+	}
+	return nr, nil
+}
+
+// Resolve returns the accepted name of a taxon.
+// If the name is not found,
+// it returns the same name.
+func (nr *nameResolver) resolve(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", nil
+	}
+	key := strings.ToLower(name)
+	if e, ok := nr.cache[key]; ok {
+		return e.accepted, nil
+	}
+
+	e, ok := nr.checklist[key]
+	if !ok && nr.gbif {
+		var err error
+		e, ok, err = searchGBIF(name)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !ok {
+		e = nameEntry{
+			status:   unresolved,
+			accepted: name,
+		}
+		nr.log.Warn("unresolved name", "taxon", name)
+	}
+	if e.status == synonym {
+		nr.log.Info("synonym", "taxon", name, "accepted", e.accepted)
+	}
+	e.name = name
+	nr.cache[key] = e
+	return e.accepted, nil
+}
+
+func searchGBIF(name string) (nameEntry, bool, error) {
+	ls, err := gbif.TaxonName(name)
+	if err != nil {
+		return nameEntry{}, false, err
+	}
+
+	for _, sp := range ls {
+		if !strings.EqualFold(sp.CanonicalName, name) {
+			continue
+		}
+		if sp.TaxonomicStatus == "ACCEPTED" || sp.AcceptedKey == 0 {
+			return nameEntry{
+				status:   accepted,
+				accepted: sp.CanonicalName,
+			}, true, nil
+		}
+		acc, err := gbif.SpeciesID(strconv.FormatInt(sp.AcceptedKey, 10))
+		if err != nil {
+			return nameEntry{}, false, err
+		}
+		return nameEntry{
+			status:   synonym,
+			accepted: acc.CanonicalName,
+		}, true, nil
+	}
+	return nameEntry{}, false, nil
+}
+
+// WriteReport writes the name resolution report.
+func (nr *nameResolver) writeReport(w io.Writer) error {
+	keys := make([]string, 0, len(nr.cache))
+	for k := range nr.cache {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	bw := bufio.NewWriter(w)
+	tab := csv.NewWriter(bw)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	if err := tab.Write([]string{"name", "status", "accepted"}); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	for _, k := range keys {
+		e := nr.cache[k]
+		if err := tab.Write([]string{e.name, e.status, e.accepted}); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+func readChecklist(name string) (map[string]nameEntry, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range []string{"name", "accepted"} {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, h)
+		}
+	}
+
+	cl := make(map[string]nameEntry)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+		}
+
+		// trailing empty columns can be omitted
+		field := func(f string) string {
+			i := fields[f]
+			if i >= len(row) {
+				return ""
+			}
+			return strings.Join(strings.Fields(row[i]), " ")
+		}
+
+		nm := field("name")
+		if nm == "" {
+			continue
+		}
+		acc := field("accepted")
+		e := nameEntry{
+			status:   synonym,
+			accepted: acc,
+		}
+		if acc == "" || strings.EqualFold(acc, nm) {
+			e.status = accepted
+			e.accepted = nm
+		}
+		cl[strings.ToLower(nm)] = e
+	}
+	return cl, nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package imppoints
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseResolution returns the equator value
+// of a pixelation
+// with a pixel size defined by a resolution,
+// in degrees (e.g. "0.5deg")
+// or arc minutes (e.g. "30min").
+func parseResolution(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(s, "deg"):
+		s = strings.TrimSuffix(s, "deg")
+	case strings.HasSuffix(s, "min"):
+		s = strings.TrimSuffix(s, "min")
+		scale = 1.0 / 60
+	default:
+		return 0, fmt.Errorf("invalid resolution %q: expecting a value in degrees (deg) or arc minutes (min)", s)
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resolution %q: %v", s, err)
+	}
+	v *= scale
+	if v <= 0 || v > 90 {
+		return 0, fmt.Errorf("invalid resolution %.6f degrees", v)
+	}
+
+	eq := int(math.Round(360 / v))
+	if eq%2 != 0 {
+		eq++
+	}
+	return eq, nil
+}
+
+// A PrecisionCheck checks the precision
+// of the coordinates of the records
+// of an input file.
+type precisionCheck struct {
+	log  *slog.Logger
+	file string
+
+	// pixel size in degrees
+	step float64
+
+	// minimum number of decimal places
+	min int
+
+	// if true, the imprecise records
+	// are only reported
+	flag bool
+
+	records  int
+	coarse   int
+	rejected int
+}
+
+// Precision is the precision check
+// of the file that is being imported.
+// Check checks the precision of a record
+// using the text of its coordinates.
+// As trailing zeros are frequently removed
+// the precision of the record
+// is the precision of the most precise coordinate.
+// It returns false if the record should be rejected.
+func (pc *precisionCheck) check(tax string, row int, lat, lon string) bool {
+	pc.records++
+	d := max(decimals(lat), decimals(lon))
+	if d < pc.min {
+		if !pc.flag {
+			pc.rejected++
+			pc.log.Debug("record rejected by coordinate precision", "file", pc.file, "row", row, "taxon", tax, "decimals", d)
+			return false
+		}
+		pc.log.Warn("imprecise coordinates", "file", pc.file, "row", row, "taxon", tax, "latitude", lat, "longitude", lon)
+	}
+	if math.Pow10(-d) > pc.step {
+		pc.coarse++
+	}
+	return true
+}
+
+// Decimals returns the number of decimal places
+// of a number.
+func decimals(s string) int {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		// assume that numbers in scientific notation
+		// are precise
+		return 15
+	}
+	_, frac, ok := strings.Cut(s, ".")
+	if !ok {
+		return 0
+	}
+	return len(frac)
+}
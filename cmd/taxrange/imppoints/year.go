@@ -0,0 +1,100 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package imppoints
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A YearFilter filters the records
+// of an input file
+// by its collection year.
+type yearFilter struct {
+	// minimum and maximum year,
+	// 0 if not defined
+	min int
+	max int
+
+	rejected int
+	undated  int
+}
+
+// Years is the year filter
+// of the file that is being imported.
+// Check checks the collection year of a record,
+// using the "year" column,
+// or if it is not defined,
+// the "eventDate" column.
+// It returns false if the record should be rejected.
+func (yf *yearFilter) check(row []string, fields map[string]int) bool {
+	if yf.min == 0 && yf.max == 0 {
+		return true
+	}
+
+	start, end, ok := recordYears(row, fields)
+	if !ok {
+		yf.undated++
+		return false
+	}
+	if yf.min != 0 && start < yf.min {
+		yf.rejected++
+		return false
+	}
+	if yf.max != 0 && end > yf.max {
+		yf.rejected++
+		return false
+	}
+	return true
+}
+
+// RecordYears returns the collection year of a record.
+// If the collection date is an interval
+// (e.g. "1990-05/1992")
+// it returns the first and last year of the interval.
+func recordYears(row []string, fields map[string]int) (start, end int, ok bool) {
+	if i, ok := fields["year"]; ok {
+		if y, err := strconv.Atoi(strings.TrimSpace(row[i])); err == nil {
+			return y, y, true
+		}
+	}
+
+	i, ok := fields["eventdate"]
+	if !ok {
+		return 0, 0, false
+	}
+	first, last, isInterval := strings.Cut(strings.TrimSpace(row[i]), "/")
+	start, ok = dateYear(first)
+	if !ok {
+		return 0, 0, false
+	}
+	if !isInterval {
+		return start, start, true
+	}
+	end, ok = dateYear(last)
+	if !ok {
+		// in ISO 8601 intervals,
+		// the year can be omitted from the end
+		// (e.g. "1990-05-01/15")
+		return start, start, true
+	}
+	return start, end, true
+}
+
+// DateYear returns the year of an ISO 8601 date
+// (e.g. "1990", "1990-05", or "1990-05-01T10:00").
+func dateYear(s string) (int, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	y, err := strconv.Atoi(s[:4])
+	if err != nil {
+		return 0, false
+	}
+	if len(s) > 4 && s[4] != '-' && s[4] != 'T' {
+		return 0, false
+	}
+	return y, true
+}
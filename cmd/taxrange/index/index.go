@@ -0,0 +1,231 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package index implements a command to build
+// indexed files of range maps,
+// and indexes of the range files in a workspace.
+package index
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/workspace"
+)
+
+var Command = &command.Command{
+	Usage: `index [--decode] [--verbatim]
+	[--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--sort <order>] [--reproducible]
+	[--force] [-o|--output <file>] [<input-file> | <dir>]`,
+	Short: "build an indexed file of range maps",
+	Long: `
+Command index reads a geographic range file, and writes it as an indexed
+binary file.
+
+An indexed file stores the taxa sorted by name, and the pixels of each taxon
+as a sorted array, so it can be mapped into memory and used without reading
+the whole collection (see the function OpenIndexed of the package
+github.com/js-arias/ranges). In this way, a process can host many large
+collections using little memory. Indexed files are read-only. The age
+intervals and the extra columns of the range file are also stored, so they
+are recovered when the file is decoded.
+
+The argument of the command is the name of the input file. If no file is
+given, the input will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+If the flag --decode is defined, the input is an indexed file, and it will be
+written as a regular range file.
+
+If the argument is a directory, the command builds a workspace index: the
+directory tree is scanned, and each file with the extension ".tab", ".tsv", or
+".txt" that is a range file is added to the index, as a row with the columns
+"taxon", "file" (the path of the file, relative to the directory), "type",
+"age" (in years), "pixels" (the number of pixels of the range), and "hash" (a
+hash of the pixels and densities of the range). If a taxon is defined with
+different ranges of the same type in several files, a warning is reported (use
+the command duplicates to resolve them). Hidden files and directories (with a
+name starting with a dot) are ignored.
+
+By default the index is written in the file "taxrange-index.tab" of the
+scanned directory, replacing any previous index. If the flag --output, or -o,
+is defined, the index is written in the indicated file. Use the command find
+to locate the files in which a taxon is defined.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined. As the indexed file is
+binary, it is not printed in a terminal, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages (for
+example, the files skipped when building a workspace index), or -vv to report
+debug messages. If the flag --log-json is defined, messages will be written
+as JSON lines.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var decodeFlag bool
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&decodeFlag, "decode", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	if st, err := os.Stat(input); err == nil && st.IsDir() {
+		if decodeFlag {
+			return c.UsageError("flag --decode cannot be used with a directory")
+		}
+		return indexDir(c, input)
+	}
+
+	var coll *ranges.Collection
+	var err error
+	if decodeFlag {
+		coll, err = readIndexed(c.Stdin(), input)
+	} else {
+		coll, err = readCollection(c.Stdin(), input)
+	}
+	if err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+
+	summary.Written(len(coll.Taxa()))
+	if decodeFlag {
+		return files.Output(c.Stdout(), output, coll.TSV)
+	}
+	return files.OutputBinary(c.Stdout(), output, coll.WriteIndex)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readIndexed(r io.Reader, name string) (*ranges.Collection, error) {
+	var ix *ranges.Indexed
+	if name != "-" && !files.IsURL(name) {
+		var err error
+		ix, err = ranges.OpenIndexed(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer ix.Close()
+	} else {
+		if name == "-" {
+			name = "stdin"
+		} else {
+			f, err := files.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("when reading %q: %v", name, err)
+		}
+		ix, err = ranges.ParseIndexed(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("when reading %q: %v", name, err)
+		}
+	}
+
+	coll, err := ix.Collection()
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+func indexDir(c *command.Command, dir string) error {
+	log := logger.New(c.Stderr())
+	entries, err := workspace.Scan(dir, func(name string, err error) {
+		log.Info("file skipped", "file", name, "error", err)
+	})
+	if err != nil {
+		return fmt.Errorf("when scanning %q: %v", dir, err)
+	}
+	for _, e := range entries {
+		log.Debug("taxon indexed", "taxon", e.Taxon, "file", e.File)
+	}
+	for _, d := range workspace.Duplicates(entries) {
+		names := make([]string, 0, len(d))
+		for _, e := range d {
+			names = append(names, e.File)
+		}
+		log.Warn("taxon defined with different ranges", "taxon", d[0].Taxon, "type", d[0].Type, "files", strings.Join(names, ", "))
+	}
+
+	write := func(w io.Writer) error {
+		return workspace.Write(w, entries)
+	}
+	if output == "" {
+		return files.ReplaceFile(filepath.Join(dir, workspace.IndexFile), write)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
@@ -0,0 +1,130 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package agefile implements the reader
+// of the files with the ages of the taxa
+// used by the taxrange commands
+// that rotate ranges.
+//
+// An ages file is a tab-delimited file without header,
+// in which each row is a taxon.
+// The first column is the name of the taxon,
+// the second column its age (in million years),
+// and the optional third and fourth columns
+// are the minimum and maximum age of the taxon
+// (in million years).
+// Lines starting with '#' are ignored.
+package agefile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+// Read reads an ages file
+// and returns the age of each taxon,
+// and the age interval of the taxa with an interval,
+// both in years.
+// Taxon names are stored in lower case.
+func Read(name string) (map[string]int64, map[string][2]int64, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	ages, intervals, err := read(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%q: %v", name, err)
+	}
+	return ages, intervals, nil
+}
+
+func read(r io.Reader) (map[string]int64, map[string][2]int64, error) {
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	tab.FieldsPerRecord = -1
+
+	fields := map[string]int{
+		"taxon": 0,
+		"age":   1,
+		"min":   2,
+		"max":   3,
+	}
+	ages := make(map[string]int64)
+	intervals := make(map[string][2]int64)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("on row %d: %v", ln, err)
+		}
+		if len(row) < 2 {
+			return nil, nil, fmt.Errorf("on row %d: got %d fields, want %d", ln, len(row), 2)
+		}
+
+		ff := "taxon"
+		name := strings.ToLower(strings.Join(strings.Fields(row[fields[ff]]), " "))
+		if name == "" {
+			continue
+		}
+
+		ff = "age"
+		ageF, err := strconv.ParseFloat(row[fields[ff]], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("on row %d: field %q: %v", ln, ff, err)
+		}
+
+		age := int64(ageF * millionYears)
+		ages[name] = age
+
+		min, max := "", ""
+		if len(row) > fields["min"] {
+			min = strings.TrimSpace(row[fields["min"]])
+		}
+		if len(row) > fields["max"] {
+			max = strings.TrimSpace(row[fields["max"]])
+		}
+		if min == "" && max == "" {
+			continue
+		}
+		if min == "" {
+			return nil, nil, fmt.Errorf("on row %d: field %q: undefined minimum age for maximum age %s", ln, "min", max)
+		}
+		if max == "" {
+			return nil, nil, fmt.Errorf("on row %d: field %q: undefined maximum age for minimum age %s", ln, "max", min)
+		}
+
+		var iv [2]int64
+		for i, ff := range []string{"min", "max"} {
+			v, err := strconv.ParseFloat(strings.TrimSpace(row[fields[ff]]), 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("on row %d: field %q: %v", ln, ff, err)
+			}
+			iv[i] = int64(v * millionYears)
+		}
+		if iv[0] < 0 || iv[0] > age || age > iv[1] || iv[1] > ranges.MaxAge {
+			return nil, nil, fmt.Errorf("on row %d: invalid age interval %.6f-%.6f for age %.6f", ln, float64(iv[0])/millionYears, float64(iv[1])/millionYears, ageF)
+		}
+		intervals[name] = iv
+	}
+	return ages, intervals, nil
+}
@@ -0,0 +1,57 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package agefile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := map[string]struct {
+		in       string
+		age      int64
+		interval [2]int64
+		hasIv    bool
+		err      string
+	}{
+		"age":          {in: "Aus  Bus\t10\n", age: 10_000_000},
+		"interval":     {in: "Aus bus\t10\t5\t12.5\n", age: 10_000_000, interval: [2]int64{5_000_000, 12_500_000}, hasIv: true},
+		"empty":        {in: "# comment\nAus bus\t10\t\t\n", age: 10_000_000},
+		"min only":     {in: "Aus bus\t10\t5\n", err: `field "max"`},
+		"empty max":    {in: "Aus bus\t10\t5\t\n", err: `field "max"`},
+		"max only":     {in: "Aus bus\t10\t\t12\n", err: `field "min"`},
+		"invalid age":  {in: "Aus bus\tten\n", err: `field "age"`},
+		"invalid":      {in: "Aus bus\t10\t12\t15\n", err: "invalid age interval"},
+		"short":        {in: "Aus bus\n", err: "got 1 fields"},
+		"invalid max":  {in: "Aus bus\t10\t5\tx\n", err: `field "max"`},
+		"out of range": {in: "Aus bus\t10\t-1\t12\n", err: "invalid age interval"},
+	}
+
+	for name, test := range tests {
+		ages, intervals, err := read(strings.NewReader(test.in))
+		if test.err != "" {
+			if err == nil {
+				t.Errorf("%s: expecting error", name)
+				continue
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %q: want %q", name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if a := ages["aus bus"]; a != test.age {
+			t.Errorf("%s: age: got %d, want %d", name, a, test.age)
+		}
+		iv, ok := intervals["aus bus"]
+		if ok != test.hasIv || iv != test.interval {
+			t.Errorf("%s: interval: got %v (%v), want %v (%v)", name, iv, ok, test.interval, test.hasIv)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheEnv is the environment variable
+// that sets the directory of the cache.
+const cacheEnv = "TAXRANGE_CACHE"
+
+// PinPrefix is the prefix of the URL fragment
+// used to pin the content of an URL
+// to a SHA-256 hash.
+const pinPrefix = "sha256="
+
+// CacheDir returns the directory of the cache
+// of downloaded files.
+//
+// By default it is the directory "taxrange"
+// in the user cache directory
+// (for example "~/.cache/taxrange"),
+// the environment variable TAXRANGE_CACHE
+// can be used to set a different directory,
+// or, if its value is "off",
+// to disable the cache
+// (in that case the returned directory is empty).
+func CacheDir() (string, error) {
+	if d := os.Getenv(cacheEnv); d != "" {
+		if d == "off" {
+			return "", nil
+		}
+		return d, nil
+	}
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cache directory: %v", err)
+	}
+	return filepath.Join(d, "taxrange"), nil
+}
+
+// A CacheEntry is an URL
+// stored in the cache.
+type CacheEntry struct {
+	URL string
+
+	// SHA-256 hash of the content,
+	// in hexadecimal
+	Hash string
+
+	Size int64
+	Time time.Time
+}
+
+// Cached returns the entries of the cache,
+// sorted by URL.
+func Cached() ([]CacheEntry, error) {
+	dir, err := CacheDir()
+	if err != nil || dir == "" {
+		return nil, err
+	}
+
+	ls, err := os.ReadDir(filepath.Join(dir, "urls"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+	for _, f := range ls {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		e, err := readEntry(filepath.Join(dir, "urls", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b CacheEntry) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+	return entries, nil
+}
+
+// Fetch downloads an URL into the cache,
+// replacing any previous content of the URL.
+// If the URL has a fragment "#sha256=<hash>",
+// the content must have the indicated hash.
+func Fetch(name string) (CacheEntry, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	if dir == "" {
+		return CacheEntry{}, errors.New("cache disabled")
+	}
+	u, pin := splitPin(name)
+	return fetch(dir, u, pin)
+}
+
+// CacheRemove removes an URL from the cache.
+// The cached content is removed
+// if it is not used by other URLs.
+func CacheRemove(name string) error {
+	dir, err := CacheDir()
+	if err != nil || dir == "" {
+		return err
+	}
+
+	u, _ := splitPin(name)
+	if err := os.Remove(entryFile(dir, u)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("URL %q not in cache", u)
+		}
+		return err
+	}
+
+	entries, err := Cached()
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		used[e.Hash] = true
+	}
+	objs, err := os.ReadDir(filepath.Join(dir, "objects"))
+	if err != nil {
+		return err
+	}
+	for _, f := range objs {
+		// skip used objects
+		// and the files of ongoing downloads
+		if used[f.Name()] || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, "objects", f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CacheClear removes all the content of the cache.
+func CacheClear() error {
+	dir, err := CacheDir()
+	if err != nil || dir == "" {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "urls")); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(dir, "objects"))
+}
+
+// OpenURL opens an URL,
+// reading it from the cache
+// if it was already downloaded.
+func openURL(name string) (io.ReadCloser, error) {
+	u, pin := splitPin(name)
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return download(u, pin)
+	}
+
+	hash := pin
+	if hash == "" {
+		if e, err := readEntry(entryFile(dir, u)); err == nil {
+			hash = e.Hash
+		}
+	}
+	if hash != "" {
+		f, err := os.Open(filepath.Join(dir, "objects", hash))
+		if err == nil {
+			return f, nil
+		}
+	}
+
+	e, err := fetch(dir, u, pin)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(dir, "objects", e.Hash))
+}
+
+// Download reads an URL
+// without using the cache.
+func download(u, pin string) (io.ReadCloser, error) {
+	r, err := get(u)
+	if err != nil {
+		return nil, err
+	}
+	if pin == "" {
+		return r, nil
+	}
+
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", u, err)
+	}
+	sum := sha256.Sum256(data)
+	if h := hex.EncodeToString(sum[:]); h != pin {
+		return nil, fmt.Errorf("when reading %q: content hash %s, want %s", u, h, pin)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Fetch downloads an URL into a cache directory.
+func fetch(dir, u, pin string) (CacheEntry, error) {
+	objs := filepath.Join(dir, "objects")
+	if err := os.MkdirAll(objs, 0o755); err != nil {
+		return CacheEntry{}, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "urls"), 0o755); err != nil {
+		return CacheEntry{}, err
+	}
+
+	r, err := get(u)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp(objs, ".download-*")
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		tmp.Close()
+		return CacheEntry{}, fmt.Errorf("when reading %q: %v", u, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return CacheEntry{}, err
+	}
+
+	e := CacheEntry{
+		URL:  u,
+		Hash: hex.EncodeToString(h.Sum(nil)),
+		Size: size,
+		Time: time.Now().UTC().Truncate(time.Second),
+	}
+	if pin != "" && e.Hash != pin {
+		return CacheEntry{}, fmt.Errorf("when reading %q: content hash %s, want %s", u, e.Hash, pin)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(objs, e.Hash)); err != nil {
+		return CacheEntry{}, err
+	}
+
+	if err := writeEntry(dir, e); err != nil {
+		return CacheEntry{}, err
+	}
+	return e, nil
+}
+
+// DownloadTimeout is the maximum time
+// used to download an URL.
+const downloadTimeout = 10 * time.Minute
+
+// Client is the HTTP client used to download URLs.
+var client = &http.Client{Timeout: downloadTimeout}
+
+// Get requests an URL.
+func get(u string) (io.ReadCloser, error) {
+	req, err := newRequest(u)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("when requesting %q: %s", u, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// EntryFile returns the name of the file
+// that stores the cache entry of an URL.
+func entryFile(dir, u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(dir, "urls", hex.EncodeToString(sum[:]))
+}
+
+// WriteEntry writes a cache entry.
+// As the file is not an output of a command,
+// ReplaceFile is not used.
+func writeEntry(dir string, e CacheEntry) error {
+	f, err := os.CreateTemp(filepath.Join(dir, "urls"), ".entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := fmt.Fprintf(f, "%s\t%d\t%s\t%s\n", e.Hash, e.Size, e.Time.Format(time.RFC3339), e.URL); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), entryFile(dir, e.URL))
+}
+
+func readEntry(name string) (CacheEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	defer f.Close()
+
+	ln, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return CacheEntry{}, err
+	}
+	fields := strings.SplitN(strings.TrimSpace(ln), "\t", 4)
+	if len(fields) < 4 {
+		return CacheEntry{}, fmt.Errorf("on file %q: invalid cache entry", name)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("on file %q: invalid cache entry: %v", name, err)
+	}
+	tm, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("on file %q: invalid cache entry: %v", name, err)
+	}
+	return CacheEntry{
+		Hash: fields[0],
+		Size: size,
+		Time: tm,
+		URL:  fields[3],
+	}, nil
+}
+
+// SplitPin splits an URL
+// and the hash defined in its fragment.
+func splitPin(name string) (u, pin string) {
+	i := strings.LastIndex(name, "#")
+	if i < 0 {
+		return name, ""
+	}
+	frag := name[i+1:]
+	if !strings.HasPrefix(frag, pinPrefix) {
+		return name, ""
+	}
+	return name[:i], strings.ToLower(strings.TrimPrefix(frag, pinPrefix))
+}
@@ -0,0 +1,161 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package files implements functions
+// shared by the taxrange commands
+// to deal with input and output files.
+//
+// By convention,
+// a file named "-"
+// (or an empty output name)
+// is the standard input or output.
+// By default an existing output file
+// is never overwritten,
+// use the flag --force to overwrite it.
+//
+// Input files can also be URLs
+// (see Open).
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var force bool
+
+func init() {
+	summary.SetWriter(WriteFile)
+}
+
+// SetFlags adds the output file flags
+// to a command.
+func SetFlags(c *command.Command) {
+	force = false
+	c.Flags().BoolVar(&force, "force", false, "")
+}
+
+// Forced returns true if the flag --force
+// is defined.
+func Forced() bool {
+	return force
+}
+
+// IsStd returns true if a file name
+// is the standard input or output.
+func IsStd(name string) bool {
+	return name == "" || name == "-"
+}
+
+// Output writes the output of a command
+// using the function fn.
+// If name is the standard output
+// (see IsStd)
+// the output is written into w
+// (usually the standard output of the command),
+// otherwise the output is written in a file
+// (see WriteFile).
+func Output(w io.Writer, name string, fn func(w io.Writer) error) error {
+	if IsStd(name) {
+		return fn(w)
+	}
+	return WriteFile(name, fn)
+}
+
+// OutputBinary is like Output,
+// but used for binary data
+// (for example images),
+// so it returns an error
+// if w is a terminal,
+// unless the flag --force is defined.
+func OutputBinary(w io.Writer, name string, fn func(w io.Writer) error) error {
+	if IsStd(name) && !force && isTerminal(w) {
+		return errors.New("binary output not written into a terminal: use --output or --force")
+	}
+	return Output(w, name, fn)
+}
+
+// IsTerminal returns true if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isTerminalFile(f)
+}
+
+// WriteFile writes a file using the function fn.
+//
+// If the file already exists,
+// an error is returned,
+// unless the flag --force is defined.
+//
+// The file is written in a temporary file
+// in the same directory of the destination file,
+// and only when fn finished without errors,
+// the temporary file is renamed to the destination
+// file.
+// In this way,
+// if there is an error while writing,
+// the previous content of the file
+// (if any)
+// will be preserved.
+func WriteFile(name string, fn func(w io.Writer) error) error {
+	if !force {
+		if _, err := os.Stat(name); err == nil {
+			return fmt.Errorf("file %q already exists: use --force to overwrite it", name)
+		}
+	}
+	return ReplaceFile(name, fn)
+}
+
+// ReplaceFile is like WriteFile,
+// but an existing file is always replaced.
+// It is used by commands that update the content
+// of an output file.
+func ReplaceFile(name string, fn func(w io.Writer) error) (err error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// keep permissions of a previous file
+	perm := os.FileMode(0o644)
+	if st, err := os.Stat(name); err == nil {
+		perm = st.Mode().Perm()
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("when writing %q: %v", name, err)
+	}
+	summary.Output(name)
+	return nil
+}
@@ -0,0 +1,11 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package files
+
+import "syscall"
+
+const ioctlGetTermios = syscall.TIOCGETA
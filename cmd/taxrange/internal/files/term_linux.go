@@ -0,0 +1,9 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package files
+
+import "syscall"
+
+const ioctlGetTermios = syscall.TCGETS
@@ -0,0 +1,184 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package files
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Open opens a file for reading.
+//
+// The name can be the name of a local file,
+// or an URL with the scheme "http", "https",
+// or "s3"
+// (for example "s3://bucket/path/file.tab").
+//
+// The objects of an S3 bucket are requested
+// using the credentials defined
+// by the environment variables
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// and AWS_SESSION_TOKEN
+// (if there are no credentials,
+// the request is not signed,
+// for example to read a public bucket).
+// The region is defined by AWS_REGION,
+// or AWS_DEFAULT_REGION
+// (by default "us-east-1"),
+// and the variable AWS_ENDPOINT_URL
+// can be used to define
+// an S3 compatible service.
+//
+// Downloaded files are stored in a local cache
+// (see CacheDir),
+// so an URL is only downloaded once.
+// The content of an URL can be pinned
+// with a fragment "#sha256=<hash>",
+// in which case the file is read from the cache
+// if there is a file with the same hash,
+// and a download with a different hash is an error.
+// A download that takes longer than 10 minutes
+// is canceled.
+func Open(name string) (io.ReadCloser, error) {
+	if !IsURL(name) {
+		return os.Open(name)
+	}
+
+	return openURL(name)
+}
+
+// IsURL returns true if a file name
+// is an URL supported by Open.
+func IsURL(name string) bool {
+	for _, p := range []string{"http://", "https://", "s3://"} {
+		if len(name) > len(p) && strings.EqualFold(name[:len(p)], p) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRequest returns the HTTP request
+// to read an URL.
+func newRequest(name string) (*http.Request, error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %v", name, err)
+	}
+	if !strings.EqualFold(u.Scheme, "s3") {
+		return http.NewRequest(http.MethodGet, name, nil)
+	}
+
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid URL %q: expecting s3://<bucket>/<key>", name)
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// by default use virtual-hosted style requests,
+	// with a custom endpoint use path-style requests
+	obj := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapePath(key))
+	if ep := os.Getenv("AWS_ENDPOINT_URL"); ep != "" {
+		obj = fmt.Sprintf("%s/%s/%s", strings.TrimRight(ep, "/"), bucket, escapePath(key))
+	}
+	req, err := http.NewRequest(http.MethodGet, obj, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %v", name, err)
+	}
+
+	id := os.Getenv("AWS_ACCESS_KEY_ID")
+	secret := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return req, nil
+	}
+	if tk := os.Getenv("AWS_SESSION_TOKEN"); tk != "" {
+		req.Header.Set("X-Amz-Security-Token", tk)
+	}
+	signS3(req, id, secret, region, time.Now())
+	return req, nil
+}
+
+// EmptyHash is the SHA256 hash
+// of an empty payload.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// SignS3 signs a GET request to S3
+// using the AWS signature version 4.
+// All the headers of the request are signed.
+func signS3(req *http.Request, id, secret, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+
+	var canon strings.Builder
+	canon.WriteString(req.Method + "\n")
+	canon.WriteString(req.URL.EscapedPath() + "\n")
+	canon.WriteString(req.URL.RawQuery + "\n")
+	for _, k := range names {
+		canon.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canon.WriteString("\n" + signed + "\n")
+	canon.WriteString(emptyHash)
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	h := sha256.Sum256([]byte(canon.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", id, scope, signed, sig))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// EscapePath escapes each element
+// of the path of an S3 object.
+func escapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
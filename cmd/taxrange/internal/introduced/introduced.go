@@ -0,0 +1,88 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package introduced implements the flag
+// shared by the taxrange commands
+// that read range files,
+// to filter the records of introduced populations.
+//
+// The flag --introduced defines how the pixels
+// of points ranges
+// tagged as introduced
+// (see ranges.MeansColumn)
+// are read:
+// "include" (the default) reads all pixels,
+// "exclude" skips the introduced pixels,
+// and "only" reads only the introduced pixels.
+package introduced
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+)
+
+var modeFlag mode
+
+// SetFlags adds the --introduced flag
+// to a command.
+func SetFlags(c *command.Command) {
+	modeFlag = include
+	c.Flags().Var(&modeFlag, "introduced", "")
+}
+
+// Options returns the read options
+// defined by the --introduced flag.
+func Options() []ranges.ReadOption {
+	switch modeFlag {
+	case exclude:
+		return []ranges.ReadOption{ranges.WithoutMeans(ranges.Introduced)}
+	case only:
+		return []ranges.ReadOption{ranges.WithMeans(ranges.Introduced)}
+	}
+	return nil
+}
+
+// Keep returns true if a record
+// with the given establishment means
+// should be kept,
+// as defined by the --introduced flag.
+func Keep(m ranges.Means) bool {
+	switch modeFlag {
+	case exclude:
+		return m != ranges.Introduced
+	case only:
+		return m == ranges.Introduced
+	}
+	return true
+}
+
+// A Mode is a flag value
+// for the filter of introduced pixels.
+type mode string
+
+const (
+	include mode = "include"
+	exclude mode = "exclude"
+	only    mode = "only"
+)
+
+func (m *mode) String() string {
+	if *m == "" {
+		return string(include)
+	}
+	return string(*m)
+}
+
+func (m *mode) Set(s string) error {
+	v := mode(strings.ToLower(s))
+	switch v {
+	case include, exclude, only:
+		*m = v
+		return nil
+	}
+	return fmt.Errorf("invalid mode %q", s)
+}
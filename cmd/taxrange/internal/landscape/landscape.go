@@ -0,0 +1,143 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package landscape implements a mask
+// of the pixels available for a taxon
+// at a given age,
+// based on a time pixelation,
+// and optionally,
+// a set of pixel priors.
+package landscape
+
+import (
+	"fmt"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/earth/stat/pixprob"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// A Landscape is a set of pixels
+// with a non-zero prior
+// at each stage of a time pixelation.
+type Landscape struct {
+	tp     *model.TimePix
+	prior  pixprob.Pixel
+	stages map[int64]map[int]bool
+}
+
+// Read reads a landscape
+// from a time pixelation file
+// and an optional prior file
+// (the same format used by the command kde).
+// If pix is not nil,
+// the time pixelation must be compatible with it.
+func Read(timepixFile, priorFile string, pix *earth.Pixelation) (*Landscape, error) {
+	tp, err := readTimePix(timepixFile, pix)
+	if err != nil {
+		return nil, err
+	}
+	var prior pixprob.Pixel
+	if priorFile != "" {
+		prior, err = readPixelPrior(priorFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return New(tp, prior), nil
+}
+
+// New returns a landscape from a time pixelation
+// and a set of pixel priors.
+// If prior is nil,
+// any pixel with a non-zero value
+// in the time pixelation is included in the landscape.
+func New(tp *model.TimePix, prior pixprob.Pixel) *Landscape {
+	return &Landscape{
+		tp:     tp,
+		prior:  prior,
+		stages: make(map[int64]map[int]bool),
+	}
+}
+
+// Pixelation returns the pixelation
+// of the landscape.
+func (l *Landscape) Pixelation() *earth.Pixelation {
+	return l.tp.Pixelation()
+}
+
+// ClosestStageAge returns the age of the stage
+// used by the landscape for the given age
+// (in years).
+func (l *Landscape) ClosestStageAge(age int64) int64 {
+	return l.tp.ClosestStageAge(age)
+}
+
+// At returns the pixels with a non-zero prior
+// at the stage closest to the given age
+// (in years).
+func (l *Landscape) At(age int64) map[int]bool {
+	age = l.tp.ClosestStageAge(age)
+	if land, ok := l.stages[age]; ok {
+		return land
+	}
+
+	land := make(map[int]bool)
+	for px, v := range l.tp.Stage(age) {
+		if l.prior != nil {
+			if l.prior.Prior(v) == 0 {
+				continue
+			}
+		} else if v == 0 {
+			continue
+		}
+		land[px] = true
+	}
+	l.stages[age] = land
+	return land
+}
+
+// Mask returns a range map
+// with only the pixels of a range
+// that are in the landscape at the given age.
+// The pixels in keep are always included.
+func (l *Landscape) Mask(rng map[int]float64, age int64, keep map[int]float64) map[int]float64 {
+	land := l.At(age)
+	m := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		if _, ok := keep[px]; ok || land[px] {
+			m[px] = v
+		}
+	}
+	return m
+}
+
+func readTimePix(name string, pix *earth.Pixelation) (*model.TimePix, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tp, err := model.ReadTimePix(f, pix)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return tp, nil
+}
+
+func readPixelPrior(name string) (pixprob.Pixel, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prior, err := pixprob.ReadTSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return prior, nil
+}
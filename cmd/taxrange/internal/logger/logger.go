@@ -0,0 +1,176 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package logger implements a logger
+// shared by the taxrange commands.
+//
+// By default only warnings and errors are reported.
+// The verbosity can be changed with the flags
+// --quiet (only errors),
+// -v (information messages),
+// and -vv (debug messages).
+// If the flag --log-json is defined,
+// messages will be written as JSON lines,
+// so they can be processed by pipeline tools.
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var quiet bool
+var verbose bool
+var debug bool
+var jsonFlag bool
+
+// SetFlags adds the logger flags
+// to a command.
+func SetFlags(c *command.Command) {
+	c.Flags().BoolVar(&quiet, "quiet", false, "")
+	c.Flags().BoolVar(&verbose, "v", false, "")
+	c.Flags().BoolVar(&debug, "vv", false, "")
+	c.Flags().BoolVar(&jsonFlag, "log-json", false, "")
+}
+
+// Level returns the logging level
+// as defined by the logger flags.
+func Level() slog.Level {
+	switch {
+	case debug:
+		return slog.LevelDebug
+	case verbose:
+		return slog.LevelInfo
+	case quiet:
+		return slog.LevelError
+	}
+	return slog.LevelWarn
+}
+
+// New returns a new logger
+// that writes into w.
+func New(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: Level(),
+	}
+	var h slog.Handler = &textHandler{
+		w:     w,
+		mu:    &sync.Mutex{},
+		level: opts.Level,
+	}
+	if jsonFlag {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(countHandler{h})
+}
+
+// A CountHandler is a slog handler
+// that counts the warnings
+// (even if they are not reported)
+// for the summary of the run.
+type countHandler struct {
+	slog.Handler
+}
+
+func (h countHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= slog.LevelWarn || h.Handler.Enabled(ctx, l)
+}
+
+func (h countHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		summary.Warning()
+	}
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h countHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return countHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h countHandler) WithGroup(name string) slog.Handler {
+	return countHandler{h.Handler.WithGroup(name)}
+}
+
+// A TextHandler is a slog handler
+// that writes messages in a simple,
+// human-readable format:
+//
+//	WARNING: message: key=value...
+type textHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(levelName(r.Level))
+	b.WriteString(": ")
+	b.WriteString(r.Message)
+
+	sep := ": "
+	write := func(a slog.Attr) bool {
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
+		b.WriteString(sep)
+		sep = " "
+		v := a.Value.Resolve()
+		if v.Kind() == slog.KindString {
+			fmt.Fprintf(&b, "%s=%q", a.Key, v.String())
+			return true
+		}
+		fmt.Fprintf(&b, "%s=%v", a.Key, v.Any())
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &nh
+}
+
+// WithGroup is not supported by the text handler,
+// so it returns the same handler.
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+func levelName(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "ERROR"
+	case l >= slog.LevelWarn:
+		return "WARNING"
+	case l >= slog.LevelInfo:
+		return "INFO"
+	}
+	return "DEBUG"
+}
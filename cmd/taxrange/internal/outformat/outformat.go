@@ -0,0 +1,101 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package outformat implements the flags
+// shared by the taxrange commands
+// that write range files,
+// to define the format of the output.
+//
+// The flag --sort defines the order of the taxa
+// ("name", the default,
+// "age" for age and then name,
+// or "input" to keep the order of the input).
+// If the flag --reproducible is defined,
+// the comment with the time in which the file was written
+// is omitted,
+// so the same data always produces the same output.
+package outformat
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+)
+
+var sortFlag orderFlag
+var reproducible bool
+
+// SetFlags adds the output format flags
+// to a command.
+func SetFlags(c *command.Command) {
+	sortFlag = orderFlag{}
+	c.Flags().Var(&sortFlag, "sort", "")
+	c.Flags().BoolVar(&reproducible, "reproducible", false, "")
+}
+
+// Set sets the output format of a collection
+// as defined by the output format flags.
+func Set(coll *ranges.Collection) {
+	coll.SetOrder(sortFlag.order)
+	coll.OmitTimestamp(reproducible)
+}
+
+// SetWriter sets the output format of a TSV writer
+// as defined by the output format flags.
+// As a TSV writer does not sort the taxa,
+// use Sort to sort them before they are written.
+func SetWriter(tw *ranges.TSVWriter) {
+	tw.OmitTimestamp(reproducible)
+}
+
+// Sort sorts a list of taxon names
+// as defined by the output format flags,
+// using age to retrieve the age of each taxon.
+// If the order is "input",
+// the list is not modified.
+func Sort(names []string, age func(name string) int64) {
+	switch sortFlag.order {
+	case ranges.ByName:
+		slices.Sort(names)
+	case ranges.ByAge:
+		slices.Sort(names)
+		slices.SortStableFunc(names, func(a, b string) int {
+			return cmp.Compare(age(a), age(b))
+		})
+	}
+}
+
+// An OrderFlag is a flag value
+// for the order of the taxa.
+type orderFlag struct {
+	order ranges.Order
+}
+
+var orders = map[string]ranges.Order{
+	"name":  ranges.ByName,
+	"age":   ranges.ByAge,
+	"input": ranges.InputOrder,
+}
+
+func (o *orderFlag) String() string {
+	for s, v := range orders {
+		if v == o.order {
+			return s
+		}
+	}
+	return ""
+}
+
+func (o *orderFlag) Set(s string) error {
+	v, ok := orders[strings.ToLower(s)]
+	if !ok {
+		return fmt.Errorf("invalid order %q", s)
+	}
+	o.order = v
+	return nil
+}
@@ -0,0 +1,252 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package plot implements simple bar charts
+// used by the taxrange commands
+// to summarize a dataset,
+// that can be written as PNG or SVG images,
+// and stratigraphic range charts,
+// that can be written as SVG images.
+package plot
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// A Bar is a bar of a chart.
+type Bar struct {
+	Label string
+	Value float64
+}
+
+// A Chart is a bar chart.
+type Chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Bars   []Bar
+}
+
+// Log2Bins returns a histogram of a set of values
+// (that must be equal or larger than 1),
+// using bins of increasing powers of 2,
+// i.e. 1, 2-3, 4-7, 8-15, ...
+// Values smaller than 1 are ignored.
+func Log2Bins(values []int) []Bar {
+	var counts []float64
+	for _, v := range values {
+		if v < 1 {
+			continue
+		}
+		b := 0
+		for x := v; x > 1; x >>= 1 {
+			b++
+		}
+		for len(counts) <= b {
+			counts = append(counts, 0)
+		}
+		counts[b]++
+	}
+
+	bars := make([]Bar, len(counts))
+	for i, n := range counts {
+		lo := 1 << i
+		hi := 1<<(i+1) - 1
+		l := strconv.Itoa(lo)
+		if hi > lo {
+			l = fmt.Sprintf("%d-%d", lo, hi)
+		}
+		bars[i] = Bar{Label: l, Value: n}
+	}
+	return bars
+}
+
+// Size of the chart elements
+// (in pixels).
+const (
+	width   = 640
+	height  = 400
+	left    = 70
+	right   = 20
+	top     = 40
+	bottom  = 60
+	ticks   = 5
+	fontAsc = 10
+	charW   = 7
+)
+
+// Max returns the maximum value of the Y axis,
+// a multiple of the tick step
+// that is equal or larger than the largest bar.
+func (c Chart) max() float64 {
+	step := c.step()
+	var max float64
+	for _, b := range c.Bars {
+		if b.Value > max {
+			max = b.Value
+		}
+	}
+	return math.Max(1, math.Ceil(max/step)) * step
+}
+
+// Step returns the interval between ticks
+// of the Y axis,
+// rounded to 1, 2, or 5 times a power of 10.
+func (c Chart) step() float64 {
+	var max float64
+	for _, b := range c.Bars {
+		max = math.Max(max, b.Value)
+	}
+	if max <= 0 {
+		return 1
+	}
+	return niceStep(max / ticks)
+}
+
+// NiceStep rounds an interval
+// to 1, 2, or 5 times a power of 10.
+func niceStep(raw float64) float64 {
+	p := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*p >= raw {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// BarRect returns the rectangle of a bar
+// in the chart area.
+func (c Chart) barRect(i int) image.Rectangle {
+	w := float64(width-left-right) / float64(len(c.Bars))
+	h := float64(height-top-bottom) * c.Bars[i].Value / c.max()
+	x0 := left + int(float64(i)*w) + 1
+	x1 := left + int(float64(i+1)*w) - 1
+	y1 := height - bottom
+	y0 := y1 - int(h)
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// Ticks returns the values of the ticks
+// of the Y axis.
+func (c Chart) ticks() []float64 {
+	max := c.max()
+	step := c.step()
+	var t []float64
+	for i := 0; float64(i)*step <= max*(1+1e-9); i++ {
+		t = append(t, float64(i)*step)
+	}
+	return t
+}
+
+// TickY returns the Y position of a value.
+func (c Chart) tickY(v float64) int {
+	return height - bottom - int(float64(height-top-bottom)*v/c.max())
+}
+
+// TickLabel returns a value as a label.
+func tickLabel(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+var barColor = color.RGBA{70, 130, 180, 255}
+
+// Image returns the chart
+// as an image.
+func (c Chart) Image() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	black := image.NewUniform(color.Black)
+	for i := range c.Bars {
+		draw.Draw(img, c.barRect(i), image.NewUniform(barColor), image.Point{}, draw.Src)
+	}
+
+	// axes
+	draw.Draw(img, image.Rect(left, top, left+1, height-bottom+1), black, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(left, height-bottom, width-right, height-bottom+1), black, image.Point{}, draw.Src)
+	for _, v := range c.ticks() {
+		y := c.tickY(v)
+		draw.Draw(img, image.Rect(left-4, y, left, y+1), black, image.Point{}, draw.Src)
+		l := fmt.Sprintf("%.4g", v)
+		text(img, left-6-len(l)*charW, y+fontAsc/2, l)
+	}
+
+	// bar labels
+	for i, b := range c.Bars {
+		r := c.barRect(i)
+		x := (r.Min.X+r.Max.X)/2 - len(b.Label)*charW/2
+		text(img, x, height-bottom+4+fontAsc, b.Label)
+	}
+
+	text(img, width/2-len(c.Title)*charW/2, top/2+fontAsc/2, c.Title)
+	text(img, width/2-len(c.XLabel)*charW/2, height-bottom/2+fontAsc, c.XLabel)
+	text(img, 4, top-8, c.YLabel)
+	return img
+}
+
+// Text draws a text
+// with the baseline at the indicated point.
+func text(dst draw.Image, x, y int, s string) {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(color.Black),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+// WritePNG writes the chart
+// as a PNG image.
+func (c Chart) WritePNG(w io.Writer) error {
+	if err := png.Encode(w, c.Image()); err != nil {
+		return fmt.Errorf("when encoding image: %v", err)
+	}
+	return nil
+}
+
+// WriteSVG writes the chart
+// as an SVG image.
+func (c Chart) WriteSVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"12\">\n", width, height, width, height)
+	fmt.Fprintf(bw, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height)
+
+	for i, b := range c.Bars {
+		r := c.barRect(i)
+		fmt.Fprintf(bw, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"steelblue\"><title>%s: %s</title></rect>\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), html.EscapeString(b.Label), tickLabel(b.Value))
+		fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", (r.Min.X+r.Max.X)/2, height-bottom+4+fontAsc, html.EscapeString(b.Label))
+	}
+
+	fmt.Fprintf(bw, "<path d=\"M%d %d V%d H%d\" stroke=\"black\" fill=\"none\"/>\n", left, top, height-bottom, width-right)
+	for _, v := range c.ticks() {
+		y := c.tickY(v)
+		fmt.Fprintf(bw, "<path d=\"M%d %d H%d\" stroke=\"black\"/>\n", left-4, y, left)
+		fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%.4g</text>\n", left-6, y+fontAsc/2, v)
+	}
+
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\" font-size=\"14\">%s</text>\n", width/2, top/2+fontAsc/2, html.EscapeString(c.Title))
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", width/2, height-bottom/2+fontAsc, html.EscapeString(c.XLabel))
+	fmt.Fprintf(bw, "<text x=\"4\" y=\"%d\">%s</text>\n", top-8, html.EscapeString(c.YLabel))
+	fmt.Fprintf(bw, "</svg>\n")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
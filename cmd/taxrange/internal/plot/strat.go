@@ -0,0 +1,150 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package plot
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Span is the stratigraphic range of a taxon.
+type Span struct {
+	Label string
+
+	// Ages in which the taxon is found
+	// (in million years).
+	Ages []float64
+}
+
+// A RangeChart is a stratigraphic range chart
+// (i.e. a range-through chart),
+// with a row for each taxon,
+// and a line from the oldest
+// to the youngest age of the taxon.
+// Time runs from the left
+// (the oldest age)
+// to the right
+// (the youngest age).
+type RangeChart struct {
+	Title  string
+	XLabel string
+	Spans  []Span
+}
+
+// Size of the range chart elements
+// (in pixels).
+const (
+	rowHeight = 18
+	minLeft   = 70
+)
+
+// Left returns the left margin of the chart,
+// wide enough for the longest label.
+func (c RangeChart) left() int {
+	l := minLeft
+	for _, s := range c.Spans {
+		if w := len(s.Label)*charW + 16; w > l {
+			l = w
+		}
+	}
+	return l
+}
+
+// Height returns the height of the chart.
+func (c RangeChart) height() int {
+	return top + bottom + rowHeight*len(c.Spans)
+}
+
+// Bounds returns the bounds of the time axis,
+// as multiples of the tick step.
+func (c RangeChart) bounds() (young, old, step float64) {
+	young, old = math.Inf(1), math.Inf(-1)
+	for _, s := range c.Spans {
+		for _, a := range s.Ages {
+			young = math.Min(young, a)
+			old = math.Max(old, a)
+		}
+	}
+	if math.IsInf(young, 0) {
+		return 0, 1, 1
+	}
+	step = 1
+	if old > young {
+		step = niceStep((old - young) / ticks)
+	}
+	young = math.Floor(young/step) * step
+	old = math.Ceil(old/step) * step
+	if old <= young {
+		old = young + step
+	}
+	return young, old, step
+}
+
+// X returns the X position of an age.
+func (c RangeChart) x(age float64) float64 {
+	left := c.left()
+	young, old, _ := c.bounds()
+	return float64(left) + float64(width-left-right)*(old-age)/(old-young)
+}
+
+// WriteSVG writes the chart
+// as an SVG image.
+func (c RangeChart) WriteSVG(w io.Writer) error {
+	left := c.left()
+	height := c.height()
+	young, old, step := c.bounds()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"12\">\n", width, height, width, height)
+	fmt.Fprintf(bw, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height)
+
+	for i, s := range c.Spans {
+		y := top + i*rowHeight + rowHeight/2
+		fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%s</text>\n", left-8, y+fontAsc/2, html.EscapeString(s.Label))
+		if len(s.Ages) == 0 {
+			continue
+		}
+
+		ages := slices.Clone(s.Ages)
+		slices.Sort(ages)
+		ls := make([]string, 0, len(ages))
+		for _, a := range ages {
+			ls = append(ls, tickLabel(a))
+		}
+		fmt.Fprintf(bw, "<g><title>%s: %s Ma</title>\n", html.EscapeString(s.Label), strings.Join(ls, ", "))
+		x0 := c.x(ages[len(ages)-1])
+		x1 := c.x(ages[0])
+		if x1 > x0 {
+			fmt.Fprintf(bw, "<path d=\"M%.1f %d H%.1f\" stroke=\"steelblue\" stroke-width=\"6\"/>\n", x0, y, x1)
+		}
+		for _, a := range ages {
+			fmt.Fprintf(bw, "<circle cx=\"%.1f\" cy=\"%d\" r=\"3\" fill=\"black\"/>\n", c.x(a), y)
+		}
+		fmt.Fprintf(bw, "</g>\n")
+	}
+
+	fmt.Fprintf(bw, "<path d=\"M%d %d V%d H%d\" stroke=\"black\" fill=\"none\"/>\n", left, top, height-bottom, width-right)
+	for i := 0; young+float64(i)*step <= old*(1+1e-9)+1e-9; i++ {
+		v := young + float64(i)*step
+		x := c.x(v)
+		fmt.Fprintf(bw, "<path d=\"M%.1f %d V%d\" stroke=\"black\"/>\n", x, height-bottom, height-bottom+4)
+		fmt.Fprintf(bw, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", x, height-bottom+4+fontAsc+2, strconv.FormatFloat(v, 'g', 6, 64))
+	}
+
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\" font-size=\"14\">%s</text>\n", width/2, top/2+fontAsc/2, html.EscapeString(c.Title))
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", (left+width-right)/2, height-bottom/2+fontAsc, html.EscapeString(c.XLabel))
+	fmt.Fprintf(bw, "</svg>\n")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package policy implements the flags
+// shared by the taxrange commands
+// that build range maps from points
+// (for example, a KDE or a convex hull),
+// to define the rules used for taxa
+// with few points.
+//
+// The flag --min-points defines the minimum number of pixels
+// of a taxon to use the method of the command.
+// Taxa with fewer pixels use a fallback rule,
+// defined with the flag --fallback:
+// "buffer=<km>" for a buffer of the indicated radius,
+// "points" to keep the pixels of the points,
+// or "skip" to discard the taxon.
+// Different rules can be defined for different number of pixels
+// with a comma separated list of rules,
+// each one preceded by the number of pixels and a colon,
+// for example "1:buffer=200,2:buffer=100,points".
+// A rule without a number of pixels
+// is used for any other number of pixels.
+//
+// If the flag --rules is defined,
+// the rule used for each taxon
+// is written in the indicated file.
+package policy
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// DefaultFallback is the default fallback rule.
+const defaultFallback = "buffer=100"
+
+var minPoints int
+var fallback rules
+var rulesFile string
+
+// Used stores the rules used for each taxon.
+var used []record
+
+// SetFlags adds the policy flags
+// to a command.
+func SetFlags(c *command.Command) {
+	minPoints = 0
+	fallback = nil
+	fallback.Set(defaultFallback)
+	rulesFile = ""
+	used = nil
+	c.Flags().IntVar(&minPoints, "min-points", 0, "")
+	c.Flags().Var(&fallback, "fallback", "")
+	c.Flags().StringVar(&rulesFile, "rules", "", "")
+}
+
+// A Rule is a rule used to build a range map
+// for a taxon with few points.
+type Rule struct {
+	count  int // number of points, 0 for any number
+	kind   string
+	radius float64
+}
+
+// String returns the rule
+// as it is written in the flag.
+func (r Rule) String() string {
+	if r.kind == "buffer" {
+		return "buffer=" + strconv.FormatFloat(r.radius, 'f', -1, 64)
+	}
+	return r.kind
+}
+
+// Apply returns the range map built with the rule
+// from the pixels of a range.
+// It returns false if the taxon should be discarded.
+func (r Rule) Apply(pix *earth.Pixelation, rng map[int]float64) (map[int]float64, bool) {
+	switch r.kind {
+	case "buffer":
+		return ranges.Buffer(pix, rng, r.radius), true
+	case "points":
+		pts := make(map[int]float64, len(rng))
+		for px := range rng {
+			pts[px] = 1
+		}
+		return pts, true
+	}
+	return nil, false
+}
+
+// Fallback returns the fallback rule
+// for a taxon with the indicated number of pixels.
+// It returns false if the taxon has enough pixels
+// to use the method of the command.
+func Fallback(points int) (Rule, bool) {
+	if points >= minPoints {
+		return Rule{}, false
+	}
+	var def Rule
+	var hasDef bool
+	for _, r := range fallback {
+		if r.count == points {
+			return r, true
+		}
+		if r.count == 0 {
+			def = r
+			hasDef = true
+		}
+	}
+	if !hasDef {
+		def, _ = parseRule(defaultFallback)
+	}
+	return def, true
+}
+
+// A Record is the rule used for a taxon.
+type record struct {
+	taxon  string
+	points int
+	rule   string
+}
+
+// Record stores the rule used for a taxon.
+func Record(taxon string, points int, rule string) {
+	used = append(used, record{
+		taxon:  taxon,
+		points: points,
+		rule:   rule,
+	})
+}
+
+// Write writes the rules used for each taxon
+// into the file defined by the flag --rules.
+// If the flag is not defined,
+// it does nothing.
+func Write() error {
+	if rulesFile == "" {
+		return nil
+	}
+	return files.WriteFile(rulesFile, writeRules)
+}
+
+func writeRules(w io.Writer) error {
+	tab := csv.NewWriter(w)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	if err := tab.Write([]string{"taxon", "points", "rule"}); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	for _, r := range used {
+		row := []string{
+			r.taxon,
+			strconv.Itoa(r.points),
+			r.rule,
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// Rules is a flag value
+// for a list of fallback rules.
+type rules []Rule
+
+func (rs *rules) String() string {
+	s := make([]string, 0, len(*rs))
+	for _, r := range *rs {
+		if r.count > 0 {
+			s = append(s, strconv.Itoa(r.count)+":"+r.String())
+			continue
+		}
+		s = append(s, r.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func (rs *rules) Set(s string) error {
+	var list rules
+	seen := make(map[int]bool)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		var count int
+		if i := strings.Index(v, ":"); i >= 0 {
+			n, err := strconv.Atoi(strings.TrimSpace(v[:i]))
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of points in rule %q", v)
+			}
+			count = n
+			v = strings.TrimSpace(v[i+1:])
+		}
+		r, err := parseRule(v)
+		if err != nil {
+			return err
+		}
+		if seen[count] {
+			if count == 0 {
+				return fmt.Errorf("default rule defined more than once")
+			}
+			return fmt.Errorf("rule for %d points defined more than once", count)
+		}
+		seen[count] = true
+		r.count = count
+		list = append(list, r)
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("invalid fallback rule %q", s)
+	}
+	*rs = list
+	return nil
+}
+
+func parseRule(s string) (Rule, error) {
+	kind, val, _ := strings.Cut(strings.ToLower(s), "=")
+	switch kind {
+	case "buffer":
+		radius, err := strconv.ParseFloat(val, 64)
+		if err != nil || radius < 0 {
+			return Rule{}, fmt.Errorf("invalid buffer radius in rule %q", s)
+		}
+		return Rule{kind: kind, radius: radius}, nil
+	case "points", "skip":
+		if val != "" {
+			return Rule{}, fmt.Errorf("invalid rule %q", s)
+		}
+		return Rule{kind: kind}, nil
+	}
+	return Rule{}, fmt.Errorf("unknown rule %q", s)
+}
@@ -0,0 +1,131 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package presence implements a reader
+// for files of presence-absence observations.
+//
+// A presence-absence file is a tab-delimited file
+// with the following fields:
+// "taxon" (or "species"),
+// "latitude",
+// "longitude",
+// and "presence".
+// Valid values for the presence field are
+// "1", "true", or "present" for a presence,
+// and "0", "false", or "absent" for an absence.
+package presence
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// An Observation is a presence
+// or an absence of a taxon
+// at a geographic location.
+type Observation struct {
+	Taxon    string
+	Lat      float64
+	Lon      float64
+	Presence bool
+}
+
+// Read reads the observations
+// from a presence-absence file.
+func Read(name string) ([]Observation, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	if _, ok := fields["taxon"]; !ok {
+		i, ok := fields["species"]
+		if !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, "taxon")
+		}
+		fields["taxon"] = i
+	}
+	for _, h := range []string{"latitude", "longitude", "presence"} {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, h)
+		}
+	}
+
+	var obs []Observation
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+		}
+
+		tax := strings.Join(strings.Fields(row[fields["taxon"]]), " ")
+		if tax == "" {
+			continue
+		}
+
+		f := "latitude"
+		lat, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		if lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: invalid latitude %.6f", name, ln, f, lat)
+		}
+		f = "longitude"
+		lon, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		if lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: invalid longitude %.6f", name, ln, f, lon)
+		}
+		f = "presence"
+		p, err := parsePresence(row[fields[f]])
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+
+		obs = append(obs, Observation{
+			Taxon:    tax,
+			Lat:      lat,
+			Lon:      lon,
+			Presence: p,
+		})
+	}
+	return obs, nil
+}
+
+func parsePresence(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "present":
+		return true, nil
+	case "0", "false", "absent":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid presence value %q", s)
+}
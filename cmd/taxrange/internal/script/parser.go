@@ -0,0 +1,460 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A Node is a node of the syntax tree
+// of a parsed expression.
+type Node struct {
+	// Op is the kind of node:
+	// "num" and "str" for literals,
+	// "var" for variables,
+	// "call" for functions,
+	// "neg" and "!" for unary operators,
+	// or the symbol of a binary operator.
+	Op string
+
+	Num  float64 // the value of a number
+	Name string  // the value of a string, or the name of a variable or function
+	Args []*Node // the operands, or the arguments of a function
+
+	// Pos is the position of the node
+	// in the source (starting at 1).
+	Pos int
+
+	fn function
+}
+
+func (n *Node) eval(e Env) Value {
+	switch n.Op {
+	case "num":
+		return Num(n.Num)
+	case "str":
+		return Str(n.Name)
+	case "var":
+		return e(n.Name)
+	case "call":
+		fn := n.fn
+		if fn.lazy != nil {
+			return fn.lazy(e, n.Args)
+		}
+		args := make([]Value, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = a.eval(e)
+		}
+		return fn.call(args)
+	case "neg":
+		return Num(-n.Args[0].eval(e).Float())
+	case "!":
+		return Bool(!n.Args[0].eval(e).IsTrue())
+	}
+
+	l := n.Args[0].eval(e)
+
+	// short circuit evaluation
+	switch n.Op {
+	case "&&":
+		if !l.IsTrue() {
+			return Bool(false)
+		}
+		return Bool(n.Args[1].eval(e).IsTrue())
+	case "||":
+		if l.IsTrue() {
+			return Bool(true)
+		}
+		return Bool(n.Args[1].eval(e).IsTrue())
+	}
+
+	r := n.Args[1].eval(e)
+	switch n.Op {
+	case "+":
+		return Num(l.Float() + r.Float())
+	case "-":
+		return Num(l.Float() - r.Float())
+	case "*":
+		return Num(l.Float() * r.Float())
+	case "/":
+		return Num(l.Float() / r.Float())
+	}
+
+	// comparisons
+	if l.isStr && r.isStr {
+		c := strings.Compare(strings.ToLower(l.str), strings.ToLower(r.str))
+		return Bool(compare(n.Op, c))
+	}
+	x, y := l.Float(), r.Float()
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return Bool(n.Op == "!=")
+	}
+	c := 0
+	if x < y {
+		c = -1
+	} else if x > y {
+		c = 1
+	}
+	return Bool(compare(n.Op, c))
+}
+
+// Compare returns the result of a comparison operator
+// from the result of a three-way comparison.
+func compare(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// A Function is a function
+// accepted in an expression.
+type function struct {
+	args int
+	call func(args []Value) Value
+
+	// lazy functions evaluate its own arguments
+	lazy func(e Env, args []*Node) Value
+}
+
+// Functions are the functions
+// accepted in an expression.
+var functions = map[string]function{
+	"abs": {args: 1, call: func(a []Value) Value {
+		return Num(math.Abs(a[0].Float()))
+	}},
+	"contains": {args: 2, call: func(a []Value) Value {
+		return Bool(strings.Contains(strings.ToLower(a[0].String()), strings.ToLower(a[1].String())))
+	}},
+	"empty": {args: 1, call: func(a []Value) Value {
+		return Bool(strings.TrimSpace(a[0].String()) == "")
+	}},
+	"exp": {args: 1, call: func(a []Value) Value {
+		return Num(math.Exp(a[0].Float()))
+	}},
+	"if": {args: 3, lazy: func(e Env, a []*Node) Value {
+		if a[0].eval(e).IsTrue() {
+			return a[1].eval(e)
+		}
+		return a[2].eval(e)
+	}},
+	"log": {args: 1, call: func(a []Value) Value {
+		return Num(math.Log(a[0].Float()))
+	}},
+	"lower": {args: 1, call: func(a []Value) Value {
+		return Str(strings.ToLower(a[0].String()))
+	}},
+	"max": {args: 2, call: func(a []Value) Value {
+		return Num(math.Max(a[0].Float(), a[1].Float()))
+	}},
+	"min": {args: 2, call: func(a []Value) Value {
+		return Num(math.Min(a[0].Float(), a[1].Float()))
+	}},
+	"pow": {args: 2, call: func(a []Value) Value {
+		return Num(math.Pow(a[0].Float(), a[1].Float()))
+	}},
+	"sqrt": {args: 1, call: func(a []Value) Value {
+		return Num(math.Sqrt(a[0].Float()))
+	}},
+}
+
+// Args returns the number of arguments
+// of the functions accepted in an expression.
+func args() map[string]int {
+	a := make(map[string]int, len(functions))
+	for name, fn := range functions {
+		a[name] = fn.args
+	}
+	return a
+}
+
+// ParseTree parses an expression
+// and returns the root of its syntax tree,
+// and the variables used in the expression
+// in the order in which they are found.
+// Funcs are the names of the accepted functions
+// (in lower case)
+// with their number of arguments.
+// Function names are case insensitive,
+// and are returned in lower case,
+// while variable names are returned as written.
+func ParseTree(src string, funcs map[string]int) (*Node, []string, error) {
+	p := &parser{src: src, funcs: funcs}
+	n, err := p.or()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, nil, fmt.Errorf("at position %d: unexpected %q", p.pos+1, p.src[p.pos])
+	}
+	return n, p.vars, nil
+}
+
+// A Parser parses an expression
+// using recursive descent.
+type parser struct {
+	src   string
+	pos   int
+	vars  []string
+	funcs map[string]int
+}
+
+func (p *parser) or() (*Node, error) {
+	n, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.match("||") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		n = &Node{Op: "||", Args: []*Node{n, r}, Pos: n.Pos}
+	}
+	return n, nil
+}
+
+func (p *parser) and() (*Node, error) {
+	n, err := p.cmp()
+	if err != nil {
+		return nil, err
+	}
+	for p.match("&&") {
+		r, err := p.cmp()
+		if err != nil {
+			return nil, err
+		}
+		n = &Node{Op: "&&", Args: []*Node{n, r}, Pos: n.Pos}
+	}
+	return n, nil
+}
+
+func (p *parser) cmp() (*Node, error) {
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.match(op) {
+			continue
+		}
+		r, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Op: op, Args: []*Node{n, r}, Pos: n.Pos}, nil
+	}
+	return n, nil
+}
+
+func (p *parser) expr() (*Node, error) {
+	n, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return n, nil
+		}
+		p.pos++
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		n = &Node{Op: string(op), Args: []*Node{n, r}, Pos: n.Pos}
+	}
+}
+
+func (p *parser) term() (*Node, error) {
+	n, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return n, nil
+		}
+		p.pos++
+		r, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		n = &Node{Op: string(op), Args: []*Node{n, r}, Pos: n.Pos}
+	}
+}
+
+func (p *parser) factor() (*Node, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("at position %d: expecting ')'", p.pos+1)
+		}
+		p.pos++
+		return n, nil
+	case c == '-':
+		start := p.pos
+		p.pos++
+		n, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Op: "neg", Args: []*Node{n}, Pos: start + 1}, nil
+	case c == '!' && !strings.HasPrefix(p.src[p.pos:], "!="):
+		start := p.pos
+		p.pos++
+		n, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Op: "!", Args: []*Node{n}, Pos: start + 1}, nil
+	case c == '"' || c == '\'':
+		start := p.pos
+		p.pos++
+		end := strings.IndexByte(p.src[p.pos:], c)
+		if end < 0 {
+			return nil, fmt.Errorf("at position %d: unterminated string", start+1)
+		}
+		s := p.src[p.pos : p.pos+end]
+		p.pos += end + 1
+		return &Node{Op: "str", Name: s, Pos: start + 1}, nil
+	case c == '.' || isDigit(c):
+		start := p.pos
+		p.number()
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("at position %d: invalid number %q", start+1, p.src[start:p.pos])
+		}
+		return &Node{Op: "num", Num: v, Pos: start + 1}, nil
+	case isIdent(c):
+		start := p.pos
+		for p.pos < len(p.src) && (isIdent(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if p.peek() != '(' {
+			p.addVar(name)
+			return &Node{Op: "var", Name: name, Pos: start + 1}, nil
+		}
+		name = strings.ToLower(name)
+		nargs, ok := p.funcs[name]
+		if !ok {
+			return nil, fmt.Errorf("at position %d: unknown function %q", start+1, name)
+		}
+		p.pos++
+		var args []*Node
+		for p.peek() != ')' {
+			if len(args) > 0 {
+				if p.peek() != ',' {
+					return nil, fmt.Errorf("at position %d: expecting ','", p.pos+1)
+				}
+				p.pos++
+			}
+			a, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+		}
+		p.pos++
+		if len(args) != nargs {
+			return nil, fmt.Errorf("at position %d: function %q: expecting %d arguments, got %d", start+1, name, nargs, len(args))
+		}
+		return &Node{Op: "call", Name: name, Args: args, Pos: start + 1}, nil
+	}
+	return nil, fmt.Errorf("at position %d: unexpected %q", p.pos+1, c)
+}
+
+// Number consumes a number,
+// with an optional exponent
+// (for example "2.5e-3").
+func (p *parser) number() {
+	digits := func() {
+		for p.pos < len(p.src) && (p.src[p.pos] == '.' || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+	}
+	digits()
+	if p.pos >= len(p.src) || (p.src[p.pos] != 'e' && p.src[p.pos] != 'E') {
+		return
+	}
+	i := p.pos + 1
+	if i < len(p.src) && (p.src[i] == '+' || p.src[i] == '-') {
+		i++
+	}
+	if i >= len(p.src) || !isDigit(p.src[i]) {
+		// not an exponent
+		return
+	}
+	p.pos = i
+	digits()
+}
+
+// Match consumes the indicated operator
+// if it is the next token.
+func (p *parser) match(op string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.src[p.pos:], op) {
+		return false
+	}
+	p.pos += len(op)
+	return true
+}
+
+func (p *parser) addVar(name string) {
+	for _, v := range p.vars {
+		if v == name {
+			return
+		}
+	}
+	p.vars = append(p.vars, name)
+}
+
+// Peek returns the next non-space character
+// without consuming it.
+// It returns 0 at the end of the expression.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
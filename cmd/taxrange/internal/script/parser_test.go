@@ -0,0 +1,112 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package script_test
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/js-arias/ranges/cmd/taxrange/internal/script"
+)
+
+func TestEval(t *testing.T) {
+	env := func(name string) script.Value {
+		switch name {
+		case "x":
+			return script.Num(2)
+		case "y":
+			return script.Num(0.5)
+		case "s":
+			return script.Str("Aus Bus")
+		case "empty":
+			return script.Str("")
+		}
+		return script.Num(math.NaN())
+	}
+
+	tests := map[string]struct {
+		src  string
+		want float64
+		vars []string
+	}{
+		"number":         {src: "3.25", want: 3.25},
+		"leading dot":    {src: ".5", want: 0.5},
+		"exponent":       {src: "2.5e-3", want: 0.0025},
+		"upper exponent": {src: "1E+2", want: 100},
+		"exponent digit": {src: "3e2 * x", want: 600, vars: []string{"x"}},
+		"precedence":     {src: "1 + 2 * 3 - 4 / 2", want: 5},
+		"parenthesis":    {src: "(1 + 2) * 3", want: 9},
+		"negation":       {src: "-x + 1", want: -1, vars: []string{"x"}},
+		"variables":      {src: "X * y + x", want: 3, vars: []string{"x", "y"}},
+		"comparison":     {src: "x >= 2 && y < 1", want: 1, vars: []string{"x", "y"}},
+		"not equal":      {src: "x != 2", want: 0, vars: []string{"x"}},
+		"or":             {src: "x < 0 || !(y > 1)", want: 1, vars: []string{"x", "y"}},
+		"string":         {src: `s == "aus bus"`, want: 1, vars: []string{"s"}},
+		"single quote":   {src: `contains(s, 'bus')`, want: 1, vars: []string{"s"}},
+		"empty":          {src: "empty(empty)", want: 1, vars: []string{"empty"}},
+		"nan comparison": {src: "z > 0", want: 0, vars: []string{"z"}},
+		"if":             {src: "if(x > 1, pow(x, 3), 0)", want: 8, vars: []string{"x"}},
+		"functions":      {src: "MAX(abs(-3), sqrt(4)) + min(x, y)", want: 3.5, vars: []string{"x", "y"}},
+		"logarithm":      {src: "log(exp(x))", want: 2, vars: []string{"x"}},
+	}
+
+	for name, test := range tests {
+		e, err := script.Parse(test.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if got := e.Eval(env).Float(); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("%s: %q: got %g, want %g", name, test.src, got, test.want)
+		}
+		if !slices.Equal(e.Vars(), test.vars) {
+			t.Errorf("%s: %q: variables: got %v, want %v", name, test.src, e.Vars(), test.vars)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := map[string]string{
+		"empty":            "",
+		"unexpected end":   "1 +",
+		"parenthesis":      "(1 + 2",
+		"trailing":         "1 2",
+		"unknown function": "foo(1)",
+		"arguments":        "pow(1)",
+		"string":           `"abc`,
+		"exponent":         "2e",
+		"invalid number":   "1.2.3",
+	}
+
+	for name, src := range tests {
+		if _, err := script.Parse(src); err == nil {
+			t.Errorf("%s: %q: expecting error", name, src)
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	n, vars, err := script.ParseTree("norm(Kde) * 2e1", map[string]int{"norm": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(vars, []string{"Kde"}) {
+		t.Errorf("variables: got %v, want [Kde]", vars)
+	}
+	if n.Op != "*" || len(n.Args) != 2 {
+		t.Fatalf("root: got %q with %d arguments, want \"*\" with 2 arguments", n.Op, len(n.Args))
+	}
+	if f := n.Args[0]; f.Op != "call" || f.Name != "norm" || f.Args[0].Op != "var" || f.Args[0].Name != "Kde" {
+		t.Errorf("left operand: got %q %q, want call \"norm\" of variable \"Kde\"", f.Op, f.Name)
+	}
+	if r := n.Args[1]; r.Op != "num" || r.Num != 20 || r.Pos != 13 {
+		t.Errorf("right operand: got %q %g at %d, want number 20 at 13", r.Op, r.Num, r.Pos)
+	}
+
+	if _, _, err := script.ParseTree("abs(x)", map[string]int{"norm": 1}); err == nil {
+		t.Errorf("function not in the function set: expecting error")
+	}
+}
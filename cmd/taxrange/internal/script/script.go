@@ -0,0 +1,221 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package script implements a small expression language
+// used by the taxrange commands
+// to define custom filters
+// (for example, to filter the records
+// of an input file)
+// and custom transforms
+// (for example, to transform the value of each pixel of a range).
+//
+// An expression accepts numbers
+// (that can use scientific notation, as in 2.5e-3),
+// strings (between double or single quotes),
+// variables,
+// the arithmetic operators +, -, *, and /,
+// the comparison operators ==, !=, <, <=, >, and >=,
+// the logical operators &&, ||, and !,
+// parenthesis,
+// and the following functions:
+//
+//	abs(x)			absolute value
+//	contains(s, t)		true if s contains t (case insensitive)
+//	empty(s)		true if s is an empty string
+//	exp(x)			the exponential of x
+//	if(c, a, b)		a if c is true, otherwise b
+//	log(x)			the natural logarithm of x
+//	lower(s)		s in lower case
+//	max(x, y)		the maximum of x and y
+//	min(x, y)		the minimum of x and y
+//	pow(x, y)		x to the power of y
+//	sqrt(x)			the square root of x
+//
+// If a string is used as a number,
+// it is parsed as a number,
+// and if it is not a valid number
+// (for example, an empty string)
+// its value is NaN,
+// so any comparison with it will be false.
+// Comparisons between two strings
+// are case insensitive.
+// A value is true if it is a non-zero number
+// (that is not NaN),
+// or a non-empty string.
+package script
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Value is the value of an expression,
+// either a number or a string.
+type Value struct {
+	num   float64
+	str   string
+	isStr bool
+}
+
+// Num returns a number value.
+func Num(v float64) Value {
+	return Value{num: v}
+}
+
+// Str returns a string value.
+func Str(s string) Value {
+	return Value{str: s, isStr: true}
+}
+
+// Bool returns a boolean value,
+// i.e. 1 if it is true,
+// and 0 if it is false.
+func Bool(b bool) Value {
+	if b {
+		return Value{num: 1}
+	}
+	return Value{num: 0}
+}
+
+// Float returns the value as a number.
+// If the value is a string
+// that is not a valid number,
+// it returns NaN.
+func (v Value) Float() float64 {
+	if !v.isStr {
+		return v.num
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+// IsTrue returns true if the value is a non-zero number
+// or a non-empty string.
+func (v Value) IsTrue() bool {
+	if v.isStr {
+		return v.str != ""
+	}
+	return v.num != 0 && !math.IsNaN(v.num)
+}
+
+// String returns the value as a string.
+func (v Value) String() string {
+	if v.isStr {
+		return v.str
+	}
+	return strconv.FormatFloat(v.num, 'g', -1, 64)
+}
+
+// An Env returns the value of a variable.
+type Env func(name string) Value
+
+// An Expr is a parsed expression.
+type Expr struct {
+	src  string
+	root *Node
+	vars []string
+}
+
+// Parse parses an expression.
+// Variable names are case insensitive.
+func Parse(src string) (*Expr, error) {
+	n, vars, err := ParseTree(src, args())
+	if err != nil {
+		return nil, err
+	}
+	bind(n)
+
+	var lv []string
+	for _, v := range vars {
+		v = strings.ToLower(v)
+		if !slices.Contains(lv, v) {
+			lv = append(lv, v)
+		}
+	}
+	return &Expr{src: src, root: n, vars: lv}, nil
+}
+
+// Bind sets the names of the variables
+// of a syntax tree in lower case,
+// and sets the functions of the function nodes.
+func bind(n *Node) {
+	switch n.Op {
+	case "var":
+		n.Name = strings.ToLower(n.Name)
+	case "call":
+		n.fn = functions[n.Name]
+	}
+	for _, a := range n.Args {
+		bind(a)
+	}
+}
+
+// Read returns an expression
+// defined in a flag.
+// If the flag value starts with '@',
+// the expression is read from the indicated file.
+func Read(flag string) (*Expr, error) {
+	src := flag
+	if name, ok := strings.CutPrefix(flag, "@"); ok {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		src = stripComments(string(b))
+	}
+	e, err := Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", flag, err)
+	}
+	return e, nil
+}
+
+// StripComments removes the comment lines
+// (lines starting with '#')
+// of an expression file.
+func stripComments(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, ln := range lines {
+		if strings.HasPrefix(strings.TrimSpace(ln), "#") {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Eval evaluates an expression.
+func (e *Expr) Eval(env Env) Value {
+	return e.root.eval(env)
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Vars returns the variables used in an expression,
+// in the order in which they are found.
+// Each variable is returned only once.
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// Check returns an error
+// if the expression uses a variable
+// that is not in the indicated list.
+func (e *Expr) Check(vars ...string) error {
+	for _, v := range e.vars {
+		if !slices.Contains(vars, v) {
+			return fmt.Errorf("unknown variable %q", v)
+		}
+	}
+	return nil
+}
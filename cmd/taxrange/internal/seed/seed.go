@@ -0,0 +1,79 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package seed implements the flag
+// shared by the taxrange commands
+// that use random numbers,
+// to define the seed of the random number generator.
+//
+// The flag --seed defines the seed
+// (default 1),
+// so the same seed always produces the same results.
+// If the value is "random",
+// a seed is taken from the current time.
+// In any case,
+// the seed used is recorded in the output,
+// so an analysis can always be reproduced.
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/js-arias/command"
+)
+
+var seedFlag = value{seed: 1}
+
+// SetFlags adds the --seed flag
+// to a command.
+func SetFlags(c *command.Command) {
+	seedFlag = value{seed: 1}
+	c.Flags().Var(&seedFlag, "seed", "")
+}
+
+// Seed returns the seed
+// defined by the --seed flag.
+func Seed() int64 {
+	return seedFlag.seed
+}
+
+// Rand returns a new random number generator
+// using the seed defined by the --seed flag.
+func Rand() *rand.Rand {
+	return rand.New(rand.NewSource(seedFlag.seed))
+}
+
+// Comment returns the comment
+// used to record the seed
+// in an output file.
+func Comment() string {
+	return fmt.Sprintf("random seed: %d", seedFlag.seed)
+}
+
+// A Value is a flag value
+// for the seed.
+type value struct {
+	seed int64
+}
+
+func (v *value) String() string {
+	return strconv.FormatInt(v.seed, 10)
+}
+
+func (v *value) Set(s string) error {
+	if strings.ToLower(s) == "random" {
+		v.seed = time.Now().UnixNano()
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid seed value %q", s)
+	}
+	v.seed = n
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package sensitive implements the reading
+// of lists of sensitive taxa
+// (for example, poached taxa),
+// and the flags shared by the taxrange commands
+// that draw or export ranges,
+// to generalize the ranges of sensitive taxa.
+//
+// A list of sensitive taxa is a tab-delimited file
+// with the field "taxon",
+// and optionally,
+// the fields "action" and "value",
+// that define how each taxon is anonymized
+// (see the command anonymize).
+//
+// The flag --sensitive defines the list of sensitive taxa,
+// and the flag --generalize defines a distance
+// (in km).
+// The range of each sensitive taxon
+// is replaced by a generalized range
+// (see ranges.Generalize),
+// and taxa with the action "remove"
+// are removed.
+package sensitive
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// Actions are the valid actions
+// for a sensitive taxon.
+var actions = []string{"coarse", "jitter", "remove"}
+
+// ValidAction returns true
+// if a is a valid action for a sensitive taxon.
+func ValidAction(a string) bool {
+	for _, v := range actions {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// A Taxon is a sensitive taxon.
+type Taxon struct {
+	Name string
+
+	// Action is the action used to anonymize the taxon.
+	// It is empty if the action is not defined.
+	Action string
+
+	// Value is the parameter of the action.
+	// HasValue is false if the value is not defined.
+	Value    float64
+	HasValue bool
+
+	// Row is the row of the taxon in the file.
+	Row int
+}
+
+// Read reads a list of sensitive taxa
+// from a file.
+func Read(name string) ([]Taxon, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list, err := read(f)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	return list, nil
+}
+
+func read(r io.Reader) ([]Taxon, error) {
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("while reading header: %v", err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	if _, ok := fields["taxon"]; !ok {
+		return nil, fmt.Errorf("expecting field %q", "taxon")
+	}
+	field := func(row []string, f string) string {
+		i, ok := fields[f]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var list []Taxon
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", ln, err)
+		}
+
+		t := Taxon{
+			Name:   strings.Join(strings.Fields(field(row, "taxon")), " "),
+			Action: strings.ToLower(field(row, "action")),
+			Row:    ln,
+		}
+		if t.Name == "" {
+			continue
+		}
+		if t.Action != "" && !ValidAction(t.Action) {
+			return nil, fmt.Errorf("row %d: field %q: unknown action %q", ln, "action", t.Action)
+		}
+		if v := field(row, "value"); v != "" {
+			t.Value, err = strconv.ParseFloat(v, 64)
+			if err != nil || t.Value < 0 {
+				return nil, fmt.Errorf("row %d: field %q: invalid value %q", ln, "value", v)
+			}
+			t.HasValue = true
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+var sensitiveFile string
+var generalize float64
+
+// List is the list of sensitive taxa
+// read from the --sensitive file.
+var list []Taxon
+var listRead bool
+
+// SetFlags adds the --sensitive and --generalize flags
+// to a command.
+func SetFlags(c *command.Command) {
+	sensitiveFile = ""
+	generalize = 0
+	list = nil
+	listRead = false
+	c.Flags().StringVar(&sensitiveFile, "sensitive", "", "")
+	c.Flags().Float64Var(&generalize, "generalize", 0, "")
+}
+
+// Check returns an error
+// if the --sensitive and --generalize flags
+// are not consistent.
+func Check() error {
+	if generalize < 0 {
+		return fmt.Errorf("invalid --generalize value %.6f", generalize)
+	}
+	if sensitiveFile == "" && generalize > 0 {
+		return errors.New("flag --generalize requires flag --sensitive")
+	}
+	if sensitiveFile != "" && generalize == 0 {
+		return errors.New("flag --sensitive requires flag --generalize")
+	}
+	return nil
+}
+
+// Apply generalizes the ranges of the sensitive taxa
+// of a collection,
+// and removes the sensitive taxa with the action "remove".
+// If the flag --sensitive is not defined,
+// the collection is not modified.
+func Apply(coll *ranges.Collection) error {
+	if sensitiveFile == "" {
+		return nil
+	}
+	if !listRead {
+		var err error
+		list, err = Read(sensitiveFile)
+		if err != nil {
+			return err
+		}
+		listRead = true
+	}
+
+	pix := coll.Pixelation()
+	for _, t := range list {
+		if !coll.HasTaxon(t.Name) {
+			continue
+		}
+		if t.Action == "remove" {
+			coll.Delete(t.Name)
+			continue
+		}
+
+		name := coll.VerbatimName(t.Name)
+		age := coll.Age(t.Name)
+		gen := ranges.Generalize(pix, coll.Range(t.Name), generalize)
+		if coll.Type(t.Name) == ranges.Points {
+			coll.SetPixels(name, age, gen)
+		} else {
+			coll.Set(name, age, gen)
+		}
+	}
+	return nil
+}
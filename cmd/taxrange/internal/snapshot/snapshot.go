@@ -0,0 +1,80 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package snapshot implements the flag --patch
+// shared by the taxrange commands
+// that edit a collection.
+//
+// If the flag --patch is defined,
+// a copy of the collection is stored
+// before it is edited,
+// and the changes are written as a patch
+// (see ranges.Patch)
+// into the indicated file,
+// so the edition can be reverted
+// with the command apply.
+package snapshot
+
+import (
+	"errors"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+var patchFile string
+var orig *ranges.Collection
+
+// SetFlags adds the patch flags
+// to a command.
+func SetFlags(c *command.Command) {
+	patchFile = ""
+	orig = nil
+	c.Flags().StringVar(&patchFile, "patch", "", "")
+}
+
+// Take stores a copy of a collection
+// before it is edited.
+// If the flag --patch is not defined,
+// it does nothing.
+func Take(coll *ranges.Collection) error {
+	if patchFile == "" {
+		return nil
+	}
+	if files.IsStd(patchFile) {
+		return errors.New("flag --patch: the standard output can not be used for the patch")
+	}
+
+	orig = ranges.New(coll.Pixelation())
+	for _, tax := range coll.Taxa() {
+		if err := orig.Copy(coll, tax); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the patch
+// with the changes between the stored copy
+// and the edited collection.
+// If the flag --patch is not defined,
+// it does nothing.
+func Write(coll *ranges.Collection) error {
+	if patchFile == "" || orig == nil {
+		return nil
+	}
+
+	p, err := ranges.Diff(orig, coll)
+	if err != nil {
+		return err
+	}
+	return files.WriteFile(patchFile, p.TSV)
+}
+
+// Defined returns true if the flag --patch
+// is defined.
+func Defined() bool {
+	return patchFile != ""
+}
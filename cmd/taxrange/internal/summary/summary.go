@@ -0,0 +1,189 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package summary implements a machine-readable summary
+// of a run of a taxrange command.
+//
+// If the flag --json-summary is defined,
+// when the command ends
+// (with or without an error)
+// a JSON object is written
+// with the number of records and taxa read,
+// the number of taxa written,
+// the number of warnings,
+// and the output files,
+// so workflow managers can check
+// that the step ends successfully.
+// For range files,
+// each pixel of a taxon is counted as a record.
+// Only files are reported as outputs,
+// so the standard output is not included.
+//
+// The value of --json-summary is a file name,
+// or "fd:<number>"
+// to write the summary into an open file descriptor,
+// for example "fd:3".
+package summary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+)
+
+var jsonSummary string
+
+// SetFlags adds the summary flags
+// to a command.
+func SetFlags(c *command.Command) {
+	jsonSummary = ""
+	c.Flags().StringVar(&jsonSummary, "json-summary", "", "")
+}
+
+// A Summary is the summary of a run.
+type summary struct {
+	Command     string   `json:"command"`
+	Status      string   `json:"status"`
+	Error       string   `json:"error,omitempty"`
+	RecordsRead int      `json:"records_read"`
+	TaxaRead    int      `json:"taxa_read"`
+	TaxaWritten int      `json:"taxa_written"`
+	Warnings    int      `json:"warnings"`
+	Outputs     []string `json:"outputs"`
+}
+
+var mu sync.Mutex
+var current summary
+
+// Run wraps the run function of a command,
+// so the summary is written when the command ends.
+func Run(run func(c *command.Command, args []string) error) func(c *command.Command, args []string) error {
+	return func(c *command.Command, args []string) error {
+		mu.Lock()
+		current = summary{
+			Command: strings.Fields(c.Usage)[0],
+			Outputs: []string{},
+		}
+		mu.Unlock()
+
+		err := run(c, args)
+		if jsonSummary == "" {
+			return err
+		}
+
+		mu.Lock()
+		s := current
+		mu.Unlock()
+		s.Status = "ok"
+		if err != nil {
+			s.Status = "error"
+			s.Error = err.Error()
+		}
+		if wErr := write(jsonSummary, s); wErr != nil && err == nil {
+			return wErr
+		}
+		return err
+	}
+}
+
+// Read adds the records and taxa
+// of a collection
+// to the summary of the input.
+func Read(coll *ranges.Collection) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, tax := range coll.Taxa() {
+		current.RecordsRead += len(coll.Range(tax))
+	}
+	current.TaxaRead += len(coll.Taxa())
+}
+
+// Records adds a number of records
+// (for example, the rows of an imported table)
+// to the summary of the input.
+func Records(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.RecordsRead += n
+}
+
+// Written adds a number of taxa
+// to the summary of the output.
+func Written(taxa int) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.TaxaWritten += taxa
+}
+
+// Warning adds a warning to the summary.
+func Warning() {
+	mu.Lock()
+	defer mu.Unlock()
+	current.Warnings++
+}
+
+// Output adds the name of an output file
+// to the summary.
+func Output(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.Outputs = append(current.Outputs, name)
+}
+
+func write(name string, s summary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("when encoding summary: %v", err)
+	}
+	data = append(data, '\n')
+
+	if fd, ok := strings.CutPrefix(name, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --json-summary value %q", name)
+		}
+		f := os.NewFile(uintptr(n), name)
+		if f == nil {
+			return fmt.Errorf("invalid --json-summary value %q", name)
+		}
+		if _, err := f.Write(data); err != nil {
+			return fmt.Errorf("when writing summary: %v", err)
+		}
+		return nil
+	}
+
+	if writeFile == nil {
+		return errors.New("when writing summary: undefined file writer")
+	}
+	err = writeFile(name, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("when writing summary: %v", err)
+	}
+	return nil
+}
+
+// WriteFile is the function used
+// to write the summary file.
+var writeFile func(name string, fn func(w io.Writer) error) error
+
+// SetWriter sets the function used
+// to write the summary file
+// (i.e. files.WriteFile,
+// as the package files can not be imported here,
+// because it reports the output files to the summary).
+func SetWriter(fn func(name string, fn func(w io.Writer) error) error) {
+	writeFile = fn
+}
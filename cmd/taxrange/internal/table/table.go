@@ -0,0 +1,207 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package table implements the summary tables
+// written by the taxrange commands,
+// and the flag used to define the format of the tables.
+//
+// The flag --format defines the format of the table:
+// "tsv" (the default) for a tab-delimited table,
+// "markdown" for a Markdown (pipe) table,
+// or "latex" for a LaTeX tabular environment.
+// In Markdown and LaTeX tables,
+// numeric columns are aligned to the right.
+package table
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+)
+
+// Format is a format of a table.
+type Format string
+
+// Valid table formats.
+const (
+	TSV      Format = "tsv"
+	Markdown Format = "markdown"
+	LaTeX    Format = "latex"
+)
+
+var formatFlag = TSV
+
+// SetFlags adds the table format flag
+// to a command.
+func SetFlags(c *command.Command) {
+	formatFlag = TSV
+	c.Flags().Var((*formatValue)(&formatFlag), "format", "")
+}
+
+// A Table is a table with a header.
+type Table struct {
+	header []string
+	rows   [][]string
+}
+
+// New returns a new table
+// with the indicated header.
+func New(header ...string) *Table {
+	return &Table{header: header}
+}
+
+// Add adds a row to the table.
+// Missing cells are written as empty cells.
+func (t *Table) Add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// Write writes the table
+// using the format defined by the --format flag.
+func (t *Table) Write(w io.Writer) error {
+	return t.WriteFormat(w, formatFlag)
+}
+
+// WriteFormat writes the table
+// using the indicated format.
+func (t *Table) WriteFormat(w io.Writer, f Format) error {
+	bw := bufio.NewWriter(w)
+	switch f {
+	case Markdown:
+		t.markdown(bw)
+	case LaTeX:
+		t.latex(bw)
+	default:
+		t.tsv(bw)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing table: %v", err)
+	}
+	return nil
+}
+
+func (t *Table) tsv(w *bufio.Writer) {
+	fmt.Fprintf(w, "%s\n", strings.Join(t.header, "\t"))
+	for _, r := range t.rows {
+		fmt.Fprintf(w, "%s\n", strings.Join(t.row(r), "\t"))
+	}
+}
+
+func (t *Table) markdown(w *bufio.Writer) {
+	esc := strings.NewReplacer("|", `\|`)
+	line := func(cells []string) {
+		fmt.Fprintf(w, "|")
+		for _, c := range cells {
+			fmt.Fprintf(w, " %s |", esc.Replace(c))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	line(t.header)
+	fmt.Fprintf(w, "|")
+	for i := range t.header {
+		if t.numeric(i) {
+			fmt.Fprintf(w, " ---: |")
+			continue
+		}
+		fmt.Fprintf(w, " --- |")
+	}
+	fmt.Fprintf(w, "\n")
+	for _, r := range t.rows {
+		line(t.row(r))
+	}
+}
+
+// LaTeXEscape replaces the LaTeX special characters.
+var latexEscape = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+	"{", `\{`,
+	"}", `\}`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+func (t *Table) latex(w *bufio.Writer) {
+	line := func(cells []string) {
+		for i, c := range cells {
+			if i > 0 {
+				fmt.Fprintf(w, " & ")
+			}
+			fmt.Fprintf(w, "%s", latexEscape.Replace(c))
+		}
+		fmt.Fprintf(w, " \\\\\n")
+	}
+
+	var align strings.Builder
+	for i := range t.header {
+		if t.numeric(i) {
+			align.WriteByte('r')
+			continue
+		}
+		align.WriteByte('l')
+	}
+	fmt.Fprintf(w, "\\begin{tabular}{%s}\n", align.String())
+	fmt.Fprintf(w, "\\hline\n")
+	line(t.header)
+	fmt.Fprintf(w, "\\hline\n")
+	for _, r := range t.rows {
+		line(t.row(r))
+	}
+	fmt.Fprintf(w, "\\hline\n")
+	fmt.Fprintf(w, "\\end{tabular}\n")
+}
+
+// Row returns the cells of a row
+// with the same number of cells as the header.
+func (t *Table) row(r []string) []string {
+	if len(r) >= len(t.header) {
+		return r[:len(t.header)]
+	}
+	cells := make([]string, len(t.header))
+	copy(cells, r)
+	return cells
+}
+
+// Numeric returns true
+// if all non-empty cells of a column
+// are numbers.
+func (t *Table) numeric(col int) bool {
+	var n int
+	for _, r := range t.rows {
+		if col >= len(r) || r[col] == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(r[col], 64); err != nil {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
+
+// A FormatValue is a flag value
+// for the format of a table.
+type formatValue Format
+
+func (f *formatValue) String() string {
+	return string(*f)
+}
+
+func (f *formatValue) Set(s string) error {
+	switch v := Format(strings.ToLower(s)); v {
+	case TSV, Markdown, LaTeX:
+		*f = formatValue(v)
+		return nil
+	}
+	return fmt.Errorf("invalid table format %q", s)
+}
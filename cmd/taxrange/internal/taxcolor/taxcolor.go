@@ -0,0 +1,133 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package taxcolor implements a file
+// that assigns a fixed color to each taxon,
+// so the same taxon is always drawn with the same color
+// by all the taxrange commands.
+//
+// The file is a tab-delimited file
+// with the following columns:
+//
+//   - taxon, the name of the taxon
+//   - color, the RGB values of the color,
+//     separated by commas.
+//
+// Here is an example file:
+//
+//	taxon	color
+//	Brontostoma discus	215, 48, 39
+//	Rhododendron ericoides	69, 117, 180
+package taxcolor
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+)
+
+// Colors is a map of taxon names to colors.
+type Colors map[string]color.RGBA
+
+// Color returns the color assigned to a taxon.
+func (tc Colors) Color(name string) (color.RGBA, bool) {
+	c, ok := tc[key(name)]
+	return c, ok
+}
+
+// ReadFile reads a taxon color file.
+func ReadFile(name string) (Colors, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tc, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+	return tc, nil
+}
+
+// Read reads taxon colors from a TSV file.
+func Read(r io.Reader) (Colors, error) {
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("while reading header: %v", err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range []string{"taxon", "color"} {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("expecting field %q", h)
+		}
+	}
+
+	tc := make(Colors)
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on row %d: %v", ln, err)
+		}
+
+		f := "taxon"
+		name := key(row[fields[f]])
+		if name == "" {
+			continue
+		}
+
+		f = "color"
+		c, err := ParseRGB(row[fields[f]])
+		if err != nil {
+			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+		}
+		tc[name] = c
+	}
+	return tc, nil
+}
+
+// ParseRGB parses a color defined
+// by its RGB values separated by commas,
+// for example "215, 48, 39".
+func ParseRGB(s string) (color.RGBA, error) {
+	vals := strings.Split(s, ",")
+	if len(vals) != 3 {
+		return color.RGBA{}, fmt.Errorf("found %d values, want 3", len(vals))
+	}
+
+	var rgb [3]uint8
+	for i, n := range []string{"red", "green", "blue"} {
+		v, err := strconv.Atoi(strings.TrimSpace(vals[i]))
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("[%s value]: %v", n, err)
+		}
+		if v < 0 || v > 255 {
+			return color.RGBA{}, fmt.Errorf("[%s value]: invalid value %d", n, v)
+		}
+		rgb[i] = uint8(v)
+	}
+	return color.RGBA{rgb[0], rgb[1], rgb[2], 255}, nil
+}
+
+func key(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
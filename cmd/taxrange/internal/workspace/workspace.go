@@ -0,0 +1,330 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package workspace implements an index
+// of the range files in a directory tree
+// (a workspace),
+// so the files in which a taxon is defined
+// can be found without reading all the files.
+//
+// The index is a tab-delimited file
+// with the following columns:
+//
+//	taxon	the name of the taxon
+//	file	the path of the range file,
+//		relative to the directory of the index
+//	type	the type of the range
+//	age	the age of the range (in years)
+//	pixels	the number of pixels of the range
+//	hash	a hash of the pixels and densities of the range
+//
+// The hash is used to detect taxa defined
+// with different ranges in several files
+// (see Duplicates).
+//
+// By default the index is stored
+// in the file "taxrange-index.tab"
+// at the root of the workspace.
+package workspace
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/ranges"
+)
+
+// IndexFile is the default name
+// of a workspace index.
+const IndexFile = "taxrange-index.tab"
+
+// An Entry is a taxon defined in a range file.
+type Entry struct {
+	Taxon string
+
+	// File is the path of the range file,
+	// relative to the root of the workspace,
+	// using forward slashes.
+	File string
+
+	Type   ranges.Type
+	Age    int64
+	Pixels int
+
+	// Hash is a hash of the pixels
+	// and densities of the range.
+	Hash string
+}
+
+// Extensions are the file extensions
+// of the files checked when a workspace is scanned.
+var extensions = []string{".tab", ".tsv", ".txt"}
+
+// Scan scans a directory tree
+// and returns the taxa defined
+// in each range file,
+// sorted by taxon name and file.
+//
+// Hidden files and directories
+// (i.e. with a name starting with a dot)
+// and workspace indexes
+// are ignored.
+// Files that are not range files
+// are reported to skip,
+// and ignored.
+func Scan(root string, skip func(name string, err error)) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if d.Name() == IndexFile {
+			return nil
+		}
+		if !slices.Contains(extensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+
+		coll, err := readCollection(path)
+		if err != nil {
+			if skip != nil {
+				skip(path, err)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, tax := range coll.Taxa() {
+			entries = append(entries, Entry{
+				Taxon:  tax,
+				File:   rel,
+				Type:   coll.Type(tax),
+				Age:    coll.Age(tax),
+				Pixels: len(coll.Range(tax)),
+				Hash:   rangeHash(coll.Range(tax)),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if c := strings.Compare(a.Taxon, b.Taxon); c != 0 {
+			return c
+		}
+		return strings.Compare(a.File, b.File)
+	})
+	return entries, nil
+}
+
+// RangeHash returns the first 16 characters
+// of the hexadecimal SHA-256 hash
+// of the pixels and densities of a range.
+func rangeHash(rng map[int]float64) string {
+	pixels := make([]int, 0, len(rng))
+	for px := range rng {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	h := sha256.New()
+	for _, px := range pixels {
+		fmt.Fprintf(h, "%d\t%s\n", px, strconv.FormatFloat(rng[px], 'g', -1, 64))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Duplicates returns the taxa
+// defined with different ranges
+// in several files.
+// Each element of the returned slice
+// contains the entries of a taxon
+// with the same type of range,
+// and at least two different hashes.
+func Duplicates(entries []Entry) [][]Entry {
+	groups := make(map[string][]Entry)
+	var keys []string
+	for _, e := range entries {
+		k := e.Taxon + "\t" + string(e.Type)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], e)
+	}
+
+	var dup [][]Entry
+	for _, k := range keys {
+		g := groups[k]
+		if len(g) < 2 {
+			continue
+		}
+		for _, e := range g[1:] {
+			if e.Hash != g[0].Hash {
+				dup = append(dup, g)
+				break
+			}
+		}
+	}
+	return dup
+}
+
+func readCollection(name string) (*ranges.Collection, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ranges.ReadTSV(f, nil)
+}
+
+var fields = []string{
+	"taxon",
+	"file",
+	"type",
+	"age",
+	"pixels",
+	"hash",
+}
+
+// Write writes the entries of an index
+// into a TSV file.
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# taxrange workspace index\n")
+
+	tab := csv.NewWriter(bw)
+	tab.Comma = '\t'
+	if err := tab.Write(fields); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	for _, e := range entries {
+		row := []string{
+			e.Taxon,
+			e.File,
+			string(e.Type),
+			strconv.FormatInt(e.Age, 10),
+			strconv.Itoa(e.Pixels),
+			e.Hash,
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// Read reads the entries of an index
+// from a TSV file.
+func Read(r io.Reader) ([]Entry, error) {
+	tab := csv.NewReader(r)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("while reading header: %v", err)
+	}
+	cols := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		cols[h] = i
+	}
+	for _, h := range fields {
+		if _, ok := cols[h]; !ok {
+			return nil, fmt.Errorf("expecting field %q", h)
+		}
+	}
+
+	var entries []Entry
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on row %d: %v", ln, err)
+		}
+
+		e := Entry{
+			Taxon: row[cols["taxon"]],
+			File:  row[cols["file"]],
+			Type:  ranges.Type(row[cols["type"]]),
+			Hash:  row[cols["hash"]],
+		}
+		f := "age"
+		e.Age, err = strconv.ParseInt(row[cols[f]], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+		}
+		f = "pixels"
+		e.Pixels, err = strconv.Atoi(row[cols[f]])
+		if err != nil {
+			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Locate returns the path of the workspace index
+// of the current directory,
+// looking for the file "taxrange-index.tab"
+// in the current directory
+// and in its parents.
+// The path is relative to the current directory.
+func Locate() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	dir := wd
+	for {
+		name := filepath.Join(dir, IndexFile)
+		if _, err := os.Stat(name); err == nil {
+			if rel, err := filepath.Rel(wd, name); err == nil {
+				return rel, nil
+			}
+			return name, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("workspace index %q not found: use the command index to build it", IndexFile)
+		}
+		dir = parent
+	}
+}
@@ -8,24 +8,45 @@
 package kde
 
 import (
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/earth"
 	"github.com/js-arias/earth/model"
-	"github.com/js-arias/earth/stat"
 	"github.com/js-arias/earth/stat/dist"
 	"github.com/js-arias/earth/stat/pixprob"
 	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/policy"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/kde"
 )
 
 var Command = &command.Command{
-	Usage: `kde --timepix <time-pixelation> [--prior <prior-file>]
+	Usage: `kde [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--timepix <time-pixelation> [--prior <prior-file>]
 	[--lambda <value>] [--bound <value>]
-	[-o|--output <file>] [<rng-file>...]`,
+	[--axis <degrees> --ratio <value>]
+	[--weight <value>]
+	[--min-points <number> [--fallback <rules>]] [--rules <file>]
+	[--checkpoint <dir>] [--diagnostics <file>]
+	[--verbatim] [--append | --replace]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>...]`,
 	Short: "estimate a geographic range using a KDE",
 	Long: `
 Command kde reads one or more geographic range files, and produce a new range
@@ -34,6 +55,11 @@ map using a Kernel Density Estimation, based on an spherical normal.
 One or more range files can be given as arguments. If no file is given, the
 ranges will be read from the standard input.
 
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
 The flag --timepix is required an defines the time pixelation that will contain
 the raster values for each pixel. Prior probabilities for each pixel type can
 be defined on a file and read with the flag --prior. The pixel prior file is a
@@ -57,16 +83,103 @@ The flag --lambda defines the concentration parameter of the spherical normal
 1/radian^2 units. If no value is defined, it will use the 1/size^2 of a pixel
 in the pixelation used for the range files.
 
+By default the spherical normal is isotropic (i.e., it has the same
+concentration in all directions). For taxa whose ranges follow a coastline or
+a mountain chain, an isotropic kernel can spread the density into unsuitable
+areas. Use the flag --ratio to define an anisotropic kernel, in which the
+concentration across an axis is the concentration along the axis (the value
+of --lambda) multiplied by the ratio. A ratio greater than 1 produces a
+kernel elongated along the axis. The flag --axis defines the orientation of
+the axis, as a bearing in degrees (0 for a north-south axis, 90 for an
+east-west axis). By default the axis is 90 (i.e., the kernel follows the
+latitudes).
+
+By default each pixel with presence records has the same weight in the
+estimation. Use the flag --weight to define weights for each pixel. If the
+value is "records", the weight will be the number of records in the pixel. Any
+other value will be taken as the name of an additional column of the range
+files (ignoring case), that stores the weight of each pixel (for example, to
+down-weight old imprecise records). Pixels without a value in the column will
+have a weight of 1.
+
+A KDE is meaningless for taxa with few pixels (for example, a taxon with a
+single point). Use the flag --min-points to define the minimum number of
+pixels with presence records of a taxon to estimate its density. For taxa
+with fewer pixels, a fallback rule is used. By default the fallback rule is
+"buffer=100", i.e. the range is the pixels at a distance of 100 km or less of
+the pixels with records, with a density of 1. Use the flag --fallback to
+define a different rule: "buffer=<km>" for a buffer with the indicated
+radius, "points" to use the pixels with records, or "skip" to ignore the
+taxon. Different rules can be used for different number of pixels with a
+comma separated list of rules, each one preceded by the number of pixels and
+a colon, for example "1:buffer=200,2:buffer=100". A rule without a number of
+pixels is used for any other number of pixels. If the flag --rules is
+defined, the rule used for each taxon ("kde", or the fallback rule) will be
+written in the indicated file, as a TSV file with the columns "taxon",
+"points" (the number of pixels with records), and "rule".
+
 By default only pixels at .95 of the spherical normal CDF will be used. Use
 the flag --bound to set the bound for the normal CDF.
 
+Estimating the density of many taxa can take a long time. If the flag
+--checkpoint is defined, the density of each taxon will be written in the
+indicated directory as soon as it is estimated (a file for each taxon). If
+the command is interrupted, and then run again with the same checkpoint
+directory, the taxa already estimated will be read from the directory instead
+of being estimated again. The checkpoint directory can only be used with the
+same time pixelation, prior file, lambda, bound, axis, ratio, and weight
+values with which it was
+created.
+
+If the flag --diagnostics is defined, a report of the smoothing applied to
+each estimated taxon will be written in the indicated file. It is a TSV file
+with the following columns:
+
+	- taxon       name of the taxon
+	- age         the age (in million years) of the taxon
+	- points      number of pixels with presence records
+	- lambda      the concentration parameter used (in 1/radian^2)
+	- bandwidth   the standard deviation of the kernel (in km)
+	- pixels      number of pixels in the estimated range
+	- mass        the probability mass captured by the pixels at the
+	              bound of the normal CDF
+
+For taxa read from a checkpoint directory, or built with a fallback rule, the
+mass is unknown and the field will be empty.
+
 By default the output will be printed in the standard output. If the flag
 --output, or -o, is defined, the indicated file will be used as output. If the
 file exists, existing taxons will be replaced, and new taxon will be added to
-the indicated file.
+the indicated file (the same as using the flag --append). Use the flag
+--replace to discard the content of the file. The output file is only replaced
+after all the data was written, so if there is an error, the previous content
+of the file will be preserved.
+
+An output file named "-" is the standard output. With the flag --replace, an
+existing output file is not overwritten, unless the flag --force is defined.
+Other files written by the command (for example, the file defined by --diag)
+are not overwritten either, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      summary.Run(run),
 }
 
 var lambdaFlag float64
@@ -74,10 +187,32 @@ var boundFlag float64
 var modelFile string
 var priorFile string
 var output string
+var appendFlag bool
+var replaceFlag bool
+var verbatimFlag bool
+var checkpoint string
+var diagFile string
+var axisFlag float64
+var ratioFlag float64
+var weightFlag string
 
 func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	policy.SetFlags(c)
+	c.Flags().BoolVar(&appendFlag, "append", false, "")
+	c.Flags().BoolVar(&replaceFlag, "replace", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&checkpoint, "checkpoint", "", "")
+	c.Flags().StringVar(&weightFlag, "weight", "", "")
+	c.Flags().StringVar(&diagFile, "diagnostics", "", "")
 	c.Flags().Float64Var(&lambdaFlag, "lambda", 0, "")
 	c.Flags().Float64Var(&boundFlag, "bound", 0.95, "")
+	c.Flags().Float64Var(&axisFlag, "axis", 90, "")
+	c.Flags().Float64Var(&ratioFlag, "ratio", 1, "")
 	c.Flags().StringVar(&modelFile, "timepix", "", "")
 	c.Flags().StringVar(&priorFile, "prior", "", "")
 	c.Flags().StringVar(&output, "output", "", "")
@@ -88,14 +223,30 @@ func run(c *command.Command, args []string) (err error) {
 	if modelFile == "" {
 		return c.UsageError("undefined time pixelation flag --timepix")
 	}
+	if appendFlag && replaceFlag {
+		return c.UsageError("both --append and --replace flags defined")
+	}
+	if ratioFlag <= 0 {
+		return c.UsageError("flag --ratio must be greater than 0")
+	}
+	log := logger.New(c.Stderr())
+	ctx := context.Background()
+
 	tPix, err := readTimePix(modelFile)
+	if err != nil {
+		return err
+	}
 
 	var prior pixprob.Pixel
 	if priorFile != "" {
 		prior, err = readPixelPrior(priorFile)
+		if err != nil {
+			return err
+		}
 	}
 
 	coll := ranges.New(tPix.Pixelation())
+	weights := make(map[string]map[int]float64)
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
@@ -110,67 +261,251 @@ func run(c *command.Command, args []string) (err error) {
 			if c.Type(nm) != ranges.Points {
 				continue
 			}
+			w, err := pixelWeights(c, nm)
+			if err != nil {
+				return fmt.Errorf("when reading %q: taxon %q: %v", a, nm, err)
+			}
 			age := c.Age(nm)
 			rng := c.Range(nm)
 			for id := range rng {
 				pt := pix.ID(id).Point()
-				coll.Add(nm, age, pt.Latitude(), pt.Longitude())
+				coll.Add(c.VerbatimName(nm), age, pt.Latitude(), pt.Longitude())
+				if w == nil {
+					continue
+				}
+				if weights[nm] == nil {
+					weights[nm] = make(map[int]float64)
+				}
+				px := coll.Pixelation().Pixel(pt.Latitude(), pt.Longitude()).ID()
+				weights[nm][px] += w[id]
 			}
 		}
 	}
 	if len(coll.Taxa()) == 0 {
 		return nil
 	}
-	kdeColl, err := readOutColl(output, coll.Pixelation())
+	prev, err := readOutColl(output, coll.Pixelation())
 	if err != nil {
 		return err
 	}
 
 	if lambdaFlag == 0 {
-		angle := earth.ToRad(coll.Pixelation().Step())
-		lambdaFlag = 1 / (angle * angle)
-		fmt.Fprintf(c.Stderr(), "# Using lambda value of: %.6f\n", lambdaFlag)
+		lambdaFlag = kde.DefaultLambda(coll.Pixelation())
+		log.Info("using default lambda", "lambda", lambdaFlag)
 	}
 	n := dist.NewNormal(lambdaFlag, tPix.Pixelation())
+	an := kde.Aniso{
+		Lambda: lambdaFlag,
+		Ratio:  ratioFlag,
+		Axis:   earth.ToRad(axisFlag),
+	}
+
+	if checkpoint != "" {
+		if err := openCheckpoint(); err != nil {
+			return err
+		}
+	}
+
+	// taxa in the output,
+	// the new estimations replace the previous ones
+	names := prev.TaxaBy(ranges.InputOrder)
+	var recs bool
+	for _, tax := range names {
+		if !coll.HasTaxon(tax) && len(prev.Records(tax)) > 0 {
+			recs = true
+		}
+	}
+	for _, tax := range coll.TaxaBy(ranges.InputOrder) {
+		if !prev.HasTaxon(tax) {
+			names = append(names, tax)
+		}
+	}
+	outformat.Sort(names, func(tax string) int64 {
+		if coll.HasTaxon(tax) {
+			return coll.Age(tax)
+		}
+		return prev.Age(tax)
+	})
+
+	var diag []diagnostic
+
+	// each density is written as soon as it is estimated,
+	// so only the points are kept in memory
+	write := func(w io.Writer) error {
+		tw := ranges.NewTSVWriter(w, coll.Pixelation())
+		tw.KeepVerbatim(verbatimFlag)
+		tw.SetRecords(recs)
+		tw.SetExtraColumns(prev.ExtraColumns())
+		outformat.SetWriter(tw)
+
+		for _, tax := range names {
+			if !coll.HasTaxon(tax) {
+				if err := tw.Append(prev, tax); err != nil {
+					return err
+				}
+				continue
+			}
 
-	for _, tax := range coll.Taxa() {
-		rng := coll.Range(tax)
-		age := coll.Age(tax)
-		kde := stat.KDE(n, rng, tPix, age, prior)
-		taxKDE := make(map[int]float64)
-		for px, p := range kde {
-			if p < 1-boundFlag {
+			if r, ok := policy.Fallback(len(coll.Range(tax))); ok {
+				pts := coll.Range(tax)
+				policy.Record(coll.VerbatimName(tax), len(pts), r.String())
+				fb, keep := r.Apply(coll.Pixelation(), pts)
+				if !keep {
+					log.Info("taxon skipped", "taxon", tax, "pixels", len(pts))
+					continue
+				}
+				fbColl := ranges.New(coll.Pixelation())
+				fbColl.Set(coll.VerbatimName(tax), coll.Age(tax), fb)
+				if err := tw.Append(fbColl, tax); err != nil {
+					return err
+				}
+				diag = append(diag, diagnostic{
+					taxon:  coll.VerbatimName(tax),
+					age:    coll.Age(tax),
+					points: len(pts),
+					pixels: len(fb),
+					mass:   math.NaN(),
+				})
+				log.Debug("fallback rule", "taxon", tax, "pixels", len(pts), "rule", r.String())
 				continue
 			}
-			taxKDE[px] = p
+			policy.Record(coll.VerbatimName(tax), len(coll.Range(tax)), "kde")
+
+			if checkpoint != "" {
+				cp, err := readCheckpoint(tax, coll.Age(tax), coll.Pixelation())
+				if err != nil {
+					log.Warn("invalid checkpoint file", "taxon", tax, "error", err)
+				}
+				if cp != nil {
+					if err := tw.Append(cp, tax); err != nil {
+						return err
+					}
+					diag = append(diag, diagnostic{
+						taxon:  coll.VerbatimName(tax),
+						age:    coll.Age(tax),
+						points: len(coll.Range(tax)),
+						pixels: len(cp.Range(tax)),
+						mass:   math.NaN(),
+					})
+					log.Debug("density read from checkpoint", "taxon", tax)
+					continue
+				}
+			}
+
+			rng := coll.Range(tax)
+			if w, ok := weights[tax]; ok {
+				rng = w
+			}
+			age := coll.Age(tax)
+			var density map[int]float64
+			var err error
+			if ratioFlag != 1 {
+				density, err = kde.Anisotropic(ctx, an, rng, tPix, age, prior)
+			} else {
+				density, err = kde.Normal(ctx, n, rng, tPix, age, prior)
+			}
+			if err != nil {
+				return err
+			}
+			taxKDE, mass := kde.Bound(density, boundFlag)
+			diag = append(diag, diagnostic{
+				taxon:  coll.VerbatimName(tax),
+				age:    age,
+				points: len(rng),
+				pixels: len(taxKDE),
+				mass:   mass,
+			})
+			kdeColl := ranges.New(coll.Pixelation())
+			kdeColl.Set(coll.VerbatimName(tax), age, taxKDE)
+			if checkpoint != "" {
+				if err := files.ReplaceFile(checkpointFile(tax), kdeColl.TSV); err != nil {
+					return err
+				}
+			}
+			if err := tw.Append(kdeColl, tax); err != nil {
+				return err
+			}
+			log.Debug("density estimated", "taxon", tax, "age", float64(age)/millionYears, "pixels", len(taxKDE))
 		}
-		kdeColl.Set(tax, age, taxKDE)
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		summary.Written(tw.Len())
+		return nil
 	}
 
-	w := c.Stdout()
-	if output != "" {
-		f, err := os.Create(output)
+	switch {
+	case files.IsStd(output):
+		err = write(c.Stdout())
+	case replaceFlag:
+		err = files.WriteFile(output, write)
+	default:
+		err = files.ReplaceFile(output, write)
+	}
+	if err != nil {
+		return err
+	}
+
+	if diagFile != "" {
+		err := files.WriteFile(diagFile, func(w io.Writer) error {
+			return writeDiagnostics(w, diag)
+		})
 		if err != nil {
 			return err
 		}
-		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
-			}
-		}()
-		w = f
 	}
-	if err := kdeColl.TSV(w); err != nil {
-		return err
+	return policy.Write()
+}
+
+// A Diagnostic stores the parameters
+// used to estimate the density of a taxon.
+type diagnostic struct {
+	taxon  string
+	age    int64
+	points int
+	pixels int
+	mass   float64
+}
+
+func writeDiagnostics(w io.Writer, diag []diagnostic) error {
+	tab := csv.NewWriter(w)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	if err := tab.Write([]string{"taxon", "age", "points", "lambda", "bandwidth", "pixels", "mass"}); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
 	}
 
+	// standard deviation of the kernel in km
+	bw := earth.Radius / math.Sqrt(lambdaFlag) / 1000
+	for _, d := range diag {
+		mass := ""
+		if !math.IsNaN(d.mass) {
+			mass = strconv.FormatFloat(d.mass, 'f', 6, 64)
+		}
+		row := []string{
+			d.taxon,
+			strconv.FormatFloat(float64(d.age)/millionYears, 'f', 6, 64),
+			strconv.Itoa(d.points),
+			strconv.FormatFloat(lambdaFlag, 'f', 6, 64),
+			strconv.FormatFloat(bw, 'f', 3, 64),
+			strconv.Itoa(d.pixels),
+			mass,
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
 	return nil
 }
 
 func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
 	if name != "-" {
-		f, err := os.Open(name)
+		f, err := files.Open(name)
 		if err != nil {
 			return nil, err
 		}
@@ -180,16 +515,17 @@ func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
 		name = "stdin"
 	}
 
-	coll, err := ranges.ReadTSV(r, nil)
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
 	if err != nil {
 		return nil, fmt.Errorf("when reading %q: %v", name, err)
 	}
+	summary.Read(coll)
 
 	return coll, nil
 }
 
 func readOutColl(name string, pix *earth.Pixelation) (*ranges.Collection, error) {
-	if name == "" {
+	if files.IsStd(name) || replaceFlag {
 		return ranges.New(pix), nil
 	}
 
@@ -210,8 +546,122 @@ func readOutColl(name string, pix *earth.Pixelation) (*ranges.Collection, error)
 	return coll, nil
 }
 
-func readTimePix(name string) (*model.TimePix, error) {
+// PixelWeights returns the weight of each pixel
+// of a taxon,
+// as defined by the --weight flag.
+// It returns nil if no weights are defined.
+func pixelWeights(c *ranges.Collection, name string) (map[int]float64, error) {
+	if weightFlag == "" {
+		return nil, nil
+	}
+
+	w := make(map[int]float64, len(c.Range(name)))
+	for px := range c.Range(name) {
+		w[px] = 1
+	}
+
+	if weightFlag == "records" {
+		for px, n := range c.Records(name) {
+			if n > 0 {
+				w[px] = float64(n)
+			}
+		}
+		return w, nil
+	}
+
+	if !slices.ContainsFunc(c.ExtraColumns(), func(col string) bool {
+		return strings.EqualFold(col, weightFlag)
+	}) {
+		return nil, fmt.Errorf("weight column %q not found", weightFlag)
+	}
+	for px, v := range c.Extra(name, weightFlag) {
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pixel %d: field %q: %v", px, weightFlag, err)
+		}
+		if f < 0 {
+			return nil, fmt.Errorf("pixel %d: field %q: invalid weight %.6f", px, weightFlag, f)
+		}
+		w[px] = f
+	}
+	return w, nil
+}
+
+// CheckpointParams is the name of the file
+// with the parameters used to create a checkpoint directory.
+const checkpointParams = "kde-params.txt"
+
+// OpenCheckpoint creates the checkpoint directory,
+// or checks that an existing directory
+// was created with the same parameters.
+func openCheckpoint() error {
+	if err := os.MkdirAll(checkpoint, 0o755); err != nil {
+		return err
+	}
+
+	params := fmt.Sprintf("timepix\t%s\nprior\t%s\nlambda\t%g\nbound\t%g\n", modelFile, priorFile, lambdaFlag, boundFlag)
+	if weightFlag != "" {
+		params += fmt.Sprintf("weight\t%s\n", weightFlag)
+	}
+	if ratioFlag != 1 {
+		params += fmt.Sprintf("axis\t%g\nratio\t%g\n", axisFlag, ratioFlag)
+	}
+	name := filepath.Join(checkpoint, checkpointParams)
+	prev, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return files.WriteFile(name, func(w io.Writer) error {
+			_, err := io.WriteString(w, params)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if string(prev) != params {
+		return fmt.Errorf("checkpoint %q: created with different parameters", checkpoint)
+	}
+	return nil
+}
+
+// CheckpointFile returns the name of the checkpoint file
+// of a taxon.
+func checkpointFile(tax string) string {
+	return filepath.Join(checkpoint, strings.Join(strings.Fields(tax), "_")+".tab")
+}
+
+// ReadCheckpoint reads the density of a taxon
+// from the checkpoint directory.
+// It returns nil if the taxon is not in the directory.
+func readCheckpoint(tax string, age int64, pix *earth.Pixelation) (*ranges.Collection, error) {
+	name := checkpointFile(tax)
 	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coll, err := ranges.ReadTSV(f, pix)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	if !coll.HasTaxon(tax) || coll.Age(tax) != age {
+		return nil, fmt.Errorf("when reading %q: taxon %q at age %d not found", name, tax, age)
+	}
+	return coll, nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func readTimePix(name string) (*model.TimePix, error) {
+	f, err := files.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -225,7 +675,7 @@ func readTimePix(name string) (*model.TimePix, error) {
 }
 
 func readPixelPrior(name string) (pixprob.Pixel, error) {
-	f, err := os.Open(name)
+	f, err := files.Open(name)
 	if err != nil {
 		return nil, err
 	}
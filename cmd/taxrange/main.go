@@ -7,11 +7,54 @@ package main
 
 import (
 	"github.com/js-arias/command"
+	"github.com/js-arias/ranges/cmd/taxrange/anonymize"
+	"github.com/js-arias/ranges/cmd/taxrange/apply"
+	"github.com/js-arias/ranges/cmd/taxrange/at"
+	"github.com/js-arias/ranges/cmd/taxrange/bench"
+	"github.com/js-arias/ranges/cmd/taxrange/blend"
+	"github.com/js-arias/ranges/cmd/taxrange/cache"
+	"github.com/js-arias/ranges/cmd/taxrange/calc"
+	"github.com/js-arias/ranges/cmd/taxrange/calibrate"
+	"github.com/js-arias/ranges/cmd/taxrange/cat"
+	"github.com/js-arias/ranges/cmd/taxrange/check"
+	"github.com/js-arias/ranges/cmd/taxrange/checkages"
+	"github.com/js-arias/ranges/cmd/taxrange/checklandscape"
+	"github.com/js-arias/ranges/cmd/taxrange/checklist"
+	"github.com/js-arias/ranges/cmd/taxrange/checkpixelation"
+	"github.com/js-arias/ranges/cmd/taxrange/checktree"
+	"github.com/js-arias/ranges/cmd/taxrange/clean"
+	"github.com/js-arias/ranges/cmd/taxrange/cumulative"
+	"github.com/js-arias/ranges/cmd/taxrange/duplicates"
+	"github.com/js-arias/ranges/cmd/taxrange/endemism"
+	"github.com/js-arias/ranges/cmd/taxrange/erase"
+	"github.com/js-arias/ranges/cmd/taxrange/exppoints"
+	"github.com/js-arias/ranges/cmd/taxrange/expseed"
+	"github.com/js-arias/ranges/cmd/taxrange/extrapolate"
+	"github.com/js-arias/ranges/cmd/taxrange/find"
+	"github.com/js-arias/ranges/cmd/taxrange/hull"
 	"github.com/js-arias/ranges/cmd/taxrange/imppoints"
+	"github.com/js-arias/ranges/cmd/taxrange/index"
 	"github.com/js-arias/ranges/cmd/taxrange/kde"
 	"github.com/js-arias/ranges/cmd/taxrange/mapcmd"
+	"github.com/js-arias/ranges/cmd/taxrange/morph"
+	"github.com/js-arias/ranges/cmd/taxrange/names"
+	"github.com/js-arias/ranges/cmd/taxrange/nearest"
+	"github.com/js-arias/ranges/cmd/taxrange/null"
+	"github.com/js-arias/ranges/cmd/taxrange/plot"
+	"github.com/js-arias/ranges/cmd/taxrange/prior"
+	"github.com/js-arias/ranges/cmd/taxrange/regions"
+	"github.com/js-arias/ranges/cmd/taxrange/report"
+	"github.com/js-arias/ranges/cmd/taxrange/resample"
+	"github.com/js-arias/ranges/cmd/taxrange/richness"
 	"github.com/js-arias/ranges/cmd/taxrange/rotate"
+	"github.com/js-arias/ranges/cmd/taxrange/setage"
+	"github.com/js-arias/ranges/cmd/taxrange/shell"
+	"github.com/js-arias/ranges/cmd/taxrange/shift"
+	"github.com/js-arias/ranges/cmd/taxrange/split"
+	"github.com/js-arias/ranges/cmd/taxrange/strat"
 	"github.com/js-arias/ranges/cmd/taxrange/taxa"
+	"github.com/js-arias/ranges/cmd/taxrange/threshold"
+	"github.com/js-arias/ranges/cmd/taxrange/topics"
 )
 
 var app = &command.Command{
@@ -20,11 +63,58 @@ var app = &command.Command{
 }
 
 func init() {
+	app.Add(anonymize.Command)
+	app.Add(apply.Command)
+	app.Add(at.Command)
+	app.Add(bench.Command)
+	app.Add(blend.Command)
+	app.Add(cache.Command)
+	app.Add(calc.Command)
+	app.Add(calibrate.Command)
+	app.Add(cat.Command)
+	app.Add(check.Command)
+	app.Add(checkages.Command)
+	app.Add(checklandscape.Command)
+	app.Add(checklist.Command)
+	app.Add(checkpixelation.Command)
+	app.Add(checktree.Command)
+	app.Add(clean.Command)
+	app.Add(cumulative.Command)
+	app.Add(duplicates.Command)
+	app.Add(endemism.Command)
+	app.Add(erase.Command)
+	app.Add(exppoints.Command)
+	app.Add(expseed.Command)
+	app.Add(extrapolate.Command)
+	app.Add(find.Command)
+	app.Add(hull.Command)
 	app.Add(imppoints.Command)
+	app.Add(index.Command)
 	app.Add(kde.Command)
 	app.Add(mapcmd.Command)
+	app.Add(morph.Command)
+	app.Add(names.Command)
+	app.Add(nearest.Command)
+	app.Add(null.Command)
+	app.Add(plot.Command)
+	app.Add(prior.Command)
+	app.Add(regions.Command)
+	app.Add(report.Command)
+	app.Add(resample.Command)
+	app.Add(richness.Command)
 	app.Add(rotate.Command)
+	app.Add(setage.Command)
+	app.Add(shell.Command)
+	app.Add(shift.Command)
+	app.Add(split.Command)
+	app.Add(strat.Command)
 	app.Add(taxa.Command)
+	app.Add(threshold.Command)
+
+	// help topics
+	app.Add(topics.Introduced)
+	app.Add(topics.JSONSummary)
+	app.Add(topics.URLs)
 }
 
 func main() {
@@ -0,0 +1,283 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Update rewrites the golden files
+// with the output of the commands,
+// use it with:
+//
+//	go test -run TestCommands -update
+var update = flag.Bool("update", false, "update golden files")
+
+// A CmdTest is an end-to-end test of a command.
+type cmdTest struct {
+	name string
+
+	// args of the command,
+	// "{out}" is replaced by a temporary directory,
+	// and "{url}" by the URL of a test server
+	// (the testdata directory is at "{url}/testdata")
+	args []string
+
+	// environment variables
+	env map[string]string
+
+	// standard input
+	stdin string
+
+	// output files,
+	// relative to the temporary directory,
+	// compared with the golden files
+	files []string
+}
+
+var cmdTests = []cmdTest{
+	{name: "anonymize", args: []string{"anonymize", "--sensitive", "testdata/sensitive.tab", "--reproducible", "testdata/points.tab"}},
+	{name: "anonymize-jitter", args: []string{"anonymize", "--sensitive", "testdata/sensitive.tab", "--mode", "jitter", "--radius", "500", "--seed", "7", "--reproducible", "testdata/points.tab"}},
+	{name: "apply", args: []string{"apply", "--reproducible", "testdata/patch.tab", "testdata/points.tab"}},
+	{name: "apply-check", args: []string{"apply", "--check", "testdata/curation.tab", "testdata/points.tab"}},
+	{name: "apply-edit", args: []string{"apply", "--reproducible", "testdata/curation.tab", "testdata/points.tab"}},
+	{name: "apply-reverse", args: []string{"apply", "--reverse", "--reproducible", "testdata/patch.tab", "testdata/golden/apply/stdout"}},
+	{name: "at", args: []string{"at", "--pixel", "456", "testdata/points.tab"}},
+	{name: "blend", args: []string{"blend", "--expert", "testdata/range.tab", "--bandwidth", "500", "--reproducible", "testdata/points.tab"}},
+	{name: "blend-clip", args: []string{"blend", "--mode", "clip", "--expert", "testdata/points.tab", "--reproducible", "testdata/range.tab"}},
+	{name: "cache", args: []string{"cache", "{url}/testdata/range.tab"}},
+	{name: "calc", args: []string{"calc", "--reproducible", "norm(a * 2)", "a=testdata/range.tab"}},
+	{name: "calibrate", args: []string{"calibrate", "--test", "testdata/presence.tab", "--bins", "4", "--reliability", "{out}/reliability.tab", "--reproducible", "testdata/range.tab"}, files: []string{"reliability.tab"}},
+	{name: "cat", args: []string{"cat", "--reproducible", "testdata/points.tab", "testdata/regions.tab"}},
+	{name: "check", args: []string{"check", "testdata/points.tab", "testdata/range.tab"}},
+	{name: "check-ages", args: []string{"check-ages", "--timepix", "testdata/timepix.tab", "testdata/points.tab"}},
+	{name: "check-ages-snap", args: []string{"check-ages", "--timepix", "testdata/timepix.tab", "--snap", "--reproducible", "-o", "{out}/snap.tab", "testdata/snap.tab"}, files: []string{"snap.tab"}},
+	{name: "check-landscape", args: []string{"check-landscape", "--timepix", "testdata/timepix.tab", "--prior", "testdata/prior.tab", "testdata/points.tab"}},
+	{name: "check-pixelation", args: []string{"check-pixelation", "--model", "testdata/model.tab", "--timepix", "testdata/timepix.tab", "testdata/points.tab"}},
+	{name: "check-pixelation-past", args: []string{"check-pixelation", "--model", "testdata/model-past.tab", "testdata/points.tab"}},
+	{name: "check-tree", args: []string{"check-tree", "--tree", "testdata/tree.nwk", "--prune", "--reproducible", "-o", "{out}/pruned.tab", "testdata/points.tab"}, files: []string{"pruned.tab"}},
+	{name: "checklist", args: []string{"checklist", "--units", "testdata/units.json", "testdata/points.tab"}},
+	{name: "clean", args: []string{"clean", "--reproducible", "testdata/points.tab"}},
+	{name: "cumulative", args: []string{"cumulative", "--appearance", "{out}/appearance.tab", "--pixels", "{out}/pixels.tab", "--reproducible", "testdata/stages/stage-20.tab", "testdata/stages/stage-5.tab"}, files: []string{"appearance.tab", "pixels.tab"}},
+	{name: "cumulative-appearance-stdout", args: []string{"cumulative", "--appearance", "-", "--reproducible", "-o", "{out}/cumulative.tab", "testdata/stages/stage-20.tab", "testdata/stages/stage-5.tab"}, files: []string{"cumulative.tab"}},
+	{name: "duplicates", args: []string{"duplicates", "--index", "testdata/workspace/taxrange-index.tab"}},
+	{name: "duplicates-ask", args: []string{"duplicates", "--keep", "ask", "--reproducible", "--index", "testdata/workspace/taxrange-index.tab"}, stdin: "2\n"},
+	{name: "duplicates-merge", args: []string{"duplicates", "--keep", "merge", "--reproducible", "--index", "testdata/workspace/taxrange-index.tab"}},
+	{name: "endemism", args: []string{"endemism", "--tree", "testdata/tree.nwk", "--map", "{out}/pe.png", "--index", "pe", "-c", "360", "testdata/points.tab"}, files: []string{"pe.png"}},
+	{name: "erase", args: []string{"erase", "--polygon", "testdata/polygon.tab", "--reproducible", "testdata/points.tab"}},
+	{name: "erase-introduced", args: []string{"erase", "--mask", "testdata/snap.tab", "--introduced", "only", "--taxon", "aus bus", "--reproducible", "testdata/snap.tab"}},
+	{name: "erase-stdin-mask", args: []string{"erase", "--mask", "-", "--reproducible", "testdata/range.tab"}, stdin: "taxon\ttype\tage\tequator\tpixel\tdensity\nAus bus\tpoints\t0\t60\t392\t1\n"},
+	{name: "erase-patch", args: []string{"erase", "--polygon", "testdata/polygon.tab", "--patch", "{out}/patch.tab", "--reproducible", "-o", "{out}/erased.tab", "testdata/points.tab"}, files: []string{"patch.tab"}},
+	{name: "exp.points", args: []string{"exp.points", "testdata/points.tab"}},
+	{name: "exp.points-sensitive", args: []string{"exp.points", "--sensitive", "testdata/sensitive.tab", "--generalize", "1000", "testdata/points.tab"}},
+	{name: "exp.seed", args: []string{"exp.seed", "--timepix", "testdata/timepix.tab", "testdata/range.tab"}},
+	{name: "extrapolate", args: []string{"extrapolate", "--model", "testdata/model.tab", "--timepix", "testdata/timepix.tab", "--dispersal", "500", "--max-age", "10", "--reproducible", "-o", "{out}/ext", "testdata/points.tab"}, files: []string{"ext-10.000.tab"}},
+	{name: "find", args: []string{"find", "--index", "testdata/workspace/taxrange-index.tab", "aus bus", "fus gus"}},
+	{name: "hull", args: []string{"hull", "--reproducible", "testdata/points.tab"}},
+	{name: "hull-policy", args: []string{"hull", "--min-points", "3", "--fallback", "1:skip,buffer=1000", "--rules", "{out}/rules.tab", "--reproducible", "testdata/points.tab"}, files: []string{"rules.tab"}},
+	{name: "imp.points", args: []string{"imp.points", "-e", "60", "--reproducible", "testdata/records.txt"}},
+	{name: "imp.points-checklist", args: []string{"imp.points", "-e", "60", "--checklist", "testdata/checklist.tab", "--names-report", "{out}/names.tab", "--reproducible", "testdata/records.txt"}, files: []string{"names.tab"}},
+	{name: "index", args: []string{"index", "--reproducible", "-o", "{out}/points.idx", "testdata/points.tab"}, files: []string{"points.idx"}},
+	{name: "index-dir", args: []string{"index", "-o", "-", "testdata/workspace"}},
+	{name: "json-summary", args: []string{"split", "--reproducible", "--json-summary", "{out}/summary.json", "-o", "{out}/split", "testdata/points.tab"}, files: []string{"summary.json"}},
+	{name: "kde", args: []string{"kde", "--timepix", "testdata/timepix.tab", "--reproducible", "testdata/points.tab"}},
+	{name: "kde-policy", args: []string{"kde", "--timepix", "testdata/timepix.tab", "--min-points", "3", "--fallback", "1:points,buffer=500", "--rules", "{out}/rules.tab", "--reproducible", "testdata/points.tab"}, files: []string{"rules.tab"}},
+	{name: "map", args: []string{"map", "-c", "360", "--timepix", "testdata/timepix.tab", "--gray", "-o", "{out}/map", "testdata/range.tab"}, files: []string{"map-Aus_bus-0.00-range.png"}},
+	{name: "map-sensitive", args: []string{"map", "-c", "360", "--sensitive", "testdata/sensitive.tab", "--generalize", "1000", "-o", "{out}/map", "testdata/range.tab"}, files: []string{"map-Aus_bus-0.00-range.png"}},
+	{name: "morph", args: []string{"morph", "--op", "dilate", "--reproducible", "testdata/points.tab"}},
+	{name: "names", args: []string{"names", "--genus", "--reproducible", "testdata/points.tab"}},
+	{name: "nearest", args: []string{"nearest", "--lat", "10", "--lon", "10", "testdata/points.tab"}},
+	{name: "null", args: []string{"null", "--timepix", "testdata/timepix.tab", "--replicates", "2", "--seed", "7", "--reproducible", "-o", "{out}/null", "testdata/points.tab"}, files: []string{"null-001.tab", "null-002.tab"}},
+	{name: "plot", args: []string{"plot", "--format", "svg", "-o", "{out}/plot", "testdata/points.tab"}, files: []string{"plot-range-size.svg", "plot-records-pixel.svg", "plot-records-taxon.svg"}},
+	{name: "prior", args: []string{"prior", "testdata/prior.tab"}},
+	{name: "regions", args: []string{"regions", "--regions", "testdata/regions.tab", "--format", "markdown", "testdata/points.tab"}},
+	{name: "report", args: []string{"report", "--timepix", "testdata/timepix.tab", "-c", "120", "testdata/points.tab"}},
+	{name: "richness", args: []string{"richness", "testdata/points.tab"}},
+	{name: "resample", args: []string{"resample", "--model", "testdata/model.tab", "--ages", "testdata/ages-interval.txt", "--replicates", "3", "--reproducible", "-o", "{out}/rep", "testdata/points.tab"}, files: []string{"rep-0.tab", "rep-2.tab"}},
+	{name: "resample-occupancy", args: []string{"resample", "--model", "testdata/model.tab", "--ages", "testdata/ages-interval.txt", "--replicates", "5", "--occupancy", "--reproducible", "-o", "{out}/occ", "testdata/points.tab"}, files: []string{"occ-0.000.tab", "occ-10.000.tab"}},
+	{name: "rotate", args: []string{"rotate", "--model", "testdata/model.tab", "--ages", "testdata/ages.txt", "--reproducible", "testdata/points.tab"}},
+	{name: "rotate-interval", args: []string{"rotate", "--model", "testdata/model.tab", "--ages", "testdata/ages-interval.txt", "--interval", "endpoints", "--reproducible", "testdata/points.tab"}},
+	{name: "set-age", args: []string{"set-age", "--ages", "testdata/ages.txt", "--reproducible", "testdata/points.tab"}},
+	{name: "shell", args: []string{"shell", "--no-prompt", "testdata/points.tab"}, stdin: "taxa\n"},
+	{name: "shift", args: []string{"shift", "a=testdata/points.tab", "b=testdata/range.tab"}},
+	{name: "split", args: []string{"split", "--reproducible", "-o", "{out}/split", "testdata/points.tab"}, files: []string{"split-Aus_bus.tab", "split-Fus_gus.tab"}},
+	{name: "strat", args: []string{"strat", "-o", "{out}/chart.svg", "testdata/stages/stage-20.tab", "testdata/stages/stage-5.tab", "testdata/points.tab"}, files: []string{"chart.svg"}},
+	{name: "taxa", args: []string{"taxa", "--count", "testdata/points.tab"}},
+	{name: "threshold", args: []string{"threshold", "--rule", "mtp", "--presences", "testdata/points.tab", "--binary", "--reproducible", "testdata/range.tab"}},
+	{name: "threshold-maxsss", args: []string{"threshold", "--rule", "maxsss", "--test", "testdata/presence.tab", "--reproducible", "testdata/range.tab"}},
+	{name: "url", args: []string{"cat", "--reproducible", "{url}/testdata/points.tab"}},
+	{name: "url-s3", args: []string{"cat", "--reproducible", "s3://testdata/points.tab"}, env: map[string]string{"AWS_ENDPOINT_URL": "{url}", "AWS_ACCESS_KEY_ID": "test", "AWS_SECRET_ACCESS_KEY": "test"}},
+}
+
+func TestCommands(t *testing.T) {
+	srv := httptest.NewServer(http.StripPrefix("/testdata", http.FileServer(http.Dir("testdata"))))
+	defer srv.Close()
+
+	// do not use the user cache
+	t.Setenv("TAXRANGE_CACHE", t.TempDir())
+
+	for _, test := range cmdTests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			args := make([]string, len(test.args))
+			for i, a := range test.args {
+				a = strings.ReplaceAll(a, "{out}", dir)
+				args[i] = strings.ReplaceAll(a, "{url}", srv.URL)
+			}
+			for k, v := range test.env {
+				t.Setenv(k, strings.ReplaceAll(v, "{url}", srv.URL))
+			}
+
+			var stdout, stderr bytes.Buffer
+			app.SetStdin(strings.NewReader(test.stdin))
+			app.SetStdout(&stdout)
+			app.SetStderr(&stderr)
+			if err := app.Execute(args); err != nil {
+				t.Fatalf("%s: %v\n%s", test.name, err, stderr.String())
+			}
+
+			golden := filepath.Join("testdata", "golden", test.name)
+			got := bytes.ReplaceAll(stdout.Bytes(), []byte(srv.URL), []byte("{url}"))
+			compareText(t, filepath.Join(golden, "stdout"), got)
+			for _, f := range test.files {
+				got, err := os.ReadFile(filepath.Join(dir, f))
+				if err != nil {
+					t.Fatalf("%s: %v", test.name, err)
+				}
+				if filepath.Ext(f) == ".png" {
+					compareImage(t, filepath.Join(golden, f), got)
+					continue
+				}
+				got = bytes.ReplaceAll(got, []byte(dir), []byte("{out}"))
+				compareText(t, filepath.Join(golden, f), got)
+			}
+		})
+	}
+}
+
+// CompareText compares a text output
+// with a golden file,
+// ignoring the comments with the time
+// in which a file was written.
+func compareText(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	got = stripTime(got)
+	if *update {
+		writeGolden(t, name, got)
+		return
+	}
+	want, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("golden file: %v", err)
+	}
+	if !bytes.Equal(got, stripTime(want)) {
+		t.Errorf("%s: output differs from golden file:\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// StripTime removes the comment lines
+// with the time in which a file was written.
+func stripTime(data []byte) []byte {
+	var b bytes.Buffer
+	for _, ln := range bytes.SplitAfter(data, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimSpace(ln), []byte("# data save on")) {
+			continue
+		}
+		b.Write(ln)
+	}
+	return b.Bytes()
+}
+
+// MaxHashDist is the maximum number of different bits
+// between the perceptual hashes of two images
+// to be considered as the same image.
+const maxHashDist = 4
+
+// CompareImage compares a PNG image
+// with a golden file
+// using a perceptual hash,
+// so small differences in rendering
+// are accepted.
+func compareImage(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	if *update {
+		writeGolden(t, name, got)
+		return
+	}
+	want, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("golden file: %v", err)
+	}
+
+	gi, err := png.Decode(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("%s: invalid image: %v", name, err)
+	}
+	wi, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("%s: invalid golden image: %v", name, err)
+	}
+	if gi.Bounds() != wi.Bounds() {
+		t.Fatalf("%s: got image size %v, want %v", name, gi.Bounds(), wi.Bounds())
+	}
+	if d := bits.OnesCount64(dHash(gi) ^ dHash(wi)); d > maxHashDist {
+		t.Errorf("%s: image differs from golden file: hash distance %d", name, d)
+	}
+}
+
+// DHash returns the difference hash of an image:
+// the image is reduced to 9x8 gray cells,
+// and each bit of the hash indicates
+// if a cell is brighter than the next cell in the row.
+func dHash(img image.Image) uint64 {
+	const cols, rows = 9, 8
+	b := img.Bounds()
+
+	var cells [rows][cols]float64
+	var count [rows][cols]int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		r := (y - b.Min.Y) * rows / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := (x - b.Min.X) * cols / b.Dx()
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			cells[r][c] += 0.299*float64(cr) + 0.587*float64(cg) + 0.114*float64(cb)
+			count[r][c]++
+		}
+	}
+
+	var h uint64
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols-1; c++ {
+			h <<= 1
+			if cells[r][c]/float64(count[r][c]) > cells[r][c+1]/float64(count[r][c+1]) {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+func writeGolden(t testing.TB, name string, data []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatalf("golden file: %v", err)
+	}
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatalf("golden file: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package mapcmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Background is a set of background images.
+// It can be either a single image,
+// or a set of images
+// one for each stage.
+type background struct {
+	img image.Image
+
+	// images by stage
+	mu    sync.Mutex
+	ages  []int64
+	files map[int64]string
+	cache map[int64]image.Image
+}
+
+// ReadBackground reads a background from a file
+// or from a directory with an image for each stage.
+func readBackground(name string) (*background, error) {
+	st, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		img, err := readBgImage(name)
+		if err != nil {
+			return nil, err
+		}
+		return &background{img: img}, nil
+	}
+
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	bg := &background{
+		files: make(map[int64]string),
+		cache: make(map[int64]image.Image),
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+			continue
+		}
+		age, ok := stageAge(e.Name())
+		if !ok {
+			continue
+		}
+		if prev, dup := bg.files[age]; dup {
+			return nil, fmt.Errorf("on directory %q: files %q and %q with the same age", name, prev, e.Name())
+		}
+		bg.files[age] = filepath.Join(name, e.Name())
+		bg.ages = append(bg.ages, age)
+	}
+	if len(bg.ages) == 0 {
+		return nil, fmt.Errorf("on directory %q: no background images", name)
+	}
+	slices.Sort(bg.ages)
+	return bg, nil
+}
+
+var ageRegexp = regexp.MustCompile(`[0-9]+(\.[0-9]+)?`)
+
+// StageAge returns the age
+// (in years)
+// from the name of a file,
+// as the first number in the file name
+// (in million years).
+func stageAge(name string) (int64, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	m := ageRegexp.FindString(name)
+	if m == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(v * millionYears), true
+}
+
+// At returns the background image
+// closest to the given age.
+func (bg *background) at(age int64) (image.Image, error) {
+	if bg.img != nil {
+		return bg.img, nil
+	}
+
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+
+	closest := bg.ages[0]
+	for _, a := range bg.ages[1:] {
+		if abs(a-age) < abs(closest-age) {
+			closest = a
+		}
+	}
+	if img, ok := bg.cache[closest]; ok {
+		return img, nil
+	}
+	img, err := readBgImage(bg.files[closest])
+	if err != nil {
+		return nil, err
+	}
+	bg.cache[closest] = img
+	return img, nil
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -7,30 +7,50 @@
 package mapcmd
 
 import (
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	_ "image/jpeg"
-	"image/png"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/js-arias/blind"
 	"github.com/js-arias/command"
 	"github.com/js-arias/earth"
 	"github.com/js-arias/earth/model"
 	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/sensitive"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/taxcolor"
+	"github.com/js-arias/ranges/render"
 )
 
 var Command = &command.Command{
-	Usage: `map [-c|--columns] [-t|--taxon <name>]
-	[--bg <image>]
+	Usage: `map [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[-c|--columns] [-t|--taxon <name>] [--window <bounds> | --fit]
+	[--bg <image-or-directory>]
 	[--timepix <time-pixelation>] [--gray] [--key <key-file>]
-	-o|--output <out-img-file> [<rng-file>...]`,
+	[--supersample <value>] [--smooth]
+	[--taxon-colors <file>] [--diff <rng-file>]
+	[--original <rng-file>]
+	[--panels] [--panel-cols <value>]
+	[--sensitive <file> --generalize <km>]
+	[--cpu <number>]
+	[--force] [-o|--output <out-img-file>] [--out-template <template>]
+	[--introduced <mode>]
+	[<rng-file>...]`,
 	Short: "draw a map of a taxon geographic range",
 	Long: `
 Package map draws the geographic range of the indicated taxon using a plate
@@ -39,58 +59,238 @@ carrée (equirectangular) projection.
 One or more range files can be given as arguments. If no file is given, the
 ranges will be read from the standard input.
 
-Flag --output, or -o, is required and sets the name of the output image. If
-multiple taxa are used, the taxon name, taxon age and type of range will be
-append to the name of the image. By default the background image will be empty,
-if the flag --bg is given, the indicated image will be used as the background,
-or if the flag --timepix is defined, the indicated time pixelation will be used
-as background. This alternative is useful if the taxa have different ages. Keys
-for the time pixelation values can be defined with the flag --key, and flag
---gray uses gray colors (so ranges will be easier to see). By default the
-output image will be 3600 pixels wide, use the flag --columns, or -c, to define
-a different number of image columns.
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+Flag --output, or -o, sets the name of the output image. The taxon name, taxon
+age and type of range will be append to the name of the image. Alternatively,
+the flag --out-template can be used to define the name of the output images,
+using the following placeholders:
+
+	{taxon}	the name of the taxon (spaces replaced by underscores)
+	{age}	the age of the taxon (in million years)
+	{type}	the type of the range
+
+For example, the template "{taxon}/{age}/{type}.png" will create a directory
+for each taxon, with a directory for each age. Directories are created as
+needed. Either --output or --out-template is required.
+
+If the output name is "-", a single map will be written into the standard
+output (use the flag --taxon to select the taxon). Existing images are not
+overwritten, unless the flag --force is defined.
+
+By default the background image will be empty, if the flag --bg is given, the
+indicated image will be used as the background, or if the flag --timepix is
+defined, the indicated time pixelation will be used as background. This
+alternative is useful if the taxa have different ages. Keys for the time
+pixelation values can be defined with the flag --key, and flag --gray uses gray
+colors (so ranges will be easier to see). If no key is given, the time
+pixelation values will be drawn using a ramp of gray colors, from light gray
+(the smallest value) to dark gray (the largest value); pixels with a value of 0
+will be left empty. By default the output image will be 3600 pixels wide, use
+the flag --columns, or -c, to define a different number of image columns.
+
+By default the map covers the whole globe. Use the flag --window to draw only
+a region, defined by its bounds, as "minLat,maxLat,minLon,maxLon" (in
+degrees). For example "--window -60,15,-90,-30" will draw South America. The
+image will use the number of columns defined by --columns, and the number of
+rows will be proportional to the size of the region. If minLon is greater than
+maxLon, the region will cross the anti-meridian (for example, "--window
+-60,0,150,-150" will draw the southwestern Pacific), and if minLon is 180 and
+maxLon is -180, the map will cover all longitudes, centered at the
+anti-meridian. If the flag --fit is defined, the region of each map will be
+the extent of the range of the taxon (with a small padding). Ranges that cross
+the anti-meridian produce a region that crosses the anti-meridian, and ranges
+that include a pole produce a region that covers all longitudes.
+
+If the flag --bg is a directory, it must contain an image for each stage (for
+example, a set of paleogeographic reconstructions), and the background of each
+map will be the image with the age closest to the age of the taxon. The age of
+each image is the first number in the name of the file (in million years), so
+for example "paleomap-100.png" is used for the 100 Ma stage. Only PNG and JPEG
+images are used.
+
+By default each image pixel is colored using a single point, which produces
+hard, blocky edges for the pixels of the range. Use the flag --supersample to
+define the number of samples per side of each image pixel (for example,
+"--supersample 3" will use 9 samples for each image pixel), so the edges will
+be anti-aliased. If the flag --smooth is defined, the density at each point
+will be interpolated from the densities of the pixel and its neighbors, so the
+range will be drawn with soft edges. The flag --smooth is ignored when drawing
+difference maps.
+
+By default the range is drawn using a color gradient for the density of each
+pixel. Use the flag --taxon-colors to define a file with a fixed color for each
+taxon, so the same taxon is always drawn with the same color in all figures.
+The file is a tab-delimited file with the following columns:
+
+	taxon	the name of the taxon
+	color	the RGB values of the color, separated by commas
+
+Here is an example of a taxon colors file:
+
+	taxon	color
+	Brontostoma discus	215, 48, 39
+	Rhododendron ericoides	69, 117, 180
+
+Taxa without a defined color will be drawn using the color gradient. When a
+taxon color is used, the density of each pixel is indicated by the opacity of
+the color.
+
+If the flag --diff is defined, the indicated range file will be compared with
+the ranges read from the input, and a difference map will be drawn for each
+taxon. Pixels present only in the input range will be drawn in blue, pixels
+present only in the --diff range will be drawn in vermillion, and pixels
+present in both will be drawn in green. This is useful to visualize the
+changes produced by a cleaning step, or a new download of records.
+
+If the flag --original is defined, the input ranges are taken as ranges
+rotated to a past age (for example, the output of the command rotate), and the
+indicated range file as the original present-day ranges used for the rotation.
+A single image will be produced for each taxon, with two panels. The first
+panel is the original range, drawn on the background at the age of the
+original range. The second panel is a difference map drawn on the background
+at the age of the rotated range (for example, a paleogeographic
+reconstruction). Pixels present only in the rotated range will be drawn in
+blue, pixels present only in the original range will be drawn in vermillion,
+and pixels present in both will be drawn in green. This is useful to verify
+that the rotation moved the range to the expected paleo-locations. The name of
+the image will be the output name, the taxon name, the age of the rotated
+range, and the word "rotation"; if --out-template is used, the {type}
+placeholder will be replaced by "rotation". Taxa not found in the original
+range file will be skipped with a warning.
+
+If the flag --panels is defined, a single image will be produced for each
+taxon, with a panel for the range of the taxon at each age in which the taxon
+is found in the input files (for example, files produced by the rotation of a
+taxon to different ages). Panels are sorted by age, and labeled with the age of
+the range. All panels use the same density scale. By default all panels are
+drawn in a single row, use the flag --panel-cols to define the number of panels
+in each row. The name of the image will be the output name, the taxon name, and
+the word "panels"; if --out-template is used, both {age} and {type}
+placeholders will be replaced by "panels".
+
+If the flag --sensitive is defined, it defines a list of sensitive taxa (for
+example, poached taxa), in the format used by the command anonymize. The range
+of each sensitive taxon will be generalized before it is drawn: each pixel at
+a distance less or equal than the value of the flag --generalize (in km) of
+the range will be added to the range, with the maximum density of the range
+pixels within that distance, so the exact pixels of the range can not be
+recovered. Sensitive taxa with the action "remove" will not be drawn. The flag
+--generalize is required if --sensitive is defined.
+
+By default, maps are drawn in parallel using all available processors. Use the
+flag --cpu to define the number of processors used.
 
 By default maps for all taxa will be produced. Use the flag -taxon to define a
 particular taxon to be mapped.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      summary.Run(run),
 }
 
 var grayFlag bool
 var colsFlag int
+var windowFlag string
+var fitFlag bool
+var supersample int
+var smoothFlag bool
+var cpuFlag int
 var bgFile string
 var keyFlag string
+var taxColorsFile string
+var diffFile string
+var origFile string
+var panelsFlag bool
+var panelCols int
 var modelFile string
 var taxFlag string
 var output string
+var outTemplate string
 
 func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	sensitive.SetFlags(c)
 	c.Flags().BoolVar(&grayFlag, "gray", false, "")
 	c.Flags().IntVar(&colsFlag, "columns", 3600, "")
 	c.Flags().IntVar(&colsFlag, "c", 3600, "")
+	c.Flags().StringVar(&windowFlag, "window", "", "")
+	c.Flags().BoolVar(&fitFlag, "fit", false, "")
+	c.Flags().IntVar(&supersample, "supersample", 1, "")
+	c.Flags().BoolVar(&smoothFlag, "smooth", false, "")
+	c.Flags().IntVar(&cpuFlag, "cpu", runtime.NumCPU(), "")
 	c.Flags().StringVar(&bgFile, "bg", "", "")
 	c.Flags().StringVar(&keyFlag, "key", "", "")
+	c.Flags().StringVar(&taxColorsFile, "taxon-colors", "", "")
+	c.Flags().StringVar(&diffFile, "diff", "", "")
+	c.Flags().StringVar(&origFile, "original", "", "")
+	c.Flags().BoolVar(&panelsFlag, "panels", false, "")
+	c.Flags().IntVar(&panelCols, "panel-cols", 0, "")
 	c.Flags().StringVar(&modelFile, "timepix", "", "")
 	c.Flags().StringVar(&taxFlag, "taxon", "", "")
 	c.Flags().StringVar(&taxFlag, "t", "", "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
+	c.Flags().StringVar(&outTemplate, "out-template", "", "")
 }
 
 func run(c *command.Command, args []string) error {
-	if output == "" {
-		return c.UsageError("undefined output image flag --output")
+	if output == "" && outTemplate == "" {
+		return c.UsageError("undefined output image flag --output or --out-template")
+	}
+	if output != "" && outTemplate != "" {
+		return c.UsageError("both --output and --out-template flags defined")
+	}
+	if panelsFlag && diffFile != "" {
+		return c.UsageError("both --panels and --diff flags defined")
+	}
+	if origFile != "" && (panelsFlag || diffFile != "") {
+		return c.UsageError("flag --original can not be used with --panels or --diff")
+	}
+
+	if err := sensitive.Check(); err != nil {
+		return c.UsageError(err.Error())
 	}
 
 	if bgFile != "" && modelFile != "" {
 		return c.UsageError("both --bg and --timepix flags defined")
 	}
+	if supersample < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --supersample value %d", supersample))
+	}
+	if colsFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --columns value %d", colsFlag))
+	}
+
+	if windowFlag != "" && fitFlag {
+		return c.UsageError("both --window and --fit flags defined")
+	}
+	mapWindow = globalWindow
+	if windowFlag != "" {
+		var err error
+		mapWindow, err = parseWindow(windowFlag)
+		if err != nil {
+			return c.UsageError(err.Error())
+		}
+	}
 
-	var bgImg image.Image
+	var bg *background
 	if bgFile != "" {
 		var err error
-		bgImg, err = readBgImage(bgFile)
+		bg, err = readBackground(bgFile)
 		if err != nil {
 			return err
 		}
@@ -108,33 +308,76 @@ func run(c *command.Command, args []string) error {
 				grayFlag = false
 			}
 		}
-		if keys != nil {
-			var err error
-			tPix, err = readTimePix(modelFile)
-			if err != nil {
-				return err
-			}
+		var err error
+		tPix, err = readTimePix(modelFile)
+		if err != nil {
+			return err
+		}
+		if keys == nil {
+			keys = grayKeys(tPix)
+		}
+	}
+
+	if taxColorsFile != "" {
+		var err error
+		taxColors, err = taxcolor.ReadFile(taxColorsFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if diffFile != "" {
+		var err error
+		diffColl, err = readCollection(c.Stdin(), diffFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if origFile != "" {
+		var err error
+		origColl, err = readCollection(c.Stdin(), origFile)
+		if err != nil {
+			return err
 		}
 	}
 
+	stdout = c.Stdout()
+	stdoutUsed = false
+
+	log := logger.New(c.Stderr())
 	if len(args) == 0 {
 		args = append(args, "-")
 	}
+	var colls []*ranges.Collection
 	for _, a := range args {
 		coll, err := readCollection(c.Stdin(), a)
 		if err != nil {
 			return err
 		}
-		if err := procCollection(coll, bgImg, tPix, keys); err != nil {
+		if panelsFlag {
+			colls = append(colls, coll)
+			continue
+		}
+		if origColl != nil {
+			if err := procRotation(log, coll, bg, tPix, keys); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := procCollection(log, coll, bg, tPix, keys); err != nil {
 			return err
 		}
 	}
+	if panelsFlag {
+		return procPanels(log, colls, bg, tPix, keys)
+	}
 	return nil
 }
 
 func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
 	if name != "-" {
-		f, err := os.Open(name)
+		f, err := files.Open(name)
 		if err != nil {
 			return nil, err
 		}
@@ -144,50 +387,181 @@ func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
 		name = "stdin"
 	}
 
-	coll, err := ranges.ReadTSV(r, nil)
+	var opts []ranges.ReadOption
+	if taxFlag != "" {
+		opts = append(opts, ranges.WithTaxa(taxFlag))
+	}
+	opts = append(opts, introduced.Options()...)
+	coll, err := ranges.ReadTSV(r, nil, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("when reading %q: %v", name, err)
 	}
+	summary.Read(coll)
+	if err := sensitive.Apply(coll); err != nil {
+		return nil, err
+	}
 
 	return coll, nil
 }
 
+// MapWindow is the region drawn in the maps.
+var mapWindow window
+
+// DiffColl is the collection compared
+// when drawing difference maps.
+var diffColl *ranges.Collection
+
+// TaxColors are the colors assigned to each taxon.
+var taxColors taxcolor.Colors
+
 // MillionYears is used to transform age in years
 // to million years.
 const millionYears = 1_000_000
 
-func procCollection(c *ranges.Collection, bgImg image.Image, tp *model.TimePix, keys *pixKey) error {
+func procCollection(log *slog.Logger, c *ranges.Collection, bg *background, tp *model.TimePix, keys *pixKey) error {
 	ls := c.Taxa()
-	for _, tax := range ls {
-		if taxFlag != "" && taxFlag != tax {
-			continue
+	if diffColl != nil {
+		if diffColl.Pixelation().Equator() != c.Pixelation().Equator() {
+			return fmt.Errorf("mismatch --diff pixelation: got %d pixels, want %d", diffColl.Pixelation().Equator(), c.Pixelation().Equator())
 		}
-		age := c.Age(tax)
-		outImg := newImg(c.Pixelation())
-		if bgImg != nil {
-			outImg.setBg(bgImg)
-		}
-		if tp != nil {
-			if tp.Pixelation().Equator() != c.Pixelation().Equator() {
-				return fmt.Errorf("mismatch range pixelation: got %d pixels, want %d", c.Pixelation().Equator(), tp.Pixelation().Equator())
+		for _, tax := range diffColl.Taxa() {
+			if !c.HasTaxon(tax) {
+				ls = append(ls, tax)
 			}
-			outImg.setModel(tp, age, keys)
 		}
-		rng := c.Range(tax)
-		outImg.rng = rng
+		slices.Sort(ls)
+	}
+	if tp != nil && tp.Pixelation().Equator() != c.Pixelation().Equator() {
+		return fmt.Errorf("mismatch range pixelation: got %d pixels, want %d", c.Pixelation().Equator(), tp.Pixelation().Equator())
+	}
+	if taxFlag != "" {
+		ls = slices.DeleteFunc(ls, func(tax string) bool {
+			return tax != taxFlag
+		})
+	}
 
-		tp := c.Type(tax)
-		taxName := strings.Join(strings.Fields(tax), "_")
-		name := fmt.Sprintf("%s-%s-%.2f-%s.png", output, taxName, float64(age)/millionYears, tp)
-		if err := writeImage(name, outImg); err != nil {
+	return parallel(len(ls), cpuFlag, func(i int) error {
+		return drawTaxon(log, c, ls[i], bg, tp, keys)
+	})
+}
+
+// DrawTaxon draws the map of a taxon.
+func drawTaxon(log *slog.Logger, c *ranges.Collection, tax string, bg *background, tp *model.TimePix, keys *pixKey) error {
+	age := c.Age(tax)
+	rngType := c.Type(tax)
+	if !c.HasTaxon(tax) {
+		age = diffColl.Age(tax)
+		rngType = diffColl.Type(tax)
+	}
+	win := mapWindow
+	if fitFlag {
+		win = fitWindow(c.Pixelation(), mergeRanges(c.Range(tax), diffRange(tax)))
+	}
+	outImg := newImg(c.Pixelation(), win)
+	if bg != nil {
+		bgImg, err := bg.at(age)
+		if err != nil {
 			return err
 		}
+		outImg.SetBackground(bgImg)
+	}
+	if tp != nil {
+		setModel(outImg, tp, age, keys)
+	}
+	outImg.SetRange(c.Range(tax))
+	if tc, ok := taxColors.Color(tax); ok {
+		outImg.SetColor(tc)
+	}
+	if diffColl != nil {
+		outImg.SetDiff(diffColl.Range(tax))
 	}
+
+	name := outName(tax, age, rngType)
+	if err := writeImage(name, outImg); err != nil {
+		return err
+	}
+	log.Info("map written", "taxon", tax, "file", name)
 	return nil
 }
 
+// DiffRange returns the range of a taxon
+// in the --diff collection.
+func diffRange(tax string) map[int]float64 {
+	if diffColl == nil {
+		return nil
+	}
+	return diffColl.Range(tax)
+}
+
+// MergeRanges returns the union of the pixels
+// of a set of ranges.
+func mergeRanges(rngs ...map[int]float64) map[int]float64 {
+	m := make(map[int]float64)
+	for _, r := range rngs {
+		for px, v := range r {
+			m[px] = v
+		}
+	}
+	return m
+}
+
+// Stdout is the standard output of the command.
+var stdout io.Writer
+
+// StdoutUsed is true if an image
+// was already written into the standard output.
+var stdoutUsed bool
+
+var stdoutMu sync.Mutex
+
+// WriteImage writes an image
+// in the indicated file,
+// or into the standard output
+// if the output is "-".
+// Only a single image can be written
+// into the standard output.
+func writeImage(name string, img image.Image) error {
+	fn := func(w io.Writer) error {
+		return render.EncodePNG(context.Background(), w, img)
+	}
+
+	if output == "-" {
+		stdoutMu.Lock()
+		defer stdoutMu.Unlock()
+		if stdoutUsed {
+			return errors.New("only a single map can be written into the standard output: use --taxon")
+		}
+		stdoutUsed = true
+		return files.OutputBinary(stdout, output, fn)
+	}
+
+	if dir := filepath.Dir(name); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return files.WriteFile(name, fn)
+}
+
+// OutName returns the name of the output image
+// of a taxon.
+func outName(tax string, age int64, tp ranges.Type) string {
+	taxName := strings.Join(strings.Fields(tax), "_")
+	ageName := strconv.FormatFloat(float64(age)/millionYears, 'f', 2, 64)
+	if outTemplate == "" {
+		return fmt.Sprintf("%s-%s-%s-%s.png", output, taxName, ageName, tp)
+	}
+
+	r := strings.NewReplacer(
+		"{taxon}", taxName,
+		"{age}", ageName,
+		"{type}", string(tp),
+	)
+	return r.Replace(outTemplate)
+}
+
 func readBgImage(name string) (image.Image, error) {
-	f, err := os.Open(name)
+	f, err := files.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +575,7 @@ func readBgImage(name string) (image.Image, error) {
 }
 
 func readTimePix(name string) (*model.TimePix, error) {
-	f, err := os.Open(name)
+	f, err := files.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -214,88 +588,39 @@ func readTimePix(name string) (*model.TimePix, error) {
 	return tp, nil
 }
 
-type mapImg struct {
-	step  float64
-	color map[int]color.RGBA
-	pix   *earth.Pixelation
-	rng   map[int]float64
-}
-
-func (m *mapImg) ColorModel() color.Model { return color.RGBAModel }
-func (m *mapImg) Bounds() image.Rectangle { return image.Rect(0, 0, colsFlag, colsFlag/2) }
-func (m *mapImg) At(x, y int) color.Color {
-	lat := 90 - float64(y)*m.step
-	lon := float64(x)*m.step - 180
-
-	pos := m.pix.Pixel(lat, lon).ID()
-	if v, ok := m.rng[pos]; ok {
-		return blind.Gradient(v)
-	}
-
-	c, ok := m.color[pos]
-	if !ok {
-		return color.RGBA{0, 0, 0, 0}
-	}
-	return c
-}
-
-func newImg(pix *earth.Pixelation) *mapImg {
-	return &mapImg{
-		step:  360 / float64(colsFlag),
-		color: make(map[int]color.RGBA, pix.Len()),
-		pix:   pix,
+// NewImg returns a new map image
+// of the indicated window.
+func newImg(pix *earth.Pixelation, win window) *render.Map {
+	m := render.New(pix, win.frame(colsFlag))
+	m.SetSupersample(supersample)
+	m.SetSmooth(smoothFlag)
+	if supersample <= 1 && !smoothFlag && !fitFlag {
+		m.UseGrid()
 	}
+	return m
 }
 
-func (m *mapImg) setBg(bg image.Image) {
-	stepX := float64(360) / float64(bg.Bounds().Dx())
-	stepY := float64(180) / float64(bg.Bounds().Dy())
-	for id := 0; id < m.pix.Len(); id++ {
-		px := m.pix.ID(id).Point()
-		x := int((px.Longitude() + 180) / stepX)
-		y := int((90 - px.Latitude()) / stepY)
-		r, g, b, a := bg.At(x, y).RGBA()
-		c := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
-		m.color[id] = c
-	}
-}
-
-func (m *mapImg) setModel(tp *model.TimePix, age int64, pix *pixKey) {
+// SetModel sets the background of a map
+// using the values of a time pixelation
+// at the indicated age.
+func setModel(m *render.Map, tp *model.TimePix, age int64, pix *pixKey) {
 	age = tp.ClosestStageAge(age)
-	for id := 0; id < m.pix.Len(); id++ {
+	for id := 0; id < tp.Pixelation().Len(); id++ {
 		v, _ := tp.At(age, id)
 		if grayFlag {
 			cv, ok := pix.gray[v]
 			if !ok {
 				continue
 			}
-			m.color[id] = color.RGBA{cv, cv, cv, 255}
+			m.SetPixelColor(id, color.RGBA{cv, cv, cv, 255})
 			continue
 		}
 		c, ok := pix.color[v]
 		if !ok {
 			continue
 		}
-		m.color[id] = c
-	}
-}
-
-func writeImage(name string, m *mapImg) (err error) {
-	f, err := os.Create(name)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		e := f.Close()
-		if e != nil && err == nil {
-			err = e
-		}
-	}()
-
-	if err := png.Encode(f, m); err != nil {
-		return fmt.Errorf("when encoding image file %q: %v", name, err)
+		m.SetPixelColor(id, c)
 	}
-	return nil
 }
 
 // PixKey stores the color values
@@ -305,8 +630,44 @@ type pixKey struct {
 	gray  map[int]uint8
 }
 
+// GrayKeys returns the keys for the values
+// of a time pixelation,
+// using a ramp of gray colors.
+// Pixels with a value of 0 are ignored.
+func grayKeys(tp *model.TimePix) *pixKey {
+	vals := make(map[int]bool)
+	for _, age := range tp.Stages() {
+		for _, v := range tp.Stage(age) {
+			if v == 0 {
+				continue
+			}
+			vals[v] = true
+		}
+	}
+	ls := make([]int, 0, len(vals))
+	for v := range vals {
+		ls = append(ls, v)
+	}
+	slices.Sort(ls)
+
+	pk := &pixKey{
+		color: make(map[int]color.RGBA, len(ls)),
+		gray:  make(map[int]uint8, len(ls)),
+	}
+	const light, dark = 220, 110
+	for i, v := range ls {
+		g := uint8(light)
+		if len(ls) > 1 {
+			g = uint8(light - (light-dark)*i/(len(ls)-1))
+		}
+		pk.color[v] = color.RGBA{g, g, g, 255}
+		pk.gray[v] = g
+	}
+	return pk
+}
+
 func readKeys(name string) (*pixKey, error) {
-	f, err := os.Open(name)
+	f, err := files.Open(name)
 	if err != nil {
 		return nil, err
 	}
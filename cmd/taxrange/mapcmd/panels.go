@@ -0,0 +1,145 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package mapcmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// A Panel is the range of a taxon
+// at a given age.
+type panel struct {
+	coll *ranges.Collection
+	age  int64
+}
+
+// ProcPanels draws a single image for each taxon,
+// with a panel for each age in which the taxon
+// is found in the collections.
+func procPanels(log *slog.Logger, colls []*ranges.Collection, bg *background, tp *model.TimePix, keys *pixKey) error {
+	taxa := make(map[string][]panel)
+	for _, c := range colls {
+		if tp != nil && tp.Pixelation().Equator() != c.Pixelation().Equator() {
+			return fmt.Errorf("mismatch range pixelation: got %d pixels, want %d", c.Pixelation().Equator(), tp.Pixelation().Equator())
+		}
+		for _, tax := range c.Taxa() {
+			if taxFlag != "" && taxFlag != tax {
+				continue
+			}
+			taxa[tax] = append(taxa[tax], panel{
+				coll: c,
+				age:  c.Age(tax),
+			})
+		}
+	}
+
+	names := make([]string, 0, len(taxa))
+	for tax := range taxa {
+		names = append(names, tax)
+	}
+	slices.Sort(names)
+
+	return parallel(len(names), cpuFlag, func(i int) error {
+		tax := names[i]
+		ps := taxa[tax]
+		slices.SortStableFunc(ps, func(a, b panel) int {
+			if a.age < b.age {
+				return -1
+			}
+			if a.age > b.age {
+				return 1
+			}
+			return 0
+		})
+
+		cols := panelCols
+		if cols <= 0 || cols > len(ps) {
+			cols = len(ps)
+		}
+		rows := (len(ps) + cols - 1) / cols
+
+		win := mapWindow
+		if fitFlag {
+			rngs := make([]map[int]float64, 0, len(ps))
+			for _, p := range ps {
+				rngs = append(rngs, p.coll.Range(tax))
+			}
+			win = fitWindow(ps[0].coll.Pixelation(), mergeRanges(rngs...))
+		}
+		w, h := win.size(colsFlag)
+		dst := image.NewRGBA(image.Rect(0, 0, w*cols, h*rows))
+		for i, p := range ps {
+			outImg := newImg(p.coll.Pixelation(), win)
+			if bg != nil {
+				bgImg, err := bg.at(p.age)
+				if err != nil {
+					return err
+				}
+				outImg.SetBackground(bgImg)
+			}
+			if tp != nil {
+				setModel(outImg, tp, p.age, keys)
+			}
+			outImg.SetRange(p.coll.Range(tax))
+			if tc, ok := taxColors.Color(tax); ok {
+				outImg.SetColor(tc)
+			}
+
+			x := (i % cols) * w
+			y := (i / cols) * h
+			r := image.Rect(x, y, x+w, y+h)
+			draw.Draw(dst, r, outImg, image.Point{}, draw.Src)
+			label(dst, x, y, fmt.Sprintf("%.2f Ma", float64(p.age)/millionYears))
+		}
+
+		taxName := strings.Join(strings.Fields(tax), "_")
+		name := fmt.Sprintf("%s-%s-panels.png", output, taxName)
+		if outTemplate != "" {
+			r := strings.NewReplacer(
+				"{taxon}", taxName,
+				"{age}", "panels",
+				"{type}", "panels",
+			)
+			name = r.Replace(outTemplate)
+		}
+		if err := writeImage(name, dst); err != nil {
+			return err
+		}
+		log.Info("map written", "taxon", tax, "file", name, "panels", len(ps))
+		return nil
+	})
+}
+
+// Label draws a text label
+// at the upper left corner of a panel.
+func label(dst *image.RGBA, x, y int, text string) {
+	face := basicfont.Face7x13
+	const margin = 4
+	w := font.MeasureString(face, text).Ceil()
+	h := face.Metrics().Height.Ceil()
+
+	box := image.Rect(x, y, x+w+2*margin, y+h+2*margin)
+	draw.Draw(dst, box, image.NewUniform(color.NRGBA{255, 255, 255, 200}), image.Point{}, draw.Over)
+
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(color.RGBA{0, 0, 0, 255}),
+		Face: face,
+		Dot:  fixed.P(x+margin, y+margin+face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+}
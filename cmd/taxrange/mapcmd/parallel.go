@@ -0,0 +1,49 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package mapcmd
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Parallel runs fn for each value in [0, n),
+// using the indicated number of goroutines.
+// It returns the first error found,
+// and after an error,
+// no new calls to fn will be made.
+func parallel(n, cpu int, fn func(i int) error) error {
+	if cpu < 1 {
+		cpu = 1
+	}
+	if cpu > n {
+		cpu = n
+	}
+
+	var next atomic.Int64
+	var failed atomic.Bool
+	var once sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < cpu; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n || failed.Load() {
+					return
+				}
+				if err := fn(i); err != nil {
+					failed.Store(true)
+					once.Do(func() { firstErr = err })
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
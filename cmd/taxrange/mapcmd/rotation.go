@@ -0,0 +1,101 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package mapcmd
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log/slog"
+
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+)
+
+// OrigColl is the collection with the present ranges
+// of a rotated collection.
+var origColl *ranges.Collection
+
+// ProcRotation draws a single image for each taxon
+// of a rotated collection,
+// with a panel for the original range
+// and a panel with the difference
+// between the rotated range
+// and the original range.
+func procRotation(log *slog.Logger, c *ranges.Collection, bg *background, tp *model.TimePix, keys *pixKey) error {
+	if origColl.Pixelation().Equator() != c.Pixelation().Equator() {
+		return fmt.Errorf("mismatch --original pixelation: got %d pixels, want %d", origColl.Pixelation().Equator(), c.Pixelation().Equator())
+	}
+	if tp != nil && tp.Pixelation().Equator() != c.Pixelation().Equator() {
+		return fmt.Errorf("mismatch range pixelation: got %d pixels, want %d", c.Pixelation().Equator(), tp.Pixelation().Equator())
+	}
+
+	var ls []string
+	for _, tax := range c.Taxa() {
+		if taxFlag != "" && taxFlag != tax {
+			continue
+		}
+		if !origColl.HasTaxon(tax) {
+			log.Warn("taxon not found in --original file", "taxon", tax)
+			continue
+		}
+		ls = append(ls, tax)
+	}
+
+	return parallel(len(ls), cpuFlag, func(i int) error {
+		return drawRotation(log, c, ls[i], bg, tp, keys)
+	})
+}
+
+// DrawRotation draws the rotation panels of a taxon.
+func drawRotation(log *slog.Logger, c *ranges.Collection, tax string, bg *background, tp *model.TimePix, keys *pixKey) error {
+	rot := c.Range(tax)
+	orig := origColl.Range(tax)
+
+	win := mapWindow
+	if fitFlag {
+		win = fitWindow(c.Pixelation(), mergeRanges(rot, orig))
+	}
+	w, h := win.size(colsFlag)
+	dst := image.NewRGBA(image.Rect(0, 0, 2*w, h))
+
+	ages := [2]int64{origColl.Age(tax), c.Age(tax)}
+	for i, age := range ages {
+		outImg := newImg(c.Pixelation(), win)
+		if bg != nil {
+			bgImg, err := bg.at(age)
+			if err != nil {
+				return err
+			}
+			outImg.SetBackground(bgImg)
+		}
+		if tp != nil {
+			setModel(outImg, tp, age, keys)
+		}
+		lbl := fmt.Sprintf("%.2f Ma", float64(age)/millionYears)
+		if i == 0 {
+			outImg.SetRange(orig)
+			if tc, ok := taxColors.Color(tax); ok {
+				outImg.SetColor(tc)
+			}
+			lbl = "original: " + lbl
+		} else {
+			outImg.SetRange(rot)
+			outImg.SetDiff(orig)
+			lbl = "rotated: " + lbl
+		}
+
+		x := i * w
+		draw.Draw(dst, image.Rect(x, 0, x+w, h), outImg, image.Point{}, draw.Src)
+		label(dst, x, 0, lbl)
+	}
+
+	name := outName(tax, c.Age(tax), "rotation")
+	if err := writeImage(name, dst); err != nil {
+		return err
+	}
+	log.Info("map written", "taxon", tax, "file", name)
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package mapcmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/render"
+)
+
+// A Window is a geographic region
+// drawn in a map.
+// If minLon is greater than maxLon,
+// the window crosses the anti-meridian.
+type window struct {
+	minLat, maxLat float64
+	minLon, maxLon float64
+}
+
+// GlobalWindow is the window of a global map.
+var globalWindow = window{
+	minLat: -90,
+	maxLat: 90,
+	minLon: -180,
+	maxLon: 180,
+}
+
+// ParseWindow parses a window definition
+// in the form "minLat,maxLat,minLon,maxLon".
+func parseWindow(s string) (window, error) {
+	vals := strings.Split(s, ",")
+	if len(vals) != 4 {
+		return window{}, fmt.Errorf("invalid window %q: found %d values, want 4", s, len(vals))
+	}
+	var v [4]float64
+	for i, f := range vals {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return window{}, fmt.Errorf("invalid window %q: %v", s, err)
+		}
+		v[i] = x
+	}
+	w := window{
+		minLat: v[0],
+		maxLat: v[1],
+		minLon: v[2],
+		maxLon: v[3],
+	}
+	if w.minLat < -90 || w.maxLat > 90 || w.minLat >= w.maxLat {
+		return window{}, fmt.Errorf("invalid window %q: invalid latitude range", s)
+	}
+	if w.minLon < -180 || w.minLon > 180 || w.maxLon < -180 || w.maxLon > 180 || w.minLon == w.maxLon {
+		return window{}, fmt.Errorf("invalid window %q: invalid longitude range", s)
+	}
+	return w, nil
+}
+
+// LonSpan returns the longitude span
+// of the window
+// (in degrees).
+// As -180 and 180 are the same meridian,
+// a window from 180 to -180
+// covers all longitudes.
+func (w window) lonSpan() float64 {
+	span := w.maxLon - w.minLon
+	if w.minLon > w.maxLon {
+		span += 360
+	}
+	if span == 0 {
+		return 360
+	}
+	return span
+}
+
+// Size returns the size of the image
+// of the window
+// with the given number of columns.
+func (w window) size(cols int) (width, height int) {
+	height = int(math.Round(float64(cols) * (w.maxLat - w.minLat) / w.lonSpan()))
+	if height < 1 {
+		height = 1
+	}
+	return cols, height
+}
+
+// Frame returns the image frame of the window
+// with the given number of columns.
+func (w window) frame(cols int) render.Frame {
+	cols, rows := w.size(cols)
+	return render.Frame{
+		Top:  w.maxLat,
+		Left: w.minLon,
+		Step: w.lonSpan() / float64(cols),
+		Cols: cols,
+		Rows: rows,
+	}
+}
+
+// FitWindow returns a window
+// that contains the pixels of a range,
+// padded by a 10% of the size of the range
+// (with at least two pixels).
+// The window is expanded
+// so its width is at least its height.
+func fitWindow(pix *earth.Pixelation, rng map[int]float64) window {
+	box, ok := ranges.BoundingBox(pix, rng)
+	if !ok {
+		return globalWindow
+	}
+
+	step := pix.Step()
+	latSpan := box.MaxLat - box.MinLat
+	span := box.LonSpan()
+	lonCenter := box.MinLon + span/2
+
+	// if the range covers all longitudes
+	// (for example, a range that includes a pole)
+	// the padding is only based on the latitude
+	ext := latSpan
+	if span < 360 {
+		ext = math.Max(latSpan, span)
+	}
+	pad := math.Max(0.1*ext, 2*step)
+	latSpan += 2 * pad
+	span += 2 * pad
+	if span < latSpan {
+		span = latSpan
+	}
+
+	latCenter := (box.MinLat + box.MaxLat) / 2
+	w := window{
+		minLat: latCenter - latSpan/2,
+		maxLat: latCenter + latSpan/2,
+	}
+	if w.minLat < -90 {
+		w.maxLat = math.Min(90, w.maxLat-90-w.minLat)
+		w.minLat = -90
+	}
+	if w.maxLat > 90 {
+		w.minLat = math.Max(-90, w.minLat-(w.maxLat-90))
+		w.maxLat = 90
+	}
+
+	if span >= 360 {
+		w.minLon, w.maxLon = -180, 180
+		return w
+	}
+	w.minLon = normLon(lonCenter - span/2)
+	w.maxLon = normLon(lonCenter + span/2)
+	return w
+}
+
+// NormLon returns a longitude
+// in the range [-180, 180].
+func normLon(lon float64) float64 {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon > 180 {
+		lon -= 360
+	}
+	return lon
+}
@@ -0,0 +1,258 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package morph implements a command to apply
+// morphological operations on range maps.
+package morph
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/landscape"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `morph [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--op <operation> [--steps <number>] [--max-gap <number>]
+	[--timepix <time-pixelation> [--prior <prior-file>]]
+	[--taxon <name>] [--verbatim]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "apply morphological operations on range maps",
+	Long: `
+Command morph reads a geographic range file, and applies a morphological
+operation, based on the neighborhood of each pixel, to the range of each taxon.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --op is required and defines the operation. Valid operations are:
+
+	dilate	expands the range by one pixel at each border: each pixel
+		takes the maximum density of the pixel and its neighbors
+	erode	shrinks the range by one pixel at each border: each pixel
+		takes the minimum density of the pixel and its neighbors
+	open	an erosion followed by a dilation, it removes isolated
+		pixels and thin protrusions of the range
+	close	a dilation followed by an erosion, it fills small holes
+		and narrow gaps of the range
+	fill	fills the interior gaps of the range (i.e. pixels outside
+		the range completely surrounded by pixels of the range),
+		with densities interpolated from the border of the gap
+
+In the case of fill, the flag --max-gap defines the maximum size (in pixels)
+of a gap to be filled. The default value is 10. The flag --steps is ignored.
+
+By default the operation is applied once. Use the flag --steps to define the
+number of times that the operation will be applied. In the case of open and
+close, the erosions (or dilations) are applied the indicated number of times
+before the dilations (or erosions).
+
+By default, all pixels of the modified range are included. If the flag
+--timepix is defined, only the pixels with a non-zero value in the indicated
+time pixelation, at the age of the taxon, will be included (for example, to
+avoid ocean pixels for terrestrial taxa). Prior probabilities for each pixel
+type can be defined on a file and read with the flag --prior (the same format
+used by the command kde), so only the pixels with a non-zero prior will be
+included. The pixels of the original range are always kept.
+
+By default, all taxa in the file will be modified. Use the flag --taxon to
+modify only the indicated taxon. The other taxa will be kept unchanged. If the
+range of a taxon is empty after the operation (for example, after eroding a
+range with a single pixel), the taxon will be removed from the output.
+
+The type of each range is preserved. Record counts of points ranges are
+discarded, as the pixels of the range are modified.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var opFlag string
+var stepsFlag int
+var maxGap int
+var taxonFlag string
+var timepixFile string
+var priorFile string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&opFlag, "op", "", "")
+	c.Flags().IntVar(&stepsFlag, "steps", 1, "")
+	c.Flags().IntVar(&maxGap, "max-gap", 10, "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().StringVar(&priorFile, "prior", "", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if opFlag == "" {
+		return c.UsageError("flag --op required")
+	}
+	op, err := operation(strings.ToLower(opFlag))
+	if err != nil {
+		return c.UsageError(err.Error())
+	}
+	if priorFile != "" && timepixFile == "" {
+		return c.UsageError("flag --prior requires --timepix")
+	}
+	if maxGap < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --max-gap value %d", maxGap))
+	}
+	if stepsFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --steps value %d", stepsFlag))
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+
+	var land *landscape.Landscape
+	if timepixFile != "" {
+		land, err = landscape.Read(timepixFile, priorFile, coll.Pixelation())
+		if err != nil {
+			return err
+		}
+	}
+
+	pix := coll.Pixelation()
+	for _, tax := range coll.Taxa() {
+		if taxonFlag != "" && !strings.EqualFold(tax, strings.Join(strings.Fields(taxonFlag), " ")) {
+			continue
+		}
+
+		rng := op(pix, coll.Range(tax))
+		if land != nil {
+			rng = land.Mask(rng, coll.Age(tax), coll.Range(tax))
+		}
+		if len(rng) == 0 {
+			log.Warn("empty range after operation", "taxon", tax, "op", opFlag)
+			coll.Delete(tax)
+			continue
+		}
+		log.Debug("taxon modified", "taxon", tax, "pixels", len(rng))
+		if coll.Type(tax) == ranges.Points {
+			coll.SetPixels(coll.VerbatimName(tax), coll.Age(tax), rng)
+			continue
+		}
+		coll.Set(coll.VerbatimName(tax), coll.Age(tax), rng)
+	}
+
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+type morphFunc func(pix *earth.Pixelation, rng map[int]float64) map[int]float64
+
+func operation(name string) (morphFunc, error) {
+	repeat := func(fn morphFunc) morphFunc {
+		return func(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+			for i := 0; i < stepsFlag; i++ {
+				rng = fn(pix, rng)
+			}
+			return rng
+		}
+	}
+
+	switch name {
+	case "dilate":
+		return repeat(ranges.Dilate), nil
+	case "erode":
+		return repeat(ranges.Erode), nil
+	case "open":
+		return func(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+			return repeat(ranges.Dilate)(pix, repeat(ranges.Erode)(pix, rng))
+		}, nil
+	case "close":
+		return func(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+			return repeat(ranges.Erode)(pix, repeat(ranges.Dilate)(pix, rng))
+		}, nil
+	case "fill":
+		return func(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+			return ranges.FillGaps(pix, rng, maxGap)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid operation %q", name)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
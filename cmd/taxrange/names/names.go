@@ -0,0 +1,514 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package names implements a command to inspect
+// and fix the taxon names of a taxon range collection.
+package names
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/snapshot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `names [--quiet | -v | -vv] [--log-json]
+	[--suggest] [--distance <value>]
+	[--json-summary <file>]
+	[--merge <mapping-file>] [--interactive]
+	[--genus [--exceptions <mapping-file>] [--report <file>]]
+	[--sort <order>] [--reproducible]
+	[--patch <file>] [--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "find and merge similar taxon names",
+	Long: `
+Command names reads a geographic range file and prints the names of the taxa in
+the file, with the canonical name in the first column, and the verbatim name
+(as it was written in the file) in the second column.
+
+The range file is given as an argument. If no file is given, the ranges will be
+read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+If the flag --suggest is defined, instead of the list of names, the command
+will print pairs of names that are probably the same taxon, as typos silently
+produce split ranges. Two names are paired if they are identical after removing
+qualifiers (such as "cf.", "aff.", or "?"), or if the edit distance between the
+names is less or equal than the value defined by the flag --distance (default
+is 2). The output is a tab-delimited table with the following columns:
+
+	taxon	the suggested name to be merged (the one with fewer pixels)
+	accepted	the suggested accepted name
+	distance	the edit distance between the names
+	reason	either "qualifier" or "distance"
+
+If the flag --interactive is defined with --suggest, for each pair of names the
+command will ask if the first name should be merged into the accepted name.
+
+The flag --merge defines a mapping file, a tab-delimited file with the
+following columns:
+
+	taxon	the name of the taxon to be merged
+	accepted	the name of the taxon that will receive the merged range
+
+Any other column will be ignored. If the accepted taxon is not in the
+collection, the taxon will be renamed. Here is an example of a mapping file:
+
+	taxon	accepted
+	Brontostoma discos	Brontostoma discus
+	Brontostoma cf. discus	Brontostoma discus
+
+Both taxa must have the same type of range and the same age. Merged points
+are the union of the pixels of both taxa, and merged continuous ranges will
+have the maximum density of both taxa at each pixel.
+
+If the flag --genus is defined, the ranges of the species will be aggregated
+into genus-level ranges, by merging each taxon into the first word of its
+name (ignoring qualifiers such as "cf." or "?"), so, for example, "Homo
+sapiens" and "Homo cf. erectus" will be merged into "Homo". Names with a
+single word are kept as they are. Use the flag --exceptions to define a
+mapping file, in the format used by the flag --merge, with the genus of the
+taxa that can not be parsed from the name (for example, a name with an
+outdated genus). The genus of a taxon in the exceptions file will be the name
+in the accepted column. If the flag --merge is also defined, the names will be
+merged before the aggregation. All the taxa of a genus must have the same type
+of range and the same age.
+
+Use the flag --report to write the mapping of each taxon to its genus in the
+indicated file, as a tab-delimited table with the following columns:
+
+	taxon	the name of the taxon
+	genus	the name of the genus
+	source	either "name" if the genus was parsed from the name,
+		or "exception" if it was taken from the exceptions
+		file
+
+If the flag --patch is defined, the changes in the ranges will be written as a
+patch into the indicated file, so they can be reverted with the command apply,
+using the flag --reverse.
+
+When merging or aggregating, the resulting collection will be printed in the
+standard output. If the flag --output, or -o, is defined, the indicated file
+will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var suggestFlag bool
+var interactive bool
+var distFlag int
+var mergeFile string
+var genusFlag bool
+var exceptFile string
+var reportFile string
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	snapshot.SetFlags(c)
+	c.Flags().BoolVar(&suggestFlag, "suggest", false, "")
+	c.Flags().BoolVar(&interactive, "interactive", false, "")
+	c.Flags().IntVar(&distFlag, "distance", 2, "")
+	c.Flags().StringVar(&mergeFile, "merge", "", "")
+	c.Flags().BoolVar(&genusFlag, "genus", false, "")
+	c.Flags().StringVar(&exceptFile, "exceptions", "", "")
+	c.Flags().StringVar(&reportFile, "report", "", "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if interactive && !suggestFlag {
+		return c.UsageError("flag --interactive requires --suggest")
+	}
+	if interactive && len(args) == 0 {
+		return c.UsageError("flag --interactive requires a range file")
+	}
+	if genusFlag && suggestFlag {
+		return c.UsageError("flags --genus and --suggest defined")
+	}
+	if !genusFlag && (exceptFile != "" || reportFile != "") {
+		return c.UsageError("flags --exceptions and --report require --genus")
+	}
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Take(coll); err != nil {
+		return err
+	}
+
+	if mergeFile != "" {
+		m, err := readMapping(mergeFile)
+		if err != nil {
+			return err
+		}
+		for _, p := range m {
+			if !coll.HasTaxon(p.taxon) {
+				continue
+			}
+			if err := coll.Merge(p.accepted, p.taxon); err != nil {
+				return err
+			}
+		}
+	}
+
+	if genusFlag {
+		var except []pair
+		if exceptFile != "" {
+			except, err = readMapping(exceptFile)
+			if err != nil {
+				return err
+			}
+		}
+		m := genusMapping(coll, except)
+		for _, p := range m {
+			if err := coll.Merge(p.accepted, p.taxon); err != nil {
+				return err
+			}
+		}
+		if reportFile != "" {
+			if err := files.WriteFile(reportFile, func(w io.Writer) error {
+				return writeReport(w, m)
+			}); err != nil {
+				return err
+			}
+		}
+		return writeCollection(c.Stdout(), coll)
+	}
+
+	if !suggestFlag {
+		if mergeFile != "" {
+			return writeCollection(c.Stdout(), coll)
+		}
+		for _, tax := range coll.Taxa() {
+			fmt.Fprintf(c.Stdout(), "%s\t%s\n", tax, coll.VerbatimName(tax))
+		}
+		return nil
+	}
+
+	pairs := suggest(coll)
+	if !interactive {
+		fmt.Fprintf(c.Stdout(), "taxon\taccepted\tdistance\treason\n")
+		for _, p := range pairs {
+			fmt.Fprintf(c.Stdout(), "%s\t%s\t%d\t%s\n", p.taxon, p.accepted, p.dist, p.reason)
+		}
+		return nil
+	}
+
+	in := bufio.NewReader(c.Stdin())
+	var merged bool
+	for _, p := range pairs {
+		if !coll.HasTaxon(p.taxon) || !coll.HasTaxon(p.accepted) {
+			continue
+		}
+		fmt.Fprintf(c.Stderr(), "merge %q into %q? [y/N] ", p.taxon, p.accepted)
+		ans, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		ans = strings.ToLower(strings.TrimSpace(ans))
+		if ans == "y" || ans == "yes" {
+			if err := coll.Merge(p.accepted, p.taxon); err != nil {
+				return err
+			}
+			merged = true
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	if !merged && mergeFile == "" {
+		return nil
+	}
+	return writeCollection(c.Stdout(), coll)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	coll.KeepVerbatim(true)
+
+	return coll, nil
+}
+
+func writeCollection(w io.Writer, coll *ranges.Collection) error {
+	if err := snapshot.Write(coll); err != nil {
+		return err
+	}
+	outformat.Set(coll)
+	summary.Written(len(coll.Taxa()))
+	return files.Output(w, output, coll.TSV)
+}
+
+type pair struct {
+	taxon    string
+	accepted string
+	dist     int
+	reason   string
+}
+
+func readMapping(name string) ([]pair, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range []string{"taxon", "accepted"} {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, h)
+		}
+	}
+
+	var m []pair
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+		}
+
+		f := "taxon"
+		tax := strings.Join(strings.Fields(row[fields[f]]), " ")
+		if tax == "" {
+			continue
+		}
+
+		f = "accepted"
+		acc := strings.Join(strings.Fields(row[fields[f]]), " ")
+		if acc == "" {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: empty name", name, ln, f)
+		}
+		m = append(m, pair{
+			taxon:    tax,
+			accepted: acc,
+		})
+	}
+	return m, nil
+}
+
+// GenusMapping returns the genus of each taxon
+// of a collection,
+// using the exceptions
+// for the taxa with a genus that can not be parsed from the name.
+func genusMapping(coll *ranges.Collection, except []pair) []pair {
+	ex := make(map[string]string, len(except))
+	for _, p := range except {
+		ex[strings.ToLower(p.taxon)] = p.accepted
+	}
+
+	var m []pair
+	for _, tax := range coll.Taxa() {
+		v := coll.VerbatimName(tax)
+		if g, ok := ex[strings.ToLower(tax)]; ok {
+			m = append(m, pair{
+				taxon:    v,
+				accepted: g,
+				reason:   "exception",
+			})
+			continue
+		}
+		g := genus(v)
+		if g == "" {
+			g = v
+		}
+		m = append(m, pair{
+			taxon:    v,
+			accepted: g,
+			reason:   "name",
+		})
+	}
+	return m
+}
+
+// Genus returns the first word of a name
+// that is not a qualifier.
+func genus(name string) string {
+	for _, w := range strings.Fields(name) {
+		w = strings.Trim(w, "?")
+		if w == "" || qualifiers[strings.ToLower(w)] {
+			continue
+		}
+		return w
+	}
+	return ""
+}
+
+func writeReport(w io.Writer, m []pair) error {
+	tab := csv.NewWriter(w)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	if err := tab.Write([]string{"taxon", "genus", "source"}); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	for _, p := range m {
+		if err := tab.Write([]string{p.taxon, p.accepted, p.reason}); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// Qualifiers are words used in taxon names
+// to indicate an uncertain identification.
+var qualifiers = map[string]bool{
+	"?":      true,
+	"aff":    true,
+	"aff.":   true,
+	"cf":     true,
+	"cf.":    true,
+	"nr":     true,
+	"nr.":    true,
+	"s.l.":   true,
+	"s.str.": true,
+	"sp":     true,
+	"sp.":    true,
+	"spp":    true,
+	"spp.":   true,
+}
+
+// Unqualified returns a name without qualifiers.
+func unqualified(name string) string {
+	var words []string
+	for _, w := range strings.Fields(strings.ToLower(name)) {
+		w = strings.Trim(w, "?")
+		if w == "" || qualifiers[w] {
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
+
+func suggest(coll *ranges.Collection) []pair {
+	taxa := coll.Taxa()
+	var pairs []pair
+	for i, a := range taxa {
+		ua := unqualified(a)
+		for _, b := range taxa[i+1:] {
+			ub := unqualified(b)
+			d := distance(strings.ToLower(a), strings.ToLower(b))
+
+			reason := ""
+			if ua == ub {
+				reason = "qualifier"
+			} else if d <= distFlag {
+				reason = "distance"
+			}
+			if reason == "" {
+				continue
+			}
+
+			p := pair{
+				taxon:    a,
+				accepted: b,
+				dist:     d,
+				reason:   reason,
+			}
+			if len(coll.Range(a)) > len(coll.Range(b)) || (ua == ub && strings.ToLower(a) == ua) {
+				p.taxon, p.accepted = b, a
+			}
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+// Distance returns the Levenshtein edit distance
+// between two strings.
+func distance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
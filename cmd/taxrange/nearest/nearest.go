@@ -0,0 +1,260 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package nearest implements a command to print
+// the distance from a site to the nearest occurrence
+// of each taxon.
+package nearest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `nearest [--quiet | -v | -vv] [--log-json]
+	[--lat <value> --lon <value> | --sites <file>]
+	[--introduced <mode>]
+	[--json-summary <file>] [--force]
+	[--taxon <name>] [<rng-file>...]`,
+	Short: "prints the distance to the nearest occurrence",
+	Long: `
+Command nearest reads one or more geographic range files, and prints, for each
+taxon, the distance from a site to the nearest pixel in the range of the taxon.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The site can be defined with the flags --lat and --lon, for the latitude and
+longitude of a point. Alternatively, the flag --sites defines a tab-delimited
+file with the following columns:
+
+	site		the name of the site
+	latitude	the latitude of the site
+	longitude	the longitude of the site
+
+By default, all taxa will be reported. Use the flag --taxon to report only the
+indicated taxon.
+
+The output is a tab-delimited table with the following columns:
+
+	file		the range file
+	site		the name of the site
+	taxon		the name of the taxon
+	pixel		the ID of the nearest pixel
+	latitude	the latitude of the center of the nearest pixel
+	longitude	the longitude of the center of the nearest pixel
+	distance	the distance to the nearest pixel (in km)
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var latFlag float64
+var lonFlag float64
+var sitesFile string
+var taxonFlag string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().Float64Var(&latFlag, "lat", math.NaN(), "")
+	c.Flags().Float64Var(&lonFlag, "lon", math.NaN(), "")
+	c.Flags().StringVar(&sitesFile, "sites", "", "")
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+}
+
+type site struct {
+	name string
+	lat  float64
+	lon  float64
+}
+
+func run(c *command.Command, args []string) error {
+	hasPoint := !math.IsNaN(latFlag) || !math.IsNaN(lonFlag)
+	if hasPoint && sitesFile != "" {
+		return c.UsageError("both --sites and --lat, --lon flags defined")
+	}
+	if hasPoint && (math.IsNaN(latFlag) || math.IsNaN(lonFlag)) {
+		return c.UsageError("both --lat and --lon flags are required")
+	}
+	if !hasPoint && sitesFile == "" {
+		return c.UsageError("undefined site: use --lat and --lon, or --sites")
+	}
+
+	var sites []site
+	if hasPoint {
+		sites = []site{{
+			name: fmt.Sprintf("%.6f,%.6f", latFlag, lonFlag),
+			lat:  latFlag,
+			lon:  lonFlag,
+		}}
+	} else {
+		var err error
+		sites, err = readSites(sitesFile)
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range sites {
+		if s.lat < -90 || s.lat > 90 {
+			return fmt.Errorf("site %q: invalid latitude %.6f", s.name, s.lat)
+		}
+		if s.lon < -180 || s.lon > 180 {
+			return fmt.Errorf("site %q: invalid longitude %.6f", s.name, s.lon)
+		}
+	}
+
+	fmt.Fprintf(c.Stdout(), "file\tsite\ttaxon\tpixel\tlatitude\tlongitude\tdistance\n")
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		if err := printNearest(c.Stdin(), c.Stdout(), a, sites); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printNearest(r io.Reader, w io.Writer, name string, sites []site) error {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	var opts []ranges.ReadOption
+	if taxonFlag != "" {
+		opts = append(opts, ranges.WithTaxa(taxonFlag))
+	}
+	opts = append(opts, introduced.Options()...)
+	coll, err := ranges.ReadTSV(r, nil, opts...)
+	if err != nil {
+		return fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	taxa := coll.Taxa()
+	if taxonFlag != "" {
+		nm := strings.Join(strings.Fields(taxonFlag), " ")
+		taxa = nil
+		for _, tax := range coll.Taxa() {
+			if strings.EqualFold(tax, nm) {
+				taxa = append(taxa, tax)
+			}
+		}
+	}
+
+	pix := coll.Pixelation()
+	for _, s := range sites {
+		for _, tax := range taxa {
+			px, d := coll.Nearest(tax, s.lat, s.lon)
+			if px < 0 {
+				continue
+			}
+			pt := pix.ID(px).Point()
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.6f\t%.6f\t%.3f\n", name, s.name, tax, px, pt.Latitude(), pt.Longitude(), d)
+		}
+	}
+	return nil
+}
+
+var sitesFields = []string{
+	"site",
+	"latitude",
+	"longitude",
+}
+
+func readSites(name string) ([]site, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range sitesFields {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("on file %q: expecting field %q", name, h)
+		}
+	}
+
+	var sites []site
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: %v", name, ln, err)
+		}
+
+		f := "latitude"
+		lat, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+		f = "longitude"
+		lon, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("on file %q: row %d: field %q: %v", name, ln, f, err)
+		}
+
+		sites = append(sites, site{
+			name: strings.TrimSpace(row[fields["site"]]),
+			lat:  lat,
+			lon:  lon,
+		})
+	}
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("on file %q: no sites defined", name)
+	}
+	return sites, nil
+}
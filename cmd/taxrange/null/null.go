@@ -0,0 +1,284 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package null implements a command to build
+// null models of range distributions.
+package null
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/earth/stat/pixprob"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/seed"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `null [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--model <value>]
+	[--timepix <time-pixelation>] [--prior <prior-file>]
+	[--replicates <number>] [--attempts <number>] [--seed <value>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] -o|--output <prefix> [<rng-file>]`,
+	Short: "build null models of range distributions",
+	Long: `
+Command null reads a geographic range file, and writes one or more replicates
+of a null model of the ranges, for example, to build null distributions for
+overlap or endemism statistics.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --model defines the null model. Valid values are:
+
+	random	each range is moved to a random position, keeping its size
+		and shape (the default)
+	dye	each range is replaced by a range with the same number of
+		pixels, built with the spreading-dye algorithm: starting
+		from a random pixel, the range grows by adding random
+		neighbors of the pixels already in the range
+
+The flag --timepix defines a time pixelation used to constrain the null
+model, so only suitable pixels, at the age of each taxon, are used. By default
+a pixel is suitable if its value in the time pixelation is not 0. Use the
+flag --prior to define a pixel prior file (as used by the command kde), in
+which case a pixel is suitable if its prior is greater than 0. If no time
+pixelation is defined, all pixels are suitable.
+
+With the "random" model, a position is accepted only if all the pixels of the
+moved range are suitable. The flag --attempts defines the maximum number of
+random positions tried for each range (default 1000). If no suitable position
+is found, the taxon will be omitted from the replicate, and a warning will be
+reported. With the "dye" model, only suitable pixels are added to the range,
+and the flag --attempts defines the maximum number of random seed pixels tried
+for each range. The densities of the ranges are not preserved with the "dye"
+model (all pixels will have a density of 1).
+
+The flag --replicates defines the number of replicates (default 1). The flag
+--seed defines the seed of the random number generator (default 1), so the
+same seed always produces the same replicates. Use "random" to take the seed
+from the current time. The seed is recorded as a comment in each replicate
+file.
+
+The flag --output, or -o, is required and defines the prefix of the output
+files. Each replicate will be written in a different file, with the name
+formed by the prefix, followed by the number of the replicate, and the
+extension ".tab", for example "null-001.tab". Record counts are not preserved.
+
+Existing output files are not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var modelFlag string
+var tpFile string
+var priorFile string
+var replicates int
+var attempts int
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	seed.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&modelFlag, "model", "random", "")
+	c.Flags().StringVar(&tpFile, "timepix", "", "")
+	c.Flags().StringVar(&priorFile, "prior", "", "")
+	c.Flags().IntVar(&replicates, "replicates", 1, "")
+	c.Flags().IntVar(&attempts, "attempts", 1000, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if output == "" {
+		return c.UsageError("flag --output required")
+	}
+	if output == "-" {
+		return c.UsageError("flag --output: the standard output can not be used as a prefix")
+	}
+	if modelFlag != "random" && modelFlag != "dye" {
+		return c.UsageError(fmt.Sprintf("flag --model: invalid value %q", modelFlag))
+	}
+	if priorFile != "" && tpFile == "" {
+		return c.UsageError("flag --prior defined without --timepix")
+	}
+	if replicates < 1 {
+		return c.UsageError("flag --replicates must be greater than 0")
+	}
+	if attempts < 1 {
+		return c.UsageError("flag --attempts must be greater than 0")
+	}
+	log := logger.New(c.Stderr())
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+	taxa := coll.TaxaBy(ranges.InputOrder)
+	if len(taxa) == 0 {
+		return nil
+	}
+
+	var tp *model.TimePix
+	var prior pixprob.Pixel
+	if tpFile != "" {
+		tp, err = readTimePix(tpFile)
+		if err != nil {
+			return err
+		}
+		if tp.Pixelation().Equator() != coll.Pixelation().Equator() {
+			return fmt.Errorf("time pixelation %q: invalid equator value %d, want %d", tpFile, tp.Pixelation().Equator(), coll.Pixelation().Equator())
+		}
+		if priorFile != "" {
+			prior, err = readPixelPrior(priorFile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	rnd := seed.Rand()
+	for r := 1; r <= replicates; r++ {
+		null := ranges.New(coll.Pixelation())
+		for _, tax := range taxa {
+			age := coll.Age(tax)
+			var rng map[int]float64
+			switch modelFlag {
+			case "random":
+				rng = ranges.RandomPlace(coll.Pixelation(), coll.Range(tax), rnd, suitable(tp, prior, age), attempts)
+			case "dye":
+				rng = ranges.SpreadingDye(coll.Pixelation(), len(coll.Range(tax)), rnd, suitable(tp, prior, age), attempts)
+			}
+			if rng == nil {
+				log.Warn("no suitable position found", "taxon", tax, "replicate", r)
+				continue
+			}
+			if coll.Type(tax) == ranges.Points {
+				null.SetPixels(coll.VerbatimName(tax), age, rng)
+				continue
+			}
+			null.Set(coll.VerbatimName(tax), age, rng)
+		}
+
+		null.KeepVerbatim(verbatimFlag)
+		null.AddComment(fmt.Sprintf("null model: %s replicate: %d", modelFlag, r))
+		null.AddComment(seed.Comment())
+		outformat.Set(null)
+		summary.Written(len(null.Taxa()))
+		name := fmt.Sprintf("%s-%03d.tab", output, r)
+		if err := files.WriteFile(name, null.TSV); err != nil {
+			return err
+		}
+		log.Info("replicate written", "replicate", r, "file", name, "taxa", len(null.Taxa()))
+	}
+	return nil
+}
+
+// Suitable returns a function that returns true
+// if a pixel is suitable at the indicated age.
+func suitable(tp *model.TimePix, prior pixprob.Pixel, age int64) func(px int) bool {
+	if tp == nil {
+		return nil
+	}
+	age = tp.ClosestStageAge(age)
+	return func(px int) bool {
+		v, _ := tp.At(age, px)
+		if prior != nil {
+			return prior.Prior(v) > 0
+		}
+		return v != 0
+	}
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+func readTimePix(name string) (*model.TimePix, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tp, err := model.ReadTimePix(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return tp, nil
+}
+
+func readPixelPrior(name string) (pixprob.Pixel, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prior, err := pixprob.ReadTSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return prior, nil
+}
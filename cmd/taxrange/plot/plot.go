@@ -0,0 +1,216 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package plot implements a command to draw
+// summary plots of a taxon range collection.
+package plot
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/plot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `plot [--quiet | -v | -vv] [--log-json]
+	[--format <format>] [--threshold <value>]
+	[--json-summary <file>]
+	[--introduced <mode>]
+	[--force] -o|--output <prefix> [<rng-file>...]`,
+	Short: "draw summary plots of a range collection",
+	Long: `
+Command plot reads one or more geographic range files, and draws simple
+summary plots of the dataset, so the quality of the data can be inspected
+without exporting it to other programs.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. All range files must use the same
+pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The following plots are drawn:
+
+	records-taxon	histogram of the number of records per taxon
+	records-pixel	histogram of the number of records per pixel
+			(summed over all taxa)
+	range-size	frequency distribution of the range size (in
+			pixels) of the taxa
+
+The records are only counted for ranges of "points" type with record counts
+(for example, ranges built with the command imp.points). The range size is
+the number of pixels in the range of the taxon. By default any pixel of a
+range is counted, use the flag --threshold to define the minimum density value
+for a pixel of a continuous range to be counted.
+
+As the values are usually skewed, the histograms use bins of increasing
+powers of 2 (i.e. 1, 2-3, 4-7, 8-15, ...).
+
+The flag --output, or -o, is required and defines the prefix of the output
+files. The name of each file will be the prefix, followed by the name of the
+plot, for example, with the prefix "data", the range size plot will be
+"data-range-size.png".
+
+Existing output files are not overwritten, unless the flag --force is defined.
+
+By default the plots will be written as PNG images. Use the flag --format to
+define a different format: "png" or "svg".
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var formatFlag string
+var threshold float64
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&formatFlag, "format", "png", "")
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if output == "" {
+		return c.UsageError("flag --output required")
+	}
+	if output == "-" {
+		return c.UsageError("flag --output: the standard output can not be used as a prefix")
+	}
+	formatFlag = strings.ToLower(strings.TrimSpace(formatFlag))
+	if formatFlag != "png" && formatFlag != "svg" {
+		return c.UsageError(fmt.Sprintf("invalid --format value %q", formatFlag))
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	var pix *earth.Pixelation
+	var recsTaxon, sizes []int
+	recsPixel := make(map[int]int)
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, pix)
+		if err != nil {
+			return err
+		}
+		pix = coll.Pixelation()
+
+		for _, tax := range coll.Taxa() {
+			var size int
+			for _, v := range coll.Range(tax) {
+				if v > 0 && v >= threshold {
+					size++
+				}
+			}
+			sizes = append(sizes, size)
+
+			recs := coll.Records(tax)
+			if len(recs) == 0 {
+				continue
+			}
+			var n int
+			for px, r := range recs {
+				n += r
+				recsPixel[px] += r
+			}
+			recsTaxon = append(recsTaxon, n)
+		}
+	}
+
+	perPixel := make([]int, 0, len(recsPixel))
+	for _, n := range recsPixel {
+		perPixel = append(perPixel, n)
+	}
+
+	charts := []struct {
+		name  string
+		chart plot.Chart
+	}{
+		{
+			name: "records-taxon",
+			chart: plot.Chart{
+				Title:  "Records per taxon",
+				XLabel: "records",
+				YLabel: "taxa",
+				Bars:   plot.Log2Bins(recsTaxon),
+			},
+		},
+		{
+			name: "records-pixel",
+			chart: plot.Chart{
+				Title:  "Records per pixel",
+				XLabel: "records",
+				YLabel: "pixels",
+				Bars:   plot.Log2Bins(perPixel),
+			},
+		},
+		{
+			name: "range-size",
+			chart: plot.Chart{
+				Title:  "Range size",
+				XLabel: "pixels",
+				YLabel: "taxa",
+				Bars:   plot.Log2Bins(sizes),
+			},
+		},
+	}
+
+	for _, ch := range charts {
+		name := fmt.Sprintf("%s-%s.%s", output, ch.name, formatFlag)
+		write := ch.chart.WritePNG
+		if formatFlag == "svg" {
+			write = ch.chart.WriteSVG
+		}
+		if err := files.WriteFile(name, write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
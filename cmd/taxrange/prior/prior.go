@@ -0,0 +1,345 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package prior implements a command to create,
+// validate,
+// and print pixel prior files.
+package prior
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `prior [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--new] [--set <key>=<prior>...]
+	[--timepix <time-pixelation>] [--default <prior>]
+	[--force] [-o|--output <file>] [<prior-file>]`,
+	Short: "create, validate, and print pixel prior files",
+	Long: `
+Command prior reads a pixel prior file, validates it, and prints it in a
+normalized form (sorted by key, and with all prior values with the same
+precision).
+
+A pixel prior file is a tab-delimited file, used by the command kde, with the
+following columns:
+
+	-key	the value used as identifier
+	-prior	the prior probability for a pixel with that value
+	-comment	an optional description of the value
+
+The argument of the command is the name of the pixel prior file. If no file is
+given, the file will be read from the standard input. Use the flag --new to
+create a new pixel prior file without reading a file.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The flag --set sets the prior of a key, in the form <key>=<prior>. The prior
+must be a value between 0 and 1. The flag can be given multiple times. For
+example:
+
+	taxrange prior --new --set 0=0 --set 1=0.01 --set 3=0.95
+
+If the flag --timepix is defined, the keys of the prior file will be compared
+with the values of the pixels in the indicated time pixelation. It is an
+error if a value of the time pixelation does not have a prior, unless the
+flag --default is defined, in which case the missing keys will be added with
+the indicated prior. Keys of the prior file that are not found in the time
+pixelation are reported as warnings.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is
+an error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var newFlag bool
+var setFlag setValues
+var tpFile string
+var defFlag float64
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&newFlag, "new", false, "")
+	setFlag = nil
+	c.Flags().Var(&setFlag, "set", "")
+	c.Flags().StringVar(&tpFile, "timepix", "", "")
+	c.Flags().Float64Var(&defFlag, "default", -1, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if defFlag > 1 || (defFlag < 0 && defFlag != -1) {
+		return c.UsageError(fmt.Sprintf("flag --default: invalid prior value %.6f", defFlag))
+	}
+	if newFlag && len(args) > 0 {
+		return c.UsageError("flag --new defined with an input file")
+	}
+	log := logger.New(c.Stderr())
+
+	p := make(priors)
+	if !newFlag {
+		name := "-"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		var err error
+		p, err = readPriors(c.Stdin(), name)
+		if err != nil {
+			return err
+		}
+		summary.Records(len(p))
+	}
+
+	for _, s := range setFlag {
+		e := p[s.key]
+		e.prior = s.prior
+		p[s.key] = e
+	}
+
+	if tpFile != "" {
+		values, err := readTimePixValues(tpFile)
+		if err != nil {
+			return err
+		}
+
+		var missing int
+		for _, v := range values {
+			if _, ok := p[v]; ok {
+				continue
+			}
+			if defFlag >= 0 {
+				p[v] = entry{prior: defFlag}
+				log.Info("key added with default prior", "key", v, "prior", defFlag)
+				continue
+			}
+			log.Warn("key without prior", "key", v)
+			missing++
+		}
+		for k := range p {
+			if _, ok := slices.BinarySearch(values, k); !ok {
+				log.Warn("key not in time pixelation", "key", k)
+			}
+		}
+		if missing > 0 {
+			return fmt.Errorf("time pixelation %q: %d keys without prior", tpFile, missing)
+		}
+	}
+
+	return files.Output(c.Stdout(), output, p.tsv)
+}
+
+// An Entry is the prior of a key
+// in a pixel prior file.
+type entry struct {
+	prior   float64
+	comment string
+}
+
+// Priors is a pixel prior file.
+type priors map[int]entry
+
+func readPriors(r io.Reader, name string) (priors, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	tsv := csv.NewReader(r)
+	tsv.Comma = '\t'
+	tsv.Comment = '#'
+
+	head, err := tsv.Read()
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: while reading header: %v", name, err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range []string{"key", "prior"} {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("when reading %q: expecting field %q", name, h)
+		}
+	}
+
+	p := make(priors)
+	for {
+		row, err := tsv.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		ln, _ := tsv.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("when reading %q: on row %d: %v", name, ln, err)
+		}
+
+		f := "key"
+		k, err := strconv.Atoi(row[fields[f]])
+		if err != nil {
+			return nil, fmt.Errorf("when reading %q: on row %d: field %q: %v", name, ln, f, err)
+		}
+		if _, dup := p[k]; dup {
+			return nil, fmt.Errorf("when reading %q: on row %d: field %q: key %d already defined", name, ln, f, k)
+		}
+
+		f = "prior"
+		pp, err := strconv.ParseFloat(row[fields[f]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("when reading %q: on row %d: field %q: %v", name, ln, f, err)
+		}
+		if pp < 0 || pp > 1 {
+			return nil, fmt.Errorf("when reading %q: on row %d: field %q: invalid prior value %.6f", name, ln, f, pp)
+		}
+
+		e := entry{prior: pp}
+		if i, ok := fields["comment"]; ok {
+			e.comment = strings.TrimSpace(row[i])
+		}
+		p[k] = e
+	}
+
+	return p, nil
+}
+
+func (p priors) tsv(w io.Writer) error {
+	keys := make([]int, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	bw := bufio.NewWriter(w)
+	tab := csv.NewWriter(bw)
+	tab.Comma = '\t'
+	tab.UseCRLF = true
+
+	if err := tab.Write([]string{"key", "prior", "comment"}); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	for _, k := range keys {
+		e := p[k]
+		row := []string{
+			strconv.Itoa(k),
+			strconv.FormatFloat(e.prior, 'f', 6, 64),
+			e.comment,
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// ReadTimePixValues returns the sorted list of values
+// used in the pixels of a time pixelation.
+func readTimePixValues(name string) ([]int, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tp, err := model.ReadTimePix(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+
+	set := make(map[int]bool)
+	for _, age := range tp.Stages() {
+		for _, v := range tp.Stage(age) {
+			set[v] = true
+		}
+	}
+	values := make([]int, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	slices.Sort(values)
+	return values, nil
+}
+
+// A SetValue is a prior defined
+// with the flag --set.
+type setValue struct {
+	key   int
+	prior float64
+}
+
+// SetValues is a flag value
+// for the --set flag.
+type setValues []setValue
+
+func (s *setValues) String() string {
+	vals := make([]string, 0, len(*s))
+	for _, v := range *s {
+		vals = append(vals, fmt.Sprintf("%d=%.6f", v.key, v.prior))
+	}
+	return strings.Join(vals, ",")
+}
+
+func (s *setValues) Set(v string) error {
+	ks, ps, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("expecting <key>=<prior>, found %q", v)
+	}
+	k, err := strconv.Atoi(strings.TrimSpace(ks))
+	if err != nil {
+		return fmt.Errorf("invalid key %q: %v", ks, err)
+	}
+	p, err := strconv.ParseFloat(strings.TrimSpace(ps), 64)
+	if err != nil {
+		return fmt.Errorf("invalid prior %q: %v", ps, err)
+	}
+	if p < 0 || p > 1 {
+		return fmt.Errorf("invalid prior value %.6f", p)
+	}
+	*s = append(*s, setValue{key: k, prior: p})
+	return nil
+}
@@ -0,0 +1,233 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package regions implements a command to write
+// a table with the presence of each taxon
+// in a set of named regions.
+package regions
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/table"
+)
+
+var Command = &command.Command{
+	Usage: `regions [--quiet | -v | -vv] [--log-json]
+	--regions <rng-file> [--marks] [--threshold <value>]
+	[--format <format>] [--verbatim] [--introduced <mode>]
+	[--json-summary <file>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "write a table of taxa by regions",
+	Long: `
+Command regions reads a geographic range file, and a file with a set of named
+regions, and writes a table with the number of pixels of the range of each
+taxon in each region, for example, to be used as a supplementary table in a
+paper.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --regions is required and defines a range file with the regions. Each
+taxon of the file is a region, and the name of the taxon (as given in the
+file) is used as the name of the region. For example, a region can be built
+with the command imp.points, or with a polygon and the command erase. The
+regions file must have the same pixelation as the range file. Regions are
+written in the order in which they are found in the regions file.
+
+By default a taxon is present in any pixel of its range. Use the flag
+--threshold to define the minimum density value for a pixel of a continuous
+range to be counted as a presence.
+
+The table has a row for each taxon, and a column for each region, and the
+following additional columns:
+
+	taxon	the name of the taxon
+	total	the number of pixels in the range of the taxon
+
+Each cell is the number of pixels of the range of the taxon in the region. If
+the flag --marks is defined, the cells will be marked with an "x" if the
+taxon is present in the region, or left empty otherwise. The last row of the
+table, "taxa", is the number of taxa present in each region.
+
+By default the table is a tab-delimited table. Use the flag --format to
+define a different format: "markdown" for a Markdown table, or "latex" for a
+LaTeX tabular environment.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var regionsFile string
+var marksFlag bool
+var threshold float64
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	table.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&regionsFile, "regions", "", "")
+	c.Flags().BoolVar(&marksFlag, "marks", false, "")
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if regionsFile == "" {
+		return c.UsageError("flag --regions required")
+	}
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name, nil, introduced.Options()...)
+	if err != nil {
+		return err
+	}
+	regs, err := readCollection(c.Stdin(), regionsFile, coll.Pixelation())
+	if err != nil {
+		return err
+	}
+
+	tab := regionTable(coll, regs)
+	write := func(w io.Writer) error {
+		return tab.Write(w)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+// RegionTable returns the table
+// of the taxa of a collection
+// by a set of regions.
+func regionTable(coll, regs *ranges.Collection) *table.Table {
+	regions := regs.TaxaBy(ranges.InputOrder)
+	header := make([]string, 0, len(regions)+2)
+	header = append(header, "taxon")
+	for _, r := range regions {
+		header = append(header, regs.VerbatimName(r))
+	}
+	header = append(header, "total")
+	tab := table.New(header...)
+
+	taxa := make([]int, len(regions))
+	for _, tax := range coll.Taxa() {
+		nm := tax
+		if verbatimFlag {
+			nm = coll.VerbatimName(tax)
+		}
+		row := make([]string, 0, len(header))
+		row = append(row, nm)
+
+		rng := coll.Range(tax)
+		var total int
+		for _, v := range rng {
+			if v >= threshold {
+				total++
+			}
+		}
+		for i, r := range regions {
+			n := inRegion(rng, regs.Range(r))
+			if n > 0 {
+				taxa[i]++
+			}
+			row = append(row, cell(n))
+		}
+		row = append(row, strconv.Itoa(total))
+		tab.Add(row...)
+	}
+
+	row := make([]string, 0, len(header))
+	row = append(row, "taxa")
+	for _, n := range taxa {
+		row = append(row, strconv.Itoa(n))
+	}
+	tab.Add(row...)
+	return tab
+}
+
+// InRegion returns the number of pixels of a range
+// in a region.
+func inRegion(rng, region map[int]float64) int {
+	var n int
+	for px, v := range rng {
+		if v < threshold {
+			continue
+		}
+		if _, ok := region[px]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Cell returns the content of a cell
+// with the indicated number of pixels.
+func cell(n int) string {
+	if !marksFlag {
+		return strconv.Itoa(n)
+	}
+	if n > 0 {
+		return "x"
+	}
+	return ""
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation, opts ...ranges.ReadOption) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
@@ -0,0 +1,436 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package report implements a command to write
+// a quality-control report
+// of a taxon range collection
+// as a self-contained HTML file.
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/plot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/render"
+)
+
+var Command = &command.Command{
+	Usage: `report [--quiet | -v | -vv] [--log-json]
+	[--timepix <time-pixelation>]
+	[--thumbnails <number>] [-c|--columns <value>]
+	[--json-summary <file>]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "write a quality-control report of a range collection",
+	Long: `
+Command report reads a geographic range file, and writes a quality-control
+report of the collection as a self-contained HTML file (all images are
+embedded in the file), so it can be shared with collaborators.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The report includes the following sections:
+
+	summary		the number of taxa, records, and pixels of the
+			collection
+	issues		the problems found in the collection (the same
+			problems reported by the command check)
+	plots		the distribution of the ages of the taxa, the range
+			size, and the number of records per taxon
+	taxa		a table with the type, age, number of pixels, number
+			of records, and area (in km²) of each taxon
+	maps		thumbnail maps of the range of each taxon
+
+By default the thumbnails are drawn over a gray globe. If the flag --timepix
+is defined, the pixels with a non-zero value in the time pixelation, at the
+stage closest to the age of each taxon, will be drawn in gray. The time
+pixelation must have the same pixelation as the range file.
+
+By default the thumbnails of the first 100 taxa (sorted by name) are drawn.
+Use the flag --thumbnails to define a different number of thumbnails (0 to
+omit the maps). By default each thumbnail will be 360 pixels wide, use the
+flag --columns, or -c, to define a different number of columns.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var timepixFile string
+var thumbFlag int
+var colsFlag int
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&timepixFile, "timepix", "", "")
+	c.Flags().IntVar(&thumbFlag, "thumbnails", 100, "")
+	c.Flags().IntVar(&colsFlag, "columns", 360, "")
+	c.Flags().IntVar(&colsFlag, "c", 360, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if colsFlag < 2 {
+		return c.UsageError(fmt.Sprintf("invalid --columns value %d", colsFlag))
+	}
+	if thumbFlag < 0 {
+		return c.UsageError(fmt.Sprintf("invalid --thumbnails value %d", thumbFlag))
+	}
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+	if name == "-" {
+		name = "stdin"
+	}
+
+	var tp *model.TimePix
+	if timepixFile != "" {
+		tp, err = readTimePix(timepixFile, coll)
+		if err != nil {
+			return err
+		}
+	}
+
+	r, err := newReport(name, coll, tp)
+	if err != nil {
+		return err
+	}
+
+	write := func(w io.Writer) error {
+		if err := reportTmpl.Execute(w, r); err != nil {
+			return fmt.Errorf("while writing report: %v", err)
+		}
+		return nil
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+// A Report is the data of a quality-control report.
+type report struct {
+	Name    string
+	Equator int
+
+	Taxa     int
+	Points   int
+	Ranges   int
+	Records  int
+	Pixels   int
+	MeanSize string
+	MaxRich  int
+
+	Issues []ranges.Issue
+	Plots  []template.HTML
+	Rows   []row
+	Thumbs []thumb
+	Omit   int
+}
+
+// A Row is a row of the taxa table.
+type row struct {
+	Taxon   string
+	Type    ranges.Type
+	Age     string
+	Pixels  int
+	Records string
+	Area    string
+	Issues  int
+}
+
+// A Thumb is a thumbnail map of a taxon.
+type thumb struct {
+	Taxon string
+	Age   string
+	Src   template.URL
+}
+
+func newReport(name string, coll *ranges.Collection, tp *model.TimePix) (*report, error) {
+	r := &report{
+		Name:    name,
+		Equator: coll.Pixelation().Equator(),
+		Issues:  coll.Validate(nil),
+	}
+
+	issues := make(map[string]int)
+	for _, i := range r.Issues {
+		issues[i.Taxon]++
+	}
+
+	rich := make(map[int]int)
+	ages := make(map[int64]int)
+	var sizes, recsTaxon []int
+	var sumSize int
+	taxa := coll.Taxa()
+	for _, tax := range taxa {
+		r.Taxa++
+		if coll.Type(tax) == ranges.Points {
+			r.Points++
+		} else {
+			r.Ranges++
+		}
+		rng := coll.Range(tax)
+		for px := range rng {
+			rich[px]++
+		}
+		sizes = append(sizes, len(rng))
+		sumSize += len(rng)
+		age := coll.Age(tax)
+		ages[age]++
+
+		rw := row{
+			Taxon:  tax,
+			Type:   coll.Type(tax),
+			Age:    strconv.FormatFloat(float64(age)/millionYears, 'f', 3, 64),
+			Pixels: len(rng),
+			Area:   strconv.FormatFloat(coll.Area(tax), 'f', 1, 64),
+			Issues: issues[tax],
+		}
+		if recs := coll.Records(tax); len(recs) > 0 {
+			var n int
+			for _, v := range recs {
+				n += v
+			}
+			r.Records += n
+			recsTaxon = append(recsTaxon, n)
+			rw.Records = strconv.Itoa(n)
+		}
+		r.Rows = append(r.Rows, rw)
+	}
+	r.Pixels = len(rich)
+	for _, n := range rich {
+		r.MaxRich = max(r.MaxRich, n)
+	}
+	if r.Taxa > 0 {
+		r.MeanSize = strconv.FormatFloat(float64(sumSize)/float64(r.Taxa), 'f', 1, 64)
+	}
+
+	ageList := make([]int64, 0, len(ages))
+	for a := range ages {
+		ageList = append(ageList, a)
+	}
+	slices.Sort(ageList)
+	ageBars := make([]plot.Bar, 0, len(ageList))
+	for _, a := range ageList {
+		ageBars = append(ageBars, plot.Bar{
+			Label: strconv.FormatFloat(float64(a)/millionYears, 'f', -1, 64),
+			Value: float64(ages[a]),
+		})
+	}
+
+	charts := []plot.Chart{
+		{Title: "Age of the taxa", XLabel: "age (Ma)", YLabel: "taxa", Bars: ageBars},
+		{Title: "Range size", XLabel: "pixels", YLabel: "taxa", Bars: plot.Log2Bins(sizes)},
+		{Title: "Records per taxon", XLabel: "records", YLabel: "taxa", Bars: plot.Log2Bins(recsTaxon)},
+	}
+	for _, ch := range charts {
+		var buf bytes.Buffer
+		if err := ch.WriteSVG(&buf); err != nil {
+			return nil, err
+		}
+		r.Plots = append(r.Plots, template.HTML(buf.String()))
+	}
+
+	for i, tax := range taxa {
+		if i >= thumbFlag {
+			r.Omit = len(taxa) - thumbFlag
+			break
+		}
+		src, err := thumbnail(coll, tax, tp)
+		if err != nil {
+			return nil, err
+		}
+		r.Thumbs = append(r.Thumbs, thumb{
+			Taxon: tax,
+			Age:   strconv.FormatFloat(float64(coll.Age(tax))/millionYears, 'f', -1, 64),
+			Src:   src,
+		})
+	}
+	return r, nil
+}
+
+// Background colors of the thumbnails.
+var (
+	globeColor = color.RGBA{225, 225, 225, 255}
+	landColor  = color.RGBA{190, 190, 190, 255}
+	seaColor   = color.RGBA{240, 240, 240, 255}
+)
+
+// Thumbnail returns a thumbnail map of a taxon
+// as a PNG data URL.
+func thumbnail(coll *ranges.Collection, tax string, tp *model.TimePix) (template.URL, error) {
+	pix := coll.Pixelation()
+	m := render.New(pix, render.Global(colsFlag))
+	m.UseGrid()
+
+	var stage map[int]int
+	if tp != nil {
+		stage = tp.Stage(tp.ClosestStageAge(coll.Age(tax)))
+	}
+	for id := 0; id < pix.Len(); id++ {
+		c := globeColor
+		if tp != nil {
+			c = seaColor
+			if stage[id] != 0 {
+				c = landColor
+			}
+		}
+		m.SetPixelColor(id, c)
+	}
+	m.SetRange(coll.Range(tax))
+
+	img, err := render.Draw(context.Background(), m)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("when encoding map of %q: %v", tax, err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+func readTimePix(name string, coll *ranges.Collection) (*model.TimePix, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tp, err := model.ReadTimePix(f, coll.Pixelation())
+	if err != nil {
+		return nil, fmt.Errorf("when reading file %q: %v", name, err)
+	}
+	return tp, nil
+}
+
+var reportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Range report: {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; }
+th { background: #eee; }
+td.num { text-align: right; }
+tr.issue td { background: #fde8e8; }
+.plots svg { margin: 0.5em; border: 1px solid #ddd; }
+.maps { display: flex; flex-wrap: wrap; }
+figure { margin: 0.5em; }
+figcaption { font-size: 0.9em; text-align: center; }
+figure img { border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>Range report: {{.Name}}</h1>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Pixelation (equator)</th><td class="num">{{.Equator}}</td></tr>
+<tr><th>Taxa</th><td class="num">{{.Taxa}}</td></tr>
+<tr><th>Taxa with points</th><td class="num">{{.Points}}</td></tr>
+<tr><th>Taxa with ranges</th><td class="num">{{.Ranges}}</td></tr>
+<tr><th>Records</th><td class="num">{{.Records}}</td></tr>
+<tr><th>Occupied pixels</th><td class="num">{{.Pixels}}</td></tr>
+<tr><th>Mean range size (pixels)</th><td class="num">{{.MeanSize}}</td></tr>
+<tr><th>Maximum richness</th><td class="num">{{.MaxRich}}</td></tr>
+</table>
+
+<h2>Issues</h2>
+{{if .Issues}}<table>
+<tr><th>Taxon</th><th>Issue</th><th>Pixel</th><th>Message</th></tr>
+{{range .Issues}}<tr><td>{{.Taxon}}</td><td>{{.Kind}}</td><td class="num">{{.Pixel}}</td><td>{{.Msg}}</td></tr>
+{{end}}</table>
+{{else}}<p>No issues found.</p>
+{{end}}
+<h2>Plots</h2>
+<div class="plots">
+{{range .Plots}}{{.}}{{end}}
+</div>
+
+<h2>Taxa</h2>
+<table>
+<tr><th>Taxon</th><th>Type</th><th>Age (Ma)</th><th>Pixels</th><th>Records</th><th>Area (km²)</th><th>Issues</th></tr>
+{{range .Rows}}<tr{{if .Issues}} class="issue"{{end}}><td>{{.Taxon}}</td><td>{{.Type}}</td><td class="num">{{.Age}}</td><td class="num">{{.Pixels}}</td><td class="num">{{.Records}}</td><td class="num">{{.Area}}</td><td class="num">{{.Issues}}</td></tr>
+{{end}}</table>
+{{if .Thumbs}}
+<h2>Maps</h2>
+<div class="maps">
+{{range .Thumbs}}<figure><img src="{{.Src}}" alt="{{.Taxon}}"><figcaption>{{.Taxon}} ({{.Age}} Ma)</figcaption></figure>
+{{end}}</div>
+{{if .Omit}}<p>{{.Omit}} taxa without map.</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
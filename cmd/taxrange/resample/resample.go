@@ -0,0 +1,369 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package resample implements a command to rotate
+// the points of a range distribution
+// to ages sampled from the age interval of each taxon.
+package resample
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/agefile"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/seed"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/rotate"
+)
+
+var Command = &command.Command{
+	Usage: `resample [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--model <motion-model> [--ages <file>]
+	[--replicates <number>] [--occupancy]
+	[--buffer <distance>] [--seed <value>]
+	[--verbatim] [--sort <order>] [--reproducible]
+	[--introduced <mode>] [--force]
+	-o|--output <prefix> [<rng-file>...]`,
+	Short: "rotate ranges to ages sampled from age intervals",
+	Long: `
+Command resample reads one or more geographic range files, with present
+locations, and rotates the ranges to ages sampled at random from the age
+interval of each taxon, repeating the procedure a number of times, to convey
+the uncertainty of the age of the taxa into their paleo-positions.
+
+One or more range files can be given as arguments. If no file is given, the
+range will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --model is required and defines a pixelated plate motion model. The
+model must be compatible with the pixelation defined by the range files.
+
+The age interval of each taxon is read from the range files (in the columns
+"min_age" and "max_age"). The flag --ages defines a file with the ages of the
+taxa, in the same format used by the command rotate, i.e. a TSV file without
+header, and the following columns:
+
+	- name	name of the taxon
+	- age	the age (in million years) of the taxon
+	- min	optional, the minimum age (in million years) of the taxon
+	- max	optional, the maximum age (in million years) of the taxon
+
+An age interval in the ages file replaces the age interval of the range
+files. A taxon with an age but without an age interval is always rotated to
+its age. Taxa without an age interval, or an age, and taxa that are not
+points ranges at the present, are not rotated, and are reported as warnings.
+
+The flag --replicates defines the number of replicates (by default 100). In
+each replicate, an age is sampled at random, with uniform probability, from
+the age interval of each taxon, and the range is rotated to that age. The flag
+--seed defines the seed of the random number generator (default 1), so the
+same seed always produces the same output. Use "random" to take the seed from
+the current time. The seed is recorded as a comment in the output files.
+
+By default a location without a rotation in the model at the sampled age is
+lost. Use the flag --buffer to define a distance (in km) to spread the
+presence of uncertain locations, as in the command rotate.
+
+The flag --output, or -o, is required, and it will be used as the prefix of
+the output files. By default, each replicate is written in a different file,
+with the prefix, the number of the replicate, and the extension ".tab". For
+example, with "-o rep" and 100 replicates, the output files will be
+"rep-000.tab" to "rep-099.tab". The age of each taxon in a replicate is the
+sampled age.
+
+If the flag --occupancy is defined, the replicates are summarized in a file
+for each stage of the plate motion model with at least a rotated taxon,
+with the prefix, the age of the stage (in million years), and the extension
+".tab". For example, with "-o occ" the file for the stage at 10 Ma will be
+"occ-10.000.tab". In each file, each taxon has a continuous range, in which
+the value of each pixel is proportional to the number of replicates in which
+the taxon is rotated into that pixel at that stage (the pixels occupied in
+most replicates will have a value of 1).
+
+Existing output files are not overwritten unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var modelFile string
+var agesFile string
+var output string
+var verbatimFlag bool
+var occupancyFlag bool
+var replicatesFlag int
+var bufferFlag float64
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	seed.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().BoolVar(&occupancyFlag, "occupancy", false, "")
+	c.Flags().StringVar(&modelFile, "model", "", "")
+	c.Flags().StringVar(&agesFile, "ages", "", "")
+	c.Flags().IntVar(&replicatesFlag, "replicates", 100, "")
+	c.Flags().Float64Var(&bufferFlag, "buffer", 0, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if modelFile == "" {
+		return c.UsageError("flag --model required")
+	}
+	if output == "" {
+		return c.UsageError("flag --output required")
+	}
+	if output == "-" {
+		return c.UsageError("flag --output: the standard output can not be used as a prefix")
+	}
+	if replicatesFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --replicates value %d", replicatesFlag))
+	}
+	if bufferFlag < 0 {
+		return c.UsageError(fmt.Sprintf("invalid --buffer value %.3f", bufferFlag))
+	}
+
+	log := logger.New(c.Stderr())
+
+	tot, err := readRotation(modelFile)
+	if err != nil {
+		return err
+	}
+
+	ages := make(map[string]int64)
+	intervals := make(map[string][2]int64)
+	if agesFile != "" {
+		ages, intervals, err = agefile.Read(agesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	coll := ranges.New(tot.Pixelation())
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		c, err := readCollection(c.Stdin(), a, tot.Pixelation())
+		if err != nil {
+			return err
+		}
+		for _, tax := range c.TaxaBy(ranges.InputOrder) {
+			if err := coll.Copy(c, tax); err != nil {
+				return err
+			}
+		}
+	}
+	if len(coll.Taxa()) == 0 {
+		return nil
+	}
+	log.Info("ranges read", "taxa", len(coll.Taxa()))
+
+	// the taxa to be rotated
+	// and its age interval
+	var taxa []string
+	for _, tax := range coll.TaxaBy(ranges.InputOrder) {
+		if coll.Type(tax) != ranges.Points || coll.Age(tax) != 0 {
+			log.Warn("taxon is not a present points range, ignored", "taxon", tax)
+			continue
+		}
+		nm := strings.ToLower(tax)
+		if iv, ok := intervals[nm]; ok {
+			coll.SetAgeInterval(tax, iv[0], iv[1])
+		} else if age, ok := ages[nm]; ok {
+			coll.SetAgeInterval(tax, age, age)
+		}
+		if !coll.HasAgeInterval(tax) {
+			log.Warn("taxon without age interval, ignored", "taxon", tax)
+			continue
+		}
+		taxa = append(taxa, tax)
+	}
+	if len(taxa) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	rnd := seed.Rand()
+
+	// rotated ranges of each taxon
+	// at each stage
+	rotated := make(map[string]map[int64]map[int]float64, len(taxa))
+	rotRange := func(tax string, age int64) (map[int]float64, error) {
+		st := tot.ClosestStageAge(age)
+		if rng, ok := rotated[tax][st]; ok {
+			return rng, nil
+		}
+		rng, err := rotate.BufferRange(ctx, []*model.Total{tot}, coll.Range(tax), age, bufferFlag)
+		if err != nil {
+			return nil, err
+		}
+		if rotated[tax] == nil {
+			rotated[tax] = make(map[int64]map[int]float64)
+		}
+		rotated[tax][st] = rng
+		return rng, nil
+	}
+
+	// number of replicates
+	// in which a taxon occupies a pixel
+	// at each stage
+	occupancy := make(map[int64]map[string]map[int]float64)
+
+	width := len(strconv.Itoa(replicatesFlag - 1))
+	for i := 0; i < replicatesFlag; i++ {
+		rep := ranges.New(coll.Pixelation())
+		for _, tax := range taxa {
+			min, max := coll.AgeInterval(tax)
+			age := min + rnd.Int63n(max-min+1)
+			rng, err := rotRange(tax, age)
+			if err != nil {
+				return err
+			}
+			if len(rng) == 0 {
+				log.Debug("empty range after rotation", "taxon", tax, "replicate", i, "age", float64(age)/millionYears)
+				continue
+			}
+
+			if occupancyFlag {
+				st := tot.ClosestStageAge(age)
+				if occupancy[st] == nil {
+					occupancy[st] = make(map[string]map[int]float64)
+				}
+				if occupancy[st][tax] == nil {
+					occupancy[st][tax] = make(map[int]float64)
+				}
+				for px := range rng {
+					occupancy[st][tax][px]++
+				}
+				continue
+			}
+			rep.SetPixels(coll.VerbatimName(tax), age, rng)
+			rep.SetAgeInterval(tax, min, max)
+		}
+		if occupancyFlag {
+			continue
+		}
+
+		name := fmt.Sprintf("%s-%0*d.tab", output, width, i)
+		if err := writeCollection(name, rep); err != nil {
+			return err
+		}
+		log.Info("replicate written", "replicate", i, "file", name, "taxa", len(rep.Taxa()))
+	}
+	if !occupancyFlag {
+		return nil
+	}
+
+	stages := make([]int64, 0, len(occupancy))
+	for st := range occupancy {
+		stages = append(stages, st)
+	}
+	slices.Sort(stages)
+	for _, st := range stages {
+		out := ranges.New(coll.Pixelation())
+		for _, tax := range taxa {
+			rng, ok := occupancy[st][tax]
+			if !ok {
+				continue
+			}
+			out.Set(coll.VerbatimName(tax), st, rng)
+			min, max := coll.AgeInterval(tax)
+			out.SetAgeInterval(tax, min, max)
+		}
+		out.AddComment(fmt.Sprintf("replicates: %d", replicatesFlag))
+
+		name := fmt.Sprintf("%s-%.3f.tab", output, float64(st)/millionYears)
+		if err := writeCollection(name, out); err != nil {
+			return err
+		}
+		log.Info("stage occupancy written", "stage", float64(st)/millionYears, "file", name, "taxa", len(out.Taxa()))
+	}
+	return nil
+}
+
+func writeCollection(name string, coll *ranges.Collection) error {
+	coll.KeepVerbatim(verbatimFlag)
+	coll.AddComment(seed.Comment())
+	outformat.Set(coll)
+	summary.Written(len(coll.Taxa()))
+	return files.WriteFile(name, coll.TSV)
+}
+
+func readRotation(name string) (*model.Total, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rot, err := model.ReadTotal(f, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("on file %q: %v", name, err)
+	}
+
+	return rot, nil
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+const millionYears = 1_000_000
@@ -0,0 +1,239 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package richness implements a command to calculate
+// the number of taxa in each pixel.
+package richness
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `richness [--quiet | -v | -vv] [--log-json]
+	[--per-area] [--threshold <value>] [--rarefy <value>]
+	[--json-summary <file>]
+	[--introduced <mode>]
+	[--force] [-o|--output <file>] [<rng-file>...]`,
+	Short: "calculate the number of taxa in each pixel",
+	Long: `
+Command richness reads one or more geographic range files, and calculates the
+number of taxa (richness) present in each pixel.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. All range files must use the same
+pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+By default a taxon is present in any pixel of its range. Use the flag
+--threshold to define the minimum density value for a pixel of a continuous
+range to be counted as a presence.
+
+The output is a tab-delimited table with the following columns:
+
+	pixel	the pixel ID
+	lat	the latitude of the pixel center
+	lon	the longitude of the pixel center
+	richness	the number of taxa in the pixel
+
+If the flag --per-area is defined, the following columns will be added:
+
+	area	the area of the pixel (in km²)
+	per-area	the number of taxa per million km²
+
+If the flag --rarefy is defined, the richness of each pixel will be rarefied
+to the indicated number of records, correcting the bias produced by differences
+in the sampling effort. Rarefaction requires the number of records of each
+taxon at each pixel, so it only uses point ranges with record counts (for
+example, the ones produced by the command imp.points). The following columns
+will be added:
+
+	records	the number of records in the pixel
+	rarefied	the expected number of taxa in a sample of the indicated
+			number of records, or "NA" if the pixel has fewer records
+
+Reporting richness per area reduces the bias produced by the small differences
+in the area of the pixels at different latitudes.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var perArea bool
+var rarefy int
+var threshold float64
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&perArea, "per-area", false, "")
+	c.Flags().Float64Var(&threshold, "threshold", 0, "")
+	c.Flags().IntVar(&rarefy, "rarefy", 0, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	var pix *earth.Pixelation
+	rich := make(map[int]int)
+	recs := make(map[int][]int)
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, pix)
+		if err != nil {
+			return err
+		}
+		pix = coll.Pixelation()
+
+		for _, tax := range coll.Taxa() {
+			for px, v := range coll.Range(tax) {
+				if v < threshold {
+					continue
+				}
+				rich[px]++
+			}
+			if rarefy <= 0 {
+				continue
+			}
+			for px, n := range coll.Records(tax) {
+				recs[px] = append(recs[px], n)
+			}
+		}
+	}
+
+	write := func(w io.Writer) error {
+		return writeRichness(w, pix, rich, recs)
+	}
+	return files.Output(c.Stdout(), output, write)
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+// MillionKm2 is used to report values
+// per million km².
+const millionKm2 = 1_000_000
+
+func writeRichness(w io.Writer, pix *earth.Pixelation, rich map[int]int, recs map[int][]int) error {
+	pixels := make([]int, 0, len(rich))
+	for px := range rich {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "pixel\tlat\tlon\trichness")
+	if perArea {
+		fmt.Fprintf(bw, "\tarea\tper-area")
+	}
+	if rarefy > 0 {
+		fmt.Fprintf(bw, "\trecords\trarefied")
+	}
+	fmt.Fprintf(bw, "\n")
+	for _, px := range pixels {
+		pt := pix.ID(px).Point()
+		fmt.Fprintf(bw, "%d\t%.6f\t%.6f\t%d", px, pt.Latitude(), pt.Longitude(), rich[px])
+		if perArea {
+			a := ranges.PixelArea(pix, px)
+			fmt.Fprintf(bw, "\t%.6f\t%.6f", a, float64(rich[px])/a*millionKm2)
+		}
+		if rarefy > 0 {
+			var n int
+			for _, r := range recs[px] {
+				n += r
+			}
+			if n < rarefy {
+				fmt.Fprintf(bw, "\t%d\tNA", n)
+			} else {
+				fmt.Fprintf(bw, "\t%d\t%.6f", n, rarefied(recs[px], rarefy))
+			}
+		}
+		fmt.Fprintf(bw, "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// Rarefied returns the expected number of taxa
+// in a sample of n records,
+// given the number of records of each taxon.
+func rarefied(recs []int, n int) float64 {
+	var tot int
+	for _, r := range recs {
+		tot += r
+	}
+
+	// log of the number of combinations
+	// of a sample of n records
+	lnComb := func(a int) float64 {
+		if a < n {
+			return math.Inf(-1)
+		}
+		x, _ := math.Lgamma(float64(a + 1))
+		y, _ := math.Lgamma(float64(a - n + 1))
+		return x - y
+	}
+
+	all := lnComb(tot)
+	var s float64
+	for _, r := range recs {
+		s += 1 - math.Exp(lnComb(tot-r)-all)
+	}
+	return s
+}
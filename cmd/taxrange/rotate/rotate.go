@@ -7,22 +7,39 @@
 package rotate
 
 import (
-	"encoding/csv"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/rand"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/earth"
 	"github.com/js-arias/earth/model"
 	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/agefile"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/seed"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+	"github.com/js-arias/ranges/rotate"
 )
 
 var Command = &command.Command{
-	Usage: `rotate --model <motion-model> --ages <file>
+	Usage: `rotate [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--model <motion-model>[,<motion-model>...] [--combine]
+	--ages <file> [--require-ages] [--buffer <distance>]
+	[--interval <mode>] [--samples <number>] [--seed <value>]
+	[--verbatim] [--append | --replace] [--force]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
 	[-o|--output <file>] [<rng-file>...]`,
 	Short: "rotate range using a plate motion model",
 	Long: `
@@ -33,32 +50,136 @@ indicated age.
 One or more range files can be given as arguments. If no file is given, the
 range will be read from the standard input.
 
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
 The flag --model is required and defines a pixelated plate motion model. The
 model must be compatible with the pixelation defined by the range files.
 
+Several plate motion models (or variants of a model) can be given to the flag
+--model, separated by commas, to convey the uncertainty of the
+paleo-positions. All models must use the same pixelation. By default, the
+ranges rotated with each model will be written in a different file, so the
+flag --output is required, and it will be used as the prefix of the output
+files, followed by the name of the model file (without extension), and the
+extension ".tab". For example, with "-o rot" and the models "a.tab,b.tab", the
+output files will be "rot-a.tab" and "rot-b.tab". If two models have the same
+file name (for example "v1/model.tab" and "v2/model.tab"), the command ends
+with an error, as both would be written in the same output file. If the flag
+--combine is defined, a single output will be produced, with a continuous
+range for each taxon, in which the value of each pixel is proportional to the
+number of models that rotate a location of the taxon into that pixel (the
+pixels supported by most models will have a value of 1).
+
 The flag --ages define the name of the file file with the ages for each taxon
 to be rotated. The age files is a TSV file without header, and the following
 columns:
 
 	- name	name of the taxon
 	- age	the age (in million years) of the taxon
+	- min	optional, the minimum age (in million years) of the taxon
+	- max	optional, the maximum age (in million years) of the taxon
+
+The minimum and maximum ages define the age interval of the taxon (i.e. the
+uncertainty of its age), both must be defined, and the age must be inside the
+interval. The age interval of a taxon is written in the output (in the columns
+"min_age" and "max_age"). If the ages file does not define an interval for a
+taxon, the age interval of the range file (if any) will be used.
+
+By default, the ranges are rotated to the age of the taxon. Use the flag
+--interval to define how the age interval of the taxa is used in the rotation:
+"none" (the default) rotates the range to the age of the taxon, "endpoints"
+rotates the range to the age, and to both endpoints of the age interval, and
+"sample" rotates the range to a number of ages sampled at random from the age
+interval (by default 10, use the flag --samples to define a different number).
+In both cases, the result is a continuous range, in which the value of each
+pixel is proportional to the number of rotations that move a location of the
+taxon into that pixel, and the age of the range is the age of the taxon. The
+flag --seed defines the seed of the random number generator used by the
+"sample" mode (default 1), so the same seed always produces the same output.
+Use "random" to take the seed from the current time. The seed is recorded as a
+comment in the output file. Taxa without an age interval are rotated to their
+age.
+
+Taxa without an age in the ages file are not rotated, and will be written
+with their present locations. Each of these taxa is reported as a warning.
+Use the flag --require-ages to make it an error. Taxa in the ages file that
+are not in the range files are also reported as warnings.
+
+By default, a location without a rotation in the model at the indicated age
+(for example, a location in a gap between plates), is lost, and if no
+location of a taxon is rotated, the taxon will be reported as a warning and
+it will not be written in the output. Use the flag --buffer to define a
+distance (in km) to spread the presence of uncertain locations: a location
+without a rotation, or at the edge of a plate (i.e. with a neighbor pixel
+without a rotation), will be rotated into the destinations of all the pixels
+at the given distance that have a rotation. A distance similar to the size of
+the pixels is usually enough to recover the locations at the edge of a plate.
 
 By default the output will be printed in the standard output. If the flag
 --output, or -o, is defined, the indicated file will be used as output. If the
 file exists, existing taxons will be replaced, and new taxon will be added to
-the indicated file.
+the indicated file (the same as using the flag --append). Use the flag
+--replace to discard the content of the file. The output file is only replaced
+after all the data was written, so if there is an error, the previous content
+of the file will be preserved.
+
+An output file named "-" is the standard output. With the flag --replace, an
+existing output file is not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      summary.Run(run),
 }
 
 var modelFile string
 var agesFile string
 var output string
+var appendFlag bool
+var replaceFlag bool
+var verbatimFlag bool
+var requireAges bool
+var combineFlag bool
+var bufferFlag float64
+var intervalFlag string
+var samplesFlag int
 
 func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	seed.SetFlags(c)
+	c.Flags().BoolVar(&appendFlag, "append", false, "")
+	c.Flags().BoolVar(&replaceFlag, "replace", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
 	c.Flags().StringVar(&modelFile, "model", "", "")
 	c.Flags().StringVar(&agesFile, "ages", "", "")
+	c.Flags().BoolVar(&requireAges, "require-ages", false, "")
+	c.Flags().BoolVar(&combineFlag, "combine", false, "")
+	c.Flags().Float64Var(&bufferFlag, "buffer", 0, "")
+	c.Flags().StringVar(&intervalFlag, "interval", "none", "")
+	c.Flags().IntVar(&samplesFlag, "samples", 10, "")
 	c.Flags().StringVar(&output, "output", "", "")
 	c.Flags().StringVar(&output, "o", "", "")
 }
@@ -67,16 +188,51 @@ func run(c *command.Command, args []string) error {
 	if modelFile == "" {
 		return c.UsageError("flag --model required")
 	}
+	if appendFlag && replaceFlag {
+		return c.UsageError("both --append and --replace flags defined")
+	}
 	if agesFile == "" {
 		return c.UsageError("flag --ages required")
 	}
+	if bufferFlag < 0 {
+		return c.UsageError(fmt.Sprintf("invalid --buffer value %.3f", bufferFlag))
+	}
+	intervalFlag = strings.ToLower(strings.TrimSpace(intervalFlag))
+	if intervalFlag != "none" && intervalFlag != "endpoints" && intervalFlag != "sample" {
+		return c.UsageError(fmt.Sprintf("invalid --interval value %q", intervalFlag))
+	}
+	if samplesFlag < 1 {
+		return c.UsageError(fmt.Sprintf("invalid --samples value %d", samplesFlag))
+	}
 
-	tot, err := readRotation(modelFile)
-	if err != nil {
-		return err
+	log := logger.New(c.Stderr())
+
+	models := strings.Split(modelFile, ",")
+	var outNames []string
+	if len(models) > 1 && !combineFlag {
+		var err error
+		outNames, err = modelOutputs(output, models)
+		if err != nil {
+			return c.UsageError(err.Error())
+		}
+	}
+	tots := make([]*model.Total, 0, len(models))
+	for _, m := range models {
+		tot, err := readRotation(m)
+		if err != nil {
+			return err
+		}
+		if len(tots) > 0 && tot.Pixelation().Equator() != tots[0].Pixelation().Equator() {
+			return fmt.Errorf("on file %q: invalid equator value %d, want %d", m, tot.Pixelation().Equator(), tots[0].Pixelation().Equator())
+		}
+		tots = append(tots, tot)
+	}
+	tot := tots[0]
+	if len(tots) > 1 && !combineFlag && files.IsStd(output) {
+		return c.UsageError("flag --output required with several models")
 	}
 
-	ages, err := readAges()
+	ages, intervals, err := agefile.Read(agesFile)
 	if err != nil {
 		return err
 	}
@@ -100,80 +256,243 @@ func run(c *command.Command, args []string) error {
 			rng := c.Range(nm)
 			for id := range rng {
 				pt := pix.ID(id).Point()
-				coll.Add(nm, age, pt.Latitude(), pt.Longitude())
+				coll.Add(c.VerbatimName(nm), age, pt.Latitude(), pt.Longitude())
+			}
+			if _, ok := intervals[strings.ToLower(nm)]; !ok && c.HasAgeInterval(nm) {
+				min, max := c.AgeInterval(nm)
+				coll.SetAgeInterval(nm, min, max)
 			}
 		}
 	}
 	if len(coll.Taxa()) == 0 {
 		return nil
 	}
+	for nm, iv := range intervals {
+		if coll.HasTaxon(nm) {
+			coll.SetAgeInterval(nm, iv[0], iv[1])
+		}
+	}
+	log.Info("ranges read", "taxa", len(coll.Taxa()))
 
-	rotColl, err := readOutColl(output, coll.Pixelation())
-	if err != nil {
-		return err
+	var noAge int
+	for _, tax := range coll.TaxaBy(ranges.InputOrder) {
+		if _, ok := ages[strings.ToLower(tax)]; ok || coll.Age(tax) != 0 {
+			continue
+		}
+		if requireAges {
+			return fmt.Errorf("taxon %q: undefined age in %q", tax, agesFile)
+		}
+		log.Warn("taxon without age, not rotated", "taxon", tax)
+		noAge++
+	}
+	var noRange int
+	for _, nm := range sortedKeys(ages) {
+		if !coll.HasTaxon(nm) {
+			log.Warn("taxon in ages file without range", "taxon", nm)
+			noRange++
+		}
 	}
+	log.Info("ages checked", "missing", noAge, "unused", noRange)
 
-	for _, tax := range coll.Taxa() {
-		rng := coll.Range(tax)
+	ctx := context.Background()
+	if len(tots) == 1 || combineFlag {
+		return writeRotated(ctx, c, log, output, coll, ages, tots)
+	}
 
-		age, ok := ages[strings.ToLower(tax)]
-		if !ok {
-			// store pixels with undefined rotations
-			rotColl.SetPixels(tax, coll.Age(tax), rng)
-			continue
+	// a file for each model
+	for i, m := range models {
+		name := outNames[i]
+		if err := writeRotated(ctx, c, log, name, coll, ages, tots[i:i+1]); err != nil {
+			return err
 		}
+		log.Info("model rotation written", "model", m, "file", name)
+	}
+	return nil
+}
 
-		// ignore taxa already rotated and warn the user
-		if a := coll.Age(tax); a != 0 {
-			fmt.Fprintf(c.Stderr(), "WARNING: taxon %q already rotated to age %.6f\n", tax, float64(a)/millionYears)
-			rotColl.SetPixels(tax, a, rng)
-			continue
+// ModelOutputs returns the name of the output file
+// of each plate motion model.
+// It returns an error
+// if two models have the same output file.
+func modelOutputs(output string, models []string) ([]string, error) {
+	names := make([]string, len(models))
+	for i, m := range models {
+		base := filepath.Base(m)
+		names[i] = fmt.Sprintf("%s-%s.tab", output, strings.TrimSuffix(base, filepath.Ext(base)))
+		for j := 0; j < i; j++ {
+			if names[j] == names[i] {
+				return nil, fmt.Errorf("models %q and %q: same output file %q", models[j], m, names[i])
+			}
 		}
+	}
+	return names, nil
+}
 
-		// store un-rotated pixels
-		if age == 0 {
-			rotColl.SetPixels(tax, 0, rng)
-			continue
+// WriteRotated writes the rotated ranges
+// in the indicated output file,
+// using one or more plate motion models.
+// If more than one model is used,
+// the models are combined.
+func writeRotated(ctx context.Context, c *command.Command, log *slog.Logger, output string, coll *ranges.Collection, ages map[string]int64, tots []*model.Total) error {
+	prev, err := readOutColl(output, coll.Pixelation())
+	if err != nil {
+		return err
+	}
+
+	// taxa in the output,
+	// the new rotations replace the previous ones
+	names := prev.TaxaBy(ranges.InputOrder)
+	var recs bool
+	for _, tax := range names {
+		if !coll.HasTaxon(tax) && len(prev.Records(tax)) > 0 {
+			recs = true
+		}
+	}
+	intervals := coll.HasAgeIntervals() || prev.HasAgeIntervals()
+	for _, tax := range coll.TaxaBy(ranges.InputOrder) {
+		if !prev.HasTaxon(tax) {
+			names = append(names, tax)
+		}
+	}
+	outformat.Sort(names, func(tax string) int64 {
+		if coll.HasTaxon(tax) {
+			return rotatedAge(coll, ages, tax)
+		}
+		return prev.Age(tax)
+	})
+
+	// each range is written as soon as it is rotated
+	write := func(w io.Writer) error {
+		tw := ranges.NewTSVWriter(w, coll.Pixelation())
+		tw.KeepVerbatim(verbatimFlag)
+		tw.SetRecords(recs)
+		tw.SetAgeIntervals(intervals)
+		tw.SetExtraColumns(prev.ExtraColumns())
+		outformat.SetWriter(tw)
+
+		var rnd *rand.Rand
+		if intervalFlag == "sample" {
+			rnd = seed.Rand()
+			tw.AddComment(seed.Comment())
 		}
 
-		rot := tot.Rotation(age)
-		n := make(map[int]float64, len(rng))
-		for px := range rng {
-			dst := rot[px]
-			for _, np := range dst {
-				n[np] = 1.0
+		for _, tax := range names {
+			if !coll.HasTaxon(tax) {
+				if err := tw.Append(prev, tax); err != nil {
+					return err
+				}
+				continue
+			}
+
+			rotColl := ranges.New(coll.Pixelation())
+			rng := coll.Range(tax)
+			age, ok := ages[strings.ToLower(tax)]
+			switch {
+			case !ok:
+				// store pixels with undefined rotations
+				rotColl.SetPixels(coll.VerbatimName(tax), coll.Age(tax), rng)
+			case coll.Age(tax) != 0:
+				// ignore taxa already rotated and warn the user
+				a := coll.Age(tax)
+				log.Warn("taxon already rotated", "taxon", tax, "age", float64(a)/millionYears)
+				rotColl.SetPixels(coll.VerbatimName(tax), a, rng)
+			case age == 0:
+				// store un-rotated pixels
+				rotColl.SetPixels(coll.VerbatimName(tax), 0, rng)
+			default:
+				rotAges := rotationAges(coll, tax, age, rnd)
+				ok, err := rotate.AgesTaxon(ctx, rotColl, coll, tax, age, rotAges, bufferFlag, tots...)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					log.Warn("empty range after rotation", "taxon", tax, "age", float64(age)/millionYears)
+
+					// keep the previous range
+					if prev.HasTaxon(tax) {
+						if err := tw.Append(prev, tax); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				log.Debug("taxon rotated", "taxon", tax, "age", float64(age)/millionYears, "rotations", len(rotAges), "pixels", len(rotColl.Range(tax)))
+			}
+			if coll.HasAgeInterval(tax) {
+				min, max := coll.AgeInterval(tax)
+				rotColl.SetAgeInterval(tax, min, max)
+			}
+			if err := tw.Append(rotColl, tax); err != nil {
+				return err
 			}
 		}
-		if len(n) == 0 {
-			fmt.Fprintf(c.Stderr(), "WARNING: taxon %q rotation to age %.6f: empty range\n", tax, float64(age)/millionYears)
-			continue
+		if err := tw.Flush(); err != nil {
+			return err
 		}
-		rotColl.SetPixels(tax, age, n)
+		summary.Written(tw.Len())
+		return nil
 	}
 
-	w := c.Stdout()
-	if output != "" {
-		f, err := os.Create(output)
-		if err != nil {
-			return err
+	if files.IsStd(output) {
+		return write(c.Stdout())
+	}
+	if replaceFlag {
+		return files.WriteFile(output, write)
+	}
+	return files.ReplaceFile(output, write)
+}
+
+// RotationAges returns the ages
+// used to rotate a taxon,
+// as defined by the --interval flag.
+func rotationAges(coll *ranges.Collection, tax string, age int64, rnd *rand.Rand) []int64 {
+	if !coll.HasAgeInterval(tax) {
+		return []int64{age}
+	}
+	min, max := coll.AgeInterval(tax)
+	switch intervalFlag {
+	case "endpoints":
+		ages := []int64{age}
+		if min != age {
+			ages = append(ages, min)
 		}
-		defer func() {
-			e := f.Close()
-			if e != nil && err == nil {
-				err = e
-			}
-		}()
-		w = f
+		if max != age {
+			ages = append(ages, max)
+		}
+		return ages
+	case "sample":
+		ages := make([]int64, samplesFlag)
+		for i := range ages {
+			ages[i] = min + rnd.Int63n(max-min+1)
+		}
+		return ages
 	}
-	if err := rotColl.TSV(w); err != nil {
-		return err
+	return []int64{age}
+}
+
+// RotatedAge returns the age of a taxon
+// in the output.
+func rotatedAge(coll *ranges.Collection, ages map[string]int64, tax string) int64 {
+	age, ok := ages[strings.ToLower(tax)]
+	if !ok || coll.Age(tax) != 0 {
+		return coll.Age(tax)
 	}
+	return age
+}
 
-	return nil
+// SortedKeys returns the sorted names
+// of the ages file.
+func sortedKeys(ages map[string]int64) []string {
+	keys := make([]string, 0, len(ages))
+	for k := range ages {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
 }
 
 func readRotation(name string) (*model.Total, error) {
-	f, err := os.Open(name)
+	f, err := files.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +508,7 @@ func readRotation(name string) (*model.Total, error) {
 
 func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
 	if name != "-" {
-		f, err := os.Open(name)
+		f, err := files.Open(name)
 		if err != nil {
 			return nil, err
 		}
@@ -199,66 +518,19 @@ func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Co
 		name = "stdin"
 	}
 
-	coll, err := ranges.ReadTSV(r, pix)
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
 	if err != nil {
 		return nil, fmt.Errorf("when reading %q: %v", name, err)
 	}
+	summary.Read(coll)
 
 	return coll, nil
 }
 
 const millionYears = 1_000_000
 
-func readAges() (map[string]int64, error) {
-	f, err := os.Open(agesFile)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	tab := csv.NewReader(f)
-	tab.Comma = '\t'
-	tab.Comment = '#'
-
-	fields := map[string]int{
-		"taxon": 0,
-		"age":   1,
-	}
-	ages := make(map[string]int64)
-	for {
-		row, err := tab.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-
-		ln, _ := tab.FieldPos(0)
-		if err != nil {
-			return nil, fmt.Errorf("%q: on row %d: %v", agesFile, ln, err)
-		}
-		if len(row) < len(fields) {
-			return nil, fmt.Errorf("%q: got %d rows, want %d", agesFile, len(row), len(fields))
-		}
-
-		ff := "taxon"
-		name := strings.ToLower(strings.Join(strings.Fields(row[fields[ff]]), " "))
-		if name == "" {
-			continue
-		}
-
-		ff = "age"
-		ageF, err := strconv.ParseFloat(row[fields[ff]], 64)
-		if err != nil {
-			return nil, fmt.Errorf("%q: on row %d: field %q: %v", agesFile, ln, ff, err)
-		}
-
-		age := int64(ageF * millionYears)
-		ages[name] = age
-	}
-	return ages, nil
-}
-
 func readOutColl(name string, pix *earth.Pixelation) (*ranges.Collection, error) {
-	if name == "" {
+	if files.IsStd(name) || replaceFlag {
 		return ranges.New(pix), nil
 	}
 
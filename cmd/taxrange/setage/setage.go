@@ -0,0 +1,247 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package setage implements a command to change
+// the age of the taxa in a range file.
+package setage
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/snapshot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `set-age [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--ages <file> [--allow-rotated] [--force] [--verbatim]
+	[--sort <order>] [--reproducible]
+	[--patch <file>] [-o|--output <file>] [<rng-file>]`,
+	Short: "change the age of the taxa in a range file",
+	Long: `
+Command set-age reads a geographic range file, and changes the age of the
+indicated taxa, keeping their ranges.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The flag --ages is required and defines the name of the file with the new age
+of each taxon. The ages file is a TSV file without header, and the following
+columns (the same format used by the command rotate):
+
+	- name	name of the taxon
+	- age	the age (in million years) of the taxon
+
+Taxa in the ages file that are not in the range file will be reported as
+warnings.
+
+The pixels of the ranges are not moved. As the pixels of a taxon with an age
+different from the present are assumed to be already rotated to that age,
+changing the age of such a taxon will produce wrong locations. Therefore, by
+default, it is an error to change the age of a taxon that is not at the
+present. Use the flag --allow-rotated to change the age anyway (for example,
+to fix an age set by mistake at import time, with the flag --age of the
+command imp.points). To move present locations to a past age use the command
+rotate.
+
+If the flag --patch is defined, the changes in the ages will be written as a
+patch into the indicated file, so they can be reverted with the command apply,
+using the flag --reverse.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var agesFile string
+var allowRotated bool
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	snapshot.SetFlags(c)
+	c.Flags().StringVar(&agesFile, "ages", "", "")
+	c.Flags().BoolVar(&allowRotated, "allow-rotated", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if agesFile == "" {
+		return c.UsageError("flag --ages required")
+	}
+	log := logger.New(c.Stderr())
+
+	name := "-"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), name)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Take(coll); err != nil {
+		return err
+	}
+
+	ages, err := readAges(agesFile)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range ages {
+		if !coll.HasTaxon(a.name) {
+			log.Warn("taxon not found", "taxon", a.name)
+			continue
+		}
+		prev := coll.Age(a.name)
+		if prev == a.age {
+			continue
+		}
+		if prev != 0 {
+			if !allowRotated {
+				return fmt.Errorf("taxon %q: already at age %.6f, use --allow-rotated to change it", a.name, float64(prev)/millionYears)
+			}
+			log.Warn("age of a rotated taxon changed", "taxon", a.name, "from", float64(prev)/millionYears, "to", float64(a.age)/millionYears)
+		}
+		coll.SetAge(a.name, a.age)
+		log.Debug("age changed", "taxon", a.name, "age", float64(a.age)/millionYears)
+	}
+
+	if err := snapshot.Write(coll); err != nil {
+		return err
+	}
+
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+// A TaxonAge is the age of a taxon
+// in the ages file.
+type taxonAge struct {
+	name string
+	age  int64
+}
+
+func readAges(name string) ([]taxonAge, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tab := csv.NewReader(f)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+
+	fields := map[string]int{
+		"taxon": 0,
+		"age":   1,
+	}
+	var ages []taxonAge
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		ln, _ := tab.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: %v", name, ln, err)
+		}
+		if len(row) < len(fields) {
+			return nil, fmt.Errorf("%q: got %d rows, want %d", name, len(row), len(fields))
+		}
+
+		ff := "taxon"
+		tax := strings.Join(strings.Fields(row[fields[ff]]), " ")
+		if tax == "" {
+			continue
+		}
+
+		ff = "age"
+		ageF, err := strconv.ParseFloat(row[fields[ff]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: on row %d: field %q: %v", name, ln, ff, err)
+		}
+		if ageF < 0 {
+			return nil, fmt.Errorf("%q: on row %d: field %q: invalid age %.6f", name, ln, ff, ageF)
+		}
+
+		ages = append(ages, taxonAge{
+			name: tax,
+			age:  int64(ageF * millionYears),
+		})
+	}
+	return ages, nil
+}
@@ -0,0 +1,328 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/render"
+)
+
+// A ShellCmd is a command of the shell.
+type shellCmd struct {
+	usage string
+	short string
+	run   func(s *session, args []string) error
+}
+
+// Commands are the commands of the shell.
+var commands map[string]shellCmd
+
+func init() {
+	commands = map[string]shellCmd{
+		"at": {
+			usage: "at <lat> <lon> | at pixel <id>",
+			short: "list the taxa present at a location",
+			run:   atCmd,
+		},
+		"exit": {
+			usage: "exit",
+			short: "exit the shell",
+			run:   quitCmd,
+		},
+		"files": {
+			usage: "files",
+			short: "list the loaded collections",
+			run:   filesCmd,
+		},
+		"help": {
+			usage: "help",
+			short: "print the list of commands",
+			run:   helpCmd,
+		},
+		"load": {
+			usage: "load [<name>=]<file>",
+			short: "load a range file",
+			run:   loadCmd,
+		},
+		"map": {
+			usage: "map <png-file> <taxon>",
+			short: "draw a quick map of the range of a taxon",
+			run:   mapCmd,
+		},
+		"nearest": {
+			usage: "nearest <lat> <lon> <taxon>",
+			short: "print the distance to the nearest pixel of a range",
+			run:   nearestCmd,
+		},
+		"pixel": {
+			usage: "pixel <lat> <lon>",
+			short: "print the pixel of a location",
+			run:   pixelCmd,
+		},
+		"quit": {
+			usage: "quit",
+			short: "exit the shell",
+			run:   quitCmd,
+		},
+		"stats": {
+			usage: "stats <taxon>",
+			short: "print the statistics of the range of a taxon",
+			run:   statsCmd,
+		},
+		"taxa": {
+			usage: "taxa [<text>]",
+			short: "list the taxa of the current collection",
+			run:   taxaCmd,
+		},
+		"use": {
+			usage: "use <name>",
+			short: "set the current collection",
+			run:   useCmd,
+		},
+	}
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+func atCmd(s *session, args []string) error {
+	coll, err := s.current()
+	if err != nil {
+		return err
+	}
+
+	var px int
+	if len(args) == 2 && strings.ToLower(args[0]) == "pixel" {
+		px, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid pixel %q: %v", args[1], err)
+		}
+		if px < 0 || px >= coll.Pixelation().Len() {
+			return fmt.Errorf("invalid pixel %d", px)
+		}
+	} else {
+		lat, lon, err := parseLocation(args)
+		if err != nil {
+			return err
+		}
+		px = coll.Pixelation().Pixel(lat, lon).ID()
+	}
+
+	taxa := coll.TaxaAt(px)
+	slices.Sort(taxa)
+	fmt.Fprintf(s.stdout, "taxon\ttype\tage\tpixel\tdensity\n")
+	for _, tax := range taxa {
+		age := float64(coll.Age(tax)) / millionYears
+		fmt.Fprintf(s.stdout, "%s\t%s\t%.6f\t%d\t%.6f\n", tax, coll.Type(tax), age, px, coll.Range(tax)[px])
+	}
+	return nil
+}
+
+func filesCmd(s *session, args []string) error {
+	fmt.Fprintf(s.stdout, "name\tequator\ttaxa\tcurrent\n")
+	for _, n := range s.names {
+		coll := s.colls[n]
+		cur := ""
+		if n == s.cur {
+			cur = "*"
+		}
+		fmt.Fprintf(s.stdout, "%s\t%d\t%d\t%s\n", n, coll.Pixelation().Equator(), len(coll.Taxa()), cur)
+	}
+	return nil
+}
+
+func helpCmd(s *session, args []string) error {
+	for _, n := range sortedCommands() {
+		cmd := commands[n]
+		fmt.Fprintf(s.stdout, "%s\n\t%s\n", cmd.usage, cmd.short)
+	}
+	return nil
+}
+
+func loadCmd(s *session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expecting a range file")
+	}
+	return s.load(args[0])
+}
+
+func mapCmd(s *session, args []string) error {
+	coll, err := s.current()
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.New("expecting image file and taxon name")
+	}
+	tax, err := taxonName(coll, args[1:])
+	if err != nil {
+		return err
+	}
+	return writeMap(args[0], coll, tax)
+}
+
+func nearestCmd(s *session, args []string) error {
+	coll, err := s.current()
+	if err != nil {
+		return err
+	}
+	if len(args) < 3 {
+		return errors.New("expecting location and taxon name")
+	}
+	lat, lon, err := parseLocation(args[:2])
+	if err != nil {
+		return err
+	}
+	tax, err := taxonName(coll, args[2:])
+	if err != nil {
+		return err
+	}
+
+	px, dist := coll.Nearest(tax, lat, lon)
+	if px < 0 {
+		return fmt.Errorf("taxon %q: empty range", tax)
+	}
+	pt := coll.Pixelation().ID(px).Point()
+	fmt.Fprintf(s.stdout, "taxon\tpixel\tlatitude\tlongitude\tdistance\n")
+	fmt.Fprintf(s.stdout, "%s\t%d\t%.6f\t%.6f\t%.3f\n", tax, px, pt.Latitude(), pt.Longitude(), dist)
+	return nil
+}
+
+func pixelCmd(s *session, args []string) error {
+	coll, err := s.current()
+	if err != nil {
+		return err
+	}
+	lat, lon, err := parseLocation(args)
+	if err != nil {
+		return err
+	}
+
+	pix := coll.Pixelation()
+	px := pix.Pixel(lat, lon)
+	pt := px.Point()
+	fmt.Fprintf(s.stdout, "pixel\tlatitude\tlongitude\tarea\n")
+	fmt.Fprintf(s.stdout, "%d\t%.6f\t%.6f\t%.3f\n", px.ID(), pt.Latitude(), pt.Longitude(), ranges.PixelArea(pix, px.ID()))
+	return nil
+}
+
+func quitCmd(s *session, args []string) error {
+	return errQuit
+}
+
+func statsCmd(s *session, args []string) error {
+	coll, err := s.current()
+	if err != nil {
+		return err
+	}
+	tax, err := taxonName(coll, args)
+	if err != nil {
+		return err
+	}
+
+	pix := coll.Pixelation()
+	rng := coll.Range(tax)
+	var recs int
+	for _, n := range coll.Records(tax) {
+		recs += n
+	}
+
+	w := s.stdout
+	fmt.Fprintf(w, "taxon\t%s\n", tax)
+	fmt.Fprintf(w, "type\t%s\n", coll.Type(tax))
+	fmt.Fprintf(w, "age\t%.6f\n", float64(coll.Age(tax))/millionYears)
+	fmt.Fprintf(w, "pixels\t%d\n", len(rng))
+	fmt.Fprintf(w, "area\t%.3f\n", coll.Area(tax))
+	if recs > 0 {
+		fmt.Fprintf(w, "records\t%d\n", recs)
+	}
+	if box, ok := coll.BoundingBox(tax); ok {
+		fmt.Fprintf(w, "min-lat\t%.6f\n", box.MinLat)
+		fmt.Fprintf(w, "max-lat\t%.6f\n", box.MaxLat)
+		fmt.Fprintf(w, "min-lon\t%.6f\n", box.MinLon)
+		fmt.Fprintf(w, "max-lon\t%.6f\n", box.MaxLon)
+	}
+	if ct, ok := ranges.Centroid(pix, rng); ok {
+		fmt.Fprintf(w, "centroid\t%.6f, %.6f\n", ct.Latitude(), ct.Longitude())
+	}
+	return nil
+}
+
+func taxaCmd(s *session, args []string) error {
+	coll, err := s.current()
+	if err != nil {
+		return err
+	}
+
+	text := strings.ToLower(strings.Join(args, " "))
+	fmt.Fprintf(s.stdout, "taxon\ttype\tage\tpixels\n")
+	for _, tax := range coll.Taxa() {
+		if text != "" && !strings.Contains(strings.ToLower(tax), text) {
+			continue
+		}
+		age := float64(coll.Age(tax)) / millionYears
+		fmt.Fprintf(s.stdout, "%s\t%s\t%.6f\t%d\n", tax, coll.Type(tax), age, len(coll.Range(tax)))
+	}
+	return nil
+}
+
+func useCmd(s *session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expecting collection name")
+	}
+	if _, ok := s.colls[args[0]]; !ok {
+		return fmt.Errorf("collection %q not loaded", args[0])
+	}
+	s.cur = args[0]
+	return nil
+}
+
+// ParseLocation returns the latitude and longitude
+// from the arguments of a command.
+func parseLocation(args []string) (lat, lon float64, err error) {
+	if len(args) != 2 {
+		return 0, 0, errors.New("expecting latitude and longitude")
+	}
+	lat, err = strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude %q: %v", args[0], err)
+	}
+	if lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("invalid latitude %.6f", lat)
+	}
+	lon, err = strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude %q: %v", args[1], err)
+	}
+	if lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("invalid longitude %.6f", lon)
+	}
+	return lat, lon, nil
+}
+
+// MapCols is the number of columns
+// of a quick map.
+const mapCols = 1800
+
+// WriteMap writes a quick map
+// of the range of a taxon.
+func writeMap(name string, coll *ranges.Collection, tax string) error {
+	m := render.New(coll.Pixelation(), render.Global(mapCols))
+	m.UseGrid()
+	m.SetRange(coll.Range(tax))
+	return files.WriteFile(name, func(w io.Writer) error {
+		return render.EncodePNG(context.Background(), w, m)
+	})
+}
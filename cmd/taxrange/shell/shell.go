@@ -0,0 +1,233 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package shell implements an interactive shell
+// to explore the ranges of one or more range files.
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `shell [--quiet | -v | -vv] [--log-json]
+	[--no-prompt] [--introduced <mode>]
+	[--json-summary <file>] [--force]
+	[[<name>=]<rng-file>...]`,
+	Short: "an interactive shell to explore range files",
+	Long: `
+Command shell starts an interactive shell to explore the ranges of one or
+more range files. As the range files are read only once, the shell avoids the
+overhead of reading and parsing the files each time a question is made with a
+separate command.
+
+The arguments of the command are the range files that will be loaded when the
+shell starts. The last loaded file will be the current collection. A name for
+each collection can be defined in the form <name>=<rng-file>, if no name is
+given, the name of the file will be used as the name of the collection.
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The commands are read from the standard input, one command per line. Empty
+lines, and lines starting with '#' are ignored. By default a prompt is printed
+before reading each command. Use the flag --no-prompt to omit the prompt (for
+example, when the commands are read from a file). The output of the commands
+is printed as tab-delimited tables in the standard output, and errors are
+printed in the standard error, without stopping the shell.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The shell commands are:
+
+	at <lat> <lon>		list the taxa present at a location
+	at pixel <id>		list the taxa present at a pixel
+	files			list the loaded collections
+	help			print the list of commands
+	load [<name>=]<file>	load a range file
+	map <png-file> <taxon>	draw a quick map of the range of a taxon
+	nearest <lat> <lon> <taxon>
+				print the distance (in km) from a location to
+				the nearest pixel in the range of a taxon
+	pixel <lat> <lon>	print the pixel of a location
+	quit			exit the shell (also "exit")
+	stats <taxon>		print the statistics of the range of a taxon
+	taxa [<text>]		list the taxa of the current collection (or
+				only the taxa with names that contain the
+				indicated text)
+	use <name>		set the current collection
+
+Quick maps are drawn using a plate carrée (equirectangular) projection, 1800
+pixels wide, without background. An existing image file is not overwritten,
+unless the flag --force is defined. Use the command map for more elaborated
+maps.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var noPrompt bool
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().BoolVar(&noPrompt, "no-prompt", false, "")
+}
+
+// A Session is the state of the shell.
+type session struct {
+	colls map[string]*ranges.Collection
+	names []string
+	cur   string
+
+	stdout io.Writer
+}
+
+// ErrQuit is returned
+// when the shell should finish.
+var errQuit = errors.New("quit")
+
+func run(c *command.Command, args []string) error {
+	s := &session{
+		colls:  make(map[string]*ranges.Collection),
+		stdout: c.Stdout(),
+	}
+	for _, a := range args {
+		if err := s.load(a); err != nil {
+			return err
+		}
+	}
+
+	in := bufio.NewScanner(c.Stdin())
+	for {
+		if !noPrompt {
+			fmt.Fprintf(c.Stdout(), "%s> ", s.cur)
+		}
+		if !in.Scan() {
+			break
+		}
+		ln := strings.TrimSpace(in.Text())
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		err := s.exec(ln)
+		if errors.Is(err, errQuit) {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(c.Stderr(), "%v\n", err)
+		}
+	}
+	if !noPrompt {
+		fmt.Fprintf(c.Stdout(), "\n")
+	}
+	return in.Err()
+}
+
+// Exec executes a command line.
+func (s *session) exec(ln string) error {
+	args := strings.Fields(ln)
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q: use \"help\" for a list of commands", args[0])
+	}
+	if err := cmd.run(s, args[1:]); err != nil {
+		if errors.Is(err, errQuit) {
+			return err
+		}
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// Load reads a range file,
+// and sets it as the current collection.
+func (s *session) load(arg string) error {
+	name, file, ok := strings.Cut(arg, "=")
+	if !ok {
+		name, file = filepath.Base(arg), arg
+	}
+	coll, err := readCollection(file)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.colls[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.colls[name] = coll
+	s.cur = name
+	return nil
+}
+
+// Current returns the current collection.
+func (s *session) current() (*ranges.Collection, error) {
+	coll, ok := s.colls[s.cur]
+	if !ok {
+		return nil, errors.New("no collection loaded: use \"load\"")
+	}
+	return coll, nil
+}
+
+// TaxonName returns the name of a taxon
+// from the arguments of a command.
+func taxonName(coll *ranges.Collection, args []string) (string, error) {
+	name := strings.Join(args, " ")
+	if name == "" {
+		return "", errors.New("expecting taxon name")
+	}
+	if !coll.HasTaxon(name) {
+		return "", fmt.Errorf("taxon %q not in collection", name)
+	}
+	return name, nil
+}
+
+func readCollection(name string) (*ranges.Collection, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coll, err := ranges.ReadTSV(f, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
+
+// SortedCommands returns the names of the shell commands
+// in alphabetical order.
+func sortedCommands() []string {
+	ls := make([]string, 0, len(commands))
+	for n := range commands {
+		ls = append(ls, n)
+	}
+	slices.Sort(ls)
+	return ls
+}
@@ -0,0 +1,244 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package shift implements a command to measure
+// the changes of the ranges of the taxa
+// across a series of time windows.
+package shift
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `shift [--quiet | -v | -vv] [--log-json]
+	[--taxon <name>] [--introduced <mode>]
+	[--json-summary <file>] [--force]
+	[<label>=]<rng-file> [<label>=]<rng-file>...`,
+	Short: "measure range shifts across time windows",
+	Long: `
+Command shift reads a series of geographic range files, each one with the
+ranges of the taxa in a time window (for example, a decade), and reports, for
+each taxon, the shift of the centroid of its range, and the expansion or
+contraction of its range, between consecutive time windows. It is useful to
+analyze the changes in the distribution of the taxa in recent times, for
+example, in response to climate change.
+
+The arguments of the command are the range files, in chronological order. At
+least two files are required, and all range files must use the same
+pixelation. A label for the time window of each file can be defined in the
+form <label>=<rng-file>, if no label is given, the name of the file will be
+used as label.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The range files for each time window can be built with the command
+imp.points, using the flags --min-year and --max-year. For example, to build
+the ranges for each decade and then measure the range shifts:
+
+	for d in 1980 1990 2000 2010; do
+		taxrange imp.points -f darwin --min-year $d --max-year $((d+9)) \
+			-o occ-$d.tab occurrences.tsv
+	done
+	taxrange shift 1980s=occ-1980.tab 1990s=occ-1990.tab \
+		2000s=occ-2000.tab 2010s=occ-2010.tab
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+By default all the taxa in the files are reported. Use the flag --taxon to
+report only the indicated taxon.
+
+The output is a tab-delimited table printed in the standard output, with the
+following columns:
+
+	window		the label of the time window
+	taxon		the name of the taxon
+	pixels		the number of pixels of the range in the time window
+	area		the area of the range (in km²)
+	latitude	the latitude of the centroid of the range
+	longitude	the longitude of the centroid of the range
+	shift		the distance (in km) between the centroid of the
+			range and the centroid in the previous window
+	bearing		the direction (in degrees from the north) of the
+			centroid shift
+	gained		the number of pixels not present in the previous
+			window
+	lost		the number of pixels of the previous window not
+			present in the window
+	change		the relative change of the range area, in relation to
+			the previous window (positive values for an
+			expansion, negative values for a contraction)
+
+The centroid is the mean direction of the pixels of the range, weighted by the
+value of each pixel. If the taxon is not present in the previous window (or
+it is the first window), the comparison columns will be empty.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var taxonFlag string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&taxonFlag, "taxon", "", "")
+}
+
+// A Window is the collection of ranges
+// of a time window.
+type window struct {
+	label string
+	coll  *ranges.Collection
+}
+
+func run(c *command.Command, args []string) error {
+	if len(args) < 2 {
+		return c.UsageError("expecting at least two range files")
+	}
+
+	var pix *earth.Pixelation
+	var windows []window
+	for _, a := range args {
+		label, file, ok := strings.Cut(a, "=")
+		if !ok {
+			label, file = filepath.Base(a), a
+		}
+		coll, err := readCollection(file, pix)
+		if err != nil {
+			return err
+		}
+		if pix == nil {
+			pix = coll.Pixelation()
+		}
+		windows = append(windows, window{label: label, coll: coll})
+	}
+
+	var taxa []string
+	seen := make(map[string]bool)
+	for _, w := range windows {
+		for _, tax := range w.coll.Taxa() {
+			if seen[tax] {
+				continue
+			}
+			seen[tax] = true
+			taxa = append(taxa, tax)
+		}
+	}
+	slices.Sort(taxa)
+	if taxonFlag != "" {
+		name := strings.Join(strings.Fields(taxonFlag), " ")
+		var ls []string
+		for _, tax := range taxa {
+			if strings.EqualFold(tax, name) {
+				ls = append(ls, tax)
+			}
+		}
+		taxa = ls
+	}
+
+	fmt.Fprintf(c.Stdout(), "window\ttaxon\tpixels\tarea\tlatitude\tlongitude\tshift\tbearing\tgained\tlost\tchange\n")
+	for i, w := range windows {
+		for _, tax := range taxa {
+			rng := w.coll.Range(tax)
+			if len(rng) == 0 {
+				continue
+			}
+			area := w.coll.Area(tax)
+			row := []string{
+				w.label,
+				tax,
+				strconv.Itoa(len(rng)),
+				strconv.FormatFloat(area, 'f', 3, 64),
+				"",
+				"",
+				"",
+				"",
+				"",
+				"",
+				"",
+			}
+			ct, ok := ranges.Centroid(pix, rng)
+			if ok {
+				row[4] = strconv.FormatFloat(ct.Latitude(), 'f', 6, 64)
+				row[5] = strconv.FormatFloat(ct.Longitude(), 'f', 6, 64)
+			}
+
+			var prev map[int]float64
+			var prevArea float64
+			if i > 0 {
+				prev = windows[i-1].coll.Range(tax)
+				prevArea = windows[i-1].coll.Area(tax)
+			}
+			if len(prev) > 0 {
+				if pc, pok := ranges.Centroid(pix, prev); ok && pok {
+					d := earth.Distance(pc, ct) * float64(earth.Radius) / 1000
+					row[6] = strconv.FormatFloat(d, 'f', 3, 64)
+					if d > 0 {
+						b := earth.ToDegree(earth.Bearing(pc, ct))
+						if b < 0 {
+							b += 360
+						}
+						row[7] = strconv.FormatFloat(b, 'f', 3, 64)
+					}
+				}
+
+				var gained, lost int
+				for px := range rng {
+					if _, ok := prev[px]; !ok {
+						gained++
+					}
+				}
+				for px := range prev {
+					if _, ok := rng[px]; !ok {
+						lost++
+					}
+				}
+				row[8] = strconv.Itoa(gained)
+				row[9] = strconv.Itoa(lost)
+				row[10] = strconv.FormatFloat(area/prevArea-1, 'f', 6, 64)
+			}
+			fmt.Fprintf(c.Stdout(), "%s\n", strings.Join(row, "\t"))
+		}
+	}
+	return nil
+}
+
+func readCollection(name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	f, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coll, err := ranges.ReadTSV(f, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
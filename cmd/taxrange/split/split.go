@@ -0,0 +1,180 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package split implements a command to write
+// the ranges of a collection
+// in a file for each taxon,
+// or for each age.
+package split
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `split [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	[--by <value>] [--verbatim]
+	[--sort <order>] [--reproducible]
+	[--introduced <mode>]
+	[--force] -o|--output <prefix> [<rng-file>]`,
+	Short: "write a range file for each taxon",
+	Long: `
+Command split reads a geographic range file, and writes the range of each
+taxon in a different file. The command cat does the reverse operation.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The flag --output, or -o, is required and defines the prefix of the output
+files. By default, the name of each file will be the prefix, followed by the
+name of the taxon (with spaces replaced by underscores), and the extension
+".tab", for example "out-Brontostoma_discus.tab".
+
+Existing output files are not overwritten, unless the flag --force is defined.
+
+The flag --by defines how the ranges are split. Valid values are:
+
+	taxon	a file for each taxon (the default)
+	age	a file for each age, with all the taxa of that age. The name
+		of each file will be the prefix, followed by the age (in
+		million years), for example "out-230.000.tab"
+
+Record counts, and any other column of the input file, are preserved. The
+output files are only replaced after all the data was written, so if there is
+an error, the previous content of the files will be preserved.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var byFlag string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&byFlag, "by", "taxon", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	if output == "" {
+		return c.UsageError("flag --output required")
+	}
+	if output == "-" {
+		return c.UsageError("flag --output: the standard output can not be used as a prefix")
+	}
+	byFlag = strings.ToLower(byFlag)
+	if byFlag != "taxon" && byFlag != "age" {
+		return c.UsageError(fmt.Sprintf("invalid --by value %q", byFlag))
+	}
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), input)
+	if err != nil {
+		return err
+	}
+
+	// taxa in each output file
+	groups := make(map[string][]string)
+	for _, tax := range coll.Taxa() {
+		name := fmt.Sprintf("%s-%s.tab", output, strings.Join(strings.Fields(tax), "_"))
+		if byFlag == "age" {
+			name = fmt.Sprintf("%s-%.3f.tab", output, float64(coll.Age(tax))/millionYears)
+		}
+		groups[name] = append(groups[name], tax)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		out := ranges.New(coll.Pixelation())
+		for _, tax := range groups[name] {
+			if err := out.Copy(coll, tax); err != nil {
+				return err
+			}
+		}
+		out.KeepVerbatim(verbatimFlag)
+		outformat.Set(out)
+		summary.Written(len(out.Taxa()))
+		if err := files.WriteFile(name, out.TSV); err != nil {
+			return err
+		}
+		log.Info("file written", "file", name, "taxa", len(groups[name]))
+	}
+	return nil
+}
+
+func readCollection(r io.Reader, name string) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
@@ -0,0 +1,213 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package strat implements a command to draw
+// a stratigraphic range chart
+// of the taxa of a collection.
+package strat
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/plot"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `strat [--quiet | -v | -vv] [--log-json]
+	[--order <order>] [--title <text>] [--verbatim]
+	[--json-summary <file>]
+	[--introduced <mode>]
+	[--force] -o|--output <svg-file> [<rng-file>...]`,
+	Short: "draw a stratigraphic range chart",
+	Long: `
+Command strat reads one or more geographic range files, with the ranges of
+taxa at different ages (for example, a file with the fossil records of each
+stage), and draws a stratigraphic range chart (a range-through chart) of the
+taxa, as an SVG image.
+
+One or more range files can be given as arguments. If no file is given, the
+ranges will be read from the standard input. All range files must use the same
+pixelation.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
+The chart has a row for each taxon, with a line from the oldest to the
+youngest age in which the taxon is found, and a dot for each age. Time runs
+from the left (the oldest age) to the right (the youngest age), in million
+years.
+
+By default the taxa are sorted by the oldest age (the first appearance), from
+the oldest, then by the youngest age (the last appearance), and then by name.
+Use the flag --order to define a different order: "first" (the default), or
+"name" to sort the taxa by name.
+
+By default the title of the chart is "Stratigraphic ranges". Use the flag
+--title to define a different title.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input files.
+
+The flag --output, or -o, is required and defines the name of the output
+image. An output file named "-" is the standard output. An existing output
+file is not overwritten, unless the flag --force is defined.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var orderFlag string
+var titleFlag string
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&orderFlag, "order", "first", "")
+	c.Flags().StringVar(&titleFlag, "title", "Stratigraphic ranges", "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+// MillionYears is used to transform age in years
+// to million years.
+const millionYears = 1_000_000
+
+// A Taxon stores the ages
+// in which a taxon is found.
+type taxon struct {
+	name     string
+	verbatim string
+	ages     []int64
+}
+
+func run(c *command.Command, args []string) error {
+	if output == "" {
+		return c.UsageError("flag --output required")
+	}
+	orderFlag = strings.ToLower(strings.TrimSpace(orderFlag))
+	if orderFlag != "first" && orderFlag != "name" {
+		return c.UsageError(fmt.Sprintf("invalid --order value %q", orderFlag))
+	}
+
+	if len(args) == 0 {
+		args = append(args, "-")
+	}
+
+	var pix *earth.Pixelation
+	taxa := make(map[string]*taxon)
+	for _, a := range args {
+		coll, err := readCollection(c.Stdin(), a, pix)
+		if err != nil {
+			return err
+		}
+		pix = coll.Pixelation()
+
+		for _, tax := range coll.Taxa() {
+			t, ok := taxa[tax]
+			if !ok {
+				t = &taxon{
+					name:     tax,
+					verbatim: coll.VerbatimName(tax),
+				}
+				taxa[tax] = t
+			}
+			if age := coll.Age(tax); !slices.Contains(t.ages, age) {
+				t.ages = append(t.ages, age)
+			}
+		}
+	}
+
+	ls := make([]*taxon, 0, len(taxa))
+	for _, t := range taxa {
+		slices.Sort(t.ages)
+		ls = append(ls, t)
+	}
+	slices.SortFunc(ls, func(a, b *taxon) int {
+		if orderFlag == "first" {
+			if c := compareAge(a.ages[len(a.ages)-1], b.ages[len(b.ages)-1]); c != 0 {
+				return c
+			}
+			if c := compareAge(a.ages[0], b.ages[0]); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.name, b.name)
+	})
+
+	ch := plot.RangeChart{
+		Title:  titleFlag,
+		XLabel: "age (Ma)",
+	}
+	for _, t := range ls {
+		nm := t.name
+		if verbatimFlag {
+			nm = t.verbatim
+		}
+		s := plot.Span{Label: nm}
+		for _, a := range t.ages {
+			s.Ages = append(s.Ages, float64(a)/millionYears)
+		}
+		ch.Spans = append(ch.Spans, s)
+	}
+
+	return files.Output(c.Stdout(), output, ch.WriteSVG)
+}
+
+// CompareAge compares two ages
+// so the oldest age is sorted first.
+func compareAge(a, b int64) int {
+	if a > b {
+		return -1
+	}
+	if a < b {
+		return 1
+	}
+	return 0
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix, introduced.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+	return coll, nil
+}
@@ -9,14 +9,20 @@ package taxa
 import (
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/js-arias/command"
 	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/introduced"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
 )
 
 var Command = &command.Command{
-	Usage: "taxa [--count] [<rng-file>...]",
+	Usage: `taxa [--quiet | -v | -vv] [--log-json]
+	[--count] [--per-area] [--introduced <mode>]
+	[--json-summary <file>] [--force]
+	[<rng-file>...]`,
 	Short: "prints the list of taxa with distribution ranges",
 	Long: `
 Command taxa reads one or more geographic range files and prints the list of
@@ -25,17 +31,37 @@ taxa with a defined distribution range in each one of them.
 One or more range files can be given as arguments. If no file is given, the
 ranges will be read from the standard input.
 
+Input files can also be read from an URL (see "taxrange help urls").
+
+Use the flag --introduced to filter the pixels of introduced populations (see
+"taxrange help introduced").
+
 If the flag --count is defined, the type of distribution map, and the number of
-pixels for each taxon will be given.
+pixels for each taxon will be given. If the flag --per-area is defined with
+--count, the area (in km²) occupied by the pixels of each taxon will be given.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages, or -vv to
+report debug messages. If the flag --log-json is defined, messages will be
+written as JSON lines.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
 	`,
 	SetFlags: setFlags,
-	Run:      run,
+	Run:      summary.Run(run),
 }
 
 var countFlag bool
+var perArea bool
 
 func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	introduced.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
 	c.Flags().BoolVar(&countFlag, "count", false, "")
+	c.Flags().BoolVar(&perArea, "per-area", false, "")
 }
 
 func run(c *command.Command, args []string) error {
@@ -55,7 +81,7 @@ func run(c *command.Command, args []string) error {
 
 func printList(r io.Reader, w io.Writer, name string) error {
 	if name != "-" {
-		f, err := os.Open(name)
+		f, err := files.Open(name)
 		if err != nil {
 			return err
 		}
@@ -65,10 +91,11 @@ func printList(r io.Reader, w io.Writer, name string) error {
 		name = "stdin"
 	}
 
-	coll, err := ranges.ReadTSV(r, nil)
+	coll, err := ranges.ReadTSV(r, nil, introduced.Options()...)
 	if err != nil {
 		return fmt.Errorf("when reading %q: %v", name, err)
 	}
+	summary.Read(coll)
 
 	fmt.Fprintf(w, "%s:\n", name)
 	ls := coll.Taxa()
@@ -78,6 +105,9 @@ func printList(r io.Reader, w io.Writer, name string) error {
 			rng := coll.Range(tax)
 			tp := coll.Type(tax)
 			fmt.Fprintf(w, "\t%s\t%d", tp, len(rng))
+			if perArea {
+				fmt.Fprintf(w, "\t%.3f", coll.Area(tax))
+			}
 		}
 		fmt.Fprintf(w, "\n")
 	}
@@ -0,0 +1,288 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package threshold implements a command to convert
+// continuous range maps into presence maps
+// using a threshold rule.
+package threshold
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/js-arias/command"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/files"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/logger"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/outformat"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/presence"
+	"github.com/js-arias/ranges/cmd/taxrange/internal/summary"
+)
+
+var Command = &command.Command{
+	Usage: `threshold [--quiet | -v | -vv] [--log-json] [--json-summary <file>]
+	--rule <rule> [--value <number>]
+	[--presences <rng-file>] [--test <file>]
+	[--binary] [--verbatim] [--sort <order>] [--reproducible]
+	[--force] [-o|--output <file>] [<rng-file>]`,
+	Short: "apply a threshold rule to continuous range maps",
+	Long: `
+Command threshold reads a geographic range file with continuous ranges (for
+example, the output of the command kde), and removes from each range the
+pixels with a density below a threshold defined by a threshold rule.
+
+The argument of the command is the name of the range file. If no file is
+given, the ranges will be read from the standard input.
+
+Input files can also be read from an URL (see "taxrange help urls").
+
+The flag --rule is required, and defines how the threshold of each taxon is
+calculated. Valid rules are:
+
+	value     a fixed density value, defined with the flag --value.
+	quantile  the quantile of the densities of the range, defined with the
+	          flag --value (a value between 0 and 1). For example, with
+	          "--value 0.25" the 25% of the pixels with the lowest density
+	          are removed.
+	mtp       minimum training presence: the lowest density at the pixels
+	          of the training presences, so all the presences are kept.
+	p10       10th percentile training presence: the density that keeps
+	          the 90% of the training presences.
+	maxsss    the density that maximizes the sum of the sensitivity (the
+	          fraction of presences kept) and the specificity (the fraction
+	          of absences removed) of a set of presence-absence
+	          observations.
+
+The rules "mtp" and "p10" require the flag --presences, with a range file with
+the points ranges of the training presences (for example, the file used as
+input for the command kde). The rule "maxsss" requires the flag --test, with a
+file of presence-absence observations: a tab-delimited file with the fields
+"taxon" (or "species"), "latitude", "longitude", and "presence" (see the
+command calibrate). If there is no data for a taxon, a warning is reported,
+and its range is not modified.
+
+Ranges of points are not modified.
+
+By default the densities of the pixels kept in the range are preserved. If the
+flag --binary is defined, the ranges will be written as points ranges, i.e.
+as presence maps.
+
+By default only warnings are reported in the standard error. Use the flag
+--quiet to report only errors, -v to report information messages (for
+example, the threshold used for each taxon), or -vv to report debug messages.
+If the flag --log-json is defined, messages will be written as JSON lines.
+
+By default the output will be printed in the standard output. If the flag
+--output, or -o, is defined, the indicated file will be used as output. The
+output file is only replaced after all the data was written, so if there is an
+error, the previous content of the file will be preserved.
+
+An output file named "-" is the standard output. An existing output file is
+not overwritten, unless the flag --force is defined.
+
+By default taxon names will be written in a canonical form (only the first
+letter in upper case). Use the flag --verbatim to keep the names as they were
+given in the input file.
+
+By default the taxa are sorted by name in the output. Use the flag --sort to
+change the order: "age" sorts the taxa by age (from the youngest) and then by
+name, and "input" keeps the order in which the taxa were read. If the flag
+--reproducible is defined, the comment with the time in which the output was
+written is omitted, so the same data always produces the same output.
+
+Use the flag --json-summary to write a summary of the run as a JSON object
+(see "taxrange help json-summary").
+	`,
+	SetFlags: setFlags,
+	Run:      summary.Run(run),
+}
+
+var ruleFlag string
+var valueFlag float64
+var presencesFile string
+var testFile string
+var binaryFlag bool
+var verbatimFlag bool
+var output string
+
+func setFlags(c *command.Command) {
+	logger.SetFlags(c)
+	outformat.SetFlags(c)
+	summary.SetFlags(c)
+	files.SetFlags(c)
+	c.Flags().StringVar(&ruleFlag, "rule", "", "")
+	c.Flags().Float64Var(&valueFlag, "value", -1, "")
+	c.Flags().StringVar(&presencesFile, "presences", "", "")
+	c.Flags().StringVar(&testFile, "test", "", "")
+	c.Flags().BoolVar(&binaryFlag, "binary", false, "")
+	c.Flags().BoolVar(&verbatimFlag, "verbatim", false, "")
+	c.Flags().StringVar(&output, "output", "", "")
+	c.Flags().StringVar(&output, "o", "", "")
+}
+
+func run(c *command.Command, args []string) error {
+	rule := strings.ToLower(ruleFlag)
+	switch rule {
+	case "":
+		return c.UsageError("flag --rule required")
+	case "value":
+		if valueFlag < 0 {
+			return c.UsageError("rule \"value\" requires --value")
+		}
+	case "quantile":
+		if valueFlag < 0 || valueFlag > 1 {
+			return c.UsageError("rule \"quantile\" requires --value between 0 and 1")
+		}
+	case "mtp", "p10":
+		if presencesFile == "" {
+			return c.UsageError(fmt.Sprintf("rule %q requires --presences", rule))
+		}
+	case "maxsss":
+		if testFile == "" {
+			return c.UsageError(fmt.Sprintf("rule %q requires --test", rule))
+		}
+	default:
+		return c.UsageError(fmt.Sprintf("invalid --rule value %q", ruleFlag))
+	}
+
+	log := logger.New(c.Stderr())
+
+	input := "-"
+	if len(args) > 0 {
+		input = args[0]
+	}
+	coll, err := readCollection(c.Stdin(), input, nil)
+	if err != nil {
+		return err
+	}
+	coll.KeepVerbatim(verbatimFlag)
+	outformat.Set(coll)
+
+	var train *ranges.Collection
+	if presencesFile != "" {
+		train, err = readCollection(nil, presencesFile, coll.Pixelation())
+		if err != nil {
+			return err
+		}
+	}
+	var obs map[string][]ranges.Observation
+	if testFile != "" {
+		obs, err = readObservations(testFile, coll)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tax := range coll.Taxa() {
+		if coll.Type(tax) != ranges.Range {
+			continue
+		}
+		rng := coll.Range(tax)
+
+		t, ok := threshold(rule, tax, rng, train, obs)
+		if !ok {
+			log.Warn("taxon without data for the threshold rule", "taxon", tax, "rule", rule)
+			continue
+		}
+		log.Info("threshold", "taxon", tax, "rule", rule, "threshold", t)
+
+		th := ranges.Threshold(rng, t)
+		if len(th) == 0 {
+			log.Warn("empty range after threshold", "taxon", tax, "threshold", t)
+			coll.Delete(tax)
+			continue
+		}
+		if binaryFlag {
+			coll.SetPixels(coll.VerbatimName(tax), coll.Age(tax), th)
+			continue
+		}
+		for _, px := range pixels(rng) {
+			if _, ok := th[px]; !ok {
+				coll.RemovePixel(tax, px)
+			}
+		}
+		log.Debug("taxon modified", "taxon", tax, "pixels", len(th))
+	}
+
+	summary.Written(len(coll.Taxa()))
+	return files.Output(c.Stdout(), output, coll.TSV)
+}
+
+// Threshold returns the threshold of a taxon
+// using the indicated rule.
+func threshold(rule, tax string, rng map[int]float64, train *ranges.Collection, obs map[string][]ranges.Observation) (float64, bool) {
+	switch rule {
+	case "value":
+		return valueFlag, true
+	case "quantile":
+		return ranges.Quantile(rng, valueFlag)
+	case "mtp":
+		return ranges.PresenceThreshold(rng, pixels(train.Range(tax)), 0)
+	case "p10":
+		return ranges.PresenceThreshold(rng, pixels(train.Range(tax)), 0.1)
+	case "maxsss":
+		return ranges.MaxSSS(obs[strings.ToLower(tax)])
+	}
+	return 0, false
+}
+
+// Pixels returns the sorted pixels
+// of a range.
+func pixels(rng map[int]float64) []int {
+	px := make([]int, 0, len(rng))
+	for id := range rng {
+		px = append(px, id)
+	}
+	slices.Sort(px)
+	return px
+}
+
+func readCollection(r io.Reader, name string, pix *earth.Pixelation) (*ranges.Collection, error) {
+	if name != "-" {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		name = "stdin"
+	}
+
+	coll, err := ranges.ReadTSV(r, pix)
+	if err != nil {
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	summary.Read(coll)
+
+	return coll, nil
+}
+
+// ReadObservations reads a presence-absence file
+// and returns the observations of each taxon
+// with a continuous range.
+func readObservations(name string, coll *ranges.Collection) (map[string][]ranges.Observation, error) {
+	po, err := presence.Read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pix := coll.Pixelation()
+	obs := make(map[string][]ranges.Observation)
+	for _, o := range po {
+		if !coll.HasTaxon(o.Taxon) || coll.Type(o.Taxon) != ranges.Range {
+			continue
+		}
+		px := pix.Pixel(o.Lat, o.Lon).ID()
+		k := strings.ToLower(o.Taxon)
+		obs[k] = append(obs[k], ranges.Observation{
+			Density:  coll.Range(o.Taxon)[px],
+			Presence: o.Presence,
+		})
+	}
+	return obs, nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package topics implements the help topics
+// that describe the behavior shared by several taxrange commands.
+package topics
+
+import "github.com/js-arias/command"
+
+var URLs = &command.Command{
+	Usage: "urls",
+	Short: "reading input files from URLs",
+	Long: `
+Most commands can read their input files from an URL, using the "http://",
+"https://", or "s3://" schemes. For example:
+
+	taxrange cat https://example.org/ranges.tab
+
+For "s3://<bucket>/<key>" URLs, the credentials are read from the environment
+variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN (if
+there are no credentials, the request is not signed, for example to read a
+public bucket). The region is read from AWS_REGION, or AWS_DEFAULT_REGION (by
+default "us-east-1"), and the variable AWS_ENDPOINT_URL can be used to set an
+S3 compatible service.
+
+A download that does not end after 10 minutes is canceled with an error.
+
+Downloaded files are stored in a local cache, so an URL is only downloaded
+once, and an URL can be pinned to a particular content with the fragment
+"#sha256=<hash>" (see the command cache).
+	`,
+}
+
+var Introduced = &command.Command{
+	Usage: "introduced",
+	Short: "filtering introduced populations",
+	Long: `
+The range files produced by the command imp.points can store the
+establishment means of the records (in the column "establishmentMeans"), so
+each pixel of a points range is tagged as "native", "introduced", or
+"uncertain". A pixel is only tagged as introduced if all of its records are
+introduced (see "taxrange help imp.points").
+
+Commands that read range files accept the flag --introduced to filter the
+pixels of points ranges:
+
+	include		reads all pixels (the default)
+	exclude		skips the pixels tagged as introduced
+	only		reads only the pixels tagged as introduced
+
+Ranges of other types are read without changes.
+	`,
+}
+
+var JSONSummary = &command.Command{
+	Usage: "json-summary",
+	Short: "writing a summary of a run",
+	Long: `
+All commands, except bench and cache, accept the flag --json-summary to write
+a summary of the run, so workflow managers can check that a step ends
+successfully. When the command ends (with or without an error) a JSON object
+is written into the indicated file, or into an open file descriptor with
+"fd:<number>" (for example "fd:3"). As with other output files, an existing
+summary file is not overwritten, unless the flag --force is defined. The
+object has the following fields:
+
+	command		the name of the command
+	status		either "ok" or "error"
+	error		the error message (if any)
+	records_read	the number of records read (for range files, each
+			pixel of a taxon is counted as a record)
+	taxa_read	the number of taxa read
+	taxa_written	the number of taxa written
+	warnings	the number of warnings
+	outputs		the output files (the standard output is not
+			included)
+	`,
+}
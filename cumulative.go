@@ -0,0 +1,77 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+// An AgeRange is the range of a taxon
+// at a given age
+// (in years).
+type AgeRange struct {
+	Age   int64
+	Range map[int]float64
+}
+
+// An Appearance is a summary
+// of the ages in which a pixel
+// is found in the ranges of a taxon.
+type Appearance struct {
+	// First is the age of the first appearance
+	// (i.e. the oldest age).
+	First int64
+
+	// Last is the age of the last appearance
+	// (i.e. the youngest age).
+	Last int64
+
+	// Ages is the number of different ages
+	// in which the pixel is found.
+	Ages int
+}
+
+// Cumulative returns the cumulative range
+// (i.e. the union of the ranges)
+// of a taxon at different ages,
+// and the first and last appearance
+// of each pixel of the cumulative range.
+// The density of each pixel
+// is the maximum density of the pixel
+// in all the ranges.
+// Pixels with a value of 0 are ignored.
+//
+// The pixels of all ranges must be in the same reference frame
+// (for example, the present locations
+// of the fossil records of the taxon).
+func Cumulative(rngs []AgeRange) (map[int]float64, map[int]Appearance) {
+	union := make(map[int]float64)
+	app := make(map[int]Appearance)
+	seen := make(map[int]map[int64]bool)
+	for _, r := range rngs {
+		for px, v := range r.Range {
+			if v <= 0 {
+				continue
+			}
+			if v > union[px] {
+				union[px] = v
+			}
+
+			a, ok := app[px]
+			if !ok {
+				a = Appearance{First: r.Age, Last: r.Age}
+				seen[px] = make(map[int64]bool)
+			}
+			if r.Age > a.First {
+				a.First = r.Age
+			}
+			if r.Age < a.Last {
+				a.Last = r.Age
+			}
+			if !seen[px][r.Age] {
+				seen[px][r.Age] = true
+				a.Ages++
+			}
+			app[px] = a
+		}
+	}
+	return union, app
+}
@@ -0,0 +1,36 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/js-arias/ranges"
+)
+
+func TestCumulative(t *testing.T) {
+	rngs := []ranges.AgeRange{
+		{Age: 20_000_000, Range: map[int]float64{1: 1, 2: 0.5}},
+		{Age: 5_000_000, Range: map[int]float64{2: 1, 3: 0.25, 4: 0}},
+		{Age: 10_000_000, Range: map[int]float64{1: 0.75, 3: 0.5}},
+		{Age: 10_000_000, Range: map[int]float64{3: 1}},
+	}
+
+	union, app := ranges.Cumulative(rngs)
+	wantUnion := map[int]float64{1: 1, 2: 1, 3: 1}
+	if !reflect.DeepEqual(union, wantUnion) {
+		t.Errorf("cumulative range: got %v, want %v", union, wantUnion)
+	}
+
+	wantApp := map[int]ranges.Appearance{
+		1: {First: 20_000_000, Last: 10_000_000, Ages: 2},
+		2: {First: 20_000_000, Last: 5_000_000, Ages: 2},
+		3: {First: 10_000_000, Last: 5_000_000, Ages: 2},
+	}
+	if !reflect.DeepEqual(app, wantApp) {
+		t.Errorf("appearance: got %v, want %v", app, wantApp)
+	}
+}
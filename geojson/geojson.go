@@ -0,0 +1,303 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package geojson implements a reader
+// for the polygons of a GeoJSON file
+// (for example, the boundaries of countries or states),
+// and their pixelation.
+//
+// As defined by the GeoJSON specification (RFC 7946),
+// the edges of a polygon are straight lines
+// in geographic coordinates,
+// the first ring of a polygon is the exterior ring,
+// and the other rings are holes.
+package geojson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/earth"
+)
+
+// A Feature is a named set of polygons.
+type Feature struct {
+	// Name of the feature
+	Name string
+
+	// Properties of the feature
+	// as given in the GeoJSON file
+	Properties map[string]any
+
+	// polygons of the feature,
+	// each one a set of rings
+	polygons [][]ring
+}
+
+// A Ring is a closed line
+// of geographic points.
+type ring []point
+
+type point struct {
+	lat, lon float64
+}
+
+// Read reads the features of a GeoJSON file,
+// that can be a FeatureCollection,
+// or a single Feature.
+// The name of each feature is the value
+// of the indicated properties,
+// joined with " / "
+// (for example,
+// "NAME_0,NAME_1" will produce names like
+// "Argentina / Mendoza").
+// Features without polygons are ignored.
+func Read(r io.Reader, fields ...string) ([]Feature, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("undefined name fields")
+	}
+
+	var obj object
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("while decoding GeoJSON: %v", err)
+	}
+
+	var fs []object
+	switch obj.Type {
+	case "FeatureCollection":
+		fs = obj.Features
+	case "Feature":
+		fs = []object{obj}
+	default:
+		return nil, fmt.Errorf("invalid GeoJSON type %q: want FeatureCollection or Feature", obj.Type)
+	}
+
+	var features []Feature
+	for i, f := range fs {
+		if f.Geometry == nil {
+			continue
+		}
+		polys, err := f.Geometry.polygons()
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %v", i, err)
+		}
+		if len(polys) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(fields))
+		for _, fd := range fields {
+			v, ok := f.Properties[fd]
+			if !ok || v == nil {
+				return nil, fmt.Errorf("feature %d: undefined property %q", i, fd)
+			}
+			names = append(names, strings.TrimSpace(propString(v)))
+		}
+		features = append(features, Feature{
+			Name:       strings.Join(names, " / "),
+			Properties: f.Properties,
+			polygons:   polys,
+		})
+	}
+	return features, nil
+}
+
+// Pixels returns the pixels
+// with a center inside the polygons of the feature.
+// If no pixel center is inside a polygon
+// (for example, a small island),
+// the pixels of the vertices of the polygon
+// are used.
+// All returned pixels are set to 1.0.
+func (f Feature) Pixels(pix *earth.Pixelation) map[int]float64 {
+	in := make(map[int]float64)
+	for _, poly := range f.polygons {
+		rs := make([]ring, 0, len(poly))
+		minLat, maxLat := 90.0, -90.0
+		for _, r := range poly {
+			u := unwrap(r)
+			rs = append(rs, u)
+			for _, p := range u {
+				minLat = math.Min(minLat, p.lat)
+				maxLat = math.Max(maxLat, p.lat)
+			}
+		}
+
+		var n int
+		for r := 0; r < pix.Rings(); r++ {
+			lat := pix.RingLat(r)
+			if lat < minLat || lat > maxLat {
+				continue
+			}
+			first := pix.FirstPix(r).ID()
+			for id := first; id < first+pix.PixPerRing(r); id++ {
+				lon := pix.ID(id).Point().Longitude()
+				for _, l := range []float64{lon, lon - 360, lon + 360} {
+					if inside(rs, point{lat: lat, lon: l}) {
+						in[id] = 1
+						n++
+						break
+					}
+				}
+			}
+		}
+		if n > 0 {
+			continue
+		}
+		for _, p := range poly[0] {
+			in[pix.Pixel(p.lat, p.lon).ID()] = 1
+		}
+	}
+	return in
+}
+
+// Unwrap returns a ring
+// in which the longitude of consecutive points
+// differs in less than 180 degrees,
+// so rings that cross the anti-meridian
+// are continuous
+// (the longitudes might be outside [-180, 180]).
+func unwrap(r ring) ring {
+	u := make(ring, len(r))
+	copy(u, r)
+	for i := 1; i < len(u); i++ {
+		d := u[i].lon - u[i-1].lon
+		for d > 180 {
+			u[i].lon -= 360
+			d -= 360
+		}
+		for d < -180 {
+			u[i].lon += 360
+			d += 360
+		}
+	}
+	return u
+}
+
+// Inside returns true
+// if a point is inside a polygon
+// made of a set of rings,
+// using the even-odd rule
+// (so holes are excluded).
+func inside(rs []ring, p point) bool {
+	in := false
+	for _, r := range rs {
+		j := len(r) - 1
+		for i := range r {
+			a, b := r[i], r[j]
+			if (a.lat > p.lat) != (b.lat > p.lat) {
+				lon := a.lon + (p.lat-a.lat)*(b.lon-a.lon)/(b.lat-a.lat)
+				if p.lon < lon {
+					in = !in
+				}
+			}
+			j = i
+		}
+	}
+	return in
+}
+
+// PropString returns a property value
+// as a string.
+func propString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// An Object is a GeoJSON object.
+type object struct {
+	Type       string         `json:"type"`
+	Features   []object       `json:"features"`
+	Properties map[string]any `json:"properties"`
+	Geometry   *geometry      `json:"geometry"`
+}
+
+// A Geometry is a GeoJSON geometry.
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometries  []geometry      `json:"geometries"`
+}
+
+// Polygons returns the polygons of a geometry.
+// Geometries without area
+// (points and lines)
+// are ignored.
+func (g geometry) polygons() ([][]ring, error) {
+	switch g.Type {
+	case "Polygon":
+		var c [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("invalid polygon: %v", err)
+		}
+		p, err := toPolygon(c)
+		if err != nil {
+			return nil, err
+		}
+		return [][]ring{p}, nil
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("invalid multipolygon: %v", err)
+		}
+		polys := make([][]ring, 0, len(c))
+		for _, pc := range c {
+			p, err := toPolygon(pc)
+			if err != nil {
+				return nil, err
+			}
+			polys = append(polys, p)
+		}
+		return polys, nil
+	case "GeometryCollection":
+		var polys [][]ring
+		for _, sg := range g.Geometries {
+			p, err := sg.polygons()
+			if err != nil {
+				return nil, err
+			}
+			polys = append(polys, p...)
+		}
+		return polys, nil
+	}
+	return nil, nil
+}
+
+func toPolygon(c [][][]float64) ([]ring, error) {
+	if len(c) == 0 {
+		return nil, errors.New("polygon without rings")
+	}
+	rs := make([]ring, 0, len(c))
+	for _, rc := range c {
+		if len(rc) < 3 {
+			return nil, fmt.Errorf("ring with %d points", len(rc))
+		}
+		r := make(ring, 0, len(rc))
+		for _, pc := range rc {
+			if len(pc) < 2 {
+				return nil, errors.New("position with less than two values")
+			}
+			lon, lat := pc[0], pc[1]
+			if lat < -90 || lat > 90 || math.IsNaN(lat) {
+				return nil, fmt.Errorf("invalid latitude %.6f", lat)
+			}
+			if lon < -180 || lon > 180 || math.IsNaN(lon) {
+				return nil, fmt.Errorf("invalid longitude %.6f", lon)
+			}
+			r = append(r, point{lat: lat, lon: lon})
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
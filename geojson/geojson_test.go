@@ -0,0 +1,122 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package geojson_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges/geojson"
+)
+
+const data = `{
+	"type": "FeatureCollection",
+	"features": [
+		{
+			"type": "Feature",
+			"properties": {"NAME_0": "Aland", "NAME_1": "North"},
+			"geometry": {
+				"type": "Polygon",
+				"coordinates": [
+					[[0, 0], [20, 0], [20, 20], [0, 20], [0, 0]],
+					[[5, 5], [15, 5], [15, 15], [5, 15], [5, 5]]
+				]
+			}
+		},
+		{
+			"type": "Feature",
+			"properties": {"NAME_0": "Bland", "NAME_1": 2},
+			"geometry": {
+				"type": "MultiPolygon",
+				"coordinates": [
+					[[[170, -10], [-170, -10], [-170, 10], [170, 10], [170, -10]]],
+					[[[-60.1, -30.1], [-60, -30.1], [-60, -30], [-60.1, -30.1]]]
+				]
+			}
+		},
+		{
+			"type": "Feature",
+			"properties": {"NAME_0": "Point", "NAME_1": "none"},
+			"geometry": {"type": "Point", "coordinates": [0, 0]}
+		}
+	]
+}`
+
+func TestRead(t *testing.T) {
+	fs, err := geojson.Read(strings.NewReader(data), "NAME_0", "NAME_1")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(fs) != 2 {
+		t.Fatalf("read: got %d features, want %d", len(fs), 2)
+	}
+	if fs[0].Name != "Aland / North" {
+		t.Errorf("read: got name %q, want %q", fs[0].Name, "Aland / North")
+	}
+	if fs[1].Name != "Bland / 2" {
+		t.Errorf("read: got name %q, want %q", fs[1].Name, "Bland / 2")
+	}
+
+	pix := earth.NewPixelation(360)
+
+	// polygon with a hole
+	in := fs[0].Pixels(pix)
+	for _, p := range [][2]float64{{2.5, 2.5}, {17.5, 17.5}} {
+		if px := pix.Pixel(p[0], p[1]).ID(); in[px] != 1 {
+			t.Errorf("polygon: pixel %d at %v not in polygon", px, p)
+		}
+	}
+	for _, p := range [][2]float64{{10, 10}, {-5, 5}, {25, 10}} {
+		if px := pix.Pixel(p[0], p[1]).ID(); in[px] != 0 {
+			t.Errorf("polygon: pixel %d at %v in polygon", px, p)
+		}
+	}
+
+	// a polygon across the anti-meridian,
+	// and a small island
+	in = fs[1].Pixels(pix)
+	for _, p := range [][2]float64{{0, 179.5}, {0, -179.5}, {5, 175}, {-30.05, -60.05}} {
+		if px := pix.Pixel(p[0], p[1]).ID(); in[px] != 1 {
+			t.Errorf("multipolygon: pixel %d at %v not in polygon", px, p)
+		}
+	}
+	if px := pix.Pixel(0, 0).ID(); in[px] != 0 {
+		t.Errorf("multipolygon: pixel %d in polygon", px)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := map[string]struct {
+		data   string
+		fields []string
+	}{
+		"no fields": {
+			data: data,
+		},
+		"missing property": {
+			data:   data,
+			fields: []string{"ADMIN"},
+		},
+		"invalid type": {
+			data:   `{"type": "Polygon", "coordinates": []}`,
+			fields: []string{"name"},
+		},
+		"invalid latitude": {
+			data:   `{"type": "Feature", "properties": {"name": "a"}, "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [0, 100], [10, 0], [0, 0]]]}}`,
+			fields: []string{"name"},
+		},
+		"invalid json": {
+			data:   `{"type": "Feature"`,
+			fields: []string{"name"},
+		},
+	}
+
+	for name, test := range tests {
+		if _, err := geojson.Read(strings.NewReader(test.data), test.fields...); err == nil {
+			t.Errorf("%s: expecting error", name)
+		}
+	}
+}
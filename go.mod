@@ -9,6 +9,7 @@ require (
 	github.com/js-arias/command v0.0.0-20220321160405-bad66700a180
 	github.com/js-arias/earth v0.0.0-20230810183752-6914a33c480c
 	github.com/js-arias/gbifer v0.0.0-20230906190155-b9741f9e3228
+	golang.org/x/image v0.14.0
 )
 
 require (
@@ -0,0 +1,113 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+
+	"github.com/js-arias/earth"
+)
+
+// GridSpacings are the spacings
+// (in degrees)
+// of the lattices commonly used in gridded data,
+// sorted from the coarsest to the finest.
+var gridSpacings = []float64{
+	10,
+	5,
+	2.5,
+	2,
+	1,
+	0.5,
+	0.25,
+	1.0 / 6, // 10 arc minutes
+	0.1,
+	1.0 / 12, // 5 arc minutes
+	1.0 / 24, // 2.5 arc minutes
+	1.0 / 60, // 1 arc minute
+}
+
+// MinGridPoints is the minimum number of pixels
+// required to detect a lattice.
+const minGridPoints = 10
+
+// MinGridFit is the minimum fraction of pixels
+// that must be on the lattice.
+const minGridFit = 0.95
+
+// GridSpacing returns the spacing
+// (in degrees)
+// of a lattice in which the pixels of a range
+// are snapped,
+// or 0 if the pixels are not in a lattice.
+//
+// A lattice can only be detected
+// if its spacing is at least twice the size of the pixels,
+// and the range has at least ten pixels.
+// Both lattices of cell corners
+// (i.e. integer multiples of the spacing)
+// and cell centers are detected.
+func GridSpacing(pix *earth.Pixelation, rng map[int]float64) float64 {
+	if len(rng) < minGridPoints {
+		return 0
+	}
+
+	step := pix.Step()
+	for _, s := range gridSpacings {
+		if s < 2*step {
+			break
+		}
+		for _, off := range []float64{0, s / 2} {
+			if onLattice(pix, rng, s, off) {
+				return s
+			}
+		}
+	}
+	return 0
+}
+
+// OnLattice returns true if the pixels of a range
+// are on a lattice with the indicated spacing and offset.
+func onLattice(pix *earth.Pixelation, rng map[int]float64, s, off float64) bool {
+	const eps = 1e-9
+	latTol := pix.Step()/2 + eps
+
+	var lat, lon, lonPoints int
+	for px := range rng {
+		p := pix.ID(px)
+		pt := p.Point()
+		if latticeDist(pt.Latitude(), s, off) <= latTol {
+			lat++
+		}
+
+		// near the poles,
+		// pixels are too wide
+		// to be informative about the longitude
+		lonTol := 180/float64(pix.PixPerRing(p.Ring())) + eps
+		if lonTol >= s/4 {
+			continue
+		}
+		lonPoints++
+		if latticeDist(pt.Longitude(), s, off) <= lonTol {
+			lon++
+		}
+	}
+
+	if float64(lat) < minGridFit*float64(len(rng)) {
+		return false
+	}
+	if lonPoints > 0 && float64(lon) < minGridFit*float64(lonPoints) {
+		return false
+	}
+	return true
+}
+
+// LatticeDist returns the distance
+// of a coordinate
+// to the closest node of a lattice.
+func latticeDist(x, s, off float64) float64 {
+	v := x - off
+	return math.Abs(v - s*math.Round(v/s))
+}
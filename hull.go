@@ -0,0 +1,293 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+	"slices"
+
+	"github.com/js-arias/earth"
+)
+
+// Patches returns the connected patches of a range,
+// i.e. the sets of pixels of the range
+// that are connected by neighbor pixels
+// (see Neighbors),
+// or,
+// if dist is greater than 0,
+// by pixels at a distance less or equal than dist
+// (in km).
+// Patches are sorted by the smallest pixel ID
+// of each patch.
+func Patches(pix *earth.Pixelation, rng map[int]float64, dist float64) []map[int]float64 {
+	ids := make([]int, 0, len(rng))
+	for px := range rng {
+		ids = append(ids, px)
+	}
+	slices.Sort(ids)
+
+	linked := func(id int) []int {
+		return Neighbors(pix, id)
+	}
+	if dist > 0 {
+		angle := dist / (float64(earth.Radius) / 1000)
+		linked = func(id int) []int {
+			pt := pix.ID(id).Point()
+			var ls []int
+			for _, px := range ids {
+				if px == id {
+					continue
+				}
+				if earth.Distance(pt, pix.ID(px).Point()) <= angle {
+					ls = append(ls, px)
+				}
+			}
+			return ls
+		}
+	}
+
+	seen := make(map[int]bool, len(rng))
+	var patches []map[int]float64
+	for _, px := range ids {
+		if seen[px] {
+			continue
+		}
+		seen[px] = true
+		p := map[int]float64{px: rng[px]}
+		queue := []int{px}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, nb := range linked(id) {
+				if seen[nb] {
+					continue
+				}
+				v, ok := rng[nb]
+				if !ok {
+					continue
+				}
+				seen[nb] = true
+				p[nb] = v
+				queue = append(queue, nb)
+			}
+		}
+		patches = append(patches, p)
+	}
+	return patches
+}
+
+// ConvexHull returns the pixels
+// inside the spherical convex hull
+// of the pixels of a range.
+// The returned pixels include the given pixels,
+// and all of them are set to 1.0.
+//
+// If the pixels are not contained
+// in the hemisphere centered at their mean direction,
+// then the hull covers the whole sphere.
+func ConvexHull(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+	hull := make(map[int]float64, len(rng))
+	if len(rng) == 0 {
+		return hull
+	}
+
+	var c vec3
+	pts := make([]vec3, 0, len(rng))
+	for px := range rng {
+		hull[px] = 1
+		v := toVec3(pix.ID(px).Point())
+		pts = append(pts, v)
+		c = c.add(v)
+	}
+	if len(rng) < 3 {
+		return hull
+	}
+
+	n := c.norm()
+	if n < 1e-9 {
+		return allPixels(pix)
+	}
+	c = c.scale(1 / n)
+	e1, e2 := tangentBasis(c)
+
+	// project the points using a gnomonic projection,
+	// in which great circles are straight lines.
+	proj := make([]point2, 0, len(pts))
+	for _, v := range pts {
+		p, ok := gnomonic(v, c, e1, e2)
+		if !ok {
+			return allPixels(pix)
+		}
+		proj = append(proj, p)
+	}
+	poly := convexHull2(proj)
+	if len(poly) < 3 {
+		return hull
+	}
+
+	for id := 0; id < pix.Len(); id++ {
+		if _, ok := hull[id]; ok {
+			continue
+		}
+		p, ok := gnomonic(toVec3(pix.ID(id).Point()), c, e1, e2)
+		if !ok {
+			continue
+		}
+		if insidePolygon(poly, p) {
+			hull[id] = 1
+		}
+	}
+	return hull
+}
+
+// PatchHulls returns the union
+// of the spherical convex hulls
+// of each connected patch of a range
+// (see Patches for the meaning of dist).
+// As the hulls are not defined over the gaps
+// between patches,
+// it avoids hulls that bridge oceans
+// for disjunct ranges.
+func PatchHulls(pix *earth.Pixelation, rng map[int]float64, dist float64) map[int]float64 {
+	hull := make(map[int]float64, len(rng))
+	for _, p := range Patches(pix, rng, dist) {
+		for px := range ConvexHull(pix, p) {
+			hull[px] = 1
+		}
+	}
+	return hull
+}
+
+func allPixels(pix *earth.Pixelation) map[int]float64 {
+	all := make(map[int]float64, pix.Len())
+	for id := 0; id < pix.Len(); id++ {
+		all[id] = 1
+	}
+	return all
+}
+
+type vec3 struct {
+	x, y, z float64
+}
+
+func toVec3(pt earth.Point) vec3 {
+	v := pt.Vector()
+	return vec3{x: v.X, y: v.Y, z: v.Z}
+}
+
+func (v vec3) add(w vec3) vec3 {
+	return vec3{x: v.x + w.x, y: v.y + w.y, z: v.z + w.z}
+}
+
+func (v vec3) cross(w vec3) vec3 {
+	return vec3{
+		x: v.y*w.z - v.z*w.y,
+		y: v.z*w.x - v.x*w.z,
+		z: v.x*w.y - v.y*w.x,
+	}
+}
+
+func (v vec3) dot(w vec3) float64 {
+	return v.x*w.x + v.y*w.y + v.z*w.z
+}
+
+func (v vec3) norm() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+func (v vec3) scale(s float64) vec3 {
+	return vec3{x: v.x * s, y: v.y * s, z: v.z * s}
+}
+
+// TangentBasis returns two orthonormal vectors
+// on the plane tangent to c.
+func tangentBasis(c vec3) (e1, e2 vec3) {
+	axis := vec3{z: 1}
+	if math.Abs(c.z) > 0.9 {
+		axis = vec3{x: 1}
+	}
+	e1 = axis.cross(c)
+	e1 = e1.scale(1 / e1.norm())
+	e2 = c.cross(e1)
+	return e1, e2
+}
+
+type point2 struct {
+	x, y float64
+}
+
+// Gnomonic returns the gnomonic projection of v
+// centered at c.
+// It returns false if v is not in the hemisphere
+// centered at c.
+func gnomonic(v, c, e1, e2 vec3) (point2, bool) {
+	d := v.dot(c)
+	if d <= 1e-9 {
+		return point2{}, false
+	}
+	return point2{x: v.dot(e1) / d, y: v.dot(e2) / d}, true
+}
+
+func cross2(o, a, b point2) float64 {
+	return (a.x-o.x)*(b.y-o.y) - (a.y-o.y)*(b.x-o.x)
+}
+
+// ConvexHull2 returns the convex hull of a set of points
+// in counter-clockwise order,
+// using the monotone chain algorithm.
+func convexHull2(pts []point2) []point2 {
+	pts = slices.Clone(pts)
+	slices.SortFunc(pts, func(a, b point2) int {
+		if a.x != b.x {
+			if a.x < b.x {
+				return -1
+			}
+			return 1
+		}
+		if a.y < b.y {
+			return -1
+		}
+		if a.y > b.y {
+			return 1
+		}
+		return 0
+	})
+	pts = slices.Compact(pts)
+	if len(pts) < 3 {
+		return pts
+	}
+
+	hull := make([]point2, 0, 2*len(pts))
+	for _, p := range pts {
+		for len(hull) >= 2 && cross2(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(pts) - 2; i >= 0; i-- {
+		p := pts[i]
+		for len(hull) >= lower && cross2(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+// InsidePolygon returns true
+// if a point is inside a convex polygon
+// in counter-clockwise order.
+func insidePolygon(poly []point2, p point2) bool {
+	const eps = 1e-12
+	for i := range poly {
+		a := poly[i]
+		b := poly[(i+1)%len(poly)]
+		if cross2(a, b, p) < -eps {
+			return false
+		}
+	}
+	return true
+}
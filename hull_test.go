@@ -0,0 +1,129 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestConvexHull(t *testing.T) {
+	pix := earth.NewPixelation(360)
+
+	rng := map[int]float64{
+		pix.Pixel(0, 0).ID():   1,
+		pix.Pixel(0, 10).ID():  1,
+		pix.Pixel(10, 10).ID(): 1,
+		pix.Pixel(10, 0).ID():  1,
+	}
+	hull := ranges.ConvexHull(pix, rng)
+	for px := range rng {
+		if _, ok := hull[px]; !ok {
+			t.Errorf("hull: pixel %d not in hull", px)
+		}
+	}
+	if px := pix.Pixel(5, 5).ID(); hull[px] != 1 {
+		t.Errorf("hull: pixel %d not in hull", px)
+	}
+	if px := pix.Pixel(20, 20).ID(); hull[px] != 0 {
+		t.Errorf("hull: pixel %d in hull", px)
+	}
+	if len(hull) < 80 || len(hull) > 150 {
+		t.Errorf("hull: got %d pixels", len(hull))
+	}
+
+	// across the anti-meridian
+	rng = map[int]float64{
+		pix.Pixel(0, 175).ID():   1,
+		pix.Pixel(0, -175).ID():  1,
+		pix.Pixel(10, -175).ID(): 1,
+		pix.Pixel(10, 175).ID():  1,
+	}
+	hull = ranges.ConvexHull(pix, rng)
+	if px := pix.Pixel(5, 179.5).ID(); hull[px] != 1 {
+		t.Errorf("hull: pixel %d not in hull", px)
+	}
+	if px := pix.Pixel(5, 0).ID(); hull[px] != 0 {
+		t.Errorf("hull: pixel %d in hull", px)
+	}
+
+	// around the pole
+	rng = map[int]float64{
+		pix.Pixel(80, 0).ID():   1,
+		pix.Pixel(80, 90).ID():  1,
+		pix.Pixel(80, 180).ID(): 1,
+		pix.Pixel(80, -90).ID(): 1,
+	}
+	hull = ranges.ConvexHull(pix, rng)
+	for _, p := range [][2]float64{{90, 0}, {85, 45}, {85, -135}} {
+		if px := pix.Pixel(p[0], p[1]).ID(); hull[px] != 1 {
+			t.Errorf("polar hull: pixel %d at %v not in hull", px, p)
+		}
+	}
+	if px := pix.Pixel(70, 45).ID(); hull[px] != 0 {
+		t.Errorf("polar hull: pixel %d in hull", px)
+	}
+}
+
+func TestPatchHulls(t *testing.T) {
+	pix := earth.NewPixelation(360)
+
+	a := pix.Pixel(0, 0).ID()
+	b := pix.Pixel(0, 40).ID()
+	rng := ranges.Dilate(pix, map[int]float64{a: 1})
+	for px := range ranges.Dilate(pix, map[int]float64{b: 1}) {
+		rng[px] = 1
+	}
+
+	patches := ranges.Patches(pix, rng, 0)
+	if len(patches) != 2 {
+		t.Fatalf("patches: got %d patches, want %d", len(patches), 2)
+	}
+	if _, ok := patches[0][a]; !ok {
+		t.Errorf("patches: pixel %d not in first patch", a)
+	}
+	if _, ok := patches[1][b]; !ok {
+		t.Errorf("patches: pixel %d not in second patch", b)
+	}
+
+	mid := pix.Pixel(0, 20).ID()
+	if h := ranges.ConvexHull(pix, rng); h[mid] != 1 {
+		t.Errorf("hull: pixel %d not in hull", mid)
+	}
+	h := ranges.PatchHulls(pix, rng, 0)
+	if h[mid] != 0 {
+		t.Errorf("patch hulls: pixel %d in hull", mid)
+	}
+	for px := range rng {
+		if h[px] != 1 {
+			t.Errorf("patch hulls: pixel %d not in hull", px)
+		}
+	}
+
+	// patches linked by distance
+	if p := ranges.Patches(pix, rng, 1000); len(p) != 2 {
+		t.Errorf("patches 1000 km: got %d patches, want %d", len(p), 2)
+	}
+	if p := ranges.Patches(pix, rng, 5000); len(p) != 1 {
+		t.Errorf("patches 5000 km: got %d patches, want %d", len(p), 1)
+	}
+
+	// a patch across the anti-meridian
+	rng = ranges.Dilate(pix, map[int]float64{pix.Pixel(0, 179.9).ID(): 1})
+	if p := ranges.Patches(pix, rng, 0); len(p) != 1 {
+		t.Errorf("patches at anti-meridian: got %d patches, want %d", len(p), 1)
+	}
+
+	// a patch around the pole
+	rng = make(map[int]float64)
+	for lon := -180.0; lon < 180; lon += 10 {
+		rng[pix.Pixel(89, lon).ID()] = 1
+	}
+	if p := ranges.Patches(pix, rng, 0); len(p) != 1 {
+		t.Errorf("patches at pole: got %d patches, want %d", len(p), 1)
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package importer implements readers
+// for files with specimen records,
+// in the formats used by the most common biodiversity databases.
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/js-arias/gbifer/tsv"
+	"github.com/js-arias/ranges"
+)
+
+// A Format is the format of a file
+// with specimen records.
+type Format string
+
+// Valid formats.
+const (
+	// Text is a simple tab-delimited file,
+	// with the fields "species", "latitude", and "longitude".
+	// Lines starting with '#' are ignored.
+	Text Format = "text"
+
+	// DarwinCore is a DarwinCore file,
+	// using tab characters as delimiters
+	// (i.e. as files downloaded from GBIF),
+	// with the fields "species", "decimalLatitude",
+	// and "decimalLongitude".
+	DarwinCore Format = "darwin"
+
+	// CSV is a DarwinCore file,
+	// using commas as delimiters.
+	CSV Format = "csv"
+
+	// PBDB is a tab-delimited file
+	// downloaded from the PaleoBiology DataBase,
+	// with the fields "accepted_name", "lat", and "lng".
+	PBDB Format = "pbdb"
+)
+
+// ParseFormat returns a format
+// from a string.
+// An empty string is the Text format.
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(s))
+	switch f {
+	case "":
+		return Text, nil
+	case Text, DarwinCore, CSV, PBDB:
+		return f, nil
+	}
+	return "", fmt.Errorf("format %q unknown", s)
+}
+
+// Fields returns the names of the fields
+// (in lower case)
+// of the taxon name,
+// latitude,
+// and longitude
+// of a format.
+func (f Format) Fields() (taxon, lat, lon string) {
+	switch f {
+	case DarwinCore, CSV:
+		return "species", "decimallatitude", "decimallongitude"
+	case PBDB:
+		return "accepted_name", "lat", "lng"
+	}
+	return "species", "latitude", "longitude"
+}
+
+// A Record is a specimen record.
+type Record struct {
+	// Taxon is the name of the taxon,
+	// as given in the input file.
+	Taxon string
+
+	// Lat and Lon are the coordinates of the record.
+	Lat, Lon float64
+
+	// RawLat and RawLon are the coordinates
+	// as given in the input file
+	// (for example, to check the precision
+	// of the coordinates).
+	RawLat, RawLon string
+
+	// Line is the line of the record
+	// in the input file.
+	Line int
+
+	row    []string
+	fields map[string]int
+}
+
+// Field returns the value of a field
+// (in lower case)
+// of the record.
+// It returns an empty string
+// if the field is not defined.
+func (r Record) Field(name string) string {
+	i, ok := r.fields[name]
+	if !ok {
+		return ""
+	}
+	return r.row[i]
+}
+
+// Row returns the fields of the record
+// as read from the input file.
+// The returned slice must not be modified.
+func (r Record) Row() []string {
+	return r.row
+}
+
+// Fields returns the index of each field
+// (in lower case)
+// of the record.
+// The returned map must not be modified.
+func (r Record) Fields() map[string]int {
+	return r.fields
+}
+
+// An Option is an option for a Reader.
+type Option func(r *Reader)
+
+// WithTaxon sets all the records
+// read from the file
+// to the indicated taxon,
+// so the field of the taxon name
+// is not required.
+func WithTaxon(name string) Option {
+	return func(r *Reader) {
+		r.taxon = name
+	}
+}
+
+// WithoutHeader sets the reader
+// to read a file without a header,
+// in which the first column is the latitude,
+// and the second column is the longitude.
+// It is only valid for the Text format,
+// and requires the WithTaxon option.
+func WithoutHeader() Option {
+	return func(r *Reader) {
+		r.noHeader = true
+	}
+}
+
+// A rowReader is a reader of table rows.
+type rowReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line, column int)
+}
+
+// A Reader reads specimen records
+// from an input file.
+type Reader struct {
+	format   Format
+	tab      rowReader
+	fields   map[string]int
+	taxon    string
+	noHeader bool
+
+	// number of lines before the header
+	metaLines int
+}
+
+// NewReader returns a reader
+// of the specimen records of a file
+// in the indicated format.
+// The header of the file is read
+// when the reader is created.
+func NewReader(r io.Reader, f Format, opts ...Option) (*Reader, error) {
+	f, err := ParseFormat(string(f))
+	if err != nil {
+		return nil, err
+	}
+	rd := &Reader{format: f}
+	for _, o := range opts {
+		o(rd)
+	}
+	if rd.noHeader && f != Text {
+		return nil, fmt.Errorf("files without header are only valid for %q format", Text)
+	}
+	if rd.noHeader && rd.taxon == "" {
+		return nil, fmt.Errorf("files without header require a taxon name")
+	}
+
+	switch f {
+	case Text:
+		tab := csv.NewReader(r)
+		tab.Comma = '\t'
+		tab.Comment = '#'
+		rd.tab = tab
+	case DarwinCore:
+		rd.tab = tsv.NewReader(r)
+	case CSV:
+		tab := csv.NewReader(r)
+		tab.LazyQuotes = true
+		rd.tab = tab
+	case PBDB:
+		br := bufio.NewReader(r)
+		for {
+			ln, err := br.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			rd.metaLines++
+			if strings.HasPrefix(ln, "Records:") {
+				break
+			}
+		}
+		rd.tab = tsv.NewReader(br)
+	}
+
+	if err := rd.readHeader(); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (rd *Reader) readHeader() error {
+	taxField, latField, lonField := rd.format.Fields()
+	if rd.noHeader {
+		rd.fields = map[string]int{
+			latField: 0,
+			lonField: 1,
+		}
+		return nil
+	}
+
+	head, err := rd.tab.Read()
+	if err != nil {
+		return fmt.Errorf("while reading header: %v", err)
+	}
+	rd.fields = make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		rd.fields[h] = i
+	}
+	for _, h := range []string{taxField, latField, lonField} {
+		if h == taxField && rd.taxon != "" {
+			continue
+		}
+		if _, ok := rd.fields[h]; !ok {
+			return fmt.Errorf("expecting field %q", h)
+		}
+	}
+	return nil
+}
+
+// HasField returns true if the input file
+// has the indicated field
+// (in lower case).
+func (rd *Reader) HasField(name string) bool {
+	_, ok := rd.fields[name]
+	return ok
+}
+
+// Fields returns the index of each field
+// (in lower case)
+// of the input file.
+// The returned map must not be modified.
+func (rd *Reader) Fields() map[string]int {
+	return rd.fields
+}
+
+// Read reads a record from the input file.
+// At the end of the file
+// it returns io.EOF.
+func (rd *Reader) Read() (Record, error) {
+	row, err := rd.tab.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, err
+		}
+		// FieldPos of a CSV reader
+		// is not valid after a parse error
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			return Record{}, fmt.Errorf("row %d: %v", pe.Line+rd.metaLines, pe.Err)
+		}
+		ln, _ := rd.tab.FieldPos(0)
+		return Record{}, fmt.Errorf("row %d: %v", ln+rd.metaLines, err)
+	}
+	ln, _ := rd.tab.FieldPos(0)
+	ln += rd.metaLines
+
+	taxField, latField, lonField := rd.format.Fields()
+	for _, f := range []string{taxField, latField, lonField} {
+		i, ok := rd.fields[f]
+		if ok && i >= len(row) {
+			return Record{}, fmt.Errorf("row %d: field %q: missing value", ln, f)
+		}
+	}
+	rec := Record{
+		Taxon:  rd.taxon,
+		RawLat: row[rd.fields[latField]],
+		RawLon: row[rd.fields[lonField]],
+		Line:   ln,
+		row:    row,
+		fields: rd.fields,
+	}
+	if rec.Taxon == "" {
+		rec.Taxon = row[rd.fields[taxField]]
+	}
+
+	rec.Lat, err = strconv.ParseFloat(rec.RawLat, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("row %d: field %q: %v", ln, latField, err)
+	}
+	if math.IsNaN(rec.Lat) || rec.Lat < -90 || rec.Lat > 90 {
+		return Record{}, fmt.Errorf("row %d: field %q: invalid latitude %.6f", ln, latField, rec.Lat)
+	}
+
+	rec.Lon, err = strconv.ParseFloat(rec.RawLon, 64)
+	if err != nil {
+		return Record{}, fmt.Errorf("row %d: field %q: %v", ln, lonField, err)
+	}
+	if math.IsNaN(rec.Lon) || rec.Lon < -180 || rec.Lon > 180 {
+		return Record{}, fmt.Errorf("row %d: field %q: invalid longitude %.6f", ln, lonField, rec.Lon)
+	}
+	return rec, nil
+}
+
+// ReadAll reads all the records of an input file
+// and adds them to a collection
+// at the indicated age.
+func ReadAll(r io.Reader, c *ranges.Collection, f Format, age int64, opts ...Option) error {
+	rd, err := NewReader(r, f, opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if tp := c.Type(rec.Taxon); tp != "" && tp != ranges.Points {
+			return fmt.Errorf("taxon %q: has defined a %q map", rec.Taxon, tp)
+		}
+		c.Add(rec.Taxon, age, rec.Lat, rec.Lon)
+	}
+}
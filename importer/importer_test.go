@@ -0,0 +1,207 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package importer_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+	"github.com/js-arias/ranges/importer"
+)
+
+func TestReader(t *testing.T) {
+	tests := map[string]struct {
+		format importer.Format
+		data   string
+		opts   []importer.Option
+		want   []importer.Record
+	}{
+		"text": {
+			format: importer.Text,
+			data: `# a comment
+species	latitude	longitude	country
+Bus cus	10.5	-70	AR
+Aus bus	-20	30	ZA
+`,
+			want: []importer.Record{
+				{Taxon: "Bus cus", Lat: 10.5, Lon: -70},
+				{Taxon: "Aus bus", Lat: -20, Lon: 30},
+			},
+		},
+		"darwin": {
+			format: importer.DarwinCore,
+			data: `gbifID	species	decimalLatitude	decimalLongitude
+1	Bus cus	10.5	-70
+`,
+			want: []importer.Record{
+				{Taxon: "Bus cus", Lat: 10.5, Lon: -70},
+			},
+		},
+		"csv": {
+			format: importer.CSV,
+			data: `gbifID,species,decimalLatitude,decimalLongitude
+1,Bus cus,10.5,-70
+`,
+			want: []importer.Record{
+				{Taxon: "Bus cus", Lat: 10.5, Lon: -70},
+			},
+		},
+		"pbdb": {
+			format: importer.PBDB,
+			data: `Data Provider:,The Paleobiology Database
+Records:,1
+accepted_name	lat	lng
+Bus cus	10.5	-70
+`,
+			want: []importer.Record{
+				{Taxon: "Bus cus", Lat: 10.5, Lon: -70},
+			},
+		},
+		"no header": {
+			format: importer.Text,
+			data: `10.5	-70
+-20	30
+`,
+			opts: []importer.Option{importer.WithTaxon("Bus cus"), importer.WithoutHeader()},
+			want: []importer.Record{
+				{Taxon: "Bus cus", Lat: 10.5, Lon: -70},
+				{Taxon: "Bus cus", Lat: -20, Lon: 30},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		rd, err := importer.NewReader(strings.NewReader(test.data), test.format, test.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got []importer.Record
+		for {
+			rec, err := rd.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got = append(got, rec)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: got %d records, want %d", name, len(got), len(test.want))
+		}
+		for i, r := range got {
+			w := test.want[i]
+			if r.Taxon != w.Taxon || r.Lat != w.Lat || r.Lon != w.Lon {
+				t.Errorf("%s: record %d: got %q %.3f %.3f, want %q %.3f %.3f", name, i, r.Taxon, r.Lat, r.Lon, w.Taxon, w.Lat, w.Lon)
+			}
+		}
+	}
+
+	// additional fields
+	rd, err := importer.NewReader(strings.NewReader(tests["text"].data), importer.Text)
+	if err != nil {
+		t.Fatalf("field: %v", err)
+	}
+	rec, err := rd.Read()
+	if err != nil {
+		t.Fatalf("field: %v", err)
+	}
+	if !rd.HasField("country") {
+		t.Errorf("field: expecting field %q", "country")
+	}
+	if c := rec.Field("country"); c != "AR" {
+		t.Errorf("field: got %q, want %q", c, "AR")
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := map[string]struct {
+		format importer.Format
+		data   string
+		opts   []importer.Option
+	}{
+		"missing field": {
+			format: importer.Text,
+			data:   "species\tlatitude\nBus cus\t10\n",
+		},
+		"invalid latitude": {
+			format: importer.Text,
+			data:   "species\tlatitude\tlongitude\nBus cus\t100\t10\n",
+		},
+		"NaN latitude": {
+			format: importer.Text,
+			data:   "species\tlatitude\tlongitude\nBus cus\tNaN\t10\n",
+		},
+		"invalid longitude": {
+			format: importer.Text,
+			data:   "species\tlatitude\tlongitude\nBus cus\t10\tx\n",
+		},
+		"no header without taxon": {
+			format: importer.Text,
+			data:   "10\t10\n",
+			opts:   []importer.Option{importer.WithoutHeader()},
+		},
+		"missing value": {
+			format: importer.Text,
+			data:   "10\n",
+			opts:   []importer.Option{importer.WithTaxon("Bus cus"), importer.WithoutHeader()},
+		},
+	}
+
+	for name, test := range tests {
+		rd, err := importer.NewReader(strings.NewReader(test.data), test.format, test.opts...)
+		if err != nil {
+			continue
+		}
+		if _, err := rd.Read(); err == nil {
+			t.Errorf("%s: expecting error", name)
+		}
+	}
+
+	if _, err := importer.ParseFormat("xml"); err == nil {
+		t.Errorf("format: expecting error")
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	c := ranges.New(earth.NewPixelation(360))
+	data := "species\tlatitude\tlongitude\nBus cus\t10.5\t-70\nBus cus\t10.5\t-70\nAus bus\t-20\t30\n"
+	if err := importer.ReadAll(strings.NewReader(data), c, importer.Text, 0); err != nil {
+		t.Fatalf("read all: %v", err)
+	}
+	if tx := c.Taxa(); len(tx) != 2 {
+		t.Errorf("read all: got %d taxa, want %d", len(tx), 2)
+	}
+	if tp := c.Type("Bus cus"); tp != ranges.Points {
+		t.Errorf("read all: got type %q, want %q", tp, ranges.Points)
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	f.Add("text", "species\tlatitude\tlongitude\nBus cus\t10.5\t-70\n")
+	f.Add("darwin", "gbifID\tspecies\tdecimalLatitude\tdecimalLongitude\n1\tBus cus\t10.5\t-70\n")
+	f.Add("csv", "gbifID,species,decimalLatitude,decimalLongitude\n1,Bus cus,10.5,-70\n")
+	f.Add("pbdb", "Records:,1\naccepted_name\tlat\tlng\nBus cus\t10.5\t-70\n")
+
+	f.Fuzz(func(t *testing.T, format, data string) {
+		rd, err := importer.NewReader(strings.NewReader(data), importer.Format(format))
+		if err != nil {
+			return
+		}
+		for {
+			rec, err := rd.Read()
+			if err != nil {
+				return
+			}
+			if !(rec.Lat >= -90 && rec.Lat <= 90 && rec.Lon >= -180 && rec.Lon <= 180) {
+				t.Errorf("invalid coordinates: %.6f %.6f", rec.Lat, rec.Lon)
+			}
+		}
+	})
+}
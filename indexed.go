@@ -0,0 +1,691 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/js-arias/earth"
+)
+
+// Layout of an indexed file.
+//
+// All values are little endian.
+// The file starts with a header,
+// followed by a table of taxa
+// (sorted by canonical name),
+// the data of each taxon,
+// the names of the taxa,
+// the names of the extra columns,
+// and the values of the extra columns
+// of each taxon.
+//
+// Strings of the extra columns
+// are stored as a length
+// followed by the bytes of the string.
+const (
+	indexMagic = "RNGIDX\x00\x02"
+
+	// header: magic, equator, number of taxa,
+	// flags, number of extra columns,
+	// extra columns offset
+	indexHeaderSize = 8 + 4 + 4 + 4 + 4 + 8
+
+	// table entry: name offset, name length,
+	// verbatim length, type, number of pixels,
+	// age, data offset, records offset,
+	// min age, max age (both -1 without an age interval),
+	// extra values offset
+	indexEntrySize = 8 + 4 + 4 + 4 + 4 + 8 + 8 + 8 + 8 + 8 + 8
+)
+
+// Flags of an indexed file.
+const (
+	indexVerbatim uint32 = 1 << iota
+)
+
+// Type codes of an indexed file.
+const (
+	indexPoints uint32 = iota + 1
+	indexRange
+)
+
+// WriteIndex encodes a collection
+// as an indexed binary file.
+//
+// An indexed file can be opened with OpenIndexed,
+// and used without decoding the whole collection,
+// so it is useful for processes
+// that use many large collections.
+// Indexed files are read-only,
+// so to modify an indexed collection
+// it must be converted into a regular collection
+// (see Indexed.Collection).
+// The age intervals
+// (see AgeInterval)
+// and the values of the extra columns
+// (see ExtraColumns)
+// are also stored.
+func (c *Collection) WriteIndex(w io.Writer) error {
+	names := c.Taxa()
+
+	var flags uint32
+	if c.keepVerbatim {
+		flags |= indexVerbatim
+	}
+
+	le := binary.LittleEndian
+	head := make([]byte, indexHeaderSize)
+	copy(head, indexMagic)
+	le.PutUint32(head[8:], uint32(c.pix.Equator()))
+	le.PutUint32(head[12:], uint32(len(names)))
+	le.PutUint32(head[16:], flags)
+	le.PutUint32(head[20:], uint32(len(c.extra)))
+
+	// sorted pixels of each taxon
+	pixels := make([][]int, len(names))
+	for i, nm := range names {
+		tax := c.taxa[nm]
+		pixels[i] = make([]int, 0, len(tax.rng))
+		for px := range tax.rng {
+			pixels[i] = append(pixels[i], px)
+		}
+		slices.Sort(pixels[i])
+	}
+
+	// extra values of each taxon
+	var extraCols []byte
+	for _, h := range c.extra {
+		extraCols = appendIndexString(extraCols, h)
+	}
+	extra := make([][]byte, len(names))
+	for i, nm := range names {
+		tax := c.taxa[nm]
+		if len(tax.extra) == 0 {
+			continue
+		}
+		for _, px := range pixels[i] {
+			vals := tax.extra[px]
+			for j := range c.extra {
+				var v string
+				if j < len(vals) {
+					v = vals[j]
+				}
+				extra[i] = appendIndexString(extra[i], v)
+			}
+		}
+	}
+
+	// table of taxa
+	dataOff := uint64(indexHeaderSize + len(names)*indexEntrySize)
+	var dataSize uint64
+	var namesSize uint64
+	for _, nm := range names {
+		tax := c.taxa[nm]
+		dataSize += uint64(len(tax.rng)) * (4 + 8)
+		if tax.recs != nil {
+			dataSize += uint64(len(tax.rng)) * 4
+		}
+		namesSize += uint64(len(tax.name) + len(tax.verbatim))
+	}
+	nameOff := dataOff + dataSize
+	extraOff := nameOff + namesSize
+	le.PutUint64(head[24:], extraOff)
+	extraOff += uint64(len(extraCols))
+
+	table := make([]byte, len(names)*indexEntrySize)
+	for i, nm := range names {
+		tax := c.taxa[nm]
+		e := table[i*indexEntrySize:]
+		le.PutUint64(e[0:], nameOff)
+		le.PutUint32(e[8:], uint32(len(tax.name)))
+		le.PutUint32(e[12:], uint32(len(tax.verbatim)))
+		tp := indexRange
+		if tax.tp == Points {
+			tp = indexPoints
+		}
+		le.PutUint32(e[16:], tp)
+		le.PutUint32(e[20:], uint32(len(tax.rng)))
+		le.PutUint64(e[24:], uint64(tax.age))
+		le.PutUint64(e[32:], dataOff)
+		dataOff += uint64(len(tax.rng)) * (4 + 8)
+		if tax.recs != nil {
+			le.PutUint64(e[40:], dataOff)
+			dataOff += uint64(len(tax.rng)) * 4
+		}
+		min, max := int64(-1), int64(-1)
+		if tax.interval {
+			min, max = tax.minAge, tax.maxAge
+		}
+		le.PutUint64(e[48:], uint64(min))
+		le.PutUint64(e[56:], uint64(max))
+		if len(extra[i]) > 0 {
+			le.PutUint64(e[64:], extraOff)
+			extraOff += uint64(len(extra[i]))
+		}
+		nameOff += uint64(len(tax.name) + len(tax.verbatim))
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(head)
+	bw.Write(table)
+
+	// data of each taxon
+	var buf [8]byte
+	for i, nm := range names {
+		tax := c.taxa[nm]
+		for _, px := range pixels[i] {
+			le.PutUint32(buf[:], uint32(px))
+			bw.Write(buf[:4])
+		}
+		for _, px := range pixels[i] {
+			le.PutUint64(buf[:], math.Float64bits(tax.rng[px]))
+			bw.Write(buf[:])
+		}
+		if tax.recs == nil {
+			continue
+		}
+		for _, px := range pixels[i] {
+			le.PutUint32(buf[:], uint32(tax.recs[px]))
+			bw.Write(buf[:4])
+		}
+	}
+
+	// names
+	for _, nm := range names {
+		tax := c.taxa[nm]
+		bw.WriteString(tax.name)
+		bw.WriteString(tax.verbatim)
+	}
+
+	// extra columns
+	bw.Write(extraCols)
+	for _, e := range extra {
+		bw.Write(e)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// AppendIndexString appends a string
+// of the extra columns of an indexed file.
+func appendIndexString(b []byte, s string) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// ReadIndexString reads a string
+// of the extra columns of an indexed file
+// at the indicated offset,
+// and returns the string
+// and the offset of the next value.
+func readIndexString(data []byte, off uint64) (string, uint64, error) {
+	size := uint64(len(data))
+	if off > size || size-off < 4 {
+		return "", 0, errors.New("truncated extra columns")
+	}
+	n := uint64(binary.LittleEndian.Uint32(data[off:]))
+	off += 4
+	if n > size-off {
+		return "", 0, errors.New("truncated extra columns")
+	}
+	return string(data[off : off+n]), off + n, nil
+}
+
+// Indexed is a read-only collection
+// stored in an indexed file.
+//
+// The data is accessed directly from the file
+// (using a memory map in the systems that support it),
+// so opening an indexed collection is fast,
+// and the memory used is shared with the operating system cache.
+// An Indexed collection is safe for concurrent use.
+type Indexed struct {
+	data  []byte
+	close func() error
+
+	pix      *earth.Pixelation
+	n        int
+	verbatim bool
+	extra    []string
+}
+
+// OpenIndexed opens an indexed file
+// created with WriteIndex.
+// If pix is not nil,
+// the file must use the same pixelation,
+// so many collections can share it.
+// The returned collection should be closed
+// after it is no longer used.
+func OpenIndexed(name string, pix *earth.Pixelation) (*Indexed, error) {
+	data, close, err := mapFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := ParseIndexed(data, pix)
+	if err != nil {
+		close()
+		return nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	ix.close = close
+	return ix, nil
+}
+
+// ParseIndexed returns an indexed collection
+// from the content of an indexed file.
+// If pix is not nil,
+// the file must use the same pixelation.
+// The data is used directly by the collection,
+// so it must not be modified.
+func ParseIndexed(data []byte, pix *earth.Pixelation) (*Indexed, error) {
+	if len(data) < indexHeaderSize || string(data[:8]) != indexMagic {
+		return nil, errors.New("invalid indexed file")
+	}
+	le := binary.LittleEndian
+	eq := int(le.Uint32(data[8:]))
+	if eq < 2 {
+		return nil, fmt.Errorf("invalid indexed file: invalid equator %d", eq)
+	}
+	if pix == nil {
+		pix = earth.NewPixelation(eq)
+	}
+	if pix.Equator() != eq {
+		return nil, fmt.Errorf("invalid pixelation: got %d, want %d", eq, pix.Equator())
+	}
+	n := int(le.Uint32(data[12:]))
+	if uint64(len(data)) < uint64(indexHeaderSize)+uint64(n)*indexEntrySize {
+		return nil, errors.New("invalid indexed file: truncated table")
+	}
+
+	ix := &Indexed{
+		data:     data,
+		pix:      pix,
+		n:        n,
+		verbatim: le.Uint32(data[16:])&indexVerbatim != 0,
+	}
+
+	// extra columns
+	off := le.Uint64(data[24:])
+	for i := 0; i < int(le.Uint32(data[20:])); i++ {
+		h, next, err := readIndexString(data, off)
+		if err != nil {
+			return nil, fmt.Errorf("invalid indexed file: %v", err)
+		}
+		ix.extra = append(ix.extra, h)
+		off = next
+	}
+
+	// check the table
+	size := uint64(len(data))
+	prev := ""
+	for i := 0; i < n; i++ {
+		e := ix.entry(i)
+		nameOff := le.Uint64(e[0:])
+		nameLen := uint64(le.Uint32(e[8:])) + uint64(le.Uint32(e[12:]))
+		if nameOff > size || nameLen > size-nameOff {
+			return nil, fmt.Errorf("invalid indexed file: taxon %d: invalid name", i)
+		}
+		nm := ix.name(i)
+		if i > 0 && nm <= prev {
+			return nil, fmt.Errorf("invalid indexed file: taxon %q: unsorted table", nm)
+		}
+		prev = nm
+		if tp := le.Uint32(e[16:]); tp != indexPoints && tp != indexRange {
+			return nil, fmt.Errorf("invalid indexed file: taxon %q: invalid type %d", nm, tp)
+		}
+		np := uint64(le.Uint32(e[20:]))
+		dataOff := le.Uint64(e[32:])
+		if dataOff > size || np*(4+8) > size-dataOff {
+			return nil, fmt.Errorf("invalid indexed file: taxon %q: truncated data", nm)
+		}
+		if recOff := le.Uint64(e[40:]); recOff != 0 {
+			if recOff > size || np*4 > size-recOff {
+				return nil, fmt.Errorf("invalid indexed file: taxon %q: truncated records", nm)
+			}
+		}
+		if min, max := int64(le.Uint64(e[48:])), int64(le.Uint64(e[56:])); min != -1 || max != -1 {
+			if !validInterval(min, max) {
+				return nil, fmt.Errorf("invalid indexed file: taxon %q: invalid age interval %d-%d", nm, min, max)
+			}
+		}
+		if extraOff := le.Uint64(e[64:]); extraOff > size {
+			return nil, fmt.Errorf("invalid indexed file: taxon %q: truncated extra columns", nm)
+		}
+	}
+	return ix, nil
+}
+
+// Close releases the resources
+// used by an indexed collection.
+// The collection must not be used
+// after it is closed.
+func (ix *Indexed) Close() error {
+	if ix.close == nil {
+		return nil
+	}
+	err := ix.close()
+	ix.close = nil
+	ix.data = nil
+	return err
+}
+
+// Age returns the age
+// (in years)
+// used to set the range map of a taxon.
+func (ix *Indexed) Age(name string) int64 {
+	i := ix.find(name)
+	if i < 0 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(ix.entry(i)[24:]))
+}
+
+// AgeInterval returns the age interval of a taxon
+// (in years).
+// If the taxon does not have an age interval,
+// both values are the age of the taxon
+// (see Collection.AgeInterval).
+func (ix *Indexed) AgeInterval(name string) (min, max int64) {
+	i := ix.find(name)
+	if i < 0 {
+		return 0, 0
+	}
+	e := ix.entry(i)
+	min, max = int64(binary.LittleEndian.Uint64(e[48:])), int64(binary.LittleEndian.Uint64(e[56:]))
+	if min == -1 && max == -1 {
+		age := int64(binary.LittleEndian.Uint64(e[24:]))
+		return age, age
+	}
+	return min, max
+}
+
+// HasAgeInterval returns true
+// if a taxon has an age interval.
+func (ix *Indexed) HasAgeInterval(name string) bool {
+	i := ix.find(name)
+	if i < 0 {
+		return false
+	}
+	return int64(binary.LittleEndian.Uint64(ix.entry(i)[48:])) != -1
+}
+
+// Collection returns a regular collection
+// with the content of the indexed collection.
+func (ix *Indexed) Collection() (*Collection, error) {
+	c := New(ix.pix)
+	c.keepVerbatim = ix.verbatim
+	c.extra = slices.Clone(ix.extra)
+	for i := 0; i < ix.n; i++ {
+		nm := ix.name(i)
+		r := ix.pixels(i)
+		tax := &taxon{
+			name:     nm,
+			verbatim: ix.verbatimName(i),
+			tp:       ix.typeOf(i),
+			age:      int64(binary.LittleEndian.Uint64(ix.entry(i)[24:])),
+			rng:      make(map[int]float64, r.Len()),
+		}
+		if r.recOff != 0 {
+			tax.recs = make(map[int]int, r.Len())
+		}
+		for j := 0; j < r.Len(); j++ {
+			px := r.Pixel(j)
+			if px >= ix.pix.Len() {
+				return nil, fmt.Errorf("taxon %q: invalid pixel value %d", nm, px)
+			}
+			tax.rng[px] = r.Density(j)
+			if tax.recs != nil {
+				if n := r.Records(j); n > 0 {
+					tax.recs[px] = n
+				}
+			}
+		}
+		e := ix.entry(i)
+		if min, max := int64(binary.LittleEndian.Uint64(e[48:])), int64(binary.LittleEndian.Uint64(e[56:])); min != -1 || max != -1 {
+			tax.interval = true
+			tax.minAge = min
+			tax.maxAge = max
+		}
+		if err := ix.readExtra(tax, r, binary.LittleEndian.Uint64(e[64:])); err != nil {
+			return nil, fmt.Errorf("taxon %q: %v", nm, err)
+		}
+		c.addTaxon(tax)
+	}
+	return c, nil
+}
+
+// ReadExtra reads the values of the extra columns
+// of a taxon
+// stored at the indicated offset.
+func (ix *Indexed) readExtra(tax *taxon, r IndexedRange, off uint64) error {
+	if off == 0 || len(ix.extra) == 0 {
+		return nil
+	}
+	for j := 0; j < r.Len(); j++ {
+		vals := make([]string, len(ix.extra))
+		var ok bool
+		for k := range vals {
+			v, next, err := readIndexString(ix.data, off)
+			if err != nil {
+				return err
+			}
+			vals[k] = v
+			off = next
+			if v != "" {
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if tax.extra == nil {
+			tax.extra = make(map[int][]string)
+		}
+		tax.extra[r.Pixel(j)] = vals
+	}
+	return nil
+}
+
+// HasTaxon returns true if the indicated taxon
+// is in the collection.
+func (ix *Indexed) HasTaxon(name string) bool {
+	return ix.find(name) >= 0
+}
+
+// Len returns the number of taxa
+// in the collection.
+func (ix *Indexed) Len() int {
+	return ix.n
+}
+
+// Pixelation returns the underlying pixelation
+// of the collection.
+func (ix *Indexed) Pixelation() *earth.Pixelation {
+	return ix.pix
+}
+
+// Pixels returns the pixels of the range of a taxon,
+// without copying them.
+// If the taxon is not in the collection,
+// it returns an empty range.
+func (ix *Indexed) Pixels(name string) IndexedRange {
+	i := ix.find(name)
+	if i < 0 {
+		return IndexedRange{}
+	}
+	return ix.pixels(i)
+}
+
+// Range returns a range map of a taxon,
+// as a new map of pixel IDs
+// to the probability field scaled to set
+// the maximum value equal to 1.0.
+func (ix *Indexed) Range(name string) map[int]float64 {
+	i := ix.find(name)
+	if i < 0 {
+		return nil
+	}
+	r := ix.pixels(i)
+	rng := make(map[int]float64, r.Len())
+	for j := 0; j < r.Len(); j++ {
+		rng[r.Pixel(j)] = r.Density(j)
+	}
+	return rng
+}
+
+// Taxa returns an slice with the taxon names
+// of the taxa in the collection.
+func (ix *Indexed) Taxa() []string {
+	ls := make([]string, 0, ix.n)
+	for i := 0; i < ix.n; i++ {
+		ls = append(ls, ix.name(i))
+	}
+	return ls
+}
+
+// Type returns the type of a range map for a given taxon.
+func (ix *Indexed) Type(name string) Type {
+	i := ix.find(name)
+	if i < 0 {
+		return ""
+	}
+	return ix.typeOf(i)
+}
+
+// VerbatimName returns the name of a taxon
+// as it was given when the taxon was added
+// to the collection.
+func (ix *Indexed) VerbatimName(name string) string {
+	i := ix.find(name)
+	if i < 0 {
+		return ""
+	}
+	return ix.verbatimName(i)
+}
+
+// Entry returns the table entry of the i-th taxon.
+func (ix *Indexed) entry(i int) []byte {
+	off := indexHeaderSize + i*indexEntrySize
+	return ix.data[off : off+indexEntrySize]
+}
+
+// Find returns the index of a taxon in the table,
+// or -1 if the taxon is not in the collection.
+func (ix *Indexed) find(name string) int {
+	name = canon(name)
+	if name == "" {
+		return -1
+	}
+	i := sort.Search(ix.n, func(i int) bool {
+		return ix.name(i) >= name
+	})
+	if i < ix.n && ix.name(i) == name {
+		return i
+	}
+	return -1
+}
+
+func (ix *Indexed) name(i int) string {
+	e := ix.entry(i)
+	off := binary.LittleEndian.Uint64(e[0:])
+	n := uint64(binary.LittleEndian.Uint32(e[8:]))
+	return string(ix.data[off : off+n])
+}
+
+func (ix *Indexed) verbatimName(i int) string {
+	e := ix.entry(i)
+	off := binary.LittleEndian.Uint64(e[0:]) + uint64(binary.LittleEndian.Uint32(e[8:]))
+	n := uint64(binary.LittleEndian.Uint32(e[12:]))
+	return string(ix.data[off : off+n])
+}
+
+func (ix *Indexed) typeOf(i int) Type {
+	if binary.LittleEndian.Uint32(ix.entry(i)[16:]) == indexPoints {
+		return Points
+	}
+	return Range
+}
+
+func (ix *Indexed) pixels(i int) IndexedRange {
+	e := ix.entry(i)
+	return IndexedRange{
+		data:   ix.data,
+		n:      int(binary.LittleEndian.Uint32(e[20:])),
+		off:    binary.LittleEndian.Uint64(e[32:]),
+		recOff: binary.LittleEndian.Uint64(e[40:]),
+	}
+}
+
+// An IndexedRange is the range of a taxon
+// in an indexed collection,
+// stored as a sorted array of pixels.
+type IndexedRange struct {
+	data   []byte
+	n      int
+	off    uint64
+	recOff uint64
+}
+
+// Len returns the number of pixels in the range.
+func (r IndexedRange) Len() int {
+	return r.n
+}
+
+// Pixel returns the ID of the i-th pixel of the range.
+// Pixels are sorted by ID.
+func (r IndexedRange) Pixel(i int) int {
+	off := r.off + uint64(i)*4
+	return int(binary.LittleEndian.Uint32(r.data[off:]))
+}
+
+// Density returns the density of the i-th pixel of the range.
+func (r IndexedRange) Density(i int) float64 {
+	off := r.off + uint64(r.n)*4 + uint64(i)*8
+	return math.Float64frombits(binary.LittleEndian.Uint64(r.data[off:]))
+}
+
+// Records returns the number of records
+// at the i-th pixel of the range.
+// It returns 0 if the records were not counted.
+func (r IndexedRange) Records(i int) int {
+	if r.recOff == 0 {
+		return 0
+	}
+	off := r.recOff + uint64(i)*4
+	return int(binary.LittleEndian.Uint32(r.data[off:]))
+}
+
+// Lookup returns the density of a pixel,
+// and true if the pixel is in the range.
+func (r IndexedRange) Lookup(pixel int) (float64, bool) {
+	i := sort.Search(r.n, func(i int) bool {
+		return r.Pixel(i) >= pixel
+	})
+	if i < r.n && r.Pixel(i) == pixel {
+		return r.Density(i), true
+	}
+	return 0, false
+}
+
+// ReadFile reads the whole content of a file,
+// for files that can not be mapped into memory.
+func readFile(name string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,148 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestIndexed(t *testing.T) {
+	data := makeCollection(t)
+
+	var buf bytes.Buffer
+	if err := data.WriteIndex(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	name := filepath.Join(t.TempDir(), "ranges.idx")
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("while writing file: %v", err)
+	}
+
+	ix, err := ranges.OpenIndexed(name, nil)
+	if err != nil {
+		t.Fatalf("while opening data: %v", err)
+	}
+	defer ix.Close()
+
+	if eq := ix.Pixelation().Equator(); eq != 360 {
+		t.Errorf("pixelation: got %d pixels, want %d", eq, 360)
+	}
+	if ls := ix.Taxa(); !reflect.DeepEqual(ls, data.Taxa()) {
+		t.Errorf("taxa: got %v, want %v", ls, data.Taxa())
+	}
+	for _, nm := range data.Taxa() {
+		if !ix.HasTaxon(nm) {
+			t.Errorf("hasTaxon: taxon %q not found", nm)
+		}
+		if tp := ix.Type(nm); tp != data.Type(nm) {
+			t.Errorf("type %q: got %q, want %q", nm, tp, data.Type(nm))
+		}
+		if a := ix.Age(nm); a != data.Age(nm) {
+			t.Errorf("age %q: got %d, want %d", nm, a, data.Age(nm))
+		}
+		if rng := ix.Range(nm); !reflect.DeepEqual(rng, data.Range(nm)) {
+			t.Errorf("range %q: got %v, want %v", nm, rng, data.Range(nm))
+		}
+
+		r := ix.Pixels(nm)
+		if r.Len() != len(data.Range(nm)) {
+			t.Errorf("pixels %q: got %d pixels, want %d", nm, r.Len(), len(data.Range(nm)))
+		}
+		for px, d := range data.Range(nm) {
+			v, ok := r.Lookup(px)
+			if !ok || v != d {
+				t.Errorf("lookup %q: pixel %d: got %.6f, want %.6f", nm, px, v, d)
+			}
+		}
+	}
+	if ix.HasTaxon("Homo sapiens") {
+		t.Errorf("hasTaxon: unexpected taxon %q", "Homo sapiens")
+	}
+	if _, ok := ix.Pixels("Brontostoma discus").Lookup(17320); ok {
+		t.Errorf("lookup: unexpected pixel %d", 17320)
+	}
+
+	c, err := ix.Collection()
+	if err != nil {
+		t.Fatalf("collection: %v", err)
+	}
+	testCollection(t, c)
+	nm := "Rhododendron ericoides"
+	if !reflect.DeepEqual(c.Records(nm), data.Records(nm)) {
+		t.Errorf("records: got %v, want %v", c.Records(nm), data.Records(nm))
+	}
+}
+
+func TestIndexedInvalid(t *testing.T) {
+	data := makeCollection(t)
+
+	var buf bytes.Buffer
+	if err := data.WriteIndex(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	b := buf.Bytes()
+
+	if _, err := ranges.ParseIndexed(b[:len(b)-1], nil); err == nil {
+		t.Errorf("truncated file: expecting error")
+	}
+	if _, err := ranges.ParseIndexed(b, earth.NewPixelation(120)); err == nil {
+		t.Errorf("different pixelation: expecting error")
+	}
+	if _, err := ranges.ParseIndexed([]byte("taxon\ttype\n"), nil); err == nil {
+		t.Errorf("TSV file: expecting error")
+	}
+}
+
+func TestIndexedIntervalExtra(t *testing.T) {
+	data := ranges.New(earth.NewPixelation(360))
+	data.Add("Aus bus", 0, 10, 10)
+	data.Add("Aus bus", 0, 20, 20)
+	data.Add("Aus cus", 0, 30, 30)
+	data.SetAgeInterval("Aus bus", 5_000_000, 10_000_000)
+	px := data.Pixelation().Pixel(10, 10).ID()
+	data.AddMeans("Aus bus", px, ranges.Introduced)
+
+	var buf bytes.Buffer
+	if err := data.WriteIndex(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	ix, err := ranges.ParseIndexed(buf.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	if !ix.HasAgeInterval("Aus bus") || ix.HasAgeInterval("Aus cus") {
+		t.Errorf("age interval: got %v %v, want true false", ix.HasAgeInterval("Aus bus"), ix.HasAgeInterval("Aus cus"))
+	}
+	if min, max := ix.AgeInterval("Aus bus"); min != 5_000_000 || max != 10_000_000 {
+		t.Errorf("age interval: got %d-%d, want 5000000-10000000", min, max)
+	}
+
+	c, err := ix.Collection()
+	if err != nil {
+		t.Fatalf("collection: %v", err)
+	}
+	if min, max := c.AgeInterval("Aus bus"); !c.HasAgeInterval("Aus bus") || min != 5_000_000 || max != 10_000_000 {
+		t.Errorf("collection age interval: got %d-%d, want 5000000-10000000", min, max)
+	}
+	if c.HasAgeInterval("Aus cus") {
+		t.Errorf("collection age interval: unexpected interval for %q", "Aus cus")
+	}
+	if !reflect.DeepEqual(c.ExtraColumns(), data.ExtraColumns()) {
+		t.Errorf("extra columns: got %v, want %v", c.ExtraColumns(), data.ExtraColumns())
+	}
+	if got, want := c.Means("Aus bus"), data.Means("Aus bus"); !reflect.DeepEqual(got, want) {
+		t.Errorf("means: got %v, want %v", got, want)
+	}
+	if got := c.Means("Aus cus"); len(got) != 0 {
+		t.Errorf("means: got %v, want no values", got)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+// AgeInterval returns the age interval of a taxon
+// (in years),
+// i.e. the uncertainty of the age of the taxon.
+// If the taxon does not have an age interval,
+// both values are the age of the taxon.
+//
+// Note that the age interval is independent
+// of the age of the range
+// (see Age),
+// that is the age of the pixel locations.
+// For example,
+// the present locations of a fossil
+// have an age of 0,
+// and an age interval with the age of the fossil.
+func (c *Collection) AgeInterval(name string) (min, max int64) {
+	name = canon(name)
+	if name == "" {
+		return 0, 0
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return 0, 0
+	}
+	return tax.ageInterval()
+}
+
+// HasAgeInterval returns true
+// if a taxon has an age interval.
+func (c *Collection) HasAgeInterval(name string) bool {
+	name = canon(name)
+	if name == "" {
+		return false
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return false
+	}
+	return tax.interval
+}
+
+// HasAgeIntervals returns true
+// if any taxon in the collection
+// has an age interval.
+func (c *Collection) HasAgeIntervals() bool {
+	for _, tax := range c.taxa {
+		if tax.interval {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAgeInterval sets the age interval of a taxon
+// (in years).
+// It returns false if the taxon is not in the collection,
+// or if the interval is not valid
+// (i.e. min is larger than max,
+// or the ages are not between 0 and MaxAge).
+func (c *Collection) SetAgeInterval(name string, min, max int64) bool {
+	name = canon(name)
+	if name == "" {
+		return false
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return false
+	}
+	if !validInterval(min, max) {
+		return false
+	}
+	tax.interval = true
+	tax.minAge = min
+	tax.maxAge = max
+	return true
+}
+
+// RemoveAgeInterval removes the age interval
+// of a taxon.
+func (c *Collection) RemoveAgeInterval(name string) {
+	name = canon(name)
+	if name == "" {
+		return
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return
+	}
+	tax.interval = false
+	tax.minAge = 0
+	tax.maxAge = 0
+}
+
+// AgeInterval returns the age interval of a taxon,
+// or its age,
+// if the taxon does not have an age interval.
+func (tax *taxon) ageInterval() (min, max int64) {
+	if !tax.interval {
+		return tax.age, tax.age
+	}
+	return tax.minAge, tax.maxAge
+}
+
+// ValidInterval returns true
+// if an age interval is valid.
+func validInterval(min, max int64) bool {
+	if min < 0 || max > MaxAge {
+		return false
+	}
+	return min <= max
+}
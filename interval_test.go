@@ -0,0 +1,144 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/ranges"
+)
+
+func TestAgeInterval(t *testing.T) {
+	c := makeCollection(t)
+	tax := "Rhododendron ericoides"
+
+	if c.HasAgeIntervals() {
+		t.Errorf("collection without intervals: got intervals")
+	}
+	if min, max := c.AgeInterval(tax); min != 0 || max != 0 {
+		t.Errorf("undefined interval: got %d-%d, want 0-0", min, max)
+	}
+
+	if c.SetAgeInterval(tax, 10, 5) {
+		t.Errorf("invalid interval: interval accepted")
+	}
+	if !c.SetAgeInterval(tax, 5_000_000, 10_000_000) {
+		t.Fatalf("valid interval: interval not accepted")
+	}
+	if !c.HasAgeInterval(tax) || !c.HasAgeIntervals() {
+		t.Errorf("interval not set")
+	}
+	if min, max := c.AgeInterval(tax); min != 5_000_000 || max != 10_000_000 {
+		t.Errorf("interval: got %d-%d, want 5000000-10000000", min, max)
+	}
+
+	// the interval is kept when the range is modified
+	c.SetPixels(tax, 0, c.Range(tax))
+	if min, max := c.AgeInterval(tax); min != 5_000_000 || max != 10_000_000 {
+		t.Errorf("interval after set: got %d-%d, want 5000000-10000000", min, max)
+	}
+
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\tmin_age\tmax_age\r\n") {
+		t.Errorf("interval columns not found in output header")
+	}
+	nc, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	for _, tx := range c.Taxa() {
+		min, max := c.AgeInterval(tx)
+		gotMin, gotMax := nc.AgeInterval(tx)
+		if gotMin != min || gotMax != max || nc.HasAgeInterval(tx) != c.HasAgeInterval(tx) {
+			t.Errorf("interval of %q: got %d-%d, want %d-%d", tx, gotMin, gotMax, min, max)
+		}
+	}
+
+	// merge produces the union of intervals
+	c.Set("Aus bus", 0, map[int]float64{10: 1})
+	c.Set("Aus cus", 0, map[int]float64{11: 1})
+	c.SetAgeInterval("Aus bus", 1_000_000, 3_000_000)
+	c.SetAgeInterval("Aus cus", 2_000_000, 6_000_000)
+	if err := c.Merge("Aus bus", "Aus cus"); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if min, max := c.AgeInterval("Aus bus"); min != 1_000_000 || max != 6_000_000 {
+		t.Errorf("merged interval: got %d-%d, want 1000000-6000000", min, max)
+	}
+
+	// the interval of a single taxon
+	// is not extended with the age of the other taxon
+	c.Set("Aus cus", 0, map[int]float64{11: 1})
+	c.SetAgeInterval("Aus cus", 2_000_000, 6_000_000)
+	c.Set("Aus dus", 0, map[int]float64{12: 1})
+	if err := c.Merge("Aus dus", "Aus cus"); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if min, max := c.AgeInterval("Aus dus"); min != 2_000_000 || max != 6_000_000 {
+		t.Errorf("merged interval: got %d-%d, want 2000000-6000000", min, max)
+	}
+
+	c.RemoveAgeInterval(tax)
+	if c.HasAgeInterval(tax) {
+		t.Errorf("interval not removed")
+	}
+}
+
+func TestReadAgeInterval(t *testing.T) {
+	tests := map[string]struct {
+		in    string
+		err   bool
+		field string
+	}{
+		"valid": {
+			in: "taxon\ttype\tage\tequator\tpixel\tdensity\tmin_age\tmax_age\nAus bus\tpoints\t0\t360\t10\t1\t5\t10\nAus bus\tpoints\t0\t360\t11\t1\t5\t10\n",
+		},
+		"missing column": {
+			in:  "taxon\ttype\tage\tequator\tpixel\tdensity\tmin_age\nAus bus\tpoints\t0\t360\t10\t1\t5\n",
+			err: true,
+		},
+		"inverted": {
+			in:  "taxon\ttype\tage\tequator\tpixel\tdensity\tmin_age\tmax_age\nAus bus\tpoints\t0\t360\t10\t1\t10\t5\n",
+			err: true,
+		},
+		"inconsistent": {
+			in:    "taxon\ttype\tage\tequator\tpixel\tdensity\tmin_age\tmax_age\nAus bus\tpoints\t0\t360\t10\t1\t5\t10\nAus bus\tpoints\t0\t360\t11\t1\t\t\n",
+			err:   true,
+			field: "min_age",
+		},
+		"inconsistent max": {
+			in:    "taxon\ttype\tage\tequator\tpixel\tdensity\tmin_age\tmax_age\nAus bus\tpoints\t0\t360\t10\t1\t5\t10\nAus bus\tpoints\t0\t360\t11\t1\t5\t12\n",
+			err:   true,
+			field: "max_age",
+		},
+	}
+
+	for name, test := range tests {
+		c, err := ranges.ReadTSV(strings.NewReader(test.in), nil)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expecting error", name)
+				continue
+			}
+			if test.field != "" && !strings.Contains(err.Error(), fmt.Sprintf("field %q", test.field)) {
+				t.Errorf("%s: error %q: want field %q", name, err, test.field)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if min, max := c.AgeInterval("Aus bus"); min != 5 || max != 10 {
+			t.Errorf("%s: interval: got %d-%d, want 5-10", name, min, max)
+		}
+	}
+}
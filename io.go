@@ -6,10 +6,13 @@ package ranges
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -18,6 +21,20 @@ import (
 	"github.com/js-arias/earth"
 )
 
+// FormatVersion is the version of the TSV format
+// written by the package.
+//
+// A new version only adds columns to the format,
+// so files with a newer version can be read
+// by older versions of the package.
+//
+// Version 2 adds the optional columns
+// "min_age" and "max_age",
+// with the age interval of each taxon.
+const FormatVersion = 2
+
+const versionComment = "# format version:"
+
 var headerFields = []string{
 	"taxon",
 	"type",
@@ -27,6 +44,12 @@ var headerFields = []string{
 	"density",
 }
 
+// Columns of the age interval of a taxon.
+const (
+	minAgeColumn = "min_age"
+	maxAgeColumn = "max_age"
+)
+
 // ReadTSV reads a collection of range maps
 // from a TSV file.
 //
@@ -42,6 +65,31 @@ var headerFields = []string{
 //   - pixel, the ID of a pixel (from the pixelation)
 //   - density, the density for the presence at that pixel
 //
+// Optionally,
+// the file can contain the column "records",
+// with the number of records of a taxon at a pixel
+// (only used for "points" ranges),
+// and the columns "min_age" and "max_age",
+// with the age interval of the taxon
+// (in years,
+// see Collection.AgeInterval).
+// The age interval must be the same
+// in all the rows of a taxon,
+// and a taxon without an age interval
+// has both columns empty.
+//
+// The columns can be in any order.
+// Any other column is kept as an extra column
+// (see ExtraColumns),
+// and written back when the collection is encoded.
+//
+// The file can contain a comment
+// with the version of the format,
+// in the form "# format version: 2".
+// Files without the version comment,
+// or with a newer version,
+// are read in the same way.
+//
 // Here is an example file:
 //
 //	# range distribution models
@@ -56,10 +104,58 @@ var headerFields = []string{
 //	Rhododendron ericoides	points	0	360	18588	1.000000
 //	Rhododendron ericoides	points	0	360	19305	1.000000
 //	Rhododendron ericoides	points	0	360	19308	1.000000
-func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
-	tab := csv.NewReader(r)
+//
+// Options can be used to read only a part of the file
+// (see WithTaxa, WithAgeRange, WithMeans, and WithoutMeans).
+// Skipped rows are not validated.
+//
+// The values of each row are validated:
+// the pixel must be defined in the pixelation,
+// the density must be a non-negative number,
+// the age must be between 0 and MaxAge,
+// and if the pixelation is taken from the file,
+// the equator must be between 2 and MaxEquator.
+// An invalid value is reported as an error
+// with the row in which it was found.
+func ReadTSV(r io.Reader, pix *earth.Pixelation, opts ...ReadOption) (*Collection, error) {
+	return ReadTSVContext(context.Background(), r, pix, opts...)
+}
+
+// MaxEquator is the largest number of pixels
+// at the equator
+// (i.e. a resolution of 0.1 degrees)
+// accepted by ReadTSV
+// when the pixelation is taken from the file.
+const MaxEquator = 3600
+
+// MaxAge is the oldest age
+// (the age of the Earth, in years)
+// accepted by ReadTSV.
+const MaxAge = 4_600_000_000
+
+// CheckEvery is the number of rows
+// read between checks of the context.
+const checkEvery = 1024
+
+// ReadTSVContext is like ReadTSV,
+// but it stops reading
+// and returns the context error
+// if the context is canceled.
+func ReadTSVContext(ctx context.Context, r io.Reader, pix *earth.Pixelation, opts ...ReadOption) (*Collection, error) {
+	var o readOptions
+	for _, fn := range opts {
+		fn(&o)
+	}
+
+	br := bufio.NewReader(r)
+	if _, err := readVersion(br); err != nil {
+		return nil, err
+	}
+
+	tab := csv.NewReader(br)
 	tab.Comma = '\t'
 	tab.Comment = '#'
+	tab.ReuseRecord = true
 
 	head, err := tab.Read()
 	if err != nil {
@@ -76,17 +172,53 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 		}
 	}
 
+	// extra columns
+	var extraCols []string
+	var extraIdx []int
+	for i, h := range head {
+		if isKnownField(strings.ToLower(h)) {
+			continue
+		}
+		if fields[strings.ToLower(h)] != i {
+			// duplicated column
+			continue
+		}
+		extraCols = append(extraCols, h)
+		extraIdx = append(extraIdx, i)
+	}
+
+	meansCol, hasMeans := fields[strings.ToLower(MeansColumn)]
+
+	minAgeCol, hasMinAge := fields[minAgeColumn]
+	maxAgeCol, hasMaxAge := fields[maxAgeColumn]
+	if hasMinAge != hasMaxAge {
+		if hasMinAge {
+			return nil, fmt.Errorf("expecting field %q", maxAgeColumn)
+		}
+		return nil, fmt.Errorf("expecting field %q", minAgeColumn)
+	}
+
 	var c *Collection
 	max := make(map[string]float64)
-	for {
+	for i := 0; ; i++ {
+		if i%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
 		row, err := tab.Read()
 		if errors.Is(err, io.EOF) {
 			break
 		}
-		ln, _ := tab.FieldPos(0)
 		if err != nil {
-			return nil, fmt.Errorf("on row %d: %v", ln, err)
+			// FieldPos is not valid after a parse error
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				return nil, fmt.Errorf("on row %d: %v", pe.Line, pe.Err)
+			}
+			return nil, fmt.Errorf("while reading data: %v", err)
 		}
+		ln, _ := tab.FieldPos(0)
 
 		f := "equator"
 		eq, err := strconv.Atoi(row[fields[f]])
@@ -94,6 +226,9 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
 		}
 		if pix == nil {
+			if eq < 2 || eq > MaxEquator {
+				return nil, fmt.Errorf("on row %d: field %q: invalid equator value %d", ln, f, eq)
+			}
 			pix = earth.NewPixelation(eq)
 		}
 		if pix.Equator() != eq {
@@ -102,6 +237,16 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 
 		if c == nil {
 			c = New(pix)
+			c.extra = extraCols
+		}
+
+		f = "taxon"
+		nm := canon(row[fields[f]])
+		if nm == "" {
+			continue
+		}
+		if o.taxa != nil && !o.taxa[nm] {
+			continue
 		}
 
 		f = "type"
@@ -122,21 +267,36 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 		if err != nil {
 			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
 		}
-
-		f = "taxon"
-		nm := canon(row[fields[f]])
-		if nm == "" {
+		if age < 0 || age > MaxAge {
+			return nil, fmt.Errorf("on row %d: field %q: invalid age %d", ln, f, age)
+		}
+		if o.ages && (age < o.minAge || age > o.maxAge) {
 			continue
 		}
+		if tp == Points && (o.means != nil || o.noMeans != nil) {
+			var m Means
+			if hasMeans {
+				m = ParseMeans(row[meansCol])
+			}
+			if o.means != nil && !o.means[m] {
+				continue
+			}
+			if o.noMeans[m] {
+				continue
+			}
+		}
+
+		f = "taxon"
 		tax, ok := c.taxa[nm]
 		if !ok {
 			tax = &taxon{
-				name: nm,
-				tp:   tp,
-				age:  age,
-				rng:  make(map[int]float64),
+				name:     nm,
+				verbatim: normalize(row[fields[f]]),
+				tp:       tp,
+				age:      age,
+				rng:      make(map[int]float64),
 			}
-			c.taxa[nm] = tax
+			c.addTaxon(tax)
 		}
 		if tax.tp != tp {
 			return nil, fmt.Errorf("on row %d: field %q: invalid type: got %q, want %q", ln, f, tp, tax.tp)
@@ -144,13 +304,31 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 		if tax.age != age {
 			return nil, fmt.Errorf("on row %d: field %q: invalid age: got %d, want %d", ln, f, age, tax.age)
 		}
+		if hasMinAge {
+			interval, min, max, err := readInterval(row[minAgeCol], row[maxAgeCol])
+			if err != nil {
+				return nil, fmt.Errorf("on row %d: %v", ln, err)
+			}
+			if !ok {
+				tax.interval = interval
+				tax.minAge = min
+				tax.maxAge = max
+			}
+			if tax.interval != interval || tax.minAge != min || tax.maxAge != max {
+				f := minAgeColumn
+				if tax.interval == interval && tax.minAge == min {
+					f = maxAgeColumn
+				}
+				return nil, fmt.Errorf("on row %d: field %q: invalid age interval: got %s, want %s", ln, f, formatInterval(interval, min, max), formatInterval(tax.interval, tax.minAge, tax.maxAge))
+			}
+		}
 
 		f = "pixel"
 		px, err := strconv.Atoi(row[fields[f]])
 		if err != nil {
 			return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
 		}
-		if px >= pix.Len() {
+		if px < 0 || px >= pix.Len() {
 			return nil, fmt.Errorf("on row %d: field %q: invalid pixel value %d", ln, f, px)
 		}
 
@@ -161,9 +339,46 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 			if err != nil {
 				return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
 			}
+			if math.IsNaN(d) || math.IsInf(d, 0) || d < 0 {
+				return nil, fmt.Errorf("on row %d: field %q: invalid density %v", ln, f, d)
+			}
 			density = d
 		}
 		tax.rng[px] = density
+		if len(extraIdx) > 0 {
+			vals := make([]string, len(extraIdx))
+			var ok bool
+			for i, j := range extraIdx {
+				vals[i] = row[j]
+				if row[j] != "" {
+					ok = true
+				}
+			}
+			if ok {
+				if tax.extra == nil {
+					tax.extra = make(map[int][]string)
+				}
+				tax.extra[px] = vals
+			}
+		}
+		if tax.tp == Points {
+			f = "records"
+			if _, ok := fields[f]; ok && row[fields[f]] != "" {
+				n, err := strconv.Atoi(row[fields[f]])
+				if err != nil {
+					return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+				}
+				if n < 0 {
+					return nil, fmt.Errorf("on row %d: field %q: invalid number of records %d", ln, f, n)
+				}
+				if n > 0 {
+					if tax.recs == nil {
+						tax.recs = make(map[int]int)
+					}
+					tax.recs[px] += n
+				}
+			}
+		}
 		if max[tax.name] < density {
 			max[tax.name] = density
 		}
@@ -177,7 +392,9 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 		if tax.tp == Points {
 			continue
 		}
-		if max[tax.name] == 1 {
+		if max[tax.name] == 1 || max[tax.name] == 0 {
+			// a range with only zero densities
+			// is kept as it is
 			continue
 		}
 
@@ -190,54 +407,396 @@ func ReadTSV(r io.Reader, pix *earth.Pixelation) (*Collection, error) {
 	return c, nil
 }
 
+// ReadVersion reads the format version
+// from the comments at the start of a file,
+// without consuming the input.
+// It returns 0 if the file does not have a version comment.
+func readVersion(br *bufio.Reader) (int, error) {
+	data, _ := br.Peek(4096)
+	for len(data) > 0 && data[0] == '#' {
+		ln := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			ln, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		ln = bytes.TrimSpace(ln)
+		if len(ln) < len(versionComment) || !strings.EqualFold(string(ln[:len(versionComment)]), versionComment) {
+			continue
+		}
+		v := strings.TrimSpace(string(ln[len(versionComment):]))
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 1 {
+			return 0, fmt.Errorf("invalid format version %q", v)
+		}
+		return version, nil
+	}
+	return 0, nil
+}
+
+// ReadInterval reads the age interval
+// of a row.
+func readInterval(minAge, maxAge string) (bool, int64, int64, error) {
+	if minAge == "" && maxAge == "" {
+		return false, 0, 0, nil
+	}
+	f := minAgeColumn
+	min, err := strconv.ParseInt(minAge, 10, 64)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("field %q: %v", f, err)
+	}
+	f = maxAgeColumn
+	max, err := strconv.ParseInt(maxAge, 10, 64)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("field %q: %v", f, err)
+	}
+	if !validInterval(min, max) {
+		return false, 0, 0, fmt.Errorf("field %q: invalid age interval %d-%d", f, min, max)
+	}
+	return true, min, max, nil
+}
+
+// FormatInterval returns an age interval
+// as a string.
+func formatInterval(interval bool, min, max int64) string {
+	if !interval {
+		return "undefined"
+	}
+	return fmt.Sprintf("%d-%d", min, max)
+}
+
+// IsKnownField returns true
+// if a column is used by the package.
+func isKnownField(h string) bool {
+	if h == "records" || h == minAgeColumn || h == maxAgeColumn {
+		return true
+	}
+	return slices.Contains(headerFields, h)
+}
+
+// A ReadOption is an option
+// used to select the rows read by ReadTSV.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	taxa map[string]bool
+
+	ages   bool
+	minAge int64
+	maxAge int64
+
+	// establishment means
+	means   map[Means]bool
+	noMeans map[Means]bool
+}
+
+// WithTaxa is a ReadOption
+// to read only the indicated taxa.
+// If used more than once,
+// the taxa of all calls will be read.
+func WithTaxa(names ...string) ReadOption {
+	return func(o *readOptions) {
+		if o.taxa == nil {
+			o.taxa = make(map[string]bool, len(names))
+		}
+		for _, nm := range names {
+			nm = canon(nm)
+			if nm == "" {
+				continue
+			}
+			o.taxa[nm] = true
+		}
+	}
+}
+
+// WithAgeRange is a ReadOption
+// to read only the taxa with an age
+// (in years)
+// between min and max,
+// inclusive.
+func WithAgeRange(min, max int64) ReadOption {
+	return func(o *readOptions) {
+		o.ages = true
+		o.minAge = min
+		o.maxAge = max
+	}
+}
+
 // TSV encodes range maps in a collection
 // to a TSV file.
+//
+// If any taxon in the collection has record counts,
+// the column "records" will be added to the file,
+// and if any taxon has an age interval,
+// the columns "min_age" and "max_age"
+// will be added to the file.
+//
+// Extra columns read with ReadTSV
+// are written after the other columns.
+//
+// By default the taxa are sorted by name
+// (see SetOrder),
+// and the file includes a comment
+// with the time in which it was written
+// (see OmitTimestamp).
+//
+// If the collection is set to keep verbatim names
+// (see KeepVerbatim)
+// the verbatim names will be written,
+// otherwise it will use the canonical names.
 func (c *Collection) TSV(w io.Writer) error {
+	tw := NewTSVWriter(w, c.pix)
+	tw.KeepVerbatim(c.keepVerbatim)
+	tw.OmitTimestamp(c.omitTime)
+	for _, cm := range c.comments {
+		tw.AddComment(cm)
+	}
+	tw.SetRecords(c.HasRecords())
+	tw.SetAgeIntervals(c.HasAgeIntervals())
+	tw.SetExtraColumns(c.extra)
+
+	for _, name := range c.TaxaBy(c.order) {
+		if err := tw.Append(c, name); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// A TSVWriter writes range maps into a TSV file
+// (in the format read by ReadTSV),
+// one taxon at a time,
+// so a large collection can be written
+// without holding all the ranges in memory.
+type TSVWriter struct {
+	bw  *bufio.Writer
+	tab *csv.Writer
+	pix *earth.Pixelation
+	eq  string
+
+	keepVerbatim bool
+	omitTime     bool
+	comments     []string
+	recs         bool
+	intervals    bool
+	extra        []string
+
+	header  bool
+	written map[string]bool
+}
+
+// NewTSVWriter returns a TSVWriter
+// that writes range maps
+// using the indicated pixelation
+// into w.
+//
+// By default,
+// the file does not include the column "records",
+// nor the age interval columns,
+// nor any extra column,
+// taxon names are written in their canonical form,
+// and the file includes a comment
+// with the time in which it was written.
+// These options can be changed
+// before the first call to Append.
+func NewTSVWriter(w io.Writer, pix *earth.Pixelation) *TSVWriter {
 	bw := bufio.NewWriter(w)
-	fmt.Fprintf(bw, "# taxon distribution range models\n")
-	fmt.Fprintf(bw, "# data save on : %s\n", time.Now().Format(time.RFC3339))
 	tab := csv.NewWriter(bw)
 	tab.Comma = '\t'
 	tab.UseCRLF = true
+	return &TSVWriter{
+		bw:      bw,
+		tab:     tab,
+		pix:     pix,
+		eq:      strconv.Itoa(pix.Equator()),
+		written: make(map[string]bool),
+	}
+}
 
-	if err := tab.Write(headerFields); err != nil {
-		return fmt.Errorf("while writing header: %v", err)
+// KeepVerbatim sets if the verbatim names of the taxa
+// are written
+// (see Collection.KeepVerbatim).
+func (tw *TSVWriter) KeepVerbatim(keep bool) {
+	tw.keepVerbatim = keep
+}
+
+// OmitTimestamp sets if the comment
+// with the time in which the file was written
+// is omitted.
+func (tw *TSVWriter) OmitTimestamp(omit bool) {
+	tw.omitTime = omit
+}
+
+// AddComment adds a comment
+// that is written in the header of the file
+// (see Collection.AddComment).
+// A comment with several lines
+// is written as several comments.
+func (tw *TSVWriter) AddComment(s string) {
+	for _, ln := range strings.Split(s, "\n") {
+		tw.comments = append(tw.comments, strings.TrimRight(ln, "\r"))
 	}
+}
+
+// SetRecords sets if the column "records"
+// is written.
+func (tw *TSVWriter) SetRecords(recs bool) {
+	tw.recs = recs
+}
 
-	eq := strconv.Itoa(c.pix.Equator())
+// SetAgeIntervals sets if the columns
+// "min_age" and "max_age"
+// are written.
+func (tw *TSVWriter) SetAgeIntervals(intervals bool) {
+	tw.intervals = intervals
+}
+
+// SetExtraColumns sets the extra columns
+// that are written
+// (see Collection.ExtraColumns).
+func (tw *TSVWriter) SetExtraColumns(cols []string) {
+	tw.extra = slices.Clone(cols)
+}
+
+// Append writes the range of a taxon
+// from a collection.
+// The collection must use the same pixelation
+// of the writer,
+// and each taxon can only be written once.
+func (tw *TSVWriter) Append(c *Collection, name string) error {
+	if c.pix.Equator() != tw.pix.Equator() {
+		return fmt.Errorf("writing %q: invalid pixelation: got %d, want %d", name, c.pix.Equator(), tw.pix.Equator())
+	}
+	nm := canon(name)
+	tax, ok := c.taxa[nm]
+	if !ok {
+		return fmt.Errorf("taxon %q not in collection", name)
+	}
+	if tw.written[nm] {
+		return fmt.Errorf("taxon %q already written", name)
+	}
+	tw.written[nm] = true
 
-	for _, name := range c.Taxa() {
-		tax := c.taxa[name]
-		age := strconv.FormatInt(tax.age, 10)
+	if err := tw.writeHeader(); err != nil {
+		return err
+	}
 
-		pixels := make([]int, 0, len(tax.rng))
-		for px := range tax.rng {
-			pixels = append(pixels, px)
+	// columns of the collection
+	// in the output
+	var cols []int
+	if len(tw.extra) > 0 && len(tax.extra) > 0 {
+		cols = make([]int, len(c.extra))
+		for i, h := range c.extra {
+			cols[i] = slices.IndexFunc(tw.extra, func(s string) bool {
+				return strings.EqualFold(s, h)
+			})
 		}
-		slices.Sort(pixels)
+	}
+
+	age := strconv.FormatInt(tax.age, 10)
+	var minAge, maxAge string
+	if tax.interval {
+		minAge = strconv.FormatInt(tax.minAge, 10)
+		maxAge = strconv.FormatInt(tax.maxAge, 10)
+	}
+	nm = tax.name
+	if tw.keepVerbatim {
+		nm = tax.verbatim
+	}
 
-		for _, px := range pixels {
-			d := strconv.FormatFloat(tax.rng[px], 'f', 6, 64)
-			row := []string{
-				tax.name,
-				string(tax.tp),
-				age,
-				eq,
-				strconv.Itoa(px),
-				d,
+	pixels := make([]int, 0, len(tax.rng))
+	for px := range tax.rng {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	for _, px := range pixels {
+		d := strconv.FormatFloat(tax.rng[px], 'f', 6, 64)
+		row := []string{
+			nm,
+			string(tax.tp),
+			age,
+			tw.eq,
+			strconv.Itoa(px),
+			d,
+		}
+		if tw.recs {
+			n := ""
+			if tax.recs != nil {
+				n = strconv.Itoa(tax.recs[px])
 			}
-			if err := tab.Write(row); err != nil {
-				return fmt.Errorf("while writing data: %v", err)
+			row = append(row, n)
+		}
+		if tw.intervals {
+			row = append(row, minAge, maxAge)
+		}
+		if len(tw.extra) > 0 {
+			vals := make([]string, len(tw.extra))
+			for i, v := range tax.extra[px] {
+				if i < len(cols) && cols[i] >= 0 {
+					vals[cols[i]] = v
+				}
 			}
+			row = append(row, vals...)
+		}
+		if err := tw.tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
 		}
 	}
+	return nil
+}
 
-	tab.Flush()
-	if err := tab.Error(); err != nil {
+// Len returns the number of taxa
+// already written.
+func (tw *TSVWriter) Len() int {
+	return len(tw.written)
+}
+
+// Flush writes any buffered data
+// into the underlying writer.
+// It must be called after the last taxon is written.
+func (tw *TSVWriter) Flush() error {
+	if err := tw.writeHeader(); err != nil {
+		return err
+	}
+	tw.tab.Flush()
+	if err := tw.tab.Error(); err != nil {
 		return fmt.Errorf("while writing data: %v", err)
 	}
-	if err := bw.Flush(); err != nil {
+	if err := tw.bw.Flush(); err != nil {
 		return fmt.Errorf("while writing data: %v", err)
 	}
 	return nil
 }
+
+// WriteHeader writes the comments
+// and the header of the file,
+// if they were not already written.
+func (tw *TSVWriter) writeHeader() error {
+	if tw.header {
+		return nil
+	}
+	tw.header = true
+
+	fmt.Fprintf(tw.bw, "# taxon distribution range models\n")
+	fmt.Fprintf(tw.bw, "%s %d\n", versionComment, FormatVersion)
+	if !tw.omitTime {
+		fmt.Fprintf(tw.bw, "# data save on : %s\n", time.Now().Format(time.RFC3339))
+	}
+	for _, cm := range tw.comments {
+		fmt.Fprintf(tw.bw, "# %s\n", cm)
+	}
+
+	header := headerFields
+	if tw.recs {
+		header = append(slices.Clip(header), "records")
+	}
+	if tw.intervals {
+		header = append(slices.Clip(header), minAgeColumn, maxAgeColumn)
+	}
+	header = append(slices.Clip(header), tw.extra...)
+	if err := tw.tab.Write(header); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	return nil
+}
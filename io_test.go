@@ -6,9 +6,14 @@ package ranges_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/js-arias/earth"
 	"github.com/js-arias/ranges"
 )
 
@@ -26,4 +31,456 @@ func TestTSV(t *testing.T) {
 	}
 
 	testCollection(t, c)
+
+	nm := "Rhododendron ericoides"
+	if !reflect.DeepEqual(c.Records(nm), data.Records(nm)) {
+		t.Errorf("records: got %v, want %v", c.Records(nm), data.Records(nm))
+	}
+}
+
+func TestTSVContext(t *testing.T) {
+	data := makeCollection(t)
+
+	var buf bytes.Buffer
+	if err := data.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+
+	c, err := ranges.ReadTSVContext(context.Background(), strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	testCollection(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ranges.ReadTSVContext(ctx, strings.NewReader(buf.String()), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTSVVerbatim(t *testing.T) {
+	data := makeCollection(t)
+	nm := "Anolis McKennai"
+	data.Add(nm, 0, 18.22, -66.59)
+	data.KeepVerbatim(true)
+
+	var buf bytes.Buffer
+	if err := data.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	if !strings.Contains(buf.String(), nm) {
+		t.Errorf("verbatim name %q not found in output", nm)
+	}
+
+	c, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	if v := c.VerbatimName("Anolis mckennai"); v != nm {
+		t.Errorf("verbatim name: got %q, want %q", v, nm)
+	}
+}
+
+func TestTSVOptions(t *testing.T) {
+	data := makeCollection(t)
+
+	var buf bytes.Buffer
+	if err := data.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	all, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+
+	tests := map[string]struct {
+		opts []ranges.ReadOption
+		taxa []string
+	}{
+		"taxa": {
+			opts: []ranges.ReadOption{ranges.WithTaxa("eoraptor  LUNENSIS", "Homo sapiens")},
+			taxa: []string{"Eoraptor lunensis"},
+		},
+		"taxa twice": {
+			opts: []ranges.ReadOption{
+				ranges.WithTaxa("Eoraptor lunensis"),
+				ranges.WithTaxa("Brontostoma discus"),
+			},
+			taxa: []string{"Brontostoma discus", "Eoraptor lunensis"},
+		},
+		"ages": {
+			opts: []ranges.ReadOption{ranges.WithAgeRange(200_000_000, 230_000_000)},
+			taxa: []string{"Eoraptor lunensis", "Megazostrodon rudnerae"},
+		},
+		"taxa and ages": {
+			opts: []ranges.ReadOption{
+				ranges.WithTaxa("Eoraptor lunensis", "Brontostoma discus"),
+				ranges.WithAgeRange(200_000_000, 230_000_000),
+			},
+			taxa: []string{"Eoraptor lunensis"},
+		},
+		"no taxa": {
+			opts: []ranges.ReadOption{ranges.WithTaxa("Homo sapiens")},
+			taxa: []string{},
+		},
+	}
+
+	for name, test := range tests {
+		c, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil, test.opts...)
+		if err != nil {
+			t.Errorf("%s: while reading data: %v", name, err)
+			continue
+		}
+		if ls := c.Taxa(); !reflect.DeepEqual(ls, test.taxa) {
+			t.Errorf("%s: taxa: got %v, want %v", name, ls, test.taxa)
+		}
+		for _, tax := range test.taxa {
+			if !reflect.DeepEqual(c.Range(tax), all.Range(tax)) {
+				t.Errorf("%s: range %q: got %v, want %v", name, tax, c.Range(tax), all.Range(tax))
+			}
+		}
+	}
+}
+
+func TestTSVExtraColumns(t *testing.T) {
+	in := `# range distribution models
+# format version: 3
+pixel	Source	taxon	density	age	type	equator	quality
+17319	GBIF	Brontostoma discus	1.000000	0	points	360	
+19117		Brontostoma discus	1.000000	0	points	360	low
+34661	atlas	Eoraptor lunensis	0.200000	230000000	range	360	
+34663	atlas	Eoraptor lunensis	1.000000	230000000	range	360	
+`
+	c, err := ranges.ReadTSV(strings.NewReader(in), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+
+	cols := []string{"Source", "quality"}
+	if ls := c.ExtraColumns(); !reflect.DeepEqual(ls, cols) {
+		t.Errorf("extra columns: got %v, want %v", ls, cols)
+	}
+	src := map[int]string{17319: "GBIF"}
+	if v := c.Extra("Brontostoma discus", "source"); !reflect.DeepEqual(v, src) {
+		t.Errorf("extra %q: got %v, want %v", "source", v, src)
+	}
+	q := map[int]string{19117: "low"}
+	if v := c.Extra("Brontostoma discus", "quality"); !reflect.DeepEqual(v, q) {
+		t.Errorf("extra %q: got %v, want %v", "quality", v, q)
+	}
+
+	var buf bytes.Buffer
+	if err := c.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	if !strings.Contains(buf.String(), fmt.Sprintf("# format version: %d\n", ranges.FormatVersion)) {
+		t.Errorf("format version comment not found in output")
+	}
+	if !strings.Contains(buf.String(), "\tSource\tquality\r\n") {
+		t.Errorf("extra columns not found in output header")
+	}
+
+	nc, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	for _, tax := range c.Taxa() {
+		for _, col := range cols {
+			if !reflect.DeepEqual(nc.Extra(tax, col), c.Extra(tax, col)) {
+				t.Errorf("extra %q of %q: got %v, want %v", col, tax, nc.Extra(tax, col), c.Extra(tax, col))
+			}
+		}
+	}
+
+	// modified ranges lose their extra values
+	c.Set("Eoraptor lunensis", 230_000_000, map[int]float64{34661: 1})
+	if v := c.Extra("Eoraptor lunensis", "source"); len(v) != 0 {
+		t.Errorf("extra after set: got %v, want empty", v)
+	}
+
+	bad := "# format version: one\ntaxon\ttype\tage\tequator\tpixel\tdensity\n"
+	if _, err := ranges.ReadTSV(strings.NewReader(bad), nil); err == nil {
+		t.Errorf("invalid format version: expecting error")
+	}
+}
+
+func TestTSVOrder(t *testing.T) {
+	data := makeCollection(t)
+
+	tests := map[string]struct {
+		order ranges.Order
+		taxa  []string
+	}{
+		"by name": {
+			order: ranges.ByName,
+			taxa:  []string{"Brontostoma discus", "Eoraptor lunensis", "Megazostrodon rudnerae", "Rhododendron ericoides"},
+		},
+		"by age": {
+			order: ranges.ByAge,
+			taxa:  []string{"Brontostoma discus", "Rhododendron ericoides", "Megazostrodon rudnerae", "Eoraptor lunensis"},
+		},
+		"input order": {
+			order: ranges.InputOrder,
+			taxa:  []string{"Brontostoma discus", "Rhododendron ericoides", "Megazostrodon rudnerae", "Eoraptor lunensis"},
+		},
+	}
+
+	for name, test := range tests {
+		if ls := data.TaxaBy(test.order); !reflect.DeepEqual(ls, test.taxa) {
+			t.Errorf("%s: taxaBy: got %v, want %v", name, ls, test.taxa)
+		}
+
+		data.SetOrder(test.order)
+		var buf bytes.Buffer
+		if err := data.TSV(&buf); err != nil {
+			t.Fatalf("%s: while writing data: %v", name, err)
+		}
+		if ls := taxaOrder(buf.String()); !reflect.DeepEqual(ls, test.taxa) {
+			t.Errorf("%s: got %v, want %v", name, ls, test.taxa)
+		}
+
+		// the input order is preserved
+		// when reading a file
+		c, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+		if err != nil {
+			t.Fatalf("%s: while reading data: %v", name, err)
+		}
+		c.SetOrder(ranges.InputOrder)
+		var out bytes.Buffer
+		if err := c.TSV(&out); err != nil {
+			t.Fatalf("%s: while writing data: %v", name, err)
+		}
+		if ls := taxaOrder(out.String()); !reflect.DeepEqual(ls, test.taxa) {
+			t.Errorf("%s: input order: got %v, want %v", name, ls, test.taxa)
+		}
+	}
+}
+
+func TestTSVOmitTimestamp(t *testing.T) {
+	data := makeCollection(t)
+	data.OmitTimestamp(true)
+
+	var b1, b2 bytes.Buffer
+	if err := data.TSV(&b1); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	if strings.Contains(b1.String(), "data save on") {
+		t.Errorf("timestamp comment found in output")
+	}
+	c, err := ranges.ReadTSV(strings.NewReader(b1.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	c.OmitTimestamp(true)
+	if err := c.TSV(&b2); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	if b1.String() != b2.String() {
+		t.Errorf("output is not stable:\n%s\n---\n%s", b1.String(), b2.String())
+	}
+}
+
+func TestTSVComments(t *testing.T) {
+	data := makeCollection(t)
+	data.AddComment("random seed: 1")
+	data.AddComment("first line\nsecond line")
+
+	var buf bytes.Buffer
+	if err := data.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	for _, cm := range []string{"# random seed: 1\n", "# first line\n", "# second line\n"} {
+		if !strings.Contains(buf.String(), cm) {
+			t.Errorf("comment %q not found in output", cm)
+		}
+	}
+
+	c, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	testCollection(t, c)
+}
+
+func TestTSVInvalidValues(t *testing.T) {
+	const head = "taxon\ttype\tage\tequator\tpixel\tdensity\trecords\n"
+	tests := map[string]string{
+		"negative pixel":   "Bus cus\tpoints\t0\t360\t-1\t1\t\n",
+		"large pixel":      "Bus cus\tpoints\t0\t360\t99999999\t1\t\n",
+		"NaN density":      "Bus cus\trange\t0\t360\t10\tNaN\t\n",
+		"infinite density": "Bus cus\trange\t0\t360\t10\t+Inf\t\n",
+		"negative density": "Bus cus\trange\t0\t360\t10\t-0.5\t\n",
+		"negative age":     "Bus cus\tpoints\t-10\t360\t10\t1\t\n",
+		"old age":          "Bus cus\tpoints\t9000000000\t360\t10\t1\t\n",
+		"zero equator":     "Bus cus\tpoints\t0\t0\t10\t1\t\n",
+		"large equator":    "Bus cus\tpoints\t0\t2000000000\t10\t1\t\n",
+		"negative records": "Bus cus\tpoints\t0\t360\t10\t1\t-3\n",
+	}
+
+	for name, row := range tests {
+		if _, err := ranges.ReadTSV(strings.NewReader(head+row), nil); err == nil {
+			t.Errorf("%s: expecting error", name)
+		}
+	}
+
+	// a range with only zero densities
+	c, err := ranges.ReadTSV(strings.NewReader(head+"Bus cus\trange\t0\t360\t10\t0\t\n"), nil)
+	if err != nil {
+		t.Fatalf("zero density: %v", err)
+	}
+	if d := c.Range("Bus cus")[10]; d != 0 {
+		t.Errorf("zero density: got %v, want 0", d)
+	}
+}
+
+func FuzzReadTSV(f *testing.F) {
+	data := makeCollection(f)
+	var buf bytes.Buffer
+	if err := data.TSV(&buf); err != nil {
+		f.Fatalf("while writing data: %v", err)
+	}
+	f.Add(buf.String())
+	f.Add("taxon\ttype\tage\tequator\tpixel\tdensity\nBus cus\trange\t0\t360\t10\t0.5\n")
+	f.Add("# format version: 1\ntaxon\ttype\tage\tequator\tpixel\tdensity\trecords\tmeans\nBus cus\tpoints\t0\t360\t10\t1\t3\tintroduced\n")
+	f.Add("taxon\ttype\tage\tequator\tpixel\tdensity\nBus cus\trange\t0\t360\t-1\tNaN\n")
+
+	pix := data.Pixelation()
+	f.Fuzz(func(t *testing.T, in string) {
+		c, err := ranges.ReadTSV(strings.NewReader(in), pix)
+		if err != nil {
+			return
+		}
+		for _, is := range c.Validate(pix) {
+			if is.Kind == ranges.PixelOutOfRange || is.Kind == ranges.InvalidDensity {
+				t.Errorf("invalid collection: %v", is)
+			}
+		}
+
+		// a file without data rows
+		// is an error for ReadTSV
+		if len(c.Taxa()) == 0 {
+			return
+		}
+		var buf bytes.Buffer
+		if err := c.TSV(&buf); err != nil {
+			t.Fatalf("while writing data: %v", err)
+		}
+		if _, err := ranges.ReadTSV(strings.NewReader(buf.String()), pix); err != nil {
+			t.Errorf("while reading written data: %v", err)
+		}
+	})
+}
+
+// TaxaOrder returns the taxa of a TSV file
+// in the order in which they are found.
+func taxaOrder(s string) []string {
+	var ls []string
+	for _, ln := range strings.Split(s, "\n") {
+		if strings.HasPrefix(ln, "#") || strings.HasPrefix(ln, "taxon\t") || ln == "" {
+			continue
+		}
+		tax := strings.Split(ln, "\t")[0]
+		if len(ls) == 0 || ls[len(ls)-1] != tax {
+			ls = append(ls, tax)
+		}
+	}
+	return ls
+}
+
+func TestCopyExtraColumns(t *testing.T) {
+	in1 := `taxon	type	age	equator	pixel	density	source
+Brontostoma discus	points	0	360	17319	1.000000	GBIF
+`
+	in2 := `taxon	type	age	equator	pixel	density	quality	source
+Eoraptor lunensis	range	230000000	360	34663	1.000000	high	atlas
+`
+	c1, err := ranges.ReadTSV(strings.NewReader(in1), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	c2, err := ranges.ReadTSV(strings.NewReader(in2), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	if err := c1.Copy(c2, "Eoraptor lunensis"); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	cols := []string{"source", "quality"}
+	if ls := c1.ExtraColumns(); !reflect.DeepEqual(ls, cols) {
+		t.Errorf("extra columns: got %v, want %v", ls, cols)
+	}
+
+	var buf bytes.Buffer
+	if err := c1.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	c, err := ranges.ReadTSV(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	want := map[string]map[string]map[int]string{
+		"Brontostoma discus": {
+			"source":  {17319: "GBIF"},
+			"quality": {},
+		},
+		"Eoraptor lunensis": {
+			"source":  {34663: "atlas"},
+			"quality": {34663: "high"},
+		},
+	}
+	for tax, cols := range want {
+		for col, w := range cols {
+			if v := c.Extra(tax, col); !reflect.DeepEqual(v, w) {
+				t.Errorf("extra %q of %q: got %v, want %v", col, tax, v, w)
+			}
+		}
+	}
+}
+
+func TestTSVWriter(t *testing.T) {
+	data := makeCollection(t)
+
+	var want bytes.Buffer
+	data.OmitTimestamp(true)
+	if err := data.TSV(&want); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+
+	// write each taxon from a different collection
+	var buf bytes.Buffer
+	tw := ranges.NewTSVWriter(&buf, data.Pixelation())
+	tw.OmitTimestamp(true)
+	tw.SetRecords(true)
+	for _, tax := range data.Taxa() {
+		c := ranges.New(data.Pixelation())
+		if err := c.Copy(data, tax); err != nil {
+			t.Fatalf("copy %q: %v", tax, err)
+		}
+		if err := tw.Append(c, tax); err != nil {
+			t.Fatalf("append %q: %v", tax, err)
+		}
+	}
+	if err := tw.Append(data, "Eoraptor lunensis"); err == nil {
+		t.Errorf("append: expecting error for a taxon already written")
+	}
+	if err := tw.Append(data, "Homo sapiens"); err == nil {
+		t.Errorf("append: expecting error for undefined taxon")
+	}
+	other := ranges.New(earth.NewPixelation(120))
+	other.AddPixel("Homo sapiens", 0, 10)
+	if err := tw.Append(other, "Homo sapiens"); err == nil {
+		t.Errorf("append: expecting error for different pixelation")
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if tw.Len() != len(data.Taxa()) {
+		t.Errorf("len: got %d, want %d", tw.Len(), len(data.Taxa()))
+	}
+
+	if buf.String() != want.String() {
+		t.Errorf("writer: got\n%s\nwant\n%s", buf.String(), want.String())
+	}
 }
@@ -0,0 +1,64 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package kde
+
+import (
+	"context"
+	"math"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/earth/stat/pixprob"
+)
+
+// An Aniso is an anisotropic spherical normal kernel,
+// with a concentration Lambda along an axis,
+// and a concentration Lambda*Ratio
+// across the axis.
+type Aniso struct {
+	Lambda float64
+	Ratio  float64
+
+	// Axis as a bearing in radians
+	Axis float64
+}
+
+// MaxExponent is the maximum value of the exponent
+// of the kernel,
+// above it,
+// the density is taken as zero.
+const maxExponent = 50
+
+// Prob returns the (unscaled) density of the kernel
+// for a pixel at point q,
+// from a record at point p.
+func (a Aniso) Prob(p, q earth.Point) float64 {
+	d := earth.Distance(p, q)
+	if d == 0 {
+		return 1
+	}
+	phi := earth.Bearing(p, q) - a.Axis
+	cos := math.Cos(phi)
+	sin := math.Sin(phi)
+	e := a.Lambda * d * d * (cos*cos + a.Ratio*sin*sin) / 2
+	if e > maxExponent {
+		return 0
+	}
+	return math.Exp(-e)
+}
+
+// Anisotropic implements a kernel density estimation
+// using an anisotropic kernel,
+// a set of weighted points p,
+// a time pixelation,
+// the age of the destination raster,
+// and a set of pixel priors.
+// As stat.KDE,
+// it returns pixel values scaled to their CDF.
+// If the context is canceled
+// it returns the context error.
+func Anisotropic(ctx context.Context, a Aniso, p map[int]float64, tp *model.TimePix, age int64, prior pixprob.Pixel) (map[int]float64, error) {
+	return estimate(ctx, a.Prob, p, tp, age, prior)
+}
@@ -0,0 +1,146 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package kde implements kernel density estimations
+// of the range of a taxon
+// from the pixels of its records.
+package kde
+
+import (
+	"context"
+	"slices"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/earth/stat/dist"
+	"github.com/js-arias/earth/stat/pixprob"
+)
+
+// DefaultLambda returns the default concentration parameter
+// of a spherical normal kernel
+// for a pixelation,
+// i.e. a kernel with a standard deviation
+// equal to the size of a pixel.
+func DefaultLambda(pix *earth.Pixelation) float64 {
+	angle := earth.ToRad(pix.Step())
+	return 1 / (angle * angle)
+}
+
+// Normal implements a kernel density estimation
+// using a spherical normal kernel,
+// a set of weighted points p,
+// a time pixelation,
+// the age of the destination raster,
+// and a set of pixel priors.
+// As stat.KDE,
+// it returns pixel values scaled to their CDF.
+// If the context is canceled
+// it returns the context error.
+func Normal(ctx context.Context, n dist.Normal, p map[int]float64, tp *model.TimePix, age int64, prior pixprob.Pixel) (map[int]float64, error) {
+	return estimate(ctx, func(p, q earth.Point) float64 {
+		return n.Prob(earth.Distance(p, q))
+	}, p, tp, age, prior)
+}
+
+// CheckEvery is the number of pixels
+// evaluated between checks of the context.
+const checkEvery = 256
+
+type pixDensity struct {
+	pix  int
+	prob float64
+}
+
+// Estimate implements a kernel density estimation
+// with an arbitrary kernel,
+// that returns the (unscaled) density
+// for a pixel at point q
+// from a record at point p.
+func estimate(ctx context.Context, kernel func(p, q earth.Point) float64, p map[int]float64, tp *model.TimePix, age int64, prior pixprob.Pixel) (map[int]float64, error) {
+	age = tp.ClosestStageAge(age)
+	pix := tp.Pixelation()
+
+	// records are visited in a fixed order
+	// so the sums are always the same
+	recs := make([]int, 0, len(p))
+	for rp := range p {
+		recs = append(recs, rp)
+	}
+	slices.Sort(recs)
+
+	var cum float64
+	raw := make([]pixDensity, 0, pix.Len())
+	for px := 0; px < pix.Len(); px++ {
+		if px%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		v, _ := tp.At(age, px)
+		pp := 1.0
+		if prior != nil {
+			pp = prior.Prior(v)
+			if pp == 0 {
+				continue
+			}
+		}
+
+		pt := pix.ID(px).Point()
+
+		var sum float64
+		for _, rp := range recs {
+			sum += kernel(pix.ID(rp).Point(), pt) * p[rp]
+		}
+		if sum == 0 {
+			continue
+		}
+		p := sum * pp
+		raw = append(raw, pixDensity{
+			pix:  px,
+			prob: p,
+		})
+		cum += p
+	}
+
+	// scale values
+	slices.SortFunc(raw, func(a, b pixDensity) int {
+		// descending sort
+		if a.prob > b.prob {
+			return -1
+		}
+		if a.prob < b.prob {
+			return 1
+		}
+		return a.pix - b.pix
+	})
+	cdf := cum
+	density := make(map[int]float64, len(raw))
+	for _, r := range raw {
+		density[r.pix] = cdf / cum
+		cdf -= r.prob
+	}
+	return density, nil
+}
+
+// Bound returns the pixels of a density
+// (scaled to its CDF)
+// that are inside the indicated bound
+// (for example 0.95 for a 95% bound),
+// and the probability mass inside the bound.
+func Bound(density map[int]float64, bound float64) (map[int]float64, float64) {
+	// the density is the cumulative probability
+	// of the pixels sorted from the most probable,
+	// so the mass outside the bound
+	// is the largest excluded value
+	var out float64
+	rng := make(map[int]float64)
+	for px, p := range density {
+		if p < 1-bound {
+			out = max(out, p)
+			continue
+		}
+		rng[px] = p
+	}
+	return rng, 1 - out
+}
@@ -0,0 +1,180 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"slices"
+	"strings"
+)
+
+// Means is the establishment means
+// of the records of a taxon at a pixel,
+// i.e. whether the taxon is native
+// or was introduced at the pixel.
+type Means string
+
+// Means valid values.
+const (
+	// Native is used for records of a taxon
+	// in its native range.
+	Native Means = "native"
+
+	// Introduced is used for records of a taxon
+	// outside its native range
+	// as a result of human activity.
+	Introduced Means = "introduced"
+
+	// Uncertain is used for records
+	// with an unknown,
+	// or uncertain,
+	// establishment means.
+	Uncertain Means = "uncertain"
+)
+
+// MeansColumn is the extra column
+// used to store the establishment means
+// of the pixels of a taxon
+// (see ExtraColumns).
+const MeansColumn = "establishmentMeans"
+
+// ParseMeans returns the establishment means category
+// of a value of the DarwinCore term establishmentMeans.
+// Both the current vocabulary
+// (e.g. "native", "nativeReintroduced", "introduced",
+// "introducedAssistedColonisation", "vagrant", "uncertain")
+// and frequently used older values
+// (e.g. "invasive", "naturalised", "managed")
+// are accepted.
+// It returns an empty string
+// if the value is empty,
+// or unknown.
+func ParseMeans(s string) Means {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "":
+		return ""
+	case "native", "nativereintroduced", "native reintroduced", "reintroduced":
+		return Native
+	case "introduced", "introducedassistedcolonisation", "introduced assisted colonisation",
+		"invasive", "naturalised", "naturalized", "managed":
+		return Introduced
+	case "uncertain", "unknown", "vagrant":
+		return Uncertain
+	}
+	return ""
+}
+
+// AddMeans adds the establishment means
+// of a record of a taxon at a pixel.
+// If the pixel already has an establishment means,
+// native records have precedence over uncertain records,
+// and uncertain records over introduced records,
+// so a pixel is only introduced
+// if all of its records are introduced.
+//
+// The establishment means is stored
+// in the extra column MeansColumn.
+func (c *Collection) AddMeans(name string, pixel int, m Means) {
+	if m == "" {
+		return
+	}
+	name = canon(name)
+	if name == "" {
+		return
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return
+	}
+	if _, ok := tax.rng[pixel]; !ok {
+		return
+	}
+
+	col := slices.IndexFunc(c.extra, func(s string) bool {
+		return strings.EqualFold(s, MeansColumn)
+	})
+	if col < 0 {
+		col = len(c.extra)
+		c.extra = append(c.extra, MeansColumn)
+	}
+	if tax.extra == nil {
+		tax.extra = make(map[int][]string)
+	}
+	vals := tax.extra[pixel]
+	if len(vals) <= col {
+		v := make([]string, len(c.extra))
+		copy(v, vals)
+		vals = v
+	}
+	if prev := ParseMeans(vals[col]); prev != "" && meansRank(prev) > meansRank(m) {
+		m = prev
+	}
+	vals[col] = string(m)
+	tax.extra[pixel] = vals
+}
+
+// Means returns the establishment means
+// of the pixels of a taxon.
+// Pixels without an establishment means
+// are not included.
+func (c *Collection) Means(name string) map[int]Means {
+	vals := c.Extra(name, MeansColumn)
+	if vals == nil {
+		return nil
+	}
+	means := make(map[int]Means, len(vals))
+	for px, v := range vals {
+		if m := ParseMeans(v); m != "" {
+			means[px] = m
+		}
+	}
+	return means
+}
+
+// MeansRank returns the precedence
+// of an establishment means.
+func meansRank(m Means) int {
+	switch m {
+	case Native:
+		return 3
+	case Uncertain:
+		return 2
+	case Introduced:
+		return 1
+	}
+	return 0
+}
+
+// WithMeans is a ReadOption
+// to read only the pixels of points ranges
+// with the indicated establishment means.
+// Pixels of points ranges without an establishment means
+// are not read.
+// Ranges of "range" type are not filtered.
+func WithMeans(means ...Means) ReadOption {
+	return func(o *readOptions) {
+		if o.means == nil {
+			o.means = make(map[Means]bool, len(means))
+		}
+		for _, m := range means {
+			o.means[m] = true
+		}
+	}
+}
+
+// WithoutMeans is a ReadOption
+// to skip the pixels of points ranges
+// with the indicated establishment means.
+// Ranges of "range" type are not filtered.
+func WithoutMeans(means ...Means) ReadOption {
+	return func(o *readOptions) {
+		if o.noMeans == nil {
+			o.noMeans = make(map[Means]bool, len(means))
+		}
+		for _, m := range means {
+			o.noMeans[m] = true
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"bytes"
+	"maps"
+	"testing"
+
+	"github.com/js-arias/ranges"
+)
+
+func TestMeans(t *testing.T) {
+	coll := makeCollection(t)
+	nm := "Rhododendron ericoides"
+	coll.AddMeans(nm, 18588, ranges.ParseMeans("introduced"))
+	coll.AddMeans(nm, 18588, ranges.ParseMeans("nativeReintroduced"))
+	coll.AddMeans(nm, 19305, ranges.ParseMeans("Invasive"))
+	coll.AddMeans(nm, 19308, ranges.ParseMeans("vagrant"))
+	coll.AddMeans(nm, 19308, ranges.ParseMeans("introduced"))
+
+	// pixel not in range
+	coll.AddMeans(nm, 100, ranges.Native)
+
+	want := map[int]ranges.Means{
+		18588: ranges.Native,
+		19305: ranges.Introduced,
+		19308: ranges.Uncertain,
+	}
+	if got := coll.Means(nm); !maps.Equal(got, want) {
+		t.Errorf("means: got %v, want %v", got, want)
+	}
+	if got := coll.Means("Brontostoma discus"); len(got) != 0 {
+		t.Errorf("means: taxon without means: got %v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := coll.TSV(&buf); err != nil {
+		t.Fatalf("while writing data: %v", err)
+	}
+	data := buf.Bytes()
+
+	c, err := ranges.ReadTSV(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	if got := c.Means(nm); !maps.Equal(got, want) {
+		t.Errorf("read means: got %v, want %v", got, want)
+	}
+
+	c, err = ranges.ReadTSV(bytes.NewReader(data), nil, ranges.WithoutMeans(ranges.Introduced))
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	if rng := c.Range(nm); len(rng) != 2 || rng[19305] != 0 {
+		t.Errorf("without introduced: got range %v", rng)
+	}
+	if !c.HasTaxon("Brontostoma discus") || !c.HasTaxon("Eoraptor lunensis") {
+		t.Errorf("without introduced: taxa %v", c.Taxa())
+	}
+
+	c, err = ranges.ReadTSV(bytes.NewReader(data), nil, ranges.WithMeans(ranges.Introduced))
+	if err != nil {
+		t.Fatalf("while reading data: %v", err)
+	}
+	if rng := c.Range(nm); len(rng) != 1 || rng[19305] != 1 {
+		t.Errorf("only introduced: got range %v", rng)
+	}
+	if c.HasTaxon("Brontostoma discus") {
+		t.Errorf("only introduced: taxon %q without introduced pixels", "Brontostoma discus")
+	}
+	if !c.HasTaxon("Eoraptor lunensis") {
+		t.Errorf("only introduced: range taxon %q not read", "Eoraptor lunensis")
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package ranges
+
+// MapFile reads the whole content of a file,
+// as memory maps are not supported
+// in this system.
+func mapFile(name string) ([]byte, func() error, error) {
+	return readFile(name)
+}
@@ -0,0 +1,43 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package ranges
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// MapFile maps a file into memory.
+// It returns the content of the file,
+// and a function to unmap it.
+func mapFile(name string) ([]byte, func() error, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := st.Size()
+	if size == 0 {
+		// empty files can not be mapped
+		return readFile(name)
+	}
+	if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("when reading %q: file too large", name)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("when reading %q: %v", name, err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,229 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+	"slices"
+
+	"github.com/js-arias/earth"
+)
+
+// Neighbors returns the IDs of the pixels
+// that are adjacent to the indicated pixel,
+// i.e. the previous and next pixels in the same ring,
+// and the pixels of the contiguous rings
+// that overlap in longitude with the pixel.
+func Neighbors(pix *earth.Pixelation, id int) []int {
+	px := pix.ID(id)
+	r := px.Ring()
+	lon := px.Point().Longitude()
+	n := pix.PixPerRing(r)
+	half := 180 / float64(n)
+
+	var nb []int
+	first := pix.FirstPix(r).ID()
+	if n > 1 {
+		pos := id - first
+		nb = append(nb, first+(pos+n-1)%n)
+		if n > 2 {
+			nb = append(nb, first+(pos+1)%n)
+		}
+	}
+
+	for _, nr := range []int{r - 1, r + 1} {
+		if nr < 0 || nr >= pix.Rings() {
+			continue
+		}
+		nb = append(nb, ringOverlap(pix, nr, lon-half, lon+half)...)
+	}
+	slices.Sort(nb)
+	return slices.Compact(nb)
+}
+
+// RingOverlap returns the pixels of a ring
+// that overlap with the longitude interval
+// [west, east].
+func ringOverlap(pix *earth.Pixelation, ring int, west, east float64) []int {
+	first := pix.FirstPix(ring).ID()
+	n := pix.PixPerRing(ring)
+	if n == 1 {
+		return []int{first}
+	}
+
+	step := 360 / float64(n)
+	offset := pix.FirstPix(ring).Point().Longitude()
+
+	// a small tolerance to avoid pixels
+	// that only share a corner
+	const eps = 1e-9
+	lo := int(math.Floor((west-offset)/step + 0.5 + eps))
+	hi := int(math.Floor((east-offset)/step + 0.5 - eps))
+	if hi-lo+1 >= n {
+		lo, hi = 0, n-1
+	}
+
+	ids := make([]int, 0, hi-lo+1)
+	for j := lo; j <= hi; j++ {
+		ids = append(ids, first+((j%n)+n)%n)
+	}
+	return ids
+}
+
+// Dilate returns a range map
+// in which the value of each pixel
+// is the maximum value of the pixel
+// and its neighbors.
+// As a result,
+// the range is expanded by one pixel
+// at each border.
+func Dilate(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+	d := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		if v > d[px] {
+			d[px] = v
+		}
+		for _, nb := range Neighbors(pix, px) {
+			if v > d[nb] {
+				d[nb] = v
+			}
+		}
+	}
+	return d
+}
+
+// Erode returns a range map
+// in which the value of each pixel
+// is the minimum value of the pixel
+// and its neighbors
+// (pixels outside the range have a value of 0).
+// As a result,
+// the range is shrunk by one pixel
+// at each border.
+func Erode(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+	e := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		min := v
+		for _, nb := range Neighbors(pix, px) {
+			min = math.Min(min, rng[nb])
+		}
+		if min <= 0 {
+			continue
+		}
+		e[px] = min
+	}
+	return e
+}
+
+// Open returns a range map
+// after an erosion followed by a dilation.
+// It removes isolated pixels
+// and thin protrusions of the range.
+func Open(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+	return Dilate(pix, Erode(pix, rng))
+}
+
+// Close returns a range map
+// after a dilation followed by an erosion.
+// It fills small holes
+// and narrow gaps of the range.
+func Close(pix *earth.Pixelation, rng map[int]float64) map[int]float64 {
+	return Erode(pix, Dilate(pix, rng))
+}
+
+// FillGaps returns a range map
+// in which the interior gaps of a range
+// are filled.
+// A gap is a set of connected pixels outside the range
+// that is completely surrounded by pixels of the range,
+// and that has at most maxSize pixels.
+//
+// The density of each filled pixel is interpolated
+// from the borders of the gap to its center,
+// as the mean density of its already filled neighbors.
+func FillGaps(pix *earth.Pixelation, rng map[int]float64, maxSize int) map[int]float64 {
+	f := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		f[px] = v
+	}
+	if maxSize < 1 {
+		return f
+	}
+
+	outside := make(map[int]bool)
+	for px := range rng {
+		for _, nb := range Neighbors(pix, px) {
+			if _, ok := f[nb]; ok {
+				continue
+			}
+			if outside[nb] {
+				continue
+			}
+			gap := findGap(pix, f, outside, nb, maxSize)
+			if gap == nil {
+				continue
+			}
+			fillGap(pix, f, gap)
+		}
+	}
+	return f
+}
+
+// FindGap returns the pixels outside a range
+// connected with the start pixel.
+// If the number of pixels is greater than maxSize,
+// the pixels are marked as outside,
+// and it returns nil.
+func findGap(pix *earth.Pixelation, rng map[int]float64, outside map[int]bool, start, maxSize int) []int {
+	gap := []int{start}
+	inGap := map[int]bool{start: true}
+	for i := 0; i < len(gap); i++ {
+		for _, nb := range Neighbors(pix, gap[i]) {
+			if _, ok := rng[nb]; ok {
+				continue
+			}
+			if inGap[nb] {
+				continue
+			}
+			if outside[nb] || len(gap) >= maxSize {
+				for _, px := range gap {
+					outside[px] = true
+				}
+				return nil
+			}
+			inGap[nb] = true
+			gap = append(gap, nb)
+		}
+	}
+	return gap
+}
+
+// FillGap sets the density of the pixels of a gap,
+// from its border to its center.
+func fillGap(pix *earth.Pixelation, rng map[int]float64, gap []int) {
+	for len(gap) > 0 {
+		layer := make(map[int]float64)
+		var next []int
+		for _, px := range gap {
+			var sum float64
+			var n int
+			for _, nb := range Neighbors(pix, px) {
+				if v, ok := rng[nb]; ok {
+					sum += v
+					n++
+				}
+			}
+			if n == 0 {
+				next = append(next, px)
+				continue
+			}
+			layer[px] = sum / float64(n)
+		}
+		for px, v := range layer {
+			rng[px] = v
+		}
+		gap = next
+	}
+}
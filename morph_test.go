@@ -0,0 +1,151 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestNeighbors(t *testing.T) {
+	pix := earth.NewPixelation(120)
+
+	for id := 0; id < pix.Len(); id++ {
+		nb := ranges.Neighbors(pix, id)
+		if len(nb) == 0 {
+			t.Fatalf("pixel %d: no neighbors", id)
+		}
+		if slices.Contains(nb, id) {
+			t.Errorf("pixel %d: pixel is its own neighbor", id)
+		}
+		for _, n := range nb {
+			if !slices.Contains(ranges.Neighbors(pix, n), id) {
+				t.Errorf("pixel %d: neighbor %d: not symmetric", id, n)
+			}
+		}
+	}
+
+	// at the equator pixels of contiguous rings
+	// are shifted by half a pixel
+	px := pix.Pixel(0, 20)
+	if nb := ranges.Neighbors(pix, px.ID()); len(nb) != 6 {
+		t.Errorf("pixel %d: got %d neighbors, want %d", px.ID(), len(nb), 6)
+	}
+
+	// the pixel at the pole
+	// is a neighbor of all the pixels
+	// of the next ring
+	np := pix.Pixel(90, 0)
+	nb := ranges.Neighbors(pix, np.ID())
+	if n := pix.PixPerRing(1); len(nb) != n {
+		t.Errorf("north pole: got %d neighbors, want %d", len(nb), n)
+	}
+
+	// neighbors across the anti-meridian
+	px = pix.Pixel(0, 179.9)
+	var west bool
+	for _, n := range ranges.Neighbors(pix, px.ID()) {
+		if pix.ID(n).Point().Longitude() < 0 {
+			west = true
+		}
+	}
+	if !west {
+		t.Errorf("pixel %d: no neighbors across the anti-meridian", px.ID())
+	}
+}
+
+func TestMorph(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	center := pix.Pixel(10, 20).ID()
+
+	// a block of pixels with a hole in the center
+	block := ranges.Dilate(pix, ranges.Dilate(pix, map[int]float64{center: 1}))
+	rng := make(map[int]float64, len(block))
+	for px := range block {
+		if px == center {
+			continue
+		}
+		rng[px] = 1
+	}
+
+	c := ranges.Close(pix, rng)
+	if _, ok := c[center]; !ok {
+		t.Errorf("close: hole at pixel %d not filled", center)
+	}
+	for px := range rng {
+		if _, ok := c[px]; !ok {
+			t.Errorf("close: pixel %d removed", px)
+		}
+	}
+
+	// an isolated pixel
+	iso := pix.Pixel(-40, 100).ID()
+	rng[iso] = 1
+	o := ranges.Open(pix, rng)
+	if _, ok := o[iso]; ok {
+		t.Errorf("open: isolated pixel %d not removed", iso)
+	}
+
+	e := ranges.Erode(pix, block)
+	if len(e) >= len(block) {
+		t.Errorf("erode: got %d pixels, want less than %d", len(e), len(block))
+	}
+	if _, ok := e[center]; !ok {
+		t.Errorf("erode: pixel %d removed", center)
+	}
+
+	// densities
+	d := ranges.Dilate(pix, map[int]float64{center: 0.5})
+	for _, nb := range ranges.Neighbors(pix, center) {
+		if d[nb] != 0.5 {
+			t.Errorf("dilate: pixel %d: got %.3f, want %.3f", nb, d[nb], 0.5)
+		}
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	center := pix.Pixel(10, 20).ID()
+
+	// a ring of pixels around a gap of one pixel
+	rng := make(map[int]float64)
+	for _, nb := range ranges.Neighbors(pix, center) {
+		rng[nb] = 0.5
+	}
+
+	f := ranges.FillGaps(pix, rng, 1)
+	if len(f) != len(rng)+1 {
+		t.Errorf("fill: got %d pixels, want %d", len(f), len(rng)+1)
+	}
+	if f[center] != 0.5 {
+		t.Errorf("fill: pixel %d: got %.3f, want %.3f", center, f[center], 0.5)
+	}
+	if _, ok := rng[center]; ok {
+		t.Errorf("fill: input range modified")
+	}
+
+	// a larger gap
+	gap := ranges.Dilate(pix, map[int]float64{center: 1})
+	border := ranges.Dilate(pix, gap)
+	rng = make(map[int]float64)
+	for px := range border {
+		if _, ok := gap[px]; ok {
+			continue
+		}
+		rng[px] = 1
+	}
+	if f := ranges.FillGaps(pix, rng, len(gap)-1); len(f) != len(rng) {
+		t.Errorf("fill: gap of %d pixels filled with max size %d", len(gap), len(gap)-1)
+	}
+	f = ranges.FillGaps(pix, rng, len(gap))
+	for px := range gap {
+		if f[px] != 1 {
+			t.Errorf("fill: pixel %d: got %.3f, want %.3f", px, f[px], 1.0)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/js-arias/earth"
+)
+
+// RandomPlace returns a range map
+// with the same size and shape of a range,
+// but moved to a random position
+// using a random rotation of the sphere.
+// If two pixels of the range are moved
+// into the same pixel
+// (for example, because they are moved
+// into a ring with fewer pixels),
+// the closest free neighbor is used instead,
+// so the moved range always has the same number of pixels
+// as the original range.
+// Only positions in which all pixels of the moved range
+// are suitable
+// (i.e. the function suitable returns true)
+// are accepted.
+// If suitable is nil,
+// all pixels are suitable.
+// It returns nil if no suitable position is found
+// after the indicated number of attempts.
+func RandomPlace(pix *earth.Pixelation, rng map[int]float64, rnd *rand.Rand, suitable func(px int) bool, attempts int) map[int]float64 {
+	if len(rng) == 0 {
+		return nil
+	}
+
+	// pixels are moved in a fixed order
+	// so the result is reproducible
+	pixels := make([]int, 0, len(rng))
+	for px := range rng {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+
+	for i := 0; i < attempts; i++ {
+		rot := randomRotation(rnd)
+		if moved := place(pix, rng, pixels, rot, suitable); moved != nil {
+			return moved
+		}
+	}
+	return nil
+}
+
+// Place moves the pixels of a range map
+// using a rotation.
+// It returns nil if a pixel is moved
+// into an unsuitable pixel,
+// or if a pixel moved into an already used pixel
+// does not have a free suitable neighbor.
+func place(pix *earth.Pixelation, rng map[int]float64, pixels []int, rot rotation3, suitable func(px int) bool) map[int]float64 {
+	moved := make(map[int]float64, len(rng))
+	for _, px := range pixels {
+		w := rot.apply(toVec3(pix.ID(px).Point()))
+		np := pix.Pixel(fromVec3(w)).ID()
+		if _, ok := moved[np]; ok {
+			used := np
+			np = -1
+			best := math.Inf(-1)
+			for _, nb := range Neighbors(pix, used) {
+				if _, ok := moved[nb]; ok {
+					continue
+				}
+				if suitable != nil && !suitable(nb) {
+					continue
+				}
+				if d := w.dot(toVec3(pix.ID(nb).Point())); d > best {
+					np, best = nb, d
+				}
+			}
+			if np < 0 {
+				return nil
+			}
+		}
+		if suitable != nil && !suitable(np) {
+			return nil
+		}
+		moved[np] = rng[px]
+	}
+	return moved
+}
+
+// A Rotation3 is a rotation matrix.
+type rotation3 [3][3]float64
+
+// RandomRotation returns a uniformly distributed
+// random rotation,
+// using the random unit quaternion method
+// of K. Shoemake (1992).
+func randomRotation(rnd *rand.Rand) rotation3 {
+	u1, u2, u3 := rnd.Float64(), rnd.Float64(), rnd.Float64()
+	a := math.Sqrt(1 - u1)
+	b := math.Sqrt(u1)
+	x := a * math.Sin(2*math.Pi*u2)
+	y := a * math.Cos(2*math.Pi*u2)
+	z := b * math.Sin(2*math.Pi*u3)
+	w := b * math.Cos(2*math.Pi*u3)
+
+	return rotation3{
+		{1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w)},
+		{2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w)},
+		{2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y)},
+	}
+}
+
+func (r rotation3) apply(v vec3) vec3 {
+	return vec3{
+		x: r[0][0]*v.x + r[0][1]*v.y + r[0][2]*v.z,
+		y: r[1][0]*v.x + r[1][1]*v.y + r[1][2]*v.z,
+		z: r[2][0]*v.x + r[2][1]*v.y + r[2][2]*v.z,
+	}
+}
+
+// FromVec3 returns the latitude and longitude
+// (in degrees)
+// of a unit vector.
+func fromVec3(v vec3) (lat, lon float64) {
+	z := math.Max(-1, math.Min(1, v.z))
+	lat = earth.ToDegree(math.Asin(z))
+	lon = earth.ToDegree(math.Atan2(v.y, v.x))
+	return lat, lon
+}
+
+// SpreadingDye returns a range map
+// of the indicated number of pixels,
+// using the spreading-dye algorithm:
+// starting from a random seed pixel,
+// the range grows by adding random neighbors
+// of the pixels already in the range.
+// Only suitable pixels
+// (i.e. the function suitable returns true)
+// are added to the range.
+// If suitable is nil,
+// all pixels are suitable.
+// If the range can not reach the indicated size
+// from the seed pixel,
+// a new seed is tried.
+// It returns nil if no range of the indicated size
+// is found after the indicated number of attempts.
+func SpreadingDye(pix *earth.Pixelation, size int, rnd *rand.Rand, suitable func(px int) bool, attempts int) map[int]float64 {
+	if size <= 0 {
+		return nil
+	}
+
+	for i := 0; i < attempts; i++ {
+		seed := rnd.Intn(pix.Len())
+		if suitable != nil && !suitable(seed) {
+			continue
+		}
+
+		rng := map[int]float64{seed: 1}
+		border := Neighbors(pix, seed)
+		for len(rng) < size && len(border) > 0 {
+			j := rnd.Intn(len(border))
+			px := border[j]
+			border[j] = border[len(border)-1]
+			border = border[:len(border)-1]
+
+			if _, ok := rng[px]; ok {
+				continue
+			}
+			if suitable != nil && !suitable(px) {
+				continue
+			}
+			rng[px] = 1
+			for _, nb := range Neighbors(pix, px) {
+				if _, ok := rng[nb]; !ok {
+					border = append(border, nb)
+				}
+			}
+		}
+		if len(rng) == size {
+			return rng
+		}
+	}
+	return nil
+}
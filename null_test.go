@@ -0,0 +1,121 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"maps"
+	"math/rand"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestRandomPlace(t *testing.T) {
+	pix := earth.NewPixelation(360)
+	rng := ranges.Dilate(pix, ranges.Dilate(pix, map[int]float64{
+		pix.Pixel(-20, -60).ID(): 1,
+	}))
+
+	north := func(px int) bool {
+		return pix.ID(px).Point().Latitude() > 0
+	}
+
+	for i := 0; i < 20; i++ {
+		m := ranges.RandomPlace(pix, rng, rand.New(rand.NewSource(int64(i))), north, 1000)
+		if m == nil {
+			t.Fatalf("seed %d: no placement found", i)
+		}
+		for px := range m {
+			if !north(px) {
+				t.Errorf("seed %d: pixel %d: not suitable", i, px)
+			}
+		}
+
+		if len(m) != len(rng) {
+			t.Errorf("seed %d: got %d pixels, want %d", i, len(m), len(rng))
+		}
+
+		again := ranges.RandomPlace(pix, rng, rand.New(rand.NewSource(int64(i))), north, 1000)
+		if !maps.Equal(m, again) {
+			t.Errorf("seed %d: placement is not reproducible", i)
+		}
+	}
+
+	// near the poles the rings have fewer pixels
+	// so moved pixels collapse more often
+	polar := func(px int) bool {
+		return pix.ID(px).Point().Latitude() > 70
+	}
+	for i := 0; i < 20; i++ {
+		m := ranges.RandomPlace(pix, rng, rand.New(rand.NewSource(int64(i))), polar, 10_000)
+		if m == nil {
+			t.Fatalf("polar: seed %d: no placement found", i)
+		}
+		if len(m) != len(rng) {
+			t.Errorf("polar: seed %d: got %d pixels, want %d", i, len(m), len(rng))
+		}
+	}
+
+	never := func(px int) bool { return false }
+	if m := ranges.RandomPlace(pix, rng, rand.New(rand.NewSource(1)), never, 10); m != nil {
+		t.Errorf("unsuitable landscape: got %d pixels, want nil", len(m))
+	}
+}
+
+func TestSpreadingDye(t *testing.T) {
+	pix := earth.NewPixelation(360)
+
+	north := func(px int) bool {
+		return pix.ID(px).Point().Latitude() > 0
+	}
+
+	for i := 0; i < 20; i++ {
+		m := ranges.SpreadingDye(pix, 50, rand.New(rand.NewSource(int64(i))), north, 1000)
+		if len(m) != 50 {
+			t.Fatalf("seed %d: got %d pixels, want %d", i, len(m), 50)
+		}
+		for px := range m {
+			if !north(px) {
+				t.Errorf("seed %d: pixel %d: not suitable", i, px)
+			}
+		}
+
+		// the range must be connected
+		var start int
+		for px := range m {
+			start = px
+			break
+		}
+		seen := map[int]bool{start: true}
+		queue := []int{start}
+		for len(queue) > 0 {
+			px := queue[0]
+			queue = queue[1:]
+			for _, nb := range ranges.Neighbors(pix, px) {
+				if _, ok := m[nb]; !ok || seen[nb] {
+					continue
+				}
+				seen[nb] = true
+				queue = append(queue, nb)
+			}
+		}
+		if len(seen) != len(m) {
+			t.Errorf("seed %d: range is not connected", i)
+		}
+
+		again := ranges.SpreadingDye(pix, 50, rand.New(rand.NewSource(int64(i))), north, 1000)
+		if !maps.Equal(m, again) {
+			t.Errorf("seed %d: range is not reproducible", i)
+		}
+	}
+
+	// a single pixel landscape
+	single := pix.Pixel(10, 10).ID()
+	island := func(px int) bool { return px == single }
+	if m := ranges.SpreadingDye(pix, 2, rand.New(rand.NewSource(1)), island, 100); m != nil {
+		t.Errorf("small landscape: got %d pixels, want nil", len(m))
+	}
+}
@@ -0,0 +1,644 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Op is an operation of a patch.
+type Op string
+
+// Op valid values.
+const (
+	// OpAdd adds a pixel to the range of a taxon.
+	OpAdd Op = "add"
+
+	// OpRemove removes a pixel from the range of a taxon.
+	OpRemove Op = "remove"
+
+	// OpAge sets the age of a taxon.
+	OpAge Op = "age"
+
+	// OpRename changes the name of a taxon.
+	OpRename Op = "rename"
+)
+
+// A Change is a change in the range of a taxon.
+type Change struct {
+	Op    Op
+	Taxon string
+
+	// Type and Age of the range of the taxon.
+	// In an OpAge change,
+	// Age is the age before the change.
+	Type Type
+	Age  int64
+
+	// Pixel is the pixel ID of the changed pixel,
+	// and Density and Records are the values
+	// of the pixel.
+	// Only used by OpAdd and OpRemove changes.
+	Pixel   int
+	Density float64
+	Records int
+
+	// NewAge is the age set by an OpAge change.
+	NewAge int64
+
+	// NewName is the name set by an OpRename change.
+	NewName string
+}
+
+// A Patch is a reversible list of changes
+// to the ranges of a collection.
+//
+// A patch adds and removes pixels,
+// sets the age of a taxon,
+// and renames a taxon.
+// As each removed pixel is stored
+// with its density and record count,
+// and each change of age or name
+// keeps the previous value,
+// a patch can be reversed
+// (see Reverse)
+// to undo the changes.
+// The values of the extra columns
+// (see ExtraColumns)
+// are not stored in a patch.
+type Patch struct {
+	eq      int
+	changes []Change
+}
+
+// Diff returns a patch
+// with the changes that transform the collection old
+// into the collection new.
+// Both collections must have the same pixelation.
+//
+// Pixels with a different density or record count
+// are stored as a removal
+// followed by an addition.
+// If the age of a taxon changed,
+// an OpAge change is stored,
+// and if the type of a taxon changed,
+// all the pixels of the taxon are replaced.
+// As a renamed taxon can not be distinguished
+// from a removed taxon and a new taxon,
+// Diff never stores OpRename changes.
+func Diff(old, new *Collection) (*Patch, error) {
+	if old.pix.Equator() != new.pix.Equator() {
+		return nil, fmt.Errorf("invalid pixelation: got %d, want %d", new.pix.Equator(), old.pix.Equator())
+	}
+
+	names := old.Taxa()
+	for _, tax := range new.Taxa() {
+		if _, ok := old.taxa[tax]; !ok {
+			names = append(names, tax)
+		}
+	}
+	slices.Sort(names)
+
+	p := &Patch{eq: old.pix.Equator()}
+	for _, nm := range names {
+		o := old.taxa[nm]
+		n := new.taxa[nm]
+
+		replace := o != nil && n != nil && o.tp != n.tp
+		age := o != nil && n != nil && !replace && o.age != n.age
+		if age {
+			p.changes = append(p.changes, Change{
+				Op:     OpAge,
+				Taxon:  o.verbatim,
+				Age:    o.age,
+				NewAge: n.age,
+			})
+		}
+		if o != nil {
+			for _, px := range sortedPixels(o.rng) {
+				if !replace && n != nil && samePixel(o, n, px) {
+					continue
+				}
+				ch := o.change(OpRemove, px)
+				if age {
+					// the pixels are removed
+					// after the age is changed
+					ch.Age = n.age
+				}
+				p.changes = append(p.changes, ch)
+			}
+		}
+		if n != nil {
+			for _, px := range sortedPixels(n.rng) {
+				if !replace && o != nil && samePixel(o, n, px) {
+					continue
+				}
+				p.changes = append(p.changes, n.change(OpAdd, px))
+			}
+		}
+	}
+	return p, nil
+}
+
+// Apply applies the changes of a patch
+// to a collection.
+//
+// An added pixel must not be in the range of the taxon,
+// a removed pixel must be in the range of the taxon,
+// the age of a taxon must be the age before the change,
+// and a taxon can not be renamed
+// to the name of another taxon in the collection.
+// A taxon is added to the collection
+// when a pixel is added to a taxon not in the collection,
+// and it is deleted
+// when all of its pixels are removed.
+// If there is an error,
+// the collection might be partially modified.
+func (p *Patch) Apply(c *Collection) error {
+	if p.eq != 0 && p.eq != c.pix.Equator() {
+		return fmt.Errorf("invalid pixelation: got %d, want %d", c.pix.Equator(), p.eq)
+	}
+
+	for i, ch := range p.changes {
+		if err := c.apply(ch); err != nil {
+			return fmt.Errorf("change %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Changes returns the changes of a patch.
+// The returned slice must not be modified.
+func (p *Patch) Changes() []Change {
+	return p.changes
+}
+
+// Equator returns the number of pixels at the equator
+// of the pixelation used by a patch.
+// It returns 0 if the patch does not change pixels.
+func (p *Patch) Equator() int {
+	return p.eq
+}
+
+// Len returns the number of changes in a patch.
+func (p *Patch) Len() int {
+	return len(p.changes)
+}
+
+// Reverse returns a patch
+// that undoes the changes of a patch.
+func (p *Patch) Reverse() *Patch {
+	r := &Patch{
+		eq:      p.eq,
+		changes: make([]Change, 0, len(p.changes)),
+	}
+	for i := len(p.changes) - 1; i >= 0; i-- {
+		ch := p.changes[i]
+		switch ch.Op {
+		case OpAdd:
+			ch.Op = OpRemove
+		case OpRemove:
+			ch.Op = OpAdd
+		case OpAge:
+			ch.Age, ch.NewAge = ch.NewAge, ch.Age
+		case OpRename:
+			ch.Taxon, ch.NewName = ch.NewName, ch.Taxon
+		}
+		r.changes = append(r.changes, ch)
+	}
+	return r
+}
+
+var patchFields = []string{
+	"op",
+	"taxon",
+	"type",
+	"age",
+	"equator",
+	"pixel",
+	"density",
+	"records",
+	"value",
+}
+
+// ReadPatch reads a patch from a TSV file.
+//
+// The TSV must contain the columns "op",
+// with the operation,
+// and "taxon",
+// with the name of the taxon.
+// The other columns depend on the operation:
+//
+//   - "add" and "remove" require the columns
+//     "type" and "age",
+//     with the type and age of the range of the taxon,
+//     "equator", with the number of pixels in the equator,
+//     and "pixel", with the ID of the pixel.
+//     The columns "density"
+//     (by default 1),
+//     and "records"
+//     (by default 0)
+//     are the values of the pixel.
+//   - "age" requires the columns "age",
+//     with the age of the taxon before the change,
+//     and "value",
+//     with the new age.
+//   - "rename" requires the column "value",
+//     with the new name of the taxon.
+//
+// Columns not used by an operation
+// can be empty.
+// The changes are applied in the order of the file.
+//
+// Here is an example file:
+//
+//	# taxon range patch
+//	# format version: 2
+//	op	taxon	type	age	equator	pixel	density	records	value
+//	remove	Brontostoma discus	points	0	360	17319	1.000000	2
+//	add	Brontostoma discus	points	0	360	17320	1.000000	1
+//	age	Eoraptor lunensis		230000000					228000000
+//	rename	Rhododendron ericoide							Rhododendron ericoides
+func ReadPatch(r io.Reader) (*Patch, error) {
+	br := bufio.NewReader(r)
+	if _, err := readVersion(br); err != nil {
+		return nil, err
+	}
+
+	tab := csv.NewReader(br)
+	tab.Comma = '\t'
+	tab.Comment = '#'
+	tab.FieldsPerRecord = -1
+
+	head, err := tab.Read()
+	if err != nil {
+		return nil, fmt.Errorf("while reading header: %v", err)
+	}
+	fields := make(map[string]int, len(head))
+	for i, h := range head {
+		h = strings.ToLower(h)
+		fields[h] = i
+	}
+	for _, h := range []string{"op", "taxon"} {
+		if _, ok := fields[h]; !ok {
+			return nil, fmt.Errorf("expecting field %q", h)
+		}
+	}
+
+	p := &Patch{}
+	for {
+		row, err := tab.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				return nil, fmt.Errorf("on row %d: %v", pe.Line, pe.Err)
+			}
+			return nil, fmt.Errorf("while reading data: %v", err)
+		}
+		ln, _ := tab.FieldPos(0)
+
+		// value returns the value of a field,
+		// or an error if the value is empty
+		value := func(f string) (string, error) {
+			i, ok := fields[f]
+			if !ok {
+				return "", fmt.Errorf("on row %d: expecting field %q", ln, f)
+			}
+			if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+				return "", fmt.Errorf("on row %d: field %q: empty value", ln, f)
+			}
+			return strings.TrimSpace(row[i]), nil
+		}
+		// optional returns the value of a field,
+		// or an empty string
+		optional := func(f string) string {
+			i, ok := fields[f]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		var ch Change
+		v, err := value("op")
+		if err != nil {
+			return nil, err
+		}
+		ch.Op = Op(strings.ToLower(v))
+
+		f := "taxon"
+		ch.Taxon = normalize(optional(f))
+		if ch.Taxon == "" {
+			return nil, fmt.Errorf("on row %d: field %q: empty taxon name", ln, f)
+		}
+
+		switch ch.Op {
+		case OpAdd, OpRemove:
+			if err := readPixelChange(p, &ch, value, optional, ln); err != nil {
+				return nil, err
+			}
+		case OpAge:
+			f := "age"
+			v, err := value(f)
+			if err != nil {
+				return nil, err
+			}
+			if ch.Age, err = parseAge(v); err != nil {
+				return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+			}
+			f = "value"
+			v, err = value(f)
+			if err != nil {
+				return nil, err
+			}
+			if ch.NewAge, err = parseAge(v); err != nil {
+				return nil, fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+			}
+		case OpRename:
+			f := "value"
+			v, err := value(f)
+			if err != nil {
+				return nil, err
+			}
+			ch.NewName = normalize(v)
+			if ch.NewName == "" {
+				return nil, fmt.Errorf("on row %d: field %q: empty taxon name", ln, f)
+			}
+		default:
+			return nil, fmt.Errorf("on row %d: field %q: unknown operation %q", ln, "op", v)
+		}
+
+		p.changes = append(p.changes, ch)
+	}
+	return p, nil
+}
+
+// ReadPixelChange reads the fields
+// of a change that adds or removes a pixel.
+func readPixelChange(p *Patch, ch *Change, value func(string) (string, error), optional func(string) string, ln int) error {
+	f := "type"
+	v, err := value(f)
+	if err != nil {
+		return err
+	}
+	ch.Type = Type(strings.ToLower(v))
+	if ch.Type != Points && ch.Type != Range {
+		return fmt.Errorf("on row %d: field %q: unknown range type %q", ln, f, v)
+	}
+
+	f = "age"
+	v, err = value(f)
+	if err != nil {
+		return err
+	}
+	if ch.Age, err = parseAge(v); err != nil {
+		return fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+	}
+
+	f = "equator"
+	v, err = value(f)
+	if err != nil {
+		return err
+	}
+	eq, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+	}
+	if p.eq == 0 {
+		if eq < 2 || eq > MaxEquator {
+			return fmt.Errorf("on row %d: field %q: invalid equator value %d", ln, f, eq)
+		}
+		p.eq = eq
+	}
+	if eq != p.eq {
+		return fmt.Errorf("on row %d: field %q: got %d, want %d", ln, f, eq, p.eq)
+	}
+
+	f = "pixel"
+	v, err = value(f)
+	if err != nil {
+		return err
+	}
+	ch.Pixel, err = strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+	}
+	if ch.Pixel < 0 {
+		return fmt.Errorf("on row %d: field %q: invalid pixel %d", ln, f, ch.Pixel)
+	}
+
+	f = "density"
+	ch.Density = 1
+	if v := optional(f); v != "" {
+		ch.Density, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+		}
+		if math.IsNaN(ch.Density) || math.IsInf(ch.Density, 0) || ch.Density < 0 {
+			return fmt.Errorf("on row %d: field %q: invalid density %v", ln, f, ch.Density)
+		}
+	}
+
+	f = "records"
+	if v := optional(f); v != "" {
+		ch.Records, err = strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("on row %d: field %q: %v", ln, f, err)
+		}
+		if ch.Records < 0 {
+			return fmt.Errorf("on row %d: field %q: invalid records %d", ln, f, ch.Records)
+		}
+	}
+	return nil
+}
+
+// ParseAge parses an age value
+// (in years).
+func parseAge(v string) (int64, error) {
+	age, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if age < 0 || age > MaxAge {
+		return 0, fmt.Errorf("invalid age %d", age)
+	}
+	return age, nil
+}
+
+// TSV encodes a patch into a TSV file.
+func (p *Patch) TSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# taxon range patch\n")
+	fmt.Fprintf(bw, "%s %d\n", versionComment, FormatVersion)
+
+	tab := csv.NewWriter(bw)
+	tab.Comma = '\t'
+
+	if err := tab.Write(patchFields); err != nil {
+		return fmt.Errorf("while writing header: %v", err)
+	}
+	eq := strconv.Itoa(p.eq)
+	for _, ch := range p.changes {
+		row := make([]string, len(patchFields))
+		row[0] = string(ch.Op)
+		row[1] = ch.Taxon
+		switch ch.Op {
+		case OpAdd, OpRemove:
+			row[2] = string(ch.Type)
+			row[3] = strconv.FormatInt(ch.Age, 10)
+			row[4] = eq
+			row[5] = strconv.Itoa(ch.Pixel)
+			row[6] = strconv.FormatFloat(ch.Density, 'f', 6, 64)
+			row[7] = strconv.Itoa(ch.Records)
+		case OpAge:
+			row[3] = strconv.FormatInt(ch.Age, 10)
+			row[8] = strconv.FormatInt(ch.NewAge, 10)
+		case OpRename:
+			row[8] = ch.NewName
+		}
+		if err := tab.Write(row); err != nil {
+			return fmt.Errorf("while writing data: %v", err)
+		}
+	}
+	tab.Flush()
+	if err := tab.Error(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("while writing data: %v", err)
+	}
+	return nil
+}
+
+// Apply applies a change to a collection.
+func (c *Collection) apply(ch Change) error {
+	name := canon(ch.Taxon)
+	if name == "" {
+		return errors.New("empty taxon name")
+	}
+	if ch.Pixel >= c.pix.Len() {
+		return fmt.Errorf("taxon %q: invalid pixel %d", ch.Taxon, ch.Pixel)
+	}
+
+	tax, ok := c.taxa[name]
+	switch ch.Op {
+	case OpAdd:
+		if !ok {
+			tax = &taxon{
+				name:     name,
+				verbatim: normalize(ch.Taxon),
+				tp:       ch.Type,
+				age:      ch.Age,
+				rng:      make(map[int]float64),
+			}
+			c.addTaxon(tax)
+		}
+		if len(tax.rng) == 0 {
+			tax.tp = ch.Type
+			tax.age = ch.Age
+		}
+		if tax.tp != ch.Type || tax.age != ch.Age {
+			return fmt.Errorf("taxon %q: got %s at age %d, want %s at age %d", ch.Taxon, tax.tp, tax.age, ch.Type, ch.Age)
+		}
+		if _, ok := tax.rng[ch.Pixel]; ok {
+			return fmt.Errorf("taxon %q: pixel %d already in range", ch.Taxon, ch.Pixel)
+		}
+		tax.rng[ch.Pixel] = ch.Density
+		if ch.Records > 0 {
+			if tax.recs == nil {
+				tax.recs = make(map[int]int)
+			}
+			tax.recs[ch.Pixel] = ch.Records
+		}
+	case OpRemove:
+		if !ok {
+			return fmt.Errorf("taxon %q not in collection", ch.Taxon)
+		}
+		if _, ok := tax.rng[ch.Pixel]; !ok {
+			return fmt.Errorf("taxon %q: pixel %d not in range", ch.Taxon, ch.Pixel)
+		}
+		delete(tax.rng, ch.Pixel)
+		delete(tax.recs, ch.Pixel)
+		delete(tax.extra, ch.Pixel)
+		if len(tax.rng) == 0 {
+			delete(c.taxa, name)
+		}
+	case OpAge:
+		if !ok {
+			return fmt.Errorf("taxon %q not in collection", ch.Taxon)
+		}
+		if tax.age != ch.Age {
+			return fmt.Errorf("taxon %q: got age %d, want %d", ch.Taxon, tax.age, ch.Age)
+		}
+		tax.age = ch.NewAge
+	case OpRename:
+		if !ok {
+			return fmt.Errorf("taxon %q not in collection", ch.Taxon)
+		}
+		nn := canon(ch.NewName)
+		if nn == "" {
+			return fmt.Errorf("taxon %q: empty new name", ch.Taxon)
+		}
+		if _, ok := c.taxa[nn]; ok && nn != name {
+			return fmt.Errorf("taxon %q: taxon %q already in collection", ch.Taxon, ch.NewName)
+		}
+		delete(c.taxa, name)
+		tax.name = nn
+		tax.verbatim = normalize(ch.NewName)
+		c.taxa[nn] = tax
+	default:
+		return fmt.Errorf("unknown operation %q", ch.Op)
+	}
+	c.resetIndex()
+	return nil
+}
+
+// Change returns the change of a pixel
+// of a taxon.
+func (tax *taxon) change(op Op, px int) Change {
+	return Change{
+		Op:      op,
+		Taxon:   tax.verbatim,
+		Type:    tax.tp,
+		Age:     tax.age,
+		Pixel:   px,
+		Density: tax.rng[px],
+		Records: tax.recs[px],
+	}
+}
+
+// SamePixel returns true if a pixel
+// has the same values in two taxa.
+func samePixel(a, b *taxon, px int) bool {
+	da, ok := a.rng[px]
+	if !ok {
+		return false
+	}
+	db, ok := b.rng[px]
+	if !ok {
+		return false
+	}
+	return da == db && a.recs[px] == b.recs[px]
+}
+
+func sortedPixels(rng map[int]float64) []int {
+	pixels := make([]int, 0, len(rng))
+	for px := range rng {
+		pixels = append(pixels, px)
+	}
+	slices.Sort(pixels)
+	return pixels
+}
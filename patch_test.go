@@ -0,0 +1,200 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestPatch(t *testing.T) {
+	var buf bytes.Buffer
+	if err := makeCollection(t).TSV(&buf); err != nil {
+		t.Fatalf("unable to write data: %v", err)
+	}
+	data := buf.Bytes()
+
+	old, err := ranges.ReadTSV(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("unable to read data: %v", err)
+	}
+	edit, err := ranges.ReadTSV(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("unable to read data: %v", err)
+	}
+	edit.RemovePixel("Brontostoma discus", 17319)
+	edit.AddPixel("Brontostoma discus", 0, 17320)
+	edit.Delete("Megazostrodon rudnerae")
+	edit.SetAge("Rhododendron ericoides", 1_000_000)
+	edit.SetPixels("Aus bus", 0, map[int]float64{100: 1, 101: 1})
+
+	p, err := ranges.Diff(old, edit)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+
+	// encode and decode the patch
+	var pb bytes.Buffer
+	if err := p.TSV(&pb); err != nil {
+		t.Fatalf("unable to write patch: %v", err)
+	}
+	p, err = ranges.ReadPatch(&pb)
+	if err != nil {
+		t.Fatalf("unable to read patch: %v", err)
+	}
+	// 1 removed and 1 added pixel of Brontostoma,
+	// 1 removed pixel of Megazostrodon,
+	// the age of Rhododendron,
+	// and 2 added pixels of Aus bus
+	if n := p.Len(); n != 6 {
+		t.Errorf("patch: got %d changes, want %d", n, 6)
+	}
+
+	got, err := ranges.ReadTSV(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("unable to read data: %v", err)
+	}
+	if err := p.Apply(got); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	testEqualCollection(t, got, edit)
+
+	if err := p.Reverse().Apply(got); err != nil {
+		t.Fatalf("apply reverse: %v", err)
+	}
+	testEqualCollection(t, got, old)
+
+	// a patch can not be applied twice
+	if err := p.Apply(got); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := p.Apply(got); err == nil {
+		t.Errorf("apply: expecting error")
+	}
+}
+
+func TestPatchEdit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := makeCollection(t).TSV(&buf); err != nil {
+		t.Fatalf("unable to write data: %v", err)
+	}
+	data := buf.Bytes()
+
+	// a patch written by hand
+	in := `# taxon range patch
+op	taxon	type	age	equator	pixel	density	records	value
+rename	Brontostoma discus							Brontostoma discum
+add	Brontostoma discum	points	0	360	17320
+age	Eoraptor lunensis		230000000					228000000
+remove	Megazostrodon rudnerae	points	201600000	360	34957	1	1
+`
+	p, err := ranges.ReadPatch(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unable to read patch: %v", err)
+	}
+
+	coll, err := ranges.ReadTSV(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("unable to read data: %v", err)
+	}
+	if err := p.Apply(coll); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	taxa := []string{"Brontostoma discum", "Eoraptor lunensis", "Rhododendron ericoides"}
+	if ls := coll.Taxa(); !reflect.DeepEqual(ls, taxa) {
+		t.Errorf("taxa: got %v, want %v", ls, taxa)
+	}
+	want := map[int]float64{17319: 1, 17320: 1, 19117: 1}
+	if rng := coll.Range("Brontostoma discum"); !reflect.DeepEqual(rng, want) {
+		t.Errorf("range: got %v, want %v", rng, want)
+	}
+	if age := coll.Age("Eoraptor lunensis"); age != 228_000_000 {
+		t.Errorf("age: got %d, want %d", age, 228_000_000)
+	}
+
+	// encode, decode, and reverse the patch
+	var pb bytes.Buffer
+	if err := p.TSV(&pb); err != nil {
+		t.Fatalf("unable to write patch: %v", err)
+	}
+	p, err = ranges.ReadPatch(&pb)
+	if err != nil {
+		t.Fatalf("unable to read patch: %v", err)
+	}
+	if err := p.Reverse().Apply(coll); err != nil {
+		t.Fatalf("apply reverse: %v", err)
+	}
+	old, err := ranges.ReadTSV(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("unable to read data: %v", err)
+	}
+	testEqualCollection(t, coll, old)
+
+	// rename into an existing taxon
+	p, err = ranges.ReadPatch(strings.NewReader("op\ttaxon\tvalue\nrename\tBrontostoma discus\tEoraptor lunensis\n"))
+	if err != nil {
+		t.Fatalf("unable to read patch: %v", err)
+	}
+	if err := p.Apply(coll); err == nil {
+		t.Errorf("apply: expecting rename error")
+	}
+}
+
+func TestPatchInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no header":  "add\tAus bus\tpoints\t0\t360\t100\t1\t0\n",
+		"operation":  "op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nmove\tAus bus\tpoints\t0\t360\t100\t1\t0\n",
+		"type":       "op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nadd\tAus bus\tpolygon\t0\t360\t100\t1\t0\n",
+		"pixel":      "op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nadd\tAus bus\tpoints\t0\t360\t-1\t1\t0\n",
+		"density":    "op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nadd\tAus bus\tpoints\t0\t360\t100\tNaN\t0\n",
+		"equator":    "op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nadd\tAus bus\tpoints\t0\t360\t100\t1\t0\nadd\tAus bus\tpoints\t0\t720\t101\t1\t0\n",
+		"empty name": "op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nadd\t\tpoints\t0\t360\t100\t1\t0\n",
+		"no pixel":   "op\ttaxon\ttype\tage\tequator\nadd\tAus bus\tpoints\t0\t360\n",
+		"new age":    "op\ttaxon\tage\tvalue\nage\tAus bus\t0\t\n",
+		"new name":   "op\ttaxon\tvalue\nrename\tAus bus\n",
+	}
+	for name, in := range tests {
+		if _, err := ranges.ReadPatch(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expecting error", name)
+		}
+	}
+
+	// pixelation mismatch
+	p, err := ranges.ReadPatch(strings.NewReader("op\ttaxon\ttype\tage\tequator\tpixel\tdensity\trecords\nadd\tAus bus\tpoints\t0\t720\t100\t1\t0\n"))
+	if err != nil {
+		t.Fatalf("unable to read patch: %v", err)
+	}
+	if err := p.Apply(ranges.New(earth.NewPixelation(360))); err == nil {
+		t.Errorf("apply: expecting pixelation error")
+	}
+}
+
+func testEqualCollection(t testing.TB, got, want *ranges.Collection) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got.Taxa(), want.Taxa()) {
+		t.Fatalf("taxa: got %v, want %v", got.Taxa(), want.Taxa())
+	}
+	for _, tax := range want.Taxa() {
+		if got.Type(tax) != want.Type(tax) {
+			t.Errorf("taxon %q: type: got %q, want %q", tax, got.Type(tax), want.Type(tax))
+		}
+		if got.Age(tax) != want.Age(tax) {
+			t.Errorf("taxon %q: age: got %d, want %d", tax, got.Age(tax), want.Age(tax))
+		}
+		if !reflect.DeepEqual(got.Range(tax), want.Range(tax)) {
+			t.Errorf("taxon %q: range: got %v, want %v", tax, got.Range(tax), want.Range(tax))
+		}
+		if !reflect.DeepEqual(got.Records(tax), want.Records(tax)) {
+			t.Errorf("taxon %q: records: got %v, want %v", tax, got.Records(tax), want.Records(tax))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package phylo
+
+// Diversity returns the phylogenetic diversity (PD)
+// and the phylogenetic endemism (PE)
+// of each pixel,
+// given the pixels in the range of each terminal of the tree.
+// Terminals without a range are ignored.
+//
+// The PD of a pixel is the sum of the lengths
+// of the branches that connect
+// the terminals present in the pixel
+// with the root of the tree
+// (Faith 1992).
+// The PE of a pixel is the sum of the lengths
+// of the same branches,
+// each one divided by the range size of the branch,
+// i.e., the number of pixels in the union of the ranges
+// of the terminals descendant from the branch
+// (Rosauer et al. 2009).
+//
+// The branch of the root is not used.
+// If no branch of the tree has a defined length,
+// all branches are taken as of length 1.
+func (t *Tree) Diversity(rng map[string]map[int]bool) (pd, pe map[int]float64) {
+	unit := true
+	for _, n := range t.Nodes() {
+		if n != t.Root && n.HasLen {
+			unit = false
+			break
+		}
+	}
+
+	pd = make(map[int]float64)
+	pe = make(map[int]float64)
+	var visit func(n *Node) map[int]bool
+	visit = func(n *Node) map[int]bool {
+		var pixels map[int]bool
+		if n.IsTerm() {
+			pixels = rng[n.Name]
+		} else {
+			pixels = make(map[int]bool)
+			for _, c := range n.Children {
+				for px := range visit(c) {
+					pixels[px] = true
+				}
+			}
+		}
+		if n == t.Root || len(pixels) == 0 {
+			return pixels
+		}
+
+		l := n.Len
+		if unit {
+			l = 1
+		}
+		w := l / float64(len(pixels))
+		for px := range pixels {
+			pd[px] += l
+			pe[px] += w
+		}
+		return pixels
+	}
+	visit(t.Root)
+
+	return pd, pe
+}
@@ -0,0 +1,62 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package phylo_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/ranges/phylo"
+)
+
+func TestDiversity(t *testing.T) {
+	tr, err := phylo.Read(strings.NewReader("((a:1,b:1):2,c:4,d:1);"))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	rng := map[string]map[int]bool{
+		"a": {1: true, 2: true},
+		"b": {2: true, 3: true},
+		"c": {3: true},
+		"x": {4: true},
+	}
+	pd, pe := tr.Diversity(rng)
+
+	wantPD := map[int]float64{
+		1: 1 + 2,
+		2: 1 + 1 + 2,
+		3: 1 + 2 + 4,
+	}
+	wantPE := map[int]float64{
+		1: 1.0/2 + 2.0/3,
+		2: 1.0/2 + 1.0/2 + 2.0/3,
+		3: 1.0/2 + 2.0/3 + 4,
+	}
+	testValues(t, "pd", pd, wantPD)
+	testValues(t, "pe", pe, wantPE)
+
+	// tree without branch lengths
+	tr, err = phylo.Read(strings.NewReader("((a,b),c);"))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	pd, _ = tr.Diversity(rng)
+	testValues(t, "unit pd", pd, map[int]float64{1: 2, 2: 3, 3: 3})
+}
+
+func testValues(t testing.TB, name string, got, want map[int]float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d pixels, want %d", name, len(got), len(want))
+	}
+	for px, w := range want {
+		if g := got[px]; math.Abs(g-w) > 1e-6 {
+			t.Errorf("%s: pixel %d: got %.6f, want %.6f", name, px, g, w)
+		}
+	}
+}
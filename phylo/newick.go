@@ -0,0 +1,301 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package phylo implements a reader
+// for phylogenetic trees in Newick format,
+// and the calculation of the phylogenetic diversity
+// and phylogenetic endemism of a set of ranges.
+package phylo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Node is a node of a phylogenetic tree.
+type Node struct {
+	// Name of the node
+	// (it can be empty for internal nodes)
+	Name string
+
+	// Len is the length of the branch
+	// that connects the node with its parent
+	Len float64
+
+	// HasLen is true
+	// if the branch length was defined in the tree
+	HasLen bool
+
+	Parent   *Node
+	Children []*Node
+}
+
+// IsTerm returns true if the node is a terminal
+// (i.e., a tip of the tree).
+func (n *Node) IsTerm() bool {
+	return len(n.Children) == 0
+}
+
+// A Tree is a rooted phylogenetic tree.
+type Tree struct {
+	Root *Node
+}
+
+// Terms returns the names of the terminals of the tree,
+// in the order in which they are found in the tree.
+func (t *Tree) Terms() []string {
+	var terms []string
+	for _, n := range t.Nodes() {
+		if n.IsTerm() {
+			terms = append(terms, n.Name)
+		}
+	}
+	return terms
+}
+
+// Nodes returns the nodes of the tree
+// in pre-order.
+func (t *Tree) Nodes() []*Node {
+	var nodes []*Node
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		nodes = append(nodes, n)
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	visit(t.Root)
+	return nodes
+}
+
+// Read reads a tree in Newick format
+// from r.
+// Only the first tree of the input is read.
+//
+// Unquoted names with underscores are read
+// with the underscores replaced by spaces,
+// quoted names
+// (with single quotes)
+// are read as they are.
+// Comments
+// (text in square brackets)
+// are ignored.
+func Read(r io.Reader) (*Tree, error) {
+	p := &parser{r: bufio.NewReader(r)}
+	c, err := p.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty tree")
+		}
+		return nil, err
+	}
+	if c != '(' {
+		return nil, fmt.Errorf("unexpected character %q at the start of the tree", c)
+	}
+	root, err := p.node(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = p.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("tree without ending ';'")
+		}
+		return nil, err
+	}
+	if c != ';' {
+		return nil, fmt.Errorf("unexpected character %q at the end of the tree", c)
+	}
+
+	t := &Tree{Root: root}
+	names := make(map[string]bool)
+	for _, n := range t.Terms() {
+		if n == "" {
+			return nil, errors.New("terminal without name")
+		}
+		if names[n] {
+			return nil, fmt.Errorf("repeated terminal %q", n)
+		}
+		names[n] = true
+	}
+	return t, nil
+}
+
+// A Parser is a Newick parser.
+type parser struct {
+	r *bufio.Reader
+}
+
+// Node reads an internal node of the tree,
+// after its opening parenthesis.
+func (p *parser) node(parent *Node) (*Node, error) {
+	n := &Node{Parent: parent}
+	for {
+		c, err := p.next()
+		if err != nil {
+			return nil, p.unexpected(err)
+		}
+		var child *Node
+		if c == '(' {
+			child, err = p.node(n)
+		} else {
+			p.r.UnreadRune()
+			child = &Node{Parent: n}
+			err = p.label(child)
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, child)
+
+		c, err = p.next()
+		if err != nil {
+			return nil, p.unexpected(err)
+		}
+		if c == ')' {
+			break
+		}
+		if c != ',' {
+			return nil, fmt.Errorf("unexpected character %q, want ',' or ')'", c)
+		}
+	}
+
+	if err := p.label(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Label reads the name and branch length
+// of a node.
+func (p *parser) label(n *Node) error {
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	n.Name = name
+
+	c, err := p.next()
+	if err != nil {
+		return p.unexpected(err)
+	}
+	if c != ':' {
+		p.r.UnreadRune()
+		return nil
+	}
+
+	v, err := p.name()
+	if err != nil {
+		return err
+	}
+	l, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("node %q: invalid branch length %q: %v", n.Name, v, err)
+	}
+	if l < 0 {
+		return fmt.Errorf("node %q: invalid branch length %q", n.Name, v)
+	}
+	n.Len = l
+	n.HasLen = true
+	return nil
+}
+
+// Name reads a name
+// (or a number)
+// from the input.
+func (p *parser) name() (string, error) {
+	c, err := p.next()
+	if err != nil {
+		return "", p.unexpected(err)
+	}
+
+	var b strings.Builder
+	if c == '\'' {
+		for {
+			c, _, err := p.r.ReadRune()
+			if err != nil {
+				return "", p.unexpected(err)
+			}
+			if c == '\'' {
+				nx, _, err := p.r.ReadRune()
+				if err == nil && nx == '\'' {
+					b.WriteRune('\'')
+					continue
+				}
+				if err == nil {
+					p.r.UnreadRune()
+				}
+				return strings.Join(strings.Fields(b.String()), " "), nil
+			}
+			b.WriteRune(c)
+		}
+	}
+
+	p.r.UnreadRune()
+	for {
+		c, _, err := p.r.ReadRune()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.ContainsRune("(),:;['", c) {
+			p.r.UnreadRune()
+			break
+		}
+		if c == '_' {
+			c = ' '
+		}
+		b.WriteRune(c)
+	}
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
+// Next returns the next character
+// that is not a space,
+// or part of a comment.
+func (p *parser) next() (rune, error) {
+	for {
+		c, _, err := p.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '[':
+			if err := p.comment(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		return c, nil
+	}
+}
+
+// Comment skips a comment.
+func (p *parser) comment() error {
+	for {
+		c, _, err := p.r.ReadRune()
+		if err != nil {
+			return p.unexpected(err)
+		}
+		if c == ']' {
+			return nil
+		}
+	}
+}
+
+func (p *parser) unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package phylo_test
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/js-arias/ranges/phylo"
+)
+
+const tree = `[a comment]
+((Homo_sapiens:1, 'Pan troglodytes':1)hominini:2.5,
+	'O''Brien':3.5,
+	(Gorilla gorilla:1.5,Pongo:2):1)root;
+(Other,tree);
+`
+
+func TestRead(t *testing.T) {
+	tr, err := phylo.Read(strings.NewReader(tree))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	want := []string{"Homo sapiens", "Pan troglodytes", "O'Brien", "Gorilla gorilla", "Pongo"}
+	if got := tr.Terms(); !reflect.DeepEqual(got, want) {
+		t.Errorf("terms: got %q, want %q", got, want)
+	}
+
+	if tr.Root.Name != "root" {
+		t.Errorf("root: got name %q, want %q", tr.Root.Name, "root")
+	}
+	if len(tr.Root.Children) != 3 {
+		t.Fatalf("root: got %d children, want %d", len(tr.Root.Children), 3)
+	}
+	h := tr.Root.Children[0]
+	if h.Name != "hominini" || !h.HasLen || math.Abs(h.Len-2.5) > 1e-6 {
+		t.Errorf("node: got %q:%.3f, want %q:%.3f", h.Name, h.Len, "hominini", 2.5)
+	}
+	if h.Parent != tr.Root {
+		t.Errorf("node %q: invalid parent", h.Name)
+	}
+	if tr.Root.HasLen {
+		t.Errorf("root: unexpected branch length")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":             "  ",
+		"no parenthesis":    "a;",
+		"unclosed":          "(a,b",
+		"no ending":         "(a,b)",
+		"invalid length":    "(a:x,b);",
+		"negative length":   "(a:-1,b);",
+		"repeated terminal": "(a,(b,a));",
+		"unnamed terminal":  "(a,,b);",
+		"unclosed comment":  "(a,b)[comment;",
+		"unclosed quote":    "(a,'b);",
+	}
+
+	for name, data := range tests {
+		if _, err := phylo.Read(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: expecting error", name)
+		}
+	}
+}
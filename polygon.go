@@ -0,0 +1,88 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"errors"
+
+	"github.com/js-arias/earth"
+)
+
+// PolygonPixels returns the pixels
+// with a center inside a spherical polygon,
+// in which the edges are great circle arcs
+// between consecutive vertices
+// (the last vertex is connected to the first one).
+// The polygon can be non-convex,
+// but its edges must not cross each other,
+// and all of its vertices must be in the hemisphere
+// centered at their mean direction.
+// All returned pixels are set to 1.0.
+func PolygonPixels(pix *earth.Pixelation, vertices []earth.Point) (map[int]float64, error) {
+	if len(vertices) < 3 {
+		return nil, errors.New("polygon with less than three vertices")
+	}
+
+	var c vec3
+	for _, pt := range vertices {
+		c = c.add(toVec3(pt))
+	}
+	n := c.norm()
+	if n < 1e-9 {
+		return nil, errors.New("polygon not contained in a hemisphere")
+	}
+	c = c.scale(1 / n)
+	e1, e2 := tangentBasis(c)
+
+	// in the gnomonic projection
+	// great circles are straight lines.
+	poly := make([]point2, 0, len(vertices))
+	minP := point2{x: 1e300, y: 1e300}
+	maxP := point2{x: -1e300, y: -1e300}
+	for _, pt := range vertices {
+		p, ok := gnomonic(toVec3(pt), c, e1, e2)
+		if !ok {
+			return nil, errors.New("polygon not contained in a hemisphere")
+		}
+		poly = append(poly, p)
+		minP.x, minP.y = min(minP.x, p.x), min(minP.y, p.y)
+		maxP.x, maxP.y = max(maxP.x, p.x), max(maxP.y, p.y)
+	}
+
+	in := make(map[int]float64)
+	for id := 0; id < pix.Len(); id++ {
+		p, ok := gnomonic(toVec3(pix.ID(id).Point()), c, e1, e2)
+		if !ok {
+			continue
+		}
+		if p.x < minP.x || p.x > maxP.x || p.y < minP.y || p.y > maxP.y {
+			continue
+		}
+		if insideSimplePolygon(poly, p) {
+			in[id] = 1
+		}
+	}
+	return in, nil
+}
+
+// InsideSimplePolygon returns true
+// if a point is inside a simple polygon
+// (not necessarily convex),
+// using the even-odd rule.
+func insideSimplePolygon(poly []point2, p point2) bool {
+	in := false
+	j := len(poly) - 1
+	for i := range poly {
+		a, b := poly[i], poly[j]
+		if (a.y > p.y) != (b.y > p.y) {
+			x := a.x + (p.y-a.y)*(b.x-a.x)/(b.y-a.y)
+			if p.x < x {
+				in = !in
+			}
+		}
+		j = i
+	}
+	return in
+}
@@ -0,0 +1,103 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestPolygonPixels(t *testing.T) {
+	pix := earth.NewPixelation(360)
+
+	// a non-convex "L" shaped polygon
+	poly := []earth.Point{
+		earth.NewPoint(0, 0),
+		earth.NewPoint(0, 20),
+		earth.NewPoint(5, 20),
+		earth.NewPoint(5, 5),
+		earth.NewPoint(20, 5),
+		earth.NewPoint(20, 0),
+	}
+	in, err := ranges.PolygonPixels(pix, poly)
+	if err != nil {
+		t.Fatalf("polygon: unexpected error: %v", err)
+	}
+	for _, p := range [][2]float64{{2.5, 15}, {15, 2.5}, {2.5, 2.5}} {
+		if px := pix.Pixel(p[0], p[1]).ID(); in[px] != 1 {
+			t.Errorf("polygon: pixel %d at %v not in polygon", px, p)
+		}
+	}
+	for _, p := range [][2]float64{{15, 15}, {-10, 10}, {10, 40}} {
+		if px := pix.Pixel(p[0], p[1]).ID(); in[px] != 0 {
+			t.Errorf("polygon: pixel %d at %v in polygon", px, p)
+		}
+	}
+
+	// across the anti-meridian
+	poly = []earth.Point{
+		earth.NewPoint(0, 175),
+		earth.NewPoint(0, -175),
+		earth.NewPoint(10, -175),
+		earth.NewPoint(10, 175),
+	}
+	in, err = ranges.PolygonPixels(pix, poly)
+	if err != nil {
+		t.Fatalf("anti-meridian polygon: unexpected error: %v", err)
+	}
+	if px := pix.Pixel(5, 179.5).ID(); in[px] != 1 {
+		t.Errorf("anti-meridian polygon: pixel %d not in polygon", px)
+	}
+	if px := pix.Pixel(5, 0).ID(); in[px] != 0 {
+		t.Errorf("anti-meridian polygon: pixel %d in polygon", px)
+	}
+
+	// around the pole
+	poly = []earth.Point{
+		earth.NewPoint(80, 0),
+		earth.NewPoint(80, 90),
+		earth.NewPoint(80, 180),
+		earth.NewPoint(80, -90),
+	}
+	in, err = ranges.PolygonPixels(pix, poly)
+	if err != nil {
+		t.Fatalf("polar polygon: unexpected error: %v", err)
+	}
+	if px := pix.Pixel(90, 0).ID(); in[px] != 1 {
+		t.Errorf("polar polygon: pixel %d not in polygon", px)
+	}
+	if px := pix.Pixel(70, 45).ID(); in[px] != 0 {
+		t.Errorf("polar polygon: pixel %d in polygon", px)
+	}
+
+	// long edges at high latitude,
+	// the great circle arcs bend towards the pole,
+	// so at longitude 0 the polygon covers
+	// from about 59 to 74 degrees of latitude
+	// (a straight line in latitude and longitude
+	// would cover from 40 to 60 degrees)
+	poly = []earth.Point{
+		earth.NewPoint(60, -60),
+		earth.NewPoint(60, 60),
+		earth.NewPoint(40, 60),
+		earth.NewPoint(40, -60),
+	}
+	in, err = ranges.PolygonPixels(pix, poly)
+	if err != nil {
+		t.Fatalf("great circle polygon: unexpected error: %v", err)
+	}
+	if px := pix.Pixel(67, 0).ID(); in[px] != 1 {
+		t.Errorf("great circle polygon: pixel %d not in polygon", px)
+	}
+	if px := pix.Pixel(50, 0).ID(); in[px] != 0 {
+		t.Errorf("great circle polygon: pixel %d in polygon", px)
+	}
+
+	if _, err := ranges.PolygonPixels(pix, poly[:2]); err == nil {
+		t.Errorf("polygon with two vertices: expecting error")
+	}
+}
@@ -9,12 +9,28 @@
 // and it can be either explicit sampling points,
 // or a probability density for the presence of a taxon
 // at a pixel.
+//
+// Geometric operations
+// (Neighbors, Buffer, Patches, ConvexHull, PatchHulls,
+// PolygonPixels, and BoundingBox)
+// are defined on the sphere,
+// so they give the same results
+// for ranges that cross the anti-meridian
+// (the ±180° meridian),
+// or that include a pole,
+// as for any other range.
+// Longitudes are never compared
+// as if the planet were flat.
 package ranges
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
+	"math"
 	"slices"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -37,11 +53,62 @@ const (
 	Range Type = "range"
 )
 
+// Order is the order of the taxa
+// when a collection is written.
+type Order int
+
+// Order valid values.
+const (
+	// ByName sorts the taxa by name.
+	ByName Order = iota
+
+	// ByAge sorts the taxa by age
+	// (from the youngest),
+	// and then by name.
+	ByAge
+
+	// InputOrder keeps the order
+	// in which the taxa were added to the collection
+	// (for example,
+	// the order of the taxa in the file read
+	// by ReadTSV).
+	InputOrder
+)
+
 // A Collection is a collection of distribution ranges
 // with an associated pixelation.
 type Collection struct {
 	pix  *earth.Pixelation
 	taxa map[string]*taxon
+
+	// if true, verbatim names will be used
+	// when writing the collection
+	keepVerbatim bool
+
+	// names of the extra columns
+	// read from a TSV file
+	extra []string
+
+	// order of the taxa when writing the collection
+	order Order
+
+	// if true, the timestamp comment is omitted
+	// when writing the collection
+	omitTime bool
+
+	// additional comments
+	// written with the collection
+	comments []string
+
+	// sequence number of the next taxon
+	// added to the collection
+	next int
+
+	// index is an inverted index of pixels to taxa,
+	// built on demand by TaxaAt,
+	// and discarded when a range is modified.
+	idxMu sync.Mutex
+	index map[int][]string
 }
 
 // New creates a new collection of taxon ranges
@@ -55,16 +122,13 @@ func New(pix *earth.Pixelation) *Collection {
 
 // Add adds a point to a taxon at an specific age
 // (in years).
+// Each added point is counted as a record
+// of the taxon at the pixel of the point.
 //
 // To add a point the range of the taxon must be defined
 // as 'points'
 // (i.e. a presence-absence pixelation).
 func (c *Collection) Add(name string, age int64, lat, lon float64) {
-	name = canon(name)
-	if name == "" {
-		return
-	}
-
 	pixID := c.pix.Pixel(lat, lon).ID()
 	c.add(name, age, pixID)
 }
@@ -78,24 +142,25 @@ func (c *Collection) Add(name string, age int64, lat, lon float64) {
 // as 'points'
 // (i.e. a presence-absence pixelation).
 func (c *Collection) AddPixel(name string, age int64, pixID int) {
-	name = canon(name)
+	c.add(name, age, pixID)
+}
+
+func (c *Collection) add(verbatim string, age int64, pixID int) {
+	name := canon(verbatim)
 	if name == "" {
 		return
 	}
 
-	c.add(name, age, pixID)
-}
-
-func (c *Collection) add(name string, age int64, pixID int) {
 	tax, ok := c.taxa[name]
 	if !ok {
 		tax = &taxon{
-			name: name,
-			age:  age,
-			tp:   Points,
-			rng:  make(map[int]float64),
+			name:     name,
+			verbatim: normalize(verbatim),
+			age:      age,
+			tp:       Points,
+			rng:      make(map[int]float64),
 		}
-		c.taxa[name] = tax
+		c.addTaxon(tax)
 	}
 	if tax.tp != Points {
 		return
@@ -104,7 +169,14 @@ func (c *Collection) add(name string, age int64, pixID int) {
 		return
 	}
 
+	if _, ok := tax.rng[pixID]; !ok {
+		c.resetIndex()
+	}
 	tax.rng[pixID] = 1
+	if tax.recs == nil {
+		tax.recs = make(map[int]int)
+	}
+	tax.recs[pixID]++
 }
 
 // Age returns the age
@@ -125,6 +197,66 @@ func (c *Collection) Age(name string) int64 {
 	return tax.age
 }
 
+// Copy copies the range of a taxon
+// from another collection,
+// including its record counts
+// and the values of the extra columns.
+// It will overwrite any data previously set for the taxon.
+// Both collections must have the same pixelation.
+func (c *Collection) Copy(src *Collection, name string) error {
+	if src.pix.Equator() != c.pix.Equator() {
+		return fmt.Errorf("copying %q: invalid pixelation: got %d, want %d", name, src.pix.Equator(), c.pix.Equator())
+	}
+	nm := canon(name)
+	srcTax, ok := src.taxa[nm]
+	if !ok {
+		return fmt.Errorf("taxon %q not in collection", name)
+	}
+
+	tax, ok := c.taxa[nm]
+	if !ok {
+		tax = &taxon{name: nm}
+		c.addTaxon(tax)
+	}
+	tax.verbatim = srcTax.verbatim
+	tax.tp = srcTax.tp
+	tax.age = srcTax.age
+	tax.interval = srcTax.interval
+	tax.minAge = srcTax.minAge
+	tax.maxAge = srcTax.maxAge
+	tax.rng = maps.Clone(srcTax.rng)
+	tax.recs = maps.Clone(srcTax.recs)
+	tax.extra = nil
+	c.resetIndex()
+
+	if len(srcTax.extra) == 0 {
+		return nil
+	}
+
+	// columns of the source collection
+	// in the destination collection
+	cols := make([]int, len(src.extra))
+	for i, h := range src.extra {
+		j := slices.IndexFunc(c.extra, func(s string) bool {
+			return strings.EqualFold(s, h)
+		})
+		if j < 0 {
+			j = len(c.extra)
+			c.extra = append(c.extra, h)
+		}
+		cols[i] = j
+	}
+	tax.extra = make(map[int][]string, len(srcTax.extra))
+	for px, v := range srcTax.extra {
+		vals := make([]string, len(c.extra))
+		for i, x := range v {
+			vals[cols[i]] = x
+		}
+		tax.extra[px] = vals
+	}
+	return nil
+}
+
 // Delete removes the indicated taxon from the collection.
 func (c *Collection) Delete(name string) {
 	name = canon(name)
@@ -133,6 +265,7 @@ func (c *Collection) Delete(name string) {
 	}
 
 	delete(c.taxa, name)
+	c.resetIndex()
 }
 
 // HasTaxon returns true if the indicated taxon
@@ -147,6 +280,203 @@ func (c *Collection) HasTaxon(name string) bool {
 	return ok
 }
 
+// AddTaxon adds a new taxon to the collection.
+func (c *Collection) addTaxon(tax *taxon) {
+	tax.seq = c.next
+	c.next++
+	c.taxa[tax.name] = tax
+}
+
+// KeepVerbatim sets the names used
+// when the collection is written.
+// If keep is true,
+// the verbatim names
+// (i.e. the names as they were first given)
+// will be used,
+// otherwise,
+// the canonical names will be used.
+func (c *Collection) KeepVerbatim(keep bool) {
+	c.keepVerbatim = keep
+}
+
+// OmitTimestamp sets if the comment
+// with the time in which the collection was written
+// is omitted when the collection is written,
+// so the output of the same collection
+// is always the same.
+func (c *Collection) OmitTimestamp(omit bool) {
+	c.omitTime = omit
+}
+
+// AddComment adds a comment
+// (for example, the parameters of an analysis)
+// that is written in the header of the file
+// when the collection is written.
+// The comments are not read back by ReadTSV.
+func (c *Collection) AddComment(s string) {
+	c.comments = append(c.comments, s)
+}
+
+// Merge merges the range of taxon src
+// into the range of taxon dst,
+// and removes src from the collection.
+// If dst is not in the collection,
+// src will be renamed as dst.
+//
+// Both taxa must have the same type of range map,
+// and the same age.
+// For points,
+// the merged range is the union of the pixels,
+// for continuous ranges,
+// the merged range is the maximum density
+// at each pixel.
+// If both taxa have an age interval,
+// the merged taxon has the union of the intervals,
+// if only one of the taxa has an age interval,
+// the merged taxon has that interval.
+func (c *Collection) Merge(dst, src string) error {
+	srcName := canon(src)
+	srcTax, ok := c.taxa[srcName]
+	if !ok {
+		return fmt.Errorf("taxon %q not in collection", src)
+	}
+	dstName := canon(dst)
+	if dstName == "" {
+		return fmt.Errorf("invalid destination name %q", dst)
+	}
+	if dstName == srcName {
+		srcTax.verbatim = normalize(dst)
+		return nil
+	}
+
+	c.resetIndex()
+	dstTax, ok := c.taxa[dstName]
+	if !ok {
+		delete(c.taxa, srcName)
+		srcTax.name = dstName
+		srcTax.verbatim = normalize(dst)
+		c.taxa[dstName] = srcTax
+		return nil
+	}
+
+	if dstTax.tp != srcTax.tp {
+		return fmt.Errorf("merging %q into %q: invalid type: got %q, want %q", src, dst, srcTax.tp, dstTax.tp)
+	}
+	if dstTax.age != srcTax.age {
+		return fmt.Errorf("merging %q into %q: invalid age: got %d, want %d", src, dst, srcTax.age, dstTax.age)
+	}
+	for px, v := range srcTax.rng {
+		if v > dstTax.rng[px] {
+			dstTax.rng[px] = v
+		}
+	}
+	switch {
+	case srcTax.interval && dstTax.interval:
+		dstTax.minAge = min(dstTax.minAge, srcTax.minAge)
+		dstTax.maxAge = max(dstTax.maxAge, srcTax.maxAge)
+	case srcTax.interval:
+		dstTax.interval = true
+		dstTax.minAge = srcTax.minAge
+		dstTax.maxAge = srcTax.maxAge
+	}
+	if len(srcTax.recs) > 0 {
+		if dstTax.recs == nil {
+			dstTax.recs = make(map[int]int)
+		}
+		for px, n := range srcTax.recs {
+			dstTax.recs[px] += n
+		}
+	}
+	for px, vals := range srcTax.extra {
+		if _, ok := dstTax.extra[px]; ok {
+			continue
+		}
+		if dstTax.extra == nil {
+			dstTax.extra = make(map[int][]string)
+		}
+		dstTax.extra[px] = vals
+	}
+	delete(c.taxa, srcName)
+	return nil
+}
+
+// ExtraColumns returns the names of the columns
+// read from a TSV file
+// that are not used by the package.
+func (c *Collection) ExtraColumns() []string {
+	return slices.Clone(c.extra)
+}
+
+// Extra returns the values of an extra column
+// for a taxon at each pixel
+// (see ExtraColumns).
+// Pixels without a value are not included.
+func (c *Collection) Extra(name, column string) map[int]string {
+	name = canon(name)
+	if name == "" {
+		return nil
+	}
+	tax, ok := c.taxa[name]
+	if !ok {
+		return nil
+	}
+	col := slices.IndexFunc(c.extra, func(s string) bool {
+		return strings.EqualFold(s, column)
+	})
+	if col < 0 {
+		return nil
+	}
+
+	vals := make(map[int]string)
+	for px, v := range tax.extra {
+		if col >= len(v) || v[col] == "" {
+			continue
+		}
+		vals[px] = v[col]
+	}
+	return vals
+}
+
+// HasRecords returns true if any taxon in the collection
+// has record counts.
+func (c *Collection) HasRecords() bool {
+	for _, tax := range c.taxa {
+		if len(tax.recs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Nearest returns the pixel in the range of a taxon
+// that is the nearest to the indicated point,
+// and the distance
+// (in km)
+// between the point and the center of the pixel.
+// If the taxon is not in the collection,
+// or its range is empty,
+// it returns -1 and +Inf.
+func (c *Collection) Nearest(name string, lat, lon float64) (pixel int, distKm float64) {
+	pixel = -1
+	distKm = math.Inf(1)
+
+	rng := c.Range(name)
+	if len(rng) == 0 {
+		return pixel, distKm
+	}
+
+	pt := earth.NewPoint(lat, lon)
+	min := math.Inf(1)
+	for px := range rng {
+		d := earth.Distance(pt, c.pix.ID(px).Point())
+		if d < min || (d == min && px < pixel) {
+			min = d
+			pixel = px
+		}
+	}
+	return pixel, min * float64(earth.Radius) / 1000
+}
+
 // Pixelation returns the underlying pixelation
 // of a Collection.
 func (c *Collection) Pixelation() *earth.Pixelation {
@@ -161,6 +491,7 @@ func (c *Collection) Pixelation() *earth.Pixelation {
 // (so in the case of points,
 // all points will be set to be 1.0,
 // and all other pixels will be 0.0).
+// The returned map must not be modified.
 func (c *Collection) Range(name string) map[int]float64 {
 	name = canon(name)
 	if name == "" {
@@ -175,29 +506,75 @@ func (c *Collection) Range(name string) map[int]float64 {
 	return tax.rng
 }
 
+// Records returns the number of records
+// of a taxon at each pixel.
+// Records are only defined for ranges of 'points' type,
+// and only if the records were counted
+// (i.e. the points were added with Add or AddPixel,
+// or read from a file with record counts).
+func (c *Collection) Records(name string) map[int]int {
+	name = canon(name)
+	if name == "" {
+		return nil
+	}
+
+	tax, ok := c.taxa[name]
+	if !ok {
+		return nil
+	}
+
+	return tax.recs
+}
+
+// RemovePixel removes a pixel from the range of a taxon,
+// including its record count
+// and the values of the extra columns.
+// The taxon is kept in the collection
+// even if its range becomes empty.
+// It returns false if the taxon is not in the collection,
+// or the pixel is not in the range of the taxon.
+func (c *Collection) RemovePixel(name string, pixel int) bool {
+	name = canon(name)
+	if name == "" {
+		return false
+	}
+
+	tax, ok := c.taxa[name]
+	if !ok {
+		return false
+	}
+	if _, ok := tax.rng[pixel]; !ok {
+		return false
+	}
+
+	delete(tax.rng, pixel)
+	delete(tax.recs, pixel)
+	delete(tax.extra, pixel)
+	c.resetIndex()
+	return true
+}
+
 // Set sets a range map for a taxon at the indicated age
 // (in years).
 // The range is a map of pixel IDs
 // to a probability.
 // The values will be scaled so the max value will be 1,
 // and values smaller than 0.0000005 will be ignored.
-// It will overwrite any range map previously set for the taxon.
+// It will overwrite any range map previously set for the taxon,
+// but the age interval of the taxon
+// (see SetAgeInterval)
+// is kept.
 func (c *Collection) Set(name string, age int64, rng map[int]float64) {
-	name = canon(name)
-	if name == "" {
+	tax := c.setTaxon(name)
+	if tax == nil {
 		return
 	}
-
-	tax, ok := c.taxa[name]
-	if !ok {
-		tax = &taxon{
-			name: name,
-		}
-		c.taxa[name] = tax
-	}
 	tax.age = age
 	tax.tp = Range
 	tax.rng = make(map[int]float64, len(rng))
+	tax.recs = nil
+	tax.extra = nil
+	c.resetIndex()
 
 	var max float64
 	for _, v := range rng {
@@ -215,27 +592,54 @@ func (c *Collection) Set(name string, age int64, rng map[int]float64) {
 	}
 }
 
-// SetPixels sets pixel points for a taxon at the indicated age
-// (in years).
-// All pixel points will set to 1.0
-// no matter the stored value in the range.
-// It will overwrite any data previously set for the taxon.
-func (c *Collection) SetPixels(name string, age int64, rng map[int]float64) {
+// SetAge sets the age of a taxon
+// (in years),
+// keeping its range.
+// Note that the pixels of the range are not moved,
+// to move the pixels of a taxon to a different age
+// use a plate motion model.
+// It returns false if the taxon is not in the collection.
+func (c *Collection) SetAge(name string, age int64) bool {
 	name = canon(name)
 	if name == "" {
-		return
+		return false
 	}
 
 	tax, ok := c.taxa[name]
 	if !ok {
-		tax = &taxon{
-			name: name,
-		}
-		c.taxa[name] = tax
+		return false
+	}
+	tax.age = age
+	return true
+}
+
+// SetOrder sets the order of the taxa
+// when the collection is written.
+// By default the taxa are sorted by name.
+func (c *Collection) SetOrder(o Order) {
+	c.order = o
+}
+
+// SetPixels sets pixel points for a taxon at the indicated age
+// (in years).
+// All pixel points will set to 1.0
+// no matter the stored value in the range.
+// It will overwrite any data previously set for the taxon,
+// including the record counts,
+// but the age interval of the taxon
+// (see SetAgeInterval)
+// is kept.
+func (c *Collection) SetPixels(name string, age int64, rng map[int]float64) {
+	tax := c.setTaxon(name)
+	if tax == nil {
+		return
 	}
 	tax.age = age
 	tax.tp = Points
 	tax.rng = make(map[int]float64, len(rng))
+	tax.recs = nil
+	tax.extra = nil
+	c.resetIndex()
 
 	for px := range rng {
 		if px >= c.pix.Len() {
@@ -246,6 +650,26 @@ func (c *Collection) SetPixels(name string, age int64, rng map[int]float64) {
 	}
 }
 
+// SetTaxon returns a taxon to be set
+// with the given name,
+// creating it if it is not in the collection.
+func (c *Collection) setTaxon(verbatim string) *taxon {
+	name := canon(verbatim)
+	if name == "" {
+		return nil
+	}
+
+	tax, ok := c.taxa[name]
+	if !ok {
+		tax = &taxon{
+			name: name,
+		}
+		c.addTaxon(tax)
+	}
+	tax.verbatim = normalize(verbatim)
+	return tax
+}
+
 // Taxa returns an slice with the taxon names
 // of the taxa in the collection of ranges.
 func (c *Collection) Taxa() []string {
@@ -258,6 +682,64 @@ func (c *Collection) Taxa() []string {
 	return ls
 }
 
+// TaxaAt returns the names of the taxa
+// with a range that includes the indicated pixel.
+//
+// The first call to TaxaAt builds an index
+// of the taxa at each pixel,
+// so successive calls are fast.
+// The index is discarded
+// each time a range in the collection is modified.
+func (c *Collection) TaxaAt(pixel int) []string {
+	c.idxMu.Lock()
+	defer c.idxMu.Unlock()
+
+	if c.index == nil {
+		c.buildIndex()
+	}
+	return slices.Clone(c.index[pixel])
+}
+
+// TaxaBy returns an slice with the taxon names
+// of the taxa in the collection,
+// sorted by the indicated order.
+func (c *Collection) TaxaBy(o Order) []string {
+	ls := c.Taxa()
+	switch o {
+	case ByAge:
+		slices.SortStableFunc(ls, func(a, b string) int {
+			return cmp.Compare(c.taxa[a].age, c.taxa[b].age)
+		})
+	case InputOrder:
+		slices.SortFunc(ls, func(a, b string) int {
+			return cmp.Compare(c.taxa[a].seq, c.taxa[b].seq)
+		})
+	}
+	return ls
+}
+
+// BuildIndex builds the inverted index
+// of pixels to taxa.
+func (c *Collection) buildIndex() {
+	c.index = make(map[int][]string)
+	for _, tax := range c.taxa {
+		for px := range tax.rng {
+			c.index[px] = append(c.index[px], tax.name)
+		}
+	}
+	for _, ls := range c.index {
+		slices.Sort(ls)
+	}
+}
+
+// ResetIndex discards the inverted index
+// of pixels to taxa.
+func (c *Collection) resetIndex() {
+	c.idxMu.Lock()
+	c.index = nil
+	c.idxMu.Unlock()
+}
+
 // Type returns the type of a range map for a given taxon.
 func (c *Collection) Type(name string) Type {
 	name = canon(name)
@@ -273,28 +755,68 @@ func (c *Collection) Type(name string) Type {
 	return tax.tp
 }
 
+// VerbatimName returns the name of a taxon
+// as it was given when the taxon was added
+// to the collection
+// (without extra spaces).
+func (c *Collection) VerbatimName(name string) string {
+	name = canon(name)
+	if name == "" {
+		return ""
+	}
+
+	tax, ok := c.taxa[name]
+	if !ok {
+		return ""
+	}
+
+	return tax.verbatim
+}
+
 // A Taxon is a representation of a taxon range.
 type taxon struct {
 	// Name of the taxon
 	name string
 
+	// Name of the taxon,
+	// as it was given
+	verbatim string
+
 	// Type of the range map defined for the taxon
 	tp Type
 
 	// Age used for the pixels of the range map.
 	age int64
 
+	// Age interval of the taxon
+	// (i.e. the uncertainty of the age of the taxon).
+	interval       bool
+	minAge, maxAge int64
+
 	// Range of the taxon.
 	//
 	// It is a probability field scaled
 	// to set the maximum value equal to 1.0
 	rng map[int]float64
+
+	// Number of records at each pixel
+	// (only for points).
+	recs map[int]int
+
+	// Values of the extra columns
+	// at each pixel.
+	extra map[int][]string
+
+	// Sequence number of the taxon,
+	// in the order in which the taxa
+	// were added to the collection.
+	seq int
 }
 
 // Canon returns a taxon name
 // in its canonical form.
 func canon(name string) string {
-	name = strings.Join(strings.Fields(name), " ")
+	name = normalize(name)
 	if name == "" {
 		return ""
 	}
@@ -302,3 +824,9 @@ func canon(name string) string {
 	r, n := utf8.DecodeRuneInString(name)
 	return string(unicode.ToUpper(r)) + name[n:]
 }
+
+// Normalize returns a taxon name
+// without extra spaces.
+func normalize(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -5,6 +5,8 @@
 package ranges_test
 
 import (
+	"maps"
+	"math"
 	"reflect"
 	"testing"
 
@@ -162,6 +164,36 @@ func testCollection(t testing.TB, coll *ranges.Collection) {
 	}
 }
 
+func TestCopy(t *testing.T) {
+	src := makeCollection(t)
+	coll := ranges.New(src.Pixelation())
+	for _, tax := range src.Taxa() {
+		if err := coll.Copy(src, tax); err != nil {
+			t.Fatalf("copy %q: %v", tax, err)
+		}
+	}
+	testCollection(t, coll)
+
+	nm := "Rhododendron ericoides"
+	if !reflect.DeepEqual(coll.Records(nm), src.Records(nm)) {
+		t.Errorf("records: got %v, want %v", coll.Records(nm), src.Records(nm))
+	}
+
+	// the copy is independent of the source
+	coll.AddPixel(nm, 0, 100)
+	if _, ok := src.Range(nm)[100]; ok {
+		t.Errorf("copy: source range modified")
+	}
+
+	if err := coll.Copy(src, "Homo sapiens"); err == nil {
+		t.Errorf("copy: expecting error for undefined taxon")
+	}
+	other := ranges.New(earth.NewPixelation(120))
+	if err := other.Copy(src, nm); err == nil {
+		t.Errorf("copy: expecting error for different pixelation")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	coll := makeCollection(t)
 	del := "Rhododendron ericoides"
@@ -177,6 +209,26 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestSetAge(t *testing.T) {
+	coll := makeCollection(t)
+
+	nm := "Rhododendron ericoides"
+	rng := maps.Clone(coll.Range(nm))
+	if !coll.SetAge(nm, 10_000_000) {
+		t.Fatalf("taxon %q: SetAge returns false", nm)
+	}
+	if a := coll.Age(nm); a != 10_000_000 {
+		t.Errorf("taxon %q: age %d, want %d", nm, a, 10_000_000)
+	}
+	if !maps.Equal(coll.Range(nm), rng) {
+		t.Errorf("taxon %q: range modified", nm)
+	}
+
+	if coll.SetAge("Homo sapiens", 10) {
+		t.Errorf("SetAge: undefined taxon: returns true")
+	}
+}
+
 func TestSetPixels(t *testing.T) {
 	coll := makeCollection(t)
 
@@ -307,3 +359,175 @@ func TestAddPixel(t *testing.T) {
 		}
 	}
 }
+
+func TestVerbatimName(t *testing.T) {
+	coll := makeCollection(t)
+	nm := "Ornithorhynchus  anatinus MacLeay"
+	coll.Add(nm, 0, -33.87, 151.21)
+	coll.Add("ornithorhynchus anatinus macleay", 0, -37.81, 144.96)
+
+	canon := "Ornithorhynchus anatinus macleay"
+	if !coll.HasTaxon(canon) {
+		t.Fatalf("hasTaxon: taxon %q not found", canon)
+	}
+	want := "Ornithorhynchus anatinus MacLeay"
+	if v := coll.VerbatimName(canon); v != want {
+		t.Errorf("verbatim name: got %q, want %q", v, want)
+	}
+
+	coll.SetPixels("ORNITHORHYNCHUS ANATINUS MACLEAY", 0, coll.Range(canon))
+	want = "ORNITHORHYNCHUS ANATINUS MACLEAY"
+	if v := coll.VerbatimName(canon); v != want {
+		t.Errorf("verbatim name: got %q, want %q", v, want)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	coll := makeCollection(t)
+	coll.Add("Brontostoma discos", 0, 10.5, -66.9)
+	coll.Add("Rhododendron ericoide", 0, 4.08, 118.52)
+
+	if err := coll.Merge("Brontostoma discus", "Brontostoma discos"); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if coll.HasTaxon("Brontostoma discos") {
+		t.Errorf("merge: taxon %q found", "Brontostoma discos")
+	}
+	want := map[int]float64{
+		16626: 1,
+		17319: 1,
+		19117: 1,
+	}
+	if rng := coll.Range("Brontostoma discus"); !reflect.DeepEqual(rng, want) {
+		t.Errorf("merge: got %v, want %v", rng, want)
+	}
+
+	// rename
+	if err := coll.Merge("Rhododendron lepidotum", "Rhododendron ericoide"); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	want = map[int]float64{
+		19308: 1,
+	}
+	if rng := coll.Range("Rhododendron lepidotum"); !reflect.DeepEqual(rng, want) {
+		t.Errorf("rename: got %v, want %v", rng, want)
+	}
+
+	// invalid age
+	if err := coll.Merge("Megazostrodon rudnerae", "Rhododendron lepidotum"); err == nil {
+		t.Errorf("merge: expecting error")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	coll := makeCollection(t)
+	nm := "Rhododendron ericoides"
+	want := map[int]int{
+		18588: 2,
+		19305: 1,
+		19308: 1,
+	}
+	if recs := coll.Records(nm); !reflect.DeepEqual(recs, want) {
+		t.Errorf("records: got %v, want %v", recs, want)
+	}
+	if !coll.HasRecords() {
+		t.Errorf("hasRecords: got false")
+	}
+
+	if recs := coll.Records("Eoraptor lunensis"); recs != nil {
+		t.Errorf("records: got %v, want nil", recs)
+	}
+
+	coll.SetPixels(nm, 0, coll.Range(nm))
+	if recs := coll.Records(nm); recs != nil {
+		t.Errorf("records after SetPixels: got %v, want nil", recs)
+	}
+}
+
+func TestRemovePixel(t *testing.T) {
+	coll := makeCollection(t)
+	nm := "Rhododendron ericoides"
+	if !coll.RemovePixel(nm, 18588) {
+		t.Fatalf("taxon %q: RemovePixel returns false", nm)
+	}
+
+	want := map[int]int{
+		19305: 1,
+		19308: 1,
+	}
+	if recs := coll.Records(nm); !reflect.DeepEqual(recs, want) {
+		t.Errorf("records: got %v, want %v", recs, want)
+	}
+	if _, ok := coll.Range(nm)[18588]; ok {
+		t.Errorf("range: pixel %d not removed", 18588)
+	}
+	if ls := coll.TaxaAt(18588); len(ls) != 0 {
+		t.Errorf("TaxaAt: got %v, want no taxa", ls)
+	}
+
+	if coll.RemovePixel(nm, 18588) {
+		t.Errorf("RemovePixel: pixel not in range: returns true")
+	}
+	if coll.RemovePixel("Homo sapiens", 18588) {
+		t.Errorf("RemovePixel: undefined taxon: returns true")
+	}
+}
+
+func TestTaxaAt(t *testing.T) {
+	coll := makeCollection(t)
+	coll.Add("Rhododendron lepidotum", 0, 6.08, 116.55)
+
+	tests := map[int][]string{
+		18588: {"Rhododendron ericoides", "Rhododendron lepidotum"},
+		34663: {"Eoraptor lunensis"},
+		0:     nil,
+	}
+	for px, want := range tests {
+		if ls := coll.TaxaAt(px); !reflect.DeepEqual(ls, want) {
+			t.Errorf("pixel %d: got %v, want %v", px, ls, want)
+		}
+	}
+
+	// the index must be updated after changes
+	coll.Delete("Rhododendron lepidotum")
+	coll.AddPixel("Brontostoma discus", 0, 18588)
+	want := []string{"Brontostoma discus", "Rhododendron ericoides"}
+	if ls := coll.TaxaAt(18588); !reflect.DeepEqual(ls, want) {
+		t.Errorf("pixel %d: got %v, want %v", 18588, ls, want)
+	}
+	if err := coll.Merge("Rhododendron", "Rhododendron ericoides"); err != nil {
+		t.Fatalf("merge: unexpected error: %v", err)
+	}
+	want = []string{"Brontostoma discus", "Rhododendron"}
+	if ls := coll.TaxaAt(18588); !reflect.DeepEqual(ls, want) {
+		t.Errorf("pixel %d: got %v, want %v", 18588, ls, want)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	coll := makeCollection(t)
+	pix := coll.Pixelation()
+
+	nm := "Brontostoma discus"
+	px, d := coll.Nearest(nm, 8.67, -83.56)
+	if px != 17319 {
+		t.Errorf("nearest: got pixel %d, want %d", px, 17319)
+	}
+	want := earth.Distance(earth.NewPoint(8.67, -83.56), pix.ID(17319).Point()) * float64(earth.Radius) / 1000
+	if math.Abs(d-want) > 0.001 {
+		t.Errorf("nearest: got %.3f km, want %.3f km", d, want)
+	}
+
+	px, d = coll.Nearest(nm, 4, -70)
+	if px != 19117 {
+		t.Errorf("nearest: got pixel %d, want %d", px, 19117)
+	}
+	if d < 100 || d > 500 {
+		t.Errorf("nearest: got %.3f km", d)
+	}
+
+	px, d = coll.Nearest("Unknown taxon", 0, 0)
+	if px != -1 || !math.IsInf(d, 1) {
+		t.Errorf("nearest unknown taxon: got %d, %.3f", px, d)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package render
+
+import (
+	"image"
+	"runtime"
+	"sync"
+
+	"github.com/js-arias/earth"
+)
+
+// A Frame defines an equirectangular image
+// of a geographic region.
+type Frame struct {
+	// Top and Left are the latitude and longitude
+	// of the top-left corner of the image.
+	Top, Left float64
+
+	// Step is the size of an image pixel
+	// (in degrees).
+	Step float64
+
+	// Cols and Rows are the size of the image.
+	Cols, Rows int
+}
+
+// Point returns the geographic coordinates
+// of an image pixel.
+// Longitudes greater than 180
+// are wrapped around the anti-meridian.
+func (f Frame) Point(x, y float64) (lat, lon float64) {
+	lat = f.Top - y*f.Step
+	if lat < -90 {
+		lat = -90
+	}
+	lon = f.Left + x*f.Step
+	if lon > 180 {
+		lon -= 360
+	}
+	return lat, lon
+}
+
+// A Grid stores the pixel ID
+// of each image pixel of a frame.
+type Grid struct {
+	cols int
+	ids  []int32
+}
+
+// At returns the pixel ID
+// at the given image pixel.
+func (g *Grid) At(x, y int) int {
+	return int(g.ids[y*g.cols+x])
+}
+
+type gridKey struct {
+	eq    int
+	frame Frame
+}
+
+type gridEntry struct {
+	once sync.Once
+	g    *Grid
+}
+
+var grids = struct {
+	sync.Mutex
+	m map[gridKey]*gridEntry
+}{m: make(map[gridKey]*gridEntry)}
+
+// NewGrid returns the grid of pixel IDs
+// of a frame.
+// The grid is calculated only once
+// for each pixelation and frame,
+// and it is safe to use it concurrently.
+func NewGrid(pix *earth.Pixelation, f Frame) *Grid {
+	k := gridKey{eq: pix.Equator(), frame: f}
+	grids.Lock()
+	e, ok := grids.m[k]
+	if !ok {
+		e = &gridEntry{}
+		grids.m[k] = e
+	}
+	grids.Unlock()
+
+	e.once.Do(func() {
+		g := &Grid{
+			cols: f.Cols,
+			ids:  make([]int32, f.Cols*f.Rows),
+		}
+		byRows(f.Rows, func(y int) {
+			for x := 0; x < f.Cols; x++ {
+				lat, lon := f.Point(float64(x), float64(y))
+				g.ids[y*f.Cols+x] = int32(pix.Pixel(lat, lon).ID())
+			}
+		})
+		e.g = g
+	})
+	return e.g
+}
+
+type coordKey struct {
+	eq   int
+	size image.Point
+}
+
+type coordEntry struct {
+	once sync.Once
+	pts  []image.Point
+}
+
+var coords = struct {
+	sync.Mutex
+	m map[coordKey]*coordEntry
+}{m: make(map[coordKey]*coordEntry)}
+
+// Coords returns the image coordinates
+// of the center of each pixel
+// in a global equirectangular image
+// of the given size.
+// The slice is indexed by pixel ID.
+// The coordinates are calculated only once
+// for each pixelation and image size,
+// and the returned slice must not be modified.
+func Coords(pix *earth.Pixelation, size image.Point) []image.Point {
+	k := coordKey{eq: pix.Equator(), size: size}
+	coords.Lock()
+	e, ok := coords.m[k]
+	if !ok {
+		e = &coordEntry{}
+		coords.m[k] = e
+	}
+	coords.Unlock()
+
+	e.once.Do(func() {
+		stepX := float64(360) / float64(size.X)
+		stepY := float64(180) / float64(size.Y)
+		pts := make([]image.Point, pix.Len())
+		for id := range pts {
+			pt := pix.ID(id).Point()
+			x := int((pt.Longitude() + 180) / stepX)
+			y := int((90 - pt.Latitude()) / stepY)
+			pts[id] = image.Pt(x, y)
+		}
+		e.pts = pts
+	})
+	return e.pts
+}
+
+// ByRows calls fn for each row,
+// using all available processors.
+func byRows(rows int, fn func(y int)) {
+	cpu := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for w := 0; w < cpu; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for y := w; y < rows; y += cpu {
+				fn(y)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
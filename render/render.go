@@ -0,0 +1,356 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package render implements images of range maps
+// using an equirectangular (plate carrée) projection.
+package render
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+
+	"github.com/js-arias/blind"
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+// Colors used for difference maps
+// (from the Okabe-Ito palette).
+var (
+	// OnlyRange is the color of the pixels
+	// only present in the range.
+	OnlyRange = color.RGBA{0, 114, 178, 255}
+
+	// OnlyOther is the color of the pixels
+	// only present in the compared range.
+	OnlyOther = color.RGBA{213, 94, 0, 255}
+
+	// InBoth is the color of the pixels
+	// present in both ranges.
+	InBoth = color.RGBA{0, 158, 115, 255}
+)
+
+// MinSmooth is the minimum smoothed density
+// drawn in a map.
+const MinSmooth = 0.05
+
+// A Map is an image of a range map.
+type Map struct {
+	frame Frame
+
+	// pixel ID of each image pixel
+	// (only used without supersampling
+	// or smoothing)
+	grid *Grid
+
+	// number of samples per side of an image pixel
+	samples int
+
+	// if true,
+	// the density is smoothed
+	// using the neighbors of each pixel
+	// (filled when the smoothing is set,
+	// so At is safe for concurrent use)
+	smooth bool
+	nb     [][]int
+
+	color map[int]color.RGBA
+	pix   *earth.Pixelation
+	rng   map[int]float64
+
+	// if defined,
+	// the color used for the range
+	taxColor *color.RGBA
+
+	// if true,
+	// it draws the difference between rng
+	// and other
+	diff  bool
+	other map[int]float64
+}
+
+// New returns a new empty map
+// of the indicated frame.
+func New(pix *earth.Pixelation, f Frame) *Map {
+	return &Map{
+		frame: f,
+		color: make(map[int]color.RGBA, pix.Len()),
+		pix:   pix,
+	}
+}
+
+// Global returns the frame of an image
+// of the whole globe
+// with the indicated number of columns.
+func Global(cols int) Frame {
+	return Frame{
+		Top:  90,
+		Left: -180,
+		Step: 360 / float64(cols),
+		Cols: cols,
+		Rows: cols / 2,
+	}
+}
+
+// SetRange sets the range drawn in the map.
+// By default the range is drawn
+// using a color gradient
+// for the density of each pixel.
+func (m *Map) SetRange(rng map[int]float64) {
+	m.rng = rng
+}
+
+// SetColor sets a fixed color for the range.
+// The density of each pixel
+// is indicated by the opacity of the color.
+func (m *Map) SetColor(c color.RGBA) {
+	m.taxColor = &c
+}
+
+// SetDiff sets a range to be compared
+// with the range of the map.
+// Pixels present only in the range
+// are drawn with the OnlyRange color,
+// pixels only present in the other range
+// are drawn with the OnlyOther color,
+// and pixels present in both
+// with the InBoth color.
+func (m *Map) SetDiff(other map[int]float64) {
+	m.diff = true
+	m.other = other
+}
+
+// SetSupersample sets the number of samples per side
+// of each image pixel
+// used to anti-alias the edges of the pixels.
+func (m *Map) SetSupersample(samples int) {
+	m.samples = samples
+}
+
+// SetSmooth sets the interpolation of the density
+// at each point
+// from the densities of the pixel and its neighbors.
+// Smoothing is ignored when drawing difference maps.
+func (m *Map) SetSmooth(smooth bool) {
+	m.smooth = smooth
+	if !smooth || m.nb != nil {
+		return
+	}
+	m.nb = make([][]int, m.pix.Len())
+	for px := range m.nb {
+		m.nb[px] = append([]int{px}, ranges.Neighbors(m.pix, px)...)
+	}
+}
+
+// UseGrid sets the map
+// to use a cached grid
+// of the pixel IDs of each image pixel,
+// so the map will be drawn faster
+// when many maps share the same frame.
+// The grid is ignored with supersampling
+// or smoothing.
+func (m *Map) UseGrid() {
+	m.grid = NewGrid(m.pix, m.frame)
+}
+
+// SetBackground sets a background image
+// for the map.
+// The image must be a global equirectangular image.
+func (m *Map) SetBackground(bg image.Image) {
+	for id, pt := range Coords(m.pix, bg.Bounds().Size()) {
+		r, g, b, a := bg.At(pt.X, pt.Y).RGBA()
+		c := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+		m.color[id] = c
+	}
+}
+
+// SetPixelColor sets the background color
+// of a pixel.
+func (m *Map) SetPixelColor(px int, c color.RGBA) {
+	m.color[px] = c
+}
+
+func (m *Map) ColorModel() color.Model { return color.RGBAModel }
+func (m *Map) Bounds() image.Rectangle { return image.Rect(0, 0, m.frame.Cols, m.frame.Rows) }
+func (m *Map) At(x, y int) color.Color {
+	if m.grid != nil && m.samples <= 1 && !m.smooth {
+		return m.pixelColor(m.grid.At(x, y))
+	}
+	if m.samples <= 1 {
+		lat, lon := m.frame.Point(float64(x), float64(y))
+		return m.sample(lat, lon)
+	}
+
+	// supersampling
+	var r, g, b, a uint32
+	n := float64(m.samples)
+	for i := 0; i < m.samples; i++ {
+		for j := 0; j < m.samples; j++ {
+			lat, lon := m.frame.Point(float64(x)+(float64(j)+0.5)/n, float64(y)+(float64(i)+0.5)/n)
+			sr, sg, sb, sa := m.sample(lat, lon).RGBA()
+			r += sr
+			g += sg
+			b += sb
+			a += sa
+		}
+	}
+	ns := uint32(m.samples * m.samples)
+	return color.RGBA64{uint16(r / ns), uint16(g / ns), uint16(b / ns), uint16(a / ns)}
+}
+
+// Sample returns the color at a geographic point.
+func (m *Map) sample(lat, lon float64) color.Color {
+	pos := m.pix.Pixel(lat, lon).ID()
+	if m.smooth && !m.diff {
+		v := m.density(lat, lon, pos)
+		if v >= MinSmooth {
+			return m.rangeColor(pos, v)
+		}
+		return m.bgColor(pos)
+	}
+	return m.pixelColor(pos)
+}
+
+// PixelColor returns the color of a pixel.
+func (m *Map) pixelColor(pos int) color.Color {
+	if m.diff {
+		_, inRng := m.rng[pos]
+		_, inOther := m.other[pos]
+		switch {
+		case inRng && inOther:
+			return InBoth
+		case inRng:
+			return OnlyRange
+		case inOther:
+			return OnlyOther
+		}
+	}
+	if v, ok := m.rng[pos]; ok && !m.diff {
+		return m.rangeColor(pos, v)
+	}
+	return m.bgColor(pos)
+}
+
+// RangeColor returns the color of a pixel
+// in the range
+// with the given density.
+func (m *Map) rangeColor(pos int, v float64) color.Color {
+	if m.taxColor != nil {
+		return blend(m.color[pos], *m.taxColor, v)
+	}
+	return blind.Gradient(v)
+}
+
+// BgColor returns the background color of a pixel.
+func (m *Map) bgColor(pos int) color.Color {
+	c, ok := m.color[pos]
+	if !ok {
+		return color.RGBA{0, 0, 0, 0}
+	}
+	return c
+}
+
+// Density returns the smoothed density
+// at a geographic point,
+// as the mean of the densities of the pixel of the point
+// and its neighbors,
+// weighted by the distance of the point
+// to the center of each pixel.
+func (m *Map) density(lat, lon float64, pos int) float64 {
+	nb := m.nb[pos]
+	pt := earth.NewPoint(lat, lon)
+	sigma := earth.ToRad(m.pix.Step()) / 2
+	var sum, wSum float64
+	for _, px := range nb {
+		d := earth.Distance(pt, m.pix.ID(px).Point()) / sigma
+		w := math.Exp(-d * d / 2)
+		sum += w * m.rng[px]
+		wSum += w
+	}
+	return sum / wSum
+}
+
+// Blend blends a color over a background color
+// using the density as the opacity of the color.
+// If the background is transparent,
+// the color is returned with the opacity
+// as a non-premultiplied color.
+func blend(bg, c color.RGBA, density float64) color.Color {
+	a := 0.25 + 0.75*density
+	if bg.A == 0 {
+		return color.NRGBA{c.R, c.G, c.B, uint8(a * 255)}
+	}
+	mix := func(b, c uint8) uint8 {
+		return uint8(float64(b)*(1-a) + float64(c)*a)
+	}
+	return color.RGBA{mix(bg.R, c.R), mix(bg.G, c.G), mix(bg.B, c.B), 255}
+}
+
+// Draw draws an image
+// (for example a Map)
+// into a new NRGBA image.
+// If the context is canceled
+// it returns the context error.
+func Draw(ctx context.Context, img image.Image) (*image.NRGBA, error) {
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(x, y, img.At(x, y))
+		}
+	}
+	return dst, nil
+}
+
+// EncodePNG draws an image
+// and writes it as a PNG image into w.
+// If the context is canceled
+// nothing is written.
+func EncodePNG(ctx context.Context, w io.Writer, img image.Image) error {
+	img, err := Draw(ctx, img)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("when encoding image: %v", err)
+	}
+	return nil
+}
+
+// WritePNG writes an image
+// as a PNG file.
+// The image is drawn before creating the file,
+// so if the context is canceled
+// no file is written.
+func WritePNG(ctx context.Context, name string, img image.Image) (err error) {
+	img, err = Draw(ctx, img)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := f.Close()
+		if e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	if err := png.Encode(f, img); err != nil {
+		return fmt.Errorf("when encoding image file %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package render_test
+
+import (
+	"context"
+	"image/color"
+	"sync"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges/render"
+)
+
+func TestTransparentColor(t *testing.T) {
+	pix := earth.NewPixelation(60)
+	px := pix.Pixel(0, 0).ID()
+
+	m := render.New(pix, render.Global(360))
+	m.SetRange(map[int]float64{px: 0.5})
+	m.SetColor(color.RGBA{200, 100, 50, 255})
+
+	img, err := render.Draw(context.Background(), m)
+	if err != nil {
+		t.Fatalf("draw: %v", err)
+	}
+
+	// opacity is 0.25 + 0.75*density
+	want := color.NRGBA{200, 100, 50, 159}
+	if got := img.NRGBAAt(180, 90); got != want {
+		t.Errorf("range pixel: got %v, want %v", got, want)
+	}
+	if got := img.NRGBAAt(0, 0); got.A != 0 {
+		t.Errorf("pixel outside range: got %v, want a transparent pixel", got)
+	}
+}
+
+func TestConcurrentSmooth(t *testing.T) {
+	pix := earth.NewPixelation(60)
+	rng := make(map[int]float64)
+	for _, lon := range []float64{0, 5, 10} {
+		rng[pix.Pixel(0, lon).ID()] = 1
+	}
+
+	m := render.New(pix, render.Global(120))
+	m.SetRange(rng)
+	m.SetSmooth(true)
+
+	want, err := render.Draw(context.Background(), m)
+	if err != nil {
+		t.Fatalf("draw: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := m.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if color.NRGBAModel.Convert(m.At(x, y)) != want.At(x, y) {
+						errs <- "concurrent drawing differs from sequential drawing"
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+// Package rotate implements the rotation of range maps
+// to a past age
+// using one or more plate motion models.
+package rotate
+
+import (
+	"context"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+)
+
+// Range returns the pixels of a range
+// rotated to the indicated age.
+// If more than one model is used,
+// the value of each pixel is the number of models
+// that rotate a pixel of the range
+// into that pixel.
+// If the context is canceled
+// it returns the context error.
+func Range(ctx context.Context, tots []*model.Total, rng map[int]float64, age int64) (map[int]float64, error) {
+	return BufferRange(ctx, tots, rng, age, 0)
+}
+
+// BufferRange returns the pixels of a range
+// rotated to the indicated age,
+// spreading the presence of uncertain pixels
+// over the neighboring destination pixels.
+//
+// A pixel is uncertain if the model
+// does not have a rotation for the pixel at the age,
+// or if the pixel is at the edge of a plate
+// (i.e. one of its neighbors does not have a rotation).
+// The presence of an uncertain pixel
+// is spread over the destinations
+// of all the pixels at a distance
+// less or equal than dist
+// (in km)
+// that have a rotation.
+// If dist is 0,
+// uncertain pixels are rotated as usual,
+// so pixels without a rotation are lost.
+//
+// If more than one model is used,
+// the value of each pixel is the number of models
+// that rotate a pixel of the range
+// into that pixel.
+// If the context is canceled
+// it returns the context error.
+func BufferRange(ctx context.Context, tots []*model.Total, rng map[int]float64, age int64, dist float64) (map[int]float64, error) {
+	n := make(map[int]float64, len(rng))
+	for _, tot := range tots {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rot := tot.Rotation(age)
+		dst := make(map[int]bool, len(rng))
+		for px := range rng {
+			src := []int{px}
+			if dist > 0 && uncertain(tot.Pixelation(), rot, px) {
+				src = src[:0]
+				for np := range ranges.Buffer(tot.Pixelation(), map[int]float64{px: 1}, dist) {
+					src = append(src, np)
+				}
+			}
+			for _, sp := range src {
+				for _, np := range rot[sp] {
+					dst[np] = true
+				}
+			}
+		}
+		for np := range dst {
+			n[np]++
+		}
+	}
+	return n, nil
+}
+
+// Uncertain returns true if a pixel
+// does not have a rotation,
+// or one of its neighbors
+// does not have a rotation.
+func uncertain(pix *earth.Pixelation, rot map[int][]int, px int) bool {
+	if len(rot[px]) == 0 {
+		return true
+	}
+	for _, nb := range ranges.Neighbors(pix, px) {
+		if len(rot[nb]) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Taxon rotates the range of a taxon
+// from a collection of present ranges
+// to the indicated age,
+// and stores the rotated range
+// in the destination collection.
+// If a single model is used,
+// the rotated range keeps the pixels
+// (without scaling),
+// otherwise,
+// the range is scaled
+// by the number of models
+// that rotate a pixel of the range
+// into each pixel.
+// It returns false if the rotated range is empty.
+// If the context is canceled
+// it returns the context error.
+func Taxon(ctx context.Context, dst, src *ranges.Collection, name string, age int64, tots ...*model.Total) (bool, error) {
+	return BufferTaxon(ctx, dst, src, name, age, 0, tots...)
+}
+
+// BufferTaxon is like Taxon,
+// but the presence of uncertain pixels
+// is spread over the neighboring destination pixels
+// at a distance less or equal than dist
+// (in km),
+// as in BufferRange.
+func BufferTaxon(ctx context.Context, dst, src *ranges.Collection, name string, age int64, dist float64, tots ...*model.Total) (bool, error) {
+	rng, err := BufferRange(ctx, tots, src.Range(name), age, dist)
+	if err != nil {
+		return false, err
+	}
+	if len(rng) == 0 {
+		return false, nil
+	}
+	if len(tots) > 1 {
+		dst.Set(src.VerbatimName(name), age, rng)
+		copyInterval(dst, src, name)
+		return true, nil
+	}
+	dst.SetPixels(src.VerbatimName(name), age, rng)
+	copyInterval(dst, src, name)
+	return true, nil
+}
+
+// AgesRange returns the pixels of a range
+// rotated to several ages
+// (for example,
+// the endpoints of the age interval of a taxon),
+// spreading the presence of uncertain pixels
+// as in BufferRange.
+// The value of each pixel is the number of models and ages
+// that rotate a pixel of the range
+// into that pixel.
+// If the context is canceled
+// it returns the context error.
+func AgesRange(ctx context.Context, tots []*model.Total, rng map[int]float64, ages []int64, dist float64) (map[int]float64, error) {
+	n := make(map[int]float64, len(rng))
+	for _, a := range ages {
+		r, err := BufferRange(ctx, tots, rng, a, dist)
+		if err != nil {
+			return nil, err
+		}
+		for px, v := range r {
+			n[px] += v
+		}
+	}
+	return n, nil
+}
+
+// AgesTaxon is like BufferTaxon,
+// but the range is rotated to several ages
+// (as in AgesRange),
+// and the rotated range is stored
+// at the indicated age.
+// If a single model and a single age are used,
+// the rotated range keeps the pixels
+// (without scaling),
+// otherwise,
+// the range is scaled
+// by the number of models and ages
+// that rotate a pixel of the range
+// into each pixel.
+func AgesTaxon(ctx context.Context, dst, src *ranges.Collection, name string, age int64, ages []int64, dist float64, tots ...*model.Total) (bool, error) {
+	rng, err := AgesRange(ctx, tots, src.Range(name), ages, dist)
+	if err != nil {
+		return false, err
+	}
+	if len(rng) == 0 {
+		return false, nil
+	}
+	if len(tots) > 1 || len(ages) > 1 {
+		dst.Set(src.VerbatimName(name), age, rng)
+		copyInterval(dst, src, name)
+		return true, nil
+	}
+	dst.SetPixels(src.VerbatimName(name), age, rng)
+	copyInterval(dst, src, name)
+	return true, nil
+}
+
+// CopyInterval copies the age interval of a taxon
+// (if defined)
+// from the source collection.
+func copyInterval(dst, src *ranges.Collection, name string) {
+	if !src.HasAgeInterval(name) {
+		return
+	}
+	min, max := src.AgeInterval(name)
+	dst.SetAgeInterval(name, min, max)
+}
@@ -0,0 +1,98 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/js-arias/earth/model"
+)
+
+// AtStage returns a new collection
+// in which the range of each taxon
+// is the intersection of its range
+// with the land pixels
+// (i.e. pixels with a non-zero value)
+// of the stage of a time pixelation
+// closest to the indicated age.
+//
+// The taxa keep their type, age,
+// record counts,
+// and the values of the extra columns
+// of the pixels kept in the range.
+// The densities of the ranges are rescaled
+// so the maximum density is 1.
+// Taxa without land pixels at the stage
+// are not included in the new collection.
+//
+// The time pixelation must use the same pixelation
+// as the collection.
+func (c *Collection) AtStage(tp *model.TimePix, age int64) *Collection {
+	if eq := tp.Pixelation().Equator(); eq != c.pix.Equator() {
+		msg := fmt.Sprintf("invalid time pixelation: got %d, want %d", eq, c.pix.Equator())
+		panic(msg)
+	}
+	stage := tp.Stage(tp.ClosestStageAge(age))
+
+	sc := New(c.pix)
+	sc.extra = slices.Clone(c.extra)
+	sc.keepVerbatim = c.keepVerbatim
+	sc.order = c.order
+	sc.omitTime = c.omitTime
+
+	for _, name := range c.TaxaBy(InputOrder) {
+		tax := c.taxa[name]
+
+		rng := make(map[int]float64, len(tax.rng))
+		var max float64
+		for px, v := range tax.rng {
+			if stage[px] == 0 {
+				continue
+			}
+			rng[px] = v
+			if v > max {
+				max = v
+			}
+		}
+		if len(rng) == 0 {
+			continue
+		}
+		if tax.tp == Range && max > 0 && max != 1 {
+			for px, v := range rng {
+				rng[px] = v / max
+			}
+		}
+
+		st := &taxon{
+			name:     tax.name,
+			verbatim: tax.verbatim,
+			tp:       tax.tp,
+			age:      tax.age,
+			interval: tax.interval,
+			minAge:   tax.minAge,
+			maxAge:   tax.maxAge,
+			rng:      rng,
+		}
+		if tax.recs != nil {
+			st.recs = make(map[int]int)
+			for px, n := range tax.recs {
+				if _, ok := rng[px]; ok {
+					st.recs[px] = n
+				}
+			}
+		}
+		if tax.extra != nil {
+			st.extra = make(map[int][]string)
+			for px, v := range tax.extra {
+				if _, ok := rng[px]; ok {
+					st.extra[px] = slices.Clone(v)
+				}
+			}
+		}
+		sc.addTaxon(st)
+	}
+	return sc
+}
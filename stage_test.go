@@ -0,0 +1,61 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"testing"
+
+	"github.com/js-arias/earth/model"
+	"github.com/js-arias/ranges"
+)
+
+func TestAtStage(t *testing.T) {
+	coll := makeCollection(t)
+	pix := coll.Pixelation()
+
+	// only the first pixel of Rhododendron ericoides
+	// and the two highest pixels of Eoraptor lunensis
+	// are land pixels at the stage
+	rhodo := pix.Pixel(4.08, 118.52).ID()
+	tp := model.NewTimePix(pix)
+	tp.Set(0, rhodo, 1)
+	tp.Set(200_000_000, 34662, 1)
+	tp.Set(200_000_000, 34663, 2)
+
+	n := len(coll.Range("Rhododendron ericoides"))
+	s := coll.AtStage(tp, 0)
+	if tx := s.Taxa(); len(tx) != 1 || tx[0] != "Rhododendron ericoides" {
+		t.Errorf("stage 0: got taxa %v", tx)
+	}
+	if rng := s.Range("Rhododendron ericoides"); len(rng) != 1 || rng[rhodo] != 1 {
+		t.Errorf("stage 0: got range %v", rng)
+	}
+	if len(coll.Range("Rhododendron ericoides")) != n {
+		t.Errorf("stage 0: source collection modified")
+	}
+
+	// closest stage
+	s = coll.AtStage(tp, 230_000_000)
+	nm := "Eoraptor lunensis"
+	if !s.HasTaxon(nm) {
+		t.Fatalf("stage 200: taxon %q not found", nm)
+	}
+	if tp := s.Type(nm); tp != ranges.Range {
+		t.Errorf("stage 200: got type %q, want %q", tp, ranges.Range)
+	}
+	if a := s.Age(nm); a != 230_000_000 {
+		t.Errorf("stage 200: got age %d, want %d", a, 230_000_000)
+	}
+	rng := s.Range(nm)
+	if len(rng) != 2 {
+		t.Fatalf("stage 200: got %d pixels, want %d", len(rng), 2)
+	}
+	if rng[34663] != 1 {
+		t.Errorf("stage 200: pixel %d: got %.6f, want %.6f", 34663, rng[34663], 1.0)
+	}
+	if want := 0.5; rng[34662] < want-0.001 || rng[34662] > want+0.001 {
+		t.Errorf("stage 200: pixel %d: got %.6f, want %.6f", 34662, rng[34662], want)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"math"
+	"slices"
+)
+
+// Threshold returns the pixels of a range map
+// with a value equal or larger than a threshold.
+// Pixels with a value of 0 are always excluded.
+func Threshold(rng map[int]float64, t float64) map[int]float64 {
+	th := make(map[int]float64, len(rng))
+	for px, v := range rng {
+		if v <= 0 || v < t {
+			continue
+		}
+		th[px] = v
+	}
+	return th
+}
+
+// Quantile returns the value of the q quantile
+// of the values of a range map,
+// i.e. the value that leaves a fraction q
+// of the pixels below it.
+// It returns false if the range is empty.
+func Quantile(rng map[int]float64, q float64) (float64, bool) {
+	vals := make([]float64, 0, len(rng))
+	for _, v := range rng {
+		vals = append(vals, v)
+	}
+	return quantile(vals, q)
+}
+
+// PresenceThreshold returns the threshold
+// that keeps a fraction 1-q of the training presences
+// in the range,
+// i.e. the q quantile
+// of the values of the range
+// at the pixels of the presences
+// (pixels outside the range have a value of 0).
+// With q = 0,
+// it is the minimum training presence threshold,
+// and with q = 0.1,
+// it is the 10th percentile training presence threshold.
+// It returns false if there are no presences.
+func PresenceThreshold(rng map[int]float64, presences []int, q float64) (float64, bool) {
+	vals := make([]float64, 0, len(presences))
+	for _, px := range presences {
+		vals = append(vals, rng[px])
+	}
+	return quantile(vals, q)
+}
+
+// MaxSSS returns the threshold
+// that maximizes the sum of the sensitivity
+// (the fraction of presences with a density
+// equal or larger than the threshold)
+// and the specificity
+// (the fraction of absences with a density
+// smaller than the threshold)
+// of a set of observations.
+// If several thresholds have the same sum,
+// the smallest threshold is returned.
+// It returns false if there are no presences,
+// or no absences.
+func MaxSSS(obs []Observation) (float64, bool) {
+	var pres, abs int
+	for _, o := range obs {
+		if o.Presence {
+			pres++
+			continue
+		}
+		abs++
+	}
+	if pres == 0 || abs == 0 {
+		return 0, false
+	}
+
+	sorted := slices.Clone(obs)
+	slices.SortFunc(sorted, func(a, b Observation) int {
+		if a.Density < b.Density {
+			return -1
+		}
+		if a.Density > b.Density {
+			return 1
+		}
+		return 0
+	})
+
+	// with the smallest threshold
+	// all presences are retained,
+	// and no absence is excluded
+	best := sorted[0].Density
+	bestSum := -1.0
+	var presBelow, absBelow int
+	for i := 0; i < len(sorted); {
+		t := sorted[i].Density
+		sum := float64(pres-presBelow)/float64(pres) + float64(absBelow)/float64(abs)
+		if sum > bestSum+1e-12 {
+			best = t
+			bestSum = sum
+		}
+
+		// observations tied with the threshold
+		for ; i < len(sorted) && sorted[i].Density == t; i++ {
+			if sorted[i].Presence {
+				presBelow++
+				continue
+			}
+			absBelow++
+		}
+	}
+	return best, true
+}
+
+// Quantile returns the q quantile of a set of values.
+func quantile(vals []float64, q float64) (float64, bool) {
+	if len(vals) == 0 {
+		return 0, false
+	}
+	slices.Sort(vals)
+	i := int(math.Floor(q * float64(len(vals))))
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(vals) {
+		i = len(vals) - 1
+	}
+	return vals[i], true
+}
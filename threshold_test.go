@@ -0,0 +1,76 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/js-arias/ranges"
+)
+
+func TestThreshold(t *testing.T) {
+	rng := map[int]float64{
+		1: 0.2,
+		2: 0.4,
+		3: 0.6,
+		4: 0.8,
+		5: 1.0,
+	}
+
+	q, ok := ranges.Quantile(rng, 0.5)
+	if !ok || q != 0.6 {
+		t.Errorf("quantile: got %.6f (%v), want %.6f", q, ok, 0.6)
+	}
+	if _, ok := ranges.Quantile(nil, 0.5); ok {
+		t.Errorf("quantile: expecting no value for an empty range")
+	}
+
+	got := ranges.Threshold(rng, q)
+	want := map[int]float64{
+		3: 0.6,
+		4: 0.8,
+		5: 1.0,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("threshold: got %v, want %v", got, want)
+	}
+
+	tests := map[string]struct {
+		presences []int
+		q         float64
+		want      float64
+	}{
+		"minimum":        {presences: []int{1, 3, 5}, q: 0, want: 0.2},
+		"outside range":  {presences: []int{1, 3, 5, 9}, q: 0, want: 0},
+		"percentile":     {presences: []int{2, 3, 4, 5}, q: 0.25, want: 0.6},
+		"low percentile": {presences: []int{2, 3, 4, 5}, q: 0.1, want: 0.4},
+	}
+	for name, test := range tests {
+		got, ok := ranges.PresenceThreshold(rng, test.presences, test.q)
+		if !ok || got != test.want {
+			t.Errorf("presence threshold %s: got %.6f (%v), want %.6f", name, got, ok, test.want)
+		}
+	}
+	if _, ok := ranges.PresenceThreshold(rng, nil, 0); ok {
+		t.Errorf("presence threshold: expecting no value without presences")
+	}
+
+	obs := []ranges.Observation{
+		{Density: 0.9, Presence: true},
+		{Density: 0.7, Presence: true},
+		{Density: 0.6, Presence: false},
+		{Density: 0.5, Presence: true},
+		{Density: 0.3, Presence: false},
+		{Density: 0.1, Presence: false},
+	}
+	sss, ok := ranges.MaxSSS(obs)
+	if !ok || sss != 0.5 {
+		t.Errorf("maxSSS: got %.6f (%v), want %.6f", sss, ok, 0.5)
+	}
+	if _, ok := ranges.MaxSSS(obs[:2]); ok {
+		t.Errorf("maxSSS: expecting no value without absences")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/js-arias/earth"
+)
+
+// IssueKind is the kind of a problem
+// found in a collection.
+type IssueKind string
+
+// Valid issue kinds.
+const (
+	// PixelOutOfRange is used when a range
+	// includes a pixel ID that is not defined
+	// in the pixelation.
+	PixelOutOfRange IssueKind = "pixel-out-of-range"
+
+	// InvalidDensity is used when a pixel
+	// has a NaN, infinite, or negative density.
+	InvalidDensity IssueKind = "invalid-density"
+
+	// EmptyRange is used when a taxon
+	// does not have any pixel.
+	EmptyRange IssueKind = "empty-range"
+
+	// DuplicateName is used when two taxon names
+	// differ only by invisible characters.
+	DuplicateName IssueKind = "duplicate-name"
+
+	// EquatorMismatch is used when the pixelation
+	// of the collection is different
+	// from the expected pixelation.
+	EquatorMismatch IssueKind = "equator-mismatch"
+
+	// GriddedPoints is used when the points of a taxon
+	// are snapped to a regular lattice
+	// (i.e. the source data was gridded),
+	// so the taxon should be treated as a range,
+	// rather than as points.
+	GriddedPoints IssueKind = "gridded-points"
+)
+
+// An Issue is a problem found in a collection.
+type Issue struct {
+	// Taxon is the taxon with the problem.
+	// It is empty if the problem is in the collection.
+	Taxon string
+
+	// Kind is the kind of problem.
+	Kind IssueKind
+
+	// Pixel is the pixel ID with the problem,
+	// or -1 if the issue is not associated
+	// with a pixel.
+	Pixel int
+
+	// Msg is a description of the problem.
+	Msg string
+}
+
+func (i Issue) String() string {
+	if i.Taxon == "" {
+		return fmt.Sprintf("%s: %s", i.Kind, i.Msg)
+	}
+	return fmt.Sprintf("taxon %q: %s: %s", i.Taxon, i.Kind, i.Msg)
+}
+
+// Validate checks a collection
+// and returns the list of problems found,
+// sorted by taxon name.
+//
+// If pix is not nil,
+// the pixelation of the collection
+// will be compared with pix.
+func (c *Collection) Validate(pix *earth.Pixelation) []Issue {
+	var issues []Issue
+	if pix != nil && pix.Equator() != c.pix.Equator() {
+		issues = append(issues, Issue{
+			Kind:  EquatorMismatch,
+			Pixel: -1,
+			Msg:   fmt.Sprintf("got %d pixels, want %d", c.pix.Equator(), pix.Equator()),
+		})
+	}
+
+	visible := make(map[string][]string)
+	for _, name := range c.Taxa() {
+		tax := c.taxa[name]
+		k := visibleName(name)
+		visible[k] = append(visible[k], name)
+
+		if len(tax.rng) == 0 {
+			issues = append(issues, Issue{
+				Taxon: name,
+				Kind:  EmptyRange,
+				Pixel: -1,
+				Msg:   "range without pixels",
+			})
+			continue
+		}
+
+		pixels := make([]int, 0, len(tax.rng))
+		for px := range tax.rng {
+			pixels = append(pixels, px)
+		}
+		slices.Sort(pixels)
+
+		for _, px := range pixels {
+			if px < 0 || px >= c.pix.Len() {
+				issues = append(issues, Issue{
+					Taxon: name,
+					Kind:  PixelOutOfRange,
+					Pixel: px,
+					Msg:   fmt.Sprintf("pixel %d: not in pixelation (%d pixels)", px, c.pix.Len()),
+				})
+			}
+			d := tax.rng[px]
+			if math.IsNaN(d) || math.IsInf(d, 0) || d < 0 {
+				issues = append(issues, Issue{
+					Taxon: name,
+					Kind:  InvalidDensity,
+					Pixel: px,
+					Msg:   fmt.Sprintf("pixel %d: invalid density %v", px, d),
+				})
+			}
+		}
+
+		if tax.tp == Points {
+			if s := GridSpacing(c.pix, tax.rng); s > 0 {
+				issues = append(issues, Issue{
+					Taxon: name,
+					Kind:  GriddedPoints,
+					Pixel: -1,
+					Msg:   fmt.Sprintf("points snapped to a lattice of %.4f degrees", s),
+				})
+			}
+		}
+	}
+
+	for _, names := range visible {
+		if len(names) < 2 {
+			continue
+		}
+		for i, name := range names {
+			others := slices.Delete(slices.Clone(names), i, i+1)
+			issues = append(issues, Issue{
+				Taxon: name,
+				Kind:  DuplicateName,
+				Pixel: -1,
+				Msg:   fmt.Sprintf("same visible name as %q", strings.Join(others, "\", \"")),
+			})
+		}
+	}
+
+	slices.SortStableFunc(issues, func(a, b Issue) int {
+		return strings.Compare(a.Taxon, b.Taxon)
+	})
+	return issues
+}
+
+// VisibleName returns a taxon name
+// without invisible characters.
+func visibleName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Cf, r) || !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, name)
+}
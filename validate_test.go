@@ -0,0 +1,95 @@
+// Copyright © 2022 J. Salvador Arias <jsalarias@gmail.com>
+// All rights reserved.
+// Distributed under BSD2 license that can be found in the LICENSE file.
+
+package ranges_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/js-arias/earth"
+	"github.com/js-arias/ranges"
+)
+
+func TestValidate(t *testing.T) {
+	coll := makeCollection(t)
+	if issues := coll.Validate(nil); len(issues) != 0 {
+		t.Errorf("valid collection: got issues %v", issues)
+	}
+
+	coll.Add("Brontostoma\u200b discus", 0, 4.27, -72.54)
+	coll.Set("Eoraptor lunensis", 230_000_000, map[int]float64{34661: math.NaN()})
+	coll.SetPixels("Rhododendron ericoides", 0, nil)
+
+	got := make(map[ranges.IssueKind][]string)
+	for _, i := range coll.Validate(earth.NewPixelation(180)) {
+		got[i.Kind] = append(got[i.Kind], i.Taxon)
+	}
+
+	want := map[ranges.IssueKind]int{
+		ranges.EquatorMismatch: 1,
+		ranges.DuplicateName:   2,
+		ranges.InvalidDensity:  1,
+		ranges.EmptyRange:      1,
+	}
+	for k, n := range want {
+		if len(got[k]) != n {
+			t.Errorf("issue %q: got %d issues %v, want %d", k, len(got[k]), got[k], n)
+		}
+	}
+	if ls := got[ranges.EmptyRange]; len(ls) > 0 && ls[0] != "Rhododendron ericoides" {
+		t.Errorf("issue %q: got taxon %q, want %q", ranges.EmptyRange, ls[0], "Rhododendron ericoides")
+	}
+}
+
+func TestGridSpacing(t *testing.T) {
+	pix := earth.NewPixelation(720)
+
+	// points on a 2.5 degree lattice
+	grid := make(map[int]float64)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 4; j++ {
+			lat := -10 + 2.5*float64(i)
+			lon := 40 + 2.5*float64(j)
+			grid[pix.Pixel(lat, lon).ID()] = 1
+		}
+	}
+	if s := ranges.GridSpacing(pix, grid); s != 2.5 {
+		t.Errorf("lattice: got spacing %.4f, want %.4f", s, 2.5)
+	}
+
+	// points at the center of the cells of a 1 degree lattice
+	centers := make(map[int]float64)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			lat := 20.5 + float64(i)
+			lon := -60.5 - float64(j)
+			centers[pix.Pixel(lat, lon).ID()] = 1
+		}
+	}
+	if s := ranges.GridSpacing(pix, centers); s != 1 {
+		t.Errorf("lattice centers: got spacing %.4f, want %.4f", s, 1.0)
+	}
+
+	// irregular points
+	rnd := rand.New(rand.NewSource(1))
+	irregular := make(map[int]float64)
+	for len(irregular) < 30 {
+		lat := -10 + rnd.Float64()*20
+		lon := 40 + rnd.Float64()*20
+		irregular[pix.Pixel(lat, lon).ID()] = 1
+	}
+	if s := ranges.GridSpacing(pix, irregular); s != 0 {
+		t.Errorf("irregular points: got spacing %.4f, want 0", s)
+	}
+
+	coll := ranges.New(pix)
+	coll.SetPixels("Brontostoma discus", 0, grid)
+	coll.SetPixels("Eoraptor lunensis", 0, irregular)
+	issues := coll.Validate(nil)
+	if len(issues) != 1 || issues[0].Kind != ranges.GriddedPoints || issues[0].Taxon != "Brontostoma discus" {
+		t.Errorf("validate: got issues %v, want %q for %q", issues, ranges.GriddedPoints, "Brontostoma discus")
+	}
+}